@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	fiberSwagger "github.com/gofiber/swagger"
@@ -14,11 +16,20 @@ import (
 	appLogging "go-ddd-clean/internal/application/logging"
 	appMedia "go-ddd-clean/internal/application/media"
 	appPayment "go-ddd-clean/internal/application/payment"
+	appPrinting "go-ddd-clean/internal/application/printing"
+	appReferral "go-ddd-clean/internal/application/referral"
 	appSession "go-ddd-clean/internal/application/session"
 	appUser "go-ddd-clean/internal/application/user"
 	appVoucher "go-ddd-clean/internal/application/voucher"
+	domainMedia "go-ddd-clean/internal/domain/media"
+	domainSession "go-ddd-clean/internal/domain/session"
+	domainVoucher "go-ddd-clean/internal/domain/voucher"
 	"go-ddd-clean/internal/infrastructure/config"
 	infraDB "go-ddd-clean/internal/infrastructure/db"
+	"go-ddd-clean/internal/infrastructure/imaging"
+	"go-ddd-clean/internal/infrastructure/queue"
+	"go-ddd-clean/internal/infrastructure/scheduler"
+	"go-ddd-clean/internal/infrastructure/storage"
 	httpTransport "go-ddd-clean/internal/interface/http"
 )
 
@@ -30,6 +41,9 @@ import (
 // @securityDefinitions.apikey BoothTokenAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.apikey UserTokenAuth
+// @in header
+// @name Authorization
 func main() {
 	cfg := config.LoadConfig()
 	database := infraDB.ConnectDB(cfg.DB_DSN)
@@ -48,24 +62,63 @@ func main() {
 	frameRepo := infraDB.NewFrameRepository(database)
 	filterRepo := infraDB.NewFilterRepository(database)
 	qrRepo := infraDB.NewQRCodeRepository(database)
+	animationRepo := infraDB.NewAnimationRepository(database)
 	userRepo := infraDB.NewUserRepository(database)
+	pointsRepo := infraDB.NewPointsRepository(database)
 	paymentRepo := infraDB.NewPaymentRepository(database)
 	voucherRepo := infraDB.NewVoucherRepository(database)
 	voucherRedemptionRepo := infraDB.NewVoucherRedemptionRepository(database)
+	voucherCampaignRepo := infraDB.NewVoucherCampaignRepository(database)
+	referralRepo := infraDB.NewReferralRepository(database)
 	logRepository := infraDB.NewLogRepository(database)
 	analyticsRepo := infraDB.NewAnalyticsRepository(database)
+	watermarkRepo := infraDB.NewWatermarkRepository(database)
+	printJobRepo := infraDB.NewPrintJobRepository(database)
+	transactor := infraDB.NewTransactor(database)
 
 	branchService := appBranch.NewService(branchRepo)
 	boothService := appBooth.NewService(boothRepo)
 	boothTokenService := appBooth.NewTokenService(boothRepo, cfg.BoothTokenSecret)
-	sessionService := appSession.NewService(sessionRepo)
-	photoService := appMedia.NewPhotoService(photoRepo)
+	blobStore, localStore := newBlobStore(cfg)
+	mediaQueue := queue.New(cfg.MediaWorkers, cfg.MediaQueueSize)
+	watermarkService := appMedia.NewWatermarkService(watermarkRepo, sessionRepo, boothRepo, paymentRepo, blobStore, cfg.MediaFetchHosts)
+	derivativeService := appMedia.NewDerivativeService(photoRepo, blobStore, mediaQueue, imaging.EncodeWebP, watermarkService)
+	photoService := appMedia.NewPhotoService(
+		photoRepo,
+		blobStore,
+		derivativeService,
+		int64(cfg.UploadMaxMB)<<20,
+		time.Duration(cfg.UploadURLTTLMinutes)*time.Minute,
+	)
 	frameService := appMedia.NewFrameService(frameRepo)
 	filterService := appMedia.NewFilterService(filterRepo)
-	qrService := appMedia.NewQRCodeService(qrRepo)
-	userService := appUser.NewService(userRepo)
-	paymentService := appPayment.NewService(paymentRepo)
-	voucherService := appVoucher.NewService(voucherRepo, voucherRedemptionRepo)
+	qrService := appMedia.NewQRCodeService(qrRepo, photoRepo, animationRepo, cfg.ShareBaseURL, cfg.QRImageSize)
+	renderService := appMedia.NewRenderService(photoRepo, frameRepo, filterRepo, blobStore, cfg.MediaFetchHosts, derivativeService, watermarkService)
+	animationService := appMedia.NewAnimationService(animationRepo, photoRepo, frameRepo, blobStore, cfg.MediaFetchHosts, watermarkService)
+	shareService := appMedia.NewShareService(qrService, photoRepo, animationRepo, blobStore)
+	exportService := appMedia.NewExportService(photoRepo, animationRepo, blobStore)
+	purgeService := appMedia.NewPurgeService(branchRepo, photoRepo, animationRepo, qrRepo, blobStore)
+	userService := appUser.NewService(userRepo, pointsRepo, transactor)
+	userTokenService := appUser.NewTokenService(userRepo, cfg.UserTokenSecret)
+	sessionService := appSession.NewService(sessionRepo, userService, domainSession.PricingPolicy{
+		MaxStackedDiscountPercent: float64(cfg.MaxStackedDiscountPercent),
+	}, transactor)
+	paymentService := appPayment.NewService(paymentRepo, transactor)
+	printService := appPrinting.NewService(printJobRepo, photoRepo, frameRepo, sessionService, boothService, userRepo, transactor)
+	voucherService := appVoucher.NewService(voucherRepo, voucherRedemptionRepo, sessionService, boothService, transactor)
+	sessionService.AddStatusListener(voucherService)
+	voucherCampaignService := appVoucher.NewCampaignService(voucherCampaignRepo, voucherRepo)
+	referralService := appReferral.NewService(referralRepo, userService, sessionService, voucherService, appReferral.Policy{
+		RewardValue:    float64(cfg.ReferralRewardBaht),
+		RewardUnit:     domainVoucher.UnitBaht,
+		RewardValid:    time.Duration(cfg.ReferralRewardDays) * 24 * time.Hour,
+		MaxPerReferrer: cfg.ReferralMaxPerReferrer,
+	}, transactor)
+	sessionService.AddStatusListener(referralService)
+	paymentService.AddSuccessListener(referralService)
+	watermarkRefresher := appMedia.NewWatermarkRefresher(photoRepo, watermarkService, renderService, derivativeService, mediaQueue, transactor)
+	sessionService.AddChangeListener(watermarkRefresher)
+	paymentService.AddSuccessListener(watermarkRefresher)
 	logService := appLogging.NewService(logRepository)
 	analyticsService := appAnalytics.NewService(analyticsRepo)
 
@@ -78,22 +131,152 @@ func main() {
 		frameService,
 		filterService,
 		qrService,
+		renderService,
+		animationService,
+		shareService,
+		exportService,
+		purgeService,
+		watermarkService,
+		printService,
 		userService,
+		userTokenService,
 		paymentService,
 		voucherService,
+		voucherCampaignService,
+		referralService,
 		logService,
 		analyticsService,
 	)
 
-	app := fiber.New()
+	jobs := scheduler.New()
+	jobs.Add(scheduler.Job{
+		Name:     "points-expiry",
+		Interval: cfg.PointsExpiryInterval,
+		Run: func(ctx context.Context) error {
+			now := time.Now()
+			result, err := userService.ExpirePoints(ctx, now)
+			if err != nil {
+				return err
+			}
+			log.Printf("points-expiry: expired %d points from %d lots across %d users", result.Points, result.Lots, result.Users)
+			notices, err := userService.UpcomingExpiry(ctx, now, time.Duration(cfg.PointsExpiryNoticeDays)*24*time.Hour)
+			if err != nil {
+				return err
+			}
+			for _, notice := range notices {
+				log.Printf("points-expiry: user %s has %d points expiring on %s", notice.UserID, notice.Points, notice.ExpiresAt.Format(time.DateOnly))
+			}
+			return nil
+		},
+	})
+	jobs.Add(scheduler.Job{
+		Name:     "tier-recompute",
+		Interval: cfg.TierRecomputeInterval,
+		Run: func(ctx context.Context) error {
+			result, err := userService.RecomputeTiers(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			log.Printf("tier-recompute: %d of %d users changed tier", result.Changed, result.Users)
+			return nil
+		},
+	})
+	jobs.Add(scheduler.Job{
+		Name:     "derivative-backfill",
+		Interval: cfg.DerivativeBackfillInterval,
+		Run: func(ctx context.Context) error {
+			queued, err := derivativeService.Backfill(ctx, cfg.MediaQueueSize/2)
+			if err != nil {
+				return err
+			}
+			if queued > 0 {
+				log.Printf("derivative-backfill: queued %d photos without derivatives", queued)
+			}
+			return nil
+		},
+	})
+	jobs.Add(scheduler.Job{
+		Name:     "media-purge",
+		Interval: cfg.MediaPurgeInterval,
+		Run: func(ctx context.Context) error {
+			report, err := purgeService.Run(ctx, time.Now(), cfg.MediaPurgeDryRun)
+			if err != nil {
+				return err
+			}
+			verb := "purged"
+			if report.DryRun {
+				verb = "would purge"
+			}
+			for _, b := range report.Branches {
+				log.Printf("media-purge: branch %s %s %d originals, %d composites, %d animations (%d files, %d bytes); %d qr codes marked",
+					b.BranchName, verb, b.Originals.Items, b.Rendered.Items, b.Animations.Items,
+					b.Originals.Files+b.Rendered.Files+b.Animations.Files,
+					b.Originals.Bytes+b.Rendered.Bytes+b.Animations.Bytes,
+					b.QRCodes)
+				for _, failure := range b.Failures {
+					log.Printf("media-purge: branch %s: %s", b.BranchName, failure)
+				}
+			}
+			return nil
+		},
+	})
+	mediaQueue.Start(context.Background())
+	jobs.Start(context.Background())
+
+	app := fiber.New(fiber.Config{
+		// Uploads are streamed to storage; PhotoService enforces the size
+		// limit itself.
+		StreamRequestBody: true,
+		BodyLimit:         (cfg.UploadMaxMB + 1) << 20,
+	})
+	if localStore != nil {
+		app.Static(localFilesPath, localStore.Root())
+	}
 	app.Get("/swagger/*", fiberSwagger.HandlerDefault)
 	app.Get("/healthz", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 	api := app.Group("/api")
 	router.RegisterRoutes(api)
+	router.RegisterShareRoutes(app.Group(sharePath))
 
 	if err := app.Listen(":" + cfg.AppPort); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// localFilesPath is where the API serves blobs kept by the local store.
+const localFilesPath = "/files"
+
+// sharePath is where the API serves the public pages QR codes open.
+const sharePath = "/s"
+
+// newBlobStore builds the configured storage backend. The local store is
+// also returned on its own so main can serve its directory.
+func newBlobStore(cfg *config.Config) (domainMedia.BlobStore, *storage.LocalStore) {
+	if cfg.StorageDriver == "s3" {
+		store, err := storage.NewS3Store(context.Background(), storage.S3Config{
+			Endpoint:      cfg.S3Endpoint,
+			AccessKey:     cfg.S3AccessKey,
+			SecretKey:     cfg.S3SecretKey,
+			Bucket:        cfg.S3Bucket,
+			PrivateBucket: cfg.S3PrivateBucket,
+			Region:        cfg.S3Region,
+			UseSSL:        cfg.S3UseSSL,
+			PublicURL:     cfg.StoragePublicURL,
+		})
+		if err != nil {
+			log.Fatal("❌ Failed to connect object storage:", err)
+		}
+		return store, nil
+	}
+	publicURL := cfg.StoragePublicURL
+	if publicURL == "" {
+		publicURL = localFilesPath
+	}
+	store, err := storage.NewLocalStore(cfg.StorageLocalRoot, cfg.StoragePrivateRoot, publicURL)
+	if err != nil {
+		log.Fatal("❌ Failed to prepare local storage:", err)
+	}
+	return store, store
+}
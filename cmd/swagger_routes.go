@@ -7,6 +7,8 @@ import (
 	domainLogging "go-ddd-clean/internal/domain/logging"
 	domainMedia "go-ddd-clean/internal/domain/media"
 	domainPayment "go-ddd-clean/internal/domain/payment"
+	domainPrinting "go-ddd-clean/internal/domain/printing"
+	domainReferral "go-ddd-clean/internal/domain/referral"
 	domainSession "go-ddd-clean/internal/domain/session"
 	domainUser "go-ddd-clean/internal/domain/user"
 	domainVoucher "go-ddd-clean/internal/domain/voucher"
@@ -20,11 +22,21 @@ type Session = domainSession.Session
 type Photo = domainMedia.Photo
 type Frame = domainMedia.Frame
 type Filter = domainMedia.Filter
+type Watermark = domainMedia.Watermark
+type Animation = domainMedia.Animation
 type QRCode = domainMedia.QRCode
 type User = domainUser.User
 type Payment = domainPayment.Payment
+type PrintJob = domainPrinting.Job
+type PointsEntry = domainUser.PointsEntry
+type PointsExpiryNotice = domainUser.ExpiryNotice
 type Voucher = domainVoucher.Voucher
 type VoucherRedemption = domainVoucher.Redemption
+type VoucherReversal = domainVoucher.Reversal
+type VoucherCampaign = domainVoucher.Campaign
+type VoucherCampaignStats = domainVoucher.CampaignStats
+type ReferralCode = domainReferral.Code
+type Referral = domainReferral.Referral
 
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -43,30 +55,45 @@ type BoothTokenResponse struct {
 	Token string `json:"token"`
 }
 
+type UserLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type UserTokenResponse struct {
+	Token string `json:"token"`
+}
+
 type BranchCreateRequest struct {
-	Name     string  `json:"name"`
-	Location *string `json:"location"`
+	Name                  string  `json:"name"`
+	Location              *string `json:"location"`
+	OriginalRetentionDays *int    `json:"original_retention_days"`
+	RenderedRetentionDays *int    `json:"rendered_retention_days"`
 }
 
 type BranchUpdateRequest struct {
-	Name     string  `json:"name"`
-	Location *string `json:"location"`
+	Name                  string  `json:"name"`
+	Location              *string `json:"location"`
+	OriginalRetentionDays *int    `json:"original_retention_days"`
+	RenderedRetentionDays *int    `json:"rendered_retention_days"`
 }
 
 type BoothCreateRequest struct {
-	BranchID string         `json:"branch_id"`
-	Name     string         `json:"name"`
-	Type     string         `json:"type"`
-	Status   string         `json:"status"`
-	Config   map[string]any `json:"config"`
+	BranchID       string         `json:"branch_id"`
+	Name           string         `json:"name"`
+	Type           string         `json:"type"`
+	Status         string         `json:"status"`
+	Config         map[string]any `json:"config"`
+	ExtraCopyPrice *float64       `json:"extra_copy_price"`
 }
 
 type BoothUpdateRequest struct {
-	BranchID string         `json:"branch_id"`
-	Name     string         `json:"name"`
-	Type     *string        `json:"type"`
-	Status   *string        `json:"status"`
-	Config   map[string]any `json:"config"`
+	BranchID       string         `json:"branch_id"`
+	Name           string         `json:"name"`
+	Type           *string        `json:"type"`
+	Status         *string        `json:"status"`
+	Config         map[string]any `json:"config"`
+	ExtraCopyPrice *float64       `json:"extra_copy_price"`
 }
 
 type BoothLogCreateRequest struct {
@@ -84,20 +111,18 @@ type BoothAnalyticsEventRequest struct {
 type SessionCreateRequest struct {
 	BoothID       string         `json:"booth_id"`
 	UserID        *string        `json:"user_id"`
-	VoucherID     *string        `json:"voucher_id"`
 	PaymentID     *string        `json:"payment_id"`
 	Status        *string        `json:"status"`
-	TotalPrice    *float64       `json:"total_price"`
+	BasePrice     *float64       `json:"base_price"`
 	BoothSnapshot map[string]any `json:"booth_snapshot"`
 	PhoneTemp     *string        `json:"phone_temp"`
 }
 
 type SessionUpdateRequest struct {
 	UserID        *string        `json:"user_id"`
-	VoucherID     *string        `json:"voucher_id"`
 	PaymentID     *string        `json:"payment_id"`
 	Status        *string        `json:"status"`
-	TotalPrice    *float64       `json:"total_price"`
+	BasePrice     *float64       `json:"base_price"`
 	FinishedAt    *int64         `json:"finished_at"`
 	BoothSnapshot map[string]any `json:"booth_snapshot"`
 	PhoneTemp     *string        `json:"phone_temp"`
@@ -120,36 +145,166 @@ type PhotoUpdateRequest struct {
 	RenderedURL *string        `json:"rendered_url"`
 }
 
+type PhotoPresignRequest struct {
+	SessionID   string `json:"session_id"`
+	ContentType string `json:"content_type" example:"image/jpeg"`
+}
+
+type PhotoPresignResponse struct {
+	UploadID  string            `json:"upload_id"`
+	Key       string            `json:"key"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method" example:"PUT"`
+	Headers   map[string]string `json:"headers"`
+	MaxBytes  int64             `json:"max_bytes"`
+	ExpiresAt string            `json:"expires_at" example:"2025-01-01T10:15:00Z"`
+}
+
+type PhotoFinalizeRequest struct {
+	SessionID   string         `json:"session_id"`
+	ContentType string         `json:"content_type" example:"image/jpeg"`
+	SHA256      string         `json:"sha256"`
+	FrameID     *string        `json:"frame_id"`
+	FilterID    *string        `json:"filter_id"`
+	Composition map[string]any `json:"composition"`
+}
+
 type FrameCreateRequest struct {
-	Name    string  `json:"name"`
-	Theme   *string `json:"theme"`
-	FileURL string  `json:"file_url"`
-	Active  *bool   `json:"active"`
+	Name     string                `json:"name"`
+	Theme    *string               `json:"theme"`
+	FileURL  string                `json:"file_url"`
+	Template *FrameTemplateRequest `json:"template"`
+	Active   *bool                 `json:"active"`
 }
 
 type FrameUpdateRequest struct {
-	Name    string  `json:"name"`
-	Theme   *string `json:"theme"`
-	FileURL string  `json:"file_url"`
-	Active  bool    `json:"active"`
+	Name     string                `json:"name"`
+	Theme    *string               `json:"theme"`
+	FileURL  string                `json:"file_url"`
+	Template *FrameTemplateRequest `json:"template"`
+	Active   bool                  `json:"active"`
+}
+
+// FrameTemplateRequest is a frame's layout in canvas pixels. The canvas
+// must be the print size at dpi, e.g. 600x1800 for a 2x6 strip at 300 dpi.
+type FrameTemplateRequest struct {
+	Width     int                   `json:"width" example:"600"`
+	Height    int                   `json:"height" example:"1800"`
+	DPI       int                   `json:"dpi" example:"300"`
+	PrintSize string                `json:"print_size" enums:"2x6,4x6"`
+	Slots     []FrameSlotRequest    `json:"slots"`
+	Overlays  []FrameOverlayRequest `json:"overlays"`
+}
+
+type FrameSlotRequest struct {
+	X        int     `json:"x"`
+	Y        int     `json:"y"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Rotation float64 `json:"rotation" minimum:"-180" maximum:"180"`
+}
+
+type FrameOverlayRequest struct {
+	Kind   string `json:"kind" enums:"text,date"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Text   string `json:"text"`
+	Format string `json:"format" example:"DD/MM/YYYY"`
+	Color  string `json:"color" example:"#000000"`
+	Align  string `json:"align" enums:"left,center,right"`
+}
+
+type QRCodePublicResponse struct {
+	Hash      string  `json:"hash"`
+	Target    string  `json:"target" example:"session"`
+	ExpireAt  *string `json:"expire_at" example:"2025-01-08T10:00:00Z"`
+	Protected bool    `json:"protected"`
+}
+
+type FrameTemplateResponse struct {
+	FrameID  string               `json:"frame_id"`
+	FileURL  string               `json:"file_url"`
+	Template FrameTemplateRequest `json:"template"`
 }
 
 type FilterCreateRequest struct {
-	Name   string         `json:"name"`
-	Effect map[string]any `json:"effect"`
-	Active *bool          `json:"active"`
+	Name   string       `json:"name"`
+	Effect FilterEffect `json:"effect"`
+	Active *bool        `json:"active"`
 }
 
 type FilterUpdateRequest struct {
-	Name   string         `json:"name"`
-	Effect map[string]any `json:"effect"`
-	Active bool           `json:"active"`
+	Name   string       `json:"name"`
+	Effect FilterEffect `json:"effect"`
+	Active bool         `json:"active"`
+}
+
+type PrintJobCreateRequest struct {
+	PhotoID   string `json:"photo_id"`
+	Kind      string `json:"kind" enums:"print,reprint,extra_copies"`
+	Copies    int    `json:"copies" minimum:"1" maximum:"20" example:"1"`
+	PaperSize string `json:"paper_size" enums:"2x6,4x6"`
+}
+
+type PrintJobStatusRequest struct {
+	Status string `json:"status" enums:"printing,done,failed"`
+	Error  string `json:"error"`
+}
+
+type PrintJobRejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+type WatermarkCreateRequest struct {
+	BranchID *string `json:"branch_id"`
+	BoothID  *string `json:"booth_id"`
+	WatermarkUpdateRequest
+}
+
+type WatermarkUpdateRequest struct {
+	ImageURL *string `json:"image_url"`
+	Text     string  `json:"text" example:"Sample"`
+	Position string  `json:"position" enums:"bottom_right,bottom_left,top_right,top_left,center,tiled"`
+	Opacity  float64 `json:"opacity" minimum:"0" maximum:"1" example:"0.5"`
+	Scale    float64 `json:"scale" minimum:"0.05" maximum:"1" example:"0.25"`
+}
+
+// FilterEffect is the effect schema; every setting is optional.
+type FilterEffect struct {
+	Brightness  float64 `json:"brightness" minimum:"-100" maximum:"100"`
+	Contrast    float64 `json:"contrast" minimum:"-100" maximum:"100"`
+	Saturation  float64 `json:"saturation" minimum:"-100" maximum:"100"`
+	Temperature float64 `json:"temperature" minimum:"-100" maximum:"100"`
+	Grayscale   bool    `json:"grayscale"`
+	Vignette    float64 `json:"vignette" minimum:"0" maximum:"100"`
+	LUT         string  `json:"lut" example:"https://cdn.example.com/luts/warm.cube"`
+}
+
+type AnimationCreateRequest struct {
+	SessionID    string   `json:"session_id"`
+	Kind         string   `json:"kind" enums:"gif,boomerang" example:"boomerang"`
+	PhotoIDs     []string `json:"photo_ids"`
+	FrameID      *string  `json:"frame_id"`
+	FrameDelayMS int      `json:"frame_delay_ms" minimum:"20" maximum:"5000" example:"400"`
+	Loops        int      `json:"loops" minimum:"0" maximum:"100" example:"0"`
+	Size         int      `json:"size" minimum:"160" maximum:"1080" example:"600"`
 }
 
 type QRCodeCreateRequest struct {
-	PhotoID  string `json:"photo_id"`
-	Hash     string `json:"hash"`
-	ExpireAt *int64 `json:"expire_at"`
+	PhotoID     *string       `json:"photo_id"`
+	AnimationID *string       `json:"animation_id"`
+	SessionID   *string       `json:"session_id"`
+	Album       []QRAlbumItem `json:"album"`
+	ExpireAt    *int64        `json:"expire_at"`
+	PIN         *string       `json:"pin" example:"4821"`
+	Phone       *string       `json:"phone" example:"0812345678"`
+}
+
+type QRAlbumItem struct {
+	Kind string `json:"kind" enums:"photo,animation"`
+	ID   string `json:"id"`
 }
 
 type UserCreateRequest struct {
@@ -164,13 +319,48 @@ type UserUpdateRequest struct {
 	Email    *string `json:"email"`
 	Password *string `json:"password"`
 	Role     *string `json:"role"`
-	Points   *int    `json:"points"`
 }
 
 type UserAdjustPointsRequest struct {
 	Delta int `json:"delta"`
 }
 
+type UserEarnPointsRequest struct {
+	Points int `json:"points"`
+}
+
+type TierRecomputeResponse struct {
+	Users   int
+	Changed int
+}
+
+type PointsExpireResponse struct {
+	Lots   int
+	Points int
+	Users  int
+}
+
+type MediaPurgeResponse struct {
+	DryRun   bool
+	Branches []MediaPurgeBranch
+}
+
+type MediaPurgeBranch struct {
+	BranchID   string
+	BranchName string
+	Originals  MediaPurgeCount
+	Rendered   MediaPurgeCount
+	Animations MediaPurgeCount
+	QRCodes    int
+	Failures   []string
+}
+
+type MediaPurgeCount struct {
+	Items int
+	Files int
+	Bytes int64
+}
+
 type PaymentCreateRequest struct {
 	SessionID      string  `json:"session_id"`
 	Method         string  `json:"method"`
@@ -189,35 +379,108 @@ type PaymentUpdateRequest struct {
 }
 
 type VoucherCreateRequest struct {
-	Code      string  `json:"code"`
-	Type      string  `json:"type"`
-	Value     float64 `json:"value"`
-	Unit      string  `json:"unit"`
-	MaxUsage  int     `json:"max_usage"`
-	ValidFrom *int64  `json:"valid_from"`
-	ValidTo   *int64  `json:"valid_to"`
-	Active    *bool   `json:"active"`
+	Code           string   `json:"code"`
+	Type           string   `json:"type"`
+	Value          float64  `json:"value"`
+	Unit           string   `json:"unit"`
+	MaxUsage       int      `json:"max_usage"`
+	ValidFrom      *int64   `json:"valid_from"`
+	ValidTo        *int64   `json:"valid_to"`
+	Active         *bool    `json:"active"`
+	BranchIDs      []string `json:"branch_ids"`
+	BoothIDs       []string `json:"booth_ids"`
+	BoothType      *string  `json:"booth_type"`
+	MinSpend       *float64 `json:"min_spend"`
+	MaxPerCustomer int      `json:"max_per_customer"`
+	Weekdays       []int    `json:"weekdays"`
+	HourFrom       *int     `json:"hour_from"`
+	HourTo         *int     `json:"hour_to"`
+	Stackable      bool     `json:"stackable"`
 }
 
 type VoucherUpdateRequest struct {
-	Value     *float64 `json:"value"`
-	Unit      *string  `json:"unit"`
-	MaxUsage  *int     `json:"max_usage"`
-	ValidFrom *int64   `json:"valid_from"`
-	ValidTo   *int64   `json:"valid_to"`
-	Active    *bool    `json:"active"`
+	Value          *float64 `json:"value"`
+	Unit           *string  `json:"unit"`
+	MaxUsage       *int     `json:"max_usage"`
+	ValidFrom      *int64   `json:"valid_from"`
+	ValidTo        *int64   `json:"valid_to"`
+	Active         *bool    `json:"active"`
+	BranchIDs      []string `json:"branch_ids"`
+	BoothIDs       []string `json:"booth_ids"`
+	BoothType      *string  `json:"booth_type"`
+	MinSpend       *float64 `json:"min_spend"`
+	MaxPerCustomer *int     `json:"max_per_customer"`
+	Weekdays       []int    `json:"weekdays"`
+	HourFrom       *int     `json:"hour_from"`
+	HourTo         *int     `json:"hour_to"`
+	Stackable      *bool    `json:"stackable"`
 }
 
 type VoucherRedeemRequest struct {
+	Code      string  `json:"code"`
+	SessionID string  `json:"session_id"`
+	Tel       *string `json:"tel"`
+}
+
+type VoucherCampaignCreateRequest struct {
+	Name           string   `json:"name"`
+	CodePattern    string   `json:"code_pattern"`
+	Quantity       int      `json:"quantity"`
+	Type           string   `json:"type"`
+	Value          float64  `json:"value"`
+	Unit           string   `json:"unit"`
+	MaxUsage       int      `json:"max_usage"`
+	ValidFrom      *int64   `json:"valid_from"`
+	ValidTo        *int64   `json:"valid_to"`
+	Active         *bool    `json:"active"`
+	BranchIDs      []string `json:"branch_ids"`
+	BoothIDs       []string `json:"booth_ids"`
+	BoothType      *string  `json:"booth_type"`
+	MinSpend       *float64 `json:"min_spend"`
+	MaxPerCustomer int      `json:"max_per_customer"`
+	Weekdays       []int    `json:"weekdays"`
+	HourFrom       *int     `json:"hour_from"`
+	HourTo         *int     `json:"hour_to"`
+	Stackable      bool     `json:"stackable"`
+}
+
+type ReferralCodeRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type ReferralApplyRequest struct {
+	Code      string  `json:"code"`
+	SessionID string  `json:"session_id"`
+	Tel       *string `json:"tel"`
+}
+
+type VoucherRejectionResponse struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+type VoucherValidateRequest struct {
 	Code      string   `json:"code"`
-	SessionID string   `json:"session_id"`
+	SessionID *string  `json:"session_id"`
+	Price     *float64 `json:"price"`
+	UserID    *string  `json:"user_id"`
 	Tel       *string  `json:"tel"`
-	Discount  *float64 `json:"discount"`
+}
+
+type VoucherValidateResponse struct {
+	Valid     bool                         `json:"valid"`
+	Reason    string                       `json:"reason,omitempty"`
+	Message   string                       `json:"message,omitempty"`
+	Voucher   *Voucher                     `json:"voucher,omitempty"`
+	Discount  float64                      `json:"discount"`
+	Total     float64                      `json:"total"`
+	Breakdown []domainSession.DiscountLine `json:"breakdown"`
 }
 
 type VoucherRedeemResponse struct {
 	Redemption VoucherRedemption `json:"redemption"`
 	Voucher    Voucher           `json:"voucher"`
+	Session    Session           `json:"session"`
 }
 
 // healthzDoc godoc
@@ -502,6 +765,102 @@ func mediaPhotosListDoc() {}
 // @Router /api/media/photos [post]
 func mediaPhotosCreateDoc() {}
 
+// mediaPhotosUploadDoc godoc
+// @Summary อัปโหลดไฟล์รูปแบบ multipart
+// @Description รองรับ JPEG, PNG, GIF และ WebP ขนาดไม่เกิน UPLOAD_MAX_MB ไฟล์ถูกเก็บใน storage ที่ตั้งค่าไว้ (local หรือ S3/MinIO)
+// @Tags Media Photos
+// @Accept multipart/form-data
+// @Produce json
+// @Security BoothTokenAuth
+// @Param file formData file true "ไฟล์รูป"
+// @Param session_id formData string true "รหัสเซสชัน"
+// @Param frame_id formData string false "รหัสกรอบรูป"
+// @Param filter_id formData string false "รหัสฟิลเตอร์"
+// @Param composition formData string false "ข้อมูล composition (JSON)"
+// @Success 201 {object} Photo
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Router /api/media/photos/upload [post]
+func mediaPhotosUploadDoc() {}
+
+// mediaPhotosUploadStreamDoc godoc
+// @Summary อัปโหลดไฟล์รูปแบบ raw body
+// @Description ส่งไฟล์เป็น body ของคำขอโดยตรง เซิร์ฟเวอร์จะสตรีมลง storage โดยไม่พักไฟล์ทั้งก้อนไว้ในหน่วยความจำ
+// @Tags Media Photos
+// @Accept octet-stream
+// @Produce json
+// @Security BoothTokenAuth
+// @Param session_id query string true "รหัสเซสชัน"
+// @Param frame_id query string false "รหัสกรอบรูป"
+// @Param filter_id query string false "รหัสฟิลเตอร์"
+// @Success 201 {object} Photo
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Router /api/media/photos/upload/stream [post]
+func mediaPhotosUploadStreamDoc() {}
+
+// mediaPhotosPresignDoc godoc
+// @Summary ขอ URL สำหรับอัปโหลดรูปตรงไปยัง storage
+// @Description บูธอัปโหลดไฟล์ด้วย method และ headers ที่ได้รับไปยัง url ก่อน expires_at แล้วเรียก finalize เพื่อบันทึกรูป ใช้ได้เฉพาะ STORAGE_DRIVER=s3
+// @Tags Media Photos
+// @Accept json
+// @Produce json
+// @Security BoothTokenAuth
+// @Param payload body PhotoPresignRequest true "ข้อมูลไฟล์ที่จะอัปโหลด"
+// @Success 201 {object} PhotoPresignResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 501 {object} ErrorResponse
+// @Router /api/media/photos/uploads [post]
+func mediaPhotosPresignDoc() {}
+
+// mediaPhotosFinalizeDoc godoc
+// @Summary ยืนยันการอัปโหลดรูปและสร้างรายการรูป
+// @Description ตรวจว่าไฟล์อยู่ใน storage ชนิดไฟล์ตรงกับ content_type และ SHA-256 ตรงกับ sha256 ถ้าไม่ผ่านไฟล์จะถูกลบและต้องขอ URL ใหม่
+// @Tags Media Photos
+// @Accept json
+// @Produce json
+// @Security BoothTokenAuth
+// @Param uploadId path string true "upload_id ที่ได้จากการขอ URL"
+// @Param payload body PhotoFinalizeRequest true "ข้อมูลยืนยันการอัปโหลด"
+// @Success 201 {object} Photo
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Router /api/media/photos/uploads/{uploadId}/finalize [post]
+func mediaPhotosFinalizeDoc() {}
+
+// mediaPhotosRenderDoc godoc
+// @Summary เรนเดอร์รูปรวมกับกรอบบนเซิร์ฟเวอร์
+// @Description วางรูปจาก composition.shots (รหัสรูปในเซสชันเดียวกัน เรียงตามช่อง) ลงในช่องของกรอบ ถ้าไม่มี shots จะใช้รูปนี้ทุกช่อง ผลลัพธ์เก็บใน storage และตั้งค่า RenderedURL
+// @Tags Media Photos
+// @Produce json
+// @Security BoothTokenAuth
+// @Param id path string true "รหัสรูป"
+// @Success 200 {object} Photo
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/photos/{id}/render [post]
+func mediaPhotosRenderDoc() {}
+
+// mediaPhotosPreviewDoc godoc
+// @Summary ดูตัวอย่างรูปเมื่อใช้ฟิลเตอร์
+// @Description คืนภาพ JPEG ขนาดด้านยาวไม่เกิน 800 พิกเซล
+// @Tags Media Photos
+// @Produce jpeg
+// @Security BoothTokenAuth
+// @Param id path string true "รหัสรูป"
+// @Param filter_id query string true "รหัสฟิลเตอร์"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/photos/{id}/preview [get]
+func mediaPhotosPreviewDoc() {}
+
 // mediaPhotosGetDoc godoc
 // @Summary ดูข้อมูลรูป
 // @Tags Media Photos
@@ -567,6 +926,17 @@ func mediaFramesCreateDoc() {}
 // @Router /api/media/frames/{id} [get]
 func mediaFramesGetDoc() {}
 
+// mediaFramesTemplateDoc godoc
+// @Summary ดูเทมเพลตของกรอบรูป
+// @Description เลย์เอาต์เดียวกับที่เซิร์ฟเวอร์ใช้เรนเดอร์ บูธใช้วางรูปและข้อความได้ตรงกัน
+// @Tags Media Frames
+// @Produce json
+// @Param id path string true "รหัสกรอบรูป"
+// @Success 200 {object} FrameTemplateResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/frames/{id}/template [get]
+func mediaFramesTemplateDoc() {}
+
 // mediaFramesUpdateDoc godoc
 // @Summary ปรับปรุงกรอบรูป
 // @Tags Media Frames
@@ -600,6 +970,7 @@ func mediaFiltersListDoc() {}
 
 // mediaFiltersCreateDoc godoc
 // @Summary สร้างฟิลเตอร์
+// @Description ค่าใน effect ต้องตรงตาม FilterEffect คีย์ที่ไม่รู้จักหรือค่าที่เกินช่วงจะถูกปฏิเสธ
 // @Tags Media Filters
 // @Accept json
 // @Produce json
@@ -640,36 +1011,375 @@ func mediaFiltersUpdateDoc() {}
 // @Router /api/media/filters/{id} [delete]
 func mediaFiltersDeleteDoc() {}
 
+// mediaWatermarksListDoc godoc
+// @Summary ดึงรายการลายน้ำ
+// @Tags Media Watermarks
+// @Produce json
+// @Success 200 {array} Watermark
+// @Failure 500 {object} ErrorResponse
+// @Router /api/media/watermarks [get]
+func mediaWatermarksListDoc() {}
+
+// mediaWatermarksCreateDoc godoc
+// @Summary สร้างลายน้ำของสาขาหรือตู้
+// @Description ระบุ branch_id หรือ booth_id อย่างใดอย่างหนึ่ง ลายน้ำของตู้ใช้แทนของสาขา ใส่ลงในรูปของเซสชันที่ใช้คูปองฟรี และของตู้เสมือนที่ยังไม่ชำระเงิน ถ้าไม่มี image_url จะใช้ข้อความ (ค่าเริ่มต้น "Sample") ใช้ได้เฉพาะผู้ดูแล
+// @Tags Media Watermarks
+// @Accept json
+// @Produce json
+// @Security UserTokenAuth
+// @Param payload body WatermarkCreateRequest true "ข้อมูลลายน้ำ"
+// @Success 201 {object} Watermark
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/media/watermarks [post]
+func mediaWatermarksCreateDoc() {}
+
+// mediaWatermarksGetDoc godoc
+// @Summary ดูข้อมูลลายน้ำ
+// @Tags Media Watermarks
+// @Produce json
+// @Param id path string true "รหัสลายน้ำ"
+// @Success 200 {object} Watermark
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/watermarks/{id} [get]
+func mediaWatermarksGetDoc() {}
+
+// mediaWatermarksUpdateDoc godoc
+// @Summary ปรับปรุงลายน้ำ
+// @Description มีผลกับรูปที่สร้างหลังจากนี้ รูปเดิมไม่ถูกแก้ไข ใช้ได้เฉพาะผู้ดูแล
+// @Tags Media Watermarks
+// @Accept json
+// @Produce json
+// @Security UserTokenAuth
+// @Param id path string true "รหัสลายน้ำ"
+// @Param payload body WatermarkUpdateRequest true "ข้อมูลที่ต้องแก้ไข"
+// @Success 200 {object} Watermark
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/media/watermarks/{id} [put]
+func mediaWatermarksUpdateDoc() {}
+
+// mediaWatermarksDeleteDoc godoc
+// @Summary ลบลายน้ำ
+// @Description ใช้ได้เฉพาะผู้ดูแล
+// @Tags Media Watermarks
+// @Security UserTokenAuth
+// @Param id path string true "รหัสลายน้ำ"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/watermarks/{id} [delete]
+func mediaWatermarksDeleteDoc() {}
+
+// mediaAnimationsListDoc godoc
+// @Summary ดึงรายการภาพเคลื่อนไหวของเซสชัน
+// @Tags Media Animations
+// @Produce json
+// @Security BoothTokenAuth
+// @Param session_id query string true "รหัสเซสชัน"
+// @Success 200 {array} Animation
+// @Failure 400 {object} ErrorResponse
+// @Router /api/media/animations [get]
+func mediaAnimationsListDoc() {}
+
+// mediaAnimationsCreateDoc godoc
+// @Summary สร้าง GIF หรือบูมเมอแรงจากรูปในเซสชัน
+// @Description ถ้าไม่ระบุ photo_ids จะใช้ทุกรูปในเซสชันตามลำดับเวลา (สูงสุด 20 รูป) loops = 0 คือเล่นวนไม่สิ้นสุด ถ้าระบุ frame_id จะวางแต่ละรูปลงในกรอบ
+// @Tags Media Animations
+// @Accept json
+// @Produce json
+// @Security BoothTokenAuth
+// @Param payload body AnimationCreateRequest true "ข้อมูลภาพเคลื่อนไหว"
+// @Success 201 {object} Animation
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/animations [post]
+func mediaAnimationsCreateDoc() {}
+
+// mediaAnimationsGetDoc godoc
+// @Summary ดูข้อมูลภาพเคลื่อนไหว
+// @Tags Media Animations
+// @Produce json
+// @Security BoothTokenAuth
+// @Param id path string true "รหัสภาพเคลื่อนไหว"
+// @Success 200 {object} Animation
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/animations/{id} [get]
+func mediaAnimationsGetDoc() {}
+
+// mediaAnimationsDeleteDoc godoc
+// @Summary ลบภาพเคลื่อนไหว
+// @Tags Media Animations
+// @Security BoothTokenAuth
+// @Param id path string true "รหัสภาพเคลื่อนไหว"
+// @Success 204 {string} string "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/animations/{id} [delete]
+func mediaAnimationsDeleteDoc() {}
+
+// mediaExportsDoc godoc
+// @Summary ส่งออกไฟล์สื่อเป็น ZIP
+// @Description ไฟล์ต้นฉบับ ภาพที่เรนเดอร์แล้ว ไฟล์ย่อขนาด และภาพเคลื่อนไหวที่ตรงกับตัวกรอง พร้อม manifest.json ต้องระบุ session_id, booth_id หรือทั้ง from และ to ที่ห่างกันไม่เกิน 31 วัน ใช้ได้กับผู้ดูแลหรือบูธ โดยบูธส่งออกได้เฉพาะสื่อของบูธตนเองและไม่ได้รับไฟล์ต้นฉบับซึ่งมีข้อมูล EXIF ของกล้อง ไฟล์ต้นฉบับส่งออกได้เฉพาะผู้ดูแล
+// @Tags Media Exports
+// @Produce application/zip
+// @Security BoothTokenAuth
+// @Security UserTokenAuth
+// @Param session_id query string false "รหัสเซสชัน"
+// @Param booth_id query string false "รหัสบูธ"
+// @Param from query int false "เริ่มตั้งแต่ (unix seconds)"
+// @Param to query int false "ก่อนเวลา (unix seconds)"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/media/exports [get]
+func mediaExportsDoc() {}
+
+// mediaPurgeDoc godoc
+// @Summary ลบไฟล์สื่อที่เกินระยะเวลาเก็บรักษาของสาขา
+// @Description ลบไฟล์ต้นฉบับ ภาพที่เรนเดอร์แล้ว และภาพเคลื่อนไหวตาม original_retention_days และ rendered_retention_days ของแต่ละสาขา เป็น dry run เว้นแต่ส่ง dry_run=false ใช้ได้เฉพาะผู้ดูแล
+// @Tags Media Retention
+// @Produce json
+// @Security UserTokenAuth
+// @Param dry_run query bool false "รายงานโดยไม่ลบจริง (ค่าเริ่มต้น true)"
+// @Success 200 {object} MediaPurgeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/media/purge [post]
+func mediaPurgeDoc() {}
+
+// printJobsListDoc godoc
+// @Summary ดึงรายการงานพิมพ์
+// @Description เรียงจากงานที่สร้างก่อน
+// @Tags Print Jobs
+// @Produce json
+// @Param booth_id query string false "รหัสบูธ"
+// @Param session_id query string false "รหัสเซสชัน"
+// @Param status query string false "สถานะ" Enums(pending_approval, queued, printing, done, failed, rejected)
+// @Success 200 {array} PrintJob
+// @Failure 400 {object} ErrorResponse
+// @Router /api/print-jobs [get]
+func printJobsListDoc() {}
+
+// printJobsCreateDoc godoc
+// @Summary สั่งพิมพ์รูปที่เรนเดอร์แล้ว
+// @Description การพิมพ์ครั้งแรกของรูปเข้าคิวทันที การพิมพ์ซ้ำและสำเนาเพิ่มต้องรอพนักงานอนุมัติ ไม่ระบุ kind แล้วรูปเคยสั่งพิมพ์ไปแล้วจะนับเป็นการพิมพ์ซ้ำ สำเนาเพิ่มคิดราคาตาม extra_copy_price ของบูธ ขนาดกระดาษตั้งต้นตามกรอบรูป
+// @Tags Print Jobs
+// @Accept json
+// @Produce json
+// @Security BoothTokenAuth
+// @Param payload body PrintJobCreateRequest true "ข้อมูลงานพิมพ์"
+// @Success 201 {object} PrintJob
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/print-jobs [post]
+func printJobsCreateDoc() {}
+
+// printJobsClaimDoc godoc
+// @Summary รับงานพิมพ์ถัดไปของบูธ
+// @Description งานที่เข้าคิวนานที่สุดจะถูกเปลี่ยนเป็น printing แล้วส่งกลับ ตอบ 204 เมื่อไม่มีงาน
+// @Tags Print Jobs
+// @Produce json
+// @Security BoothTokenAuth
+// @Success 200 {object} PrintJob
+// @Success 204 {string} string "No Content"
+// @Router /api/print-jobs/claim [post]
+func printJobsClaimDoc() {}
+
+// printJobsStreamDoc godoc
+// @Summary ติดตามคิวงานพิมพ์ของบูธ
+// @Description server-sent events ส่ง event "jobs" ที่มีงานในคิวทั้งหมดเมื่อเชื่อมต่อ เมื่อมีงานเข้าคิว และทุก 15 วินาที
+// @Tags Print Jobs
+// @Produce text/event-stream
+// @Security BoothTokenAuth
+// @Success 200 {array} PrintJob
+// @Router /api/print-jobs/stream [get]
+func printJobsStreamDoc() {}
+
+// printJobsGetDoc godoc
+// @Summary ดูข้อมูลงานพิมพ์
+// @Tags Print Jobs
+// @Produce json
+// @Param id path string true "รหัสงานพิมพ์"
+// @Success 200 {object} PrintJob
+// @Failure 404 {object} ErrorResponse
+// @Router /api/print-jobs/{id} [get]
+func printJobsGetDoc() {}
+
+// printJobsStatusDoc godoc
+// @Summary รายงานสถานะเครื่องพิมพ์
+// @Description queued เปลี่ยนเป็น printing หรือ failed ได้ และ printing เปลี่ยนเป็น done หรือ failed ได้
+// @Tags Print Jobs
+// @Accept json
+// @Produce json
+// @Security BoothTokenAuth
+// @Param id path string true "รหัสงานพิมพ์"
+// @Param payload body PrintJobStatusRequest true "สถานะใหม่"
+// @Success 200 {object} PrintJob
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/print-jobs/{id}/status [put]
+func printJobsStatusDoc() {}
+
+// printJobsApproveDoc godoc
+// @Summary อนุมัติงานพิมพ์ซ้ำหรือสำเนาเพิ่ม
+// @Description ผู้อนุมัติคือพนักงานหรือผู้ดูแลที่เข้าสู่ระบบ สำเนาเพิ่มจะถูกบวกเข้าราคาของเซสชันในธุรกรรมเดียวกับการอนุมัติ และคิดเงินเพียงครั้งเดียวต่องาน
+// @Tags Print Jobs
+// @Produce json
+// @Security UserTokenAuth
+// @Param id path string true "รหัสงานพิมพ์"
+// @Success 200 {object} PrintJob
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/print-jobs/{id}/approve [post]
+func printJobsApproveDoc() {}
+
+// printJobsRejectDoc godoc
+// @Summary ปฏิเสธงานพิมพ์ซ้ำหรือสำเนาเพิ่ม
+// @Description ผู้ปฏิเสธคือพนักงานหรือผู้ดูแลที่เข้าสู่ระบบ
+// @Tags Print Jobs
+// @Accept json
+// @Produce json
+// @Security UserTokenAuth
+// @Param id path string true "รหัสงานพิมพ์"
+// @Param payload body PrintJobRejectRequest false "เหตุผล"
+// @Success 200 {object} PrintJob
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/print-jobs/{id}/reject [post]
+func printJobsRejectDoc() {}
+
 // mediaQRCodesCreateDoc godoc
 // @Summary สร้าง QR Code
+// @Description ระบุ photo_id, animation_id, session_id หรือ album อย่างใดอย่างหนึ่ง เซิร์ฟเวอร์สร้าง hash แบบสุ่มและคืน ShareURL ที่ใช้ใน QR ถ้าระบุ pin หรือ phone (ใช้ 4 ตัวท้าย) หน้าแชร์จะถามรหัสก่อนแสดงรูป สื่อทั้งหมดต้องมาจากเซสชันของตู้ที่ถือโทเคน
 // @Tags Media QRCodes
 // @Accept json
 // @Produce json
+// @Security BoothTokenAuth
 // @Param payload body QRCodeCreateRequest true "ข้อมูล QR Code"
 // @Success 201 {object} QRCode
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/media/qrcodes [post]
 func mediaQRCodesCreateDoc() {}
 
 // mediaQRCodesGetDoc godoc
 // @Summary ดูข้อมูล QR Code
+// @Description ไม่ต้องใช้โทเคน จึงคืนเฉพาะ hash ประเภทสื่อ วันหมดอายุ และว่าต้องใส่รหัสหรือไม่ โดยไม่บอกว่าชี้ไปที่สื่อใด
 // @Tags Media QRCodes
 // @Produce json
 // @Param hash path string true "แฮชของ QR Code"
-// @Success 200 {object} QRCode
+// @Success 200 {object} QRCodePublicResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /api/media/qrcodes/{hash} [get]
 func mediaQRCodesGetDoc() {}
 
+// mediaQRCodesPNGDoc godoc
+// @Summary ภาพ QR Code แบบ PNG
+// @Tags Media QRCodes
+// @Produce png
+// @Param hash path string true "แฮชของ QR Code"
+// @Param size query int false "ความกว้างเป็นพิกเซล (64-2048)"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/qrcodes/{hash}/image.png [get]
+func mediaQRCodesPNGDoc() {}
+
+// mediaQRCodesSVGDoc godoc
+// @Summary ภาพ QR Code แบบ SVG
+// @Tags Media QRCodes
+// @Produce image/svg+xml
+// @Param hash path string true "แฮชของ QR Code"
+// @Param size query int false "ความกว้างเป็นพิกเซล (64-2048)"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/media/qrcodes/{hash}/image.svg [get]
+func mediaQRCodesSVGDoc() {}
+
 // mediaQRCodesDeleteDoc godoc
 // @Summary ลบ QR Code
 // @Tags Media QRCodes
+// @Security BoothTokenAuth
 // @Param id path string true "รหัส QR Code"
 // @Success 204 {string} string "No Content"
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /api/media/qrcodes/{id} [delete]
 func mediaQRCodesDeleteDoc() {}
 
+// shareShowDoc godoc
+// @Summary หน้าแชร์รูปสำหรับลูกค้าที่สแกน QR
+// @Description หน้า HTML แสดงสื่อทั้งหมดของเป้าหมาย QR (รูป, GIF, เซสชัน หรืออัลบั้ม) ไม่ต้องยืนยันตัวตน QR ที่มีรหัสจะแสดงฟอร์มกรอกรหัส (401) QR ที่หมดอายุจะได้ 410
+// @Tags Share
+// @Produce html
+// @Param hash path string true "แฮชของ QR Code"
+// @Success 200 {string} string "HTML"
+// @Failure 404 {string} string "HTML"
+// @Failure 410 {string} string "HTML"
+// @Router /s/{hash} [get]
+func shareShowDoc() {}
+
+// shareUnlockDoc godoc
+// @Summary กรอกรหัสเพื่อเปิดหน้าแชร์
+// @Description รหัสถูกต้องจะตั้งคุกกี้และ redirect กลับไปหน้าแชร์ ใส่ผิด 5 ครั้งจะถูกล็อก 15 นาที (429)
+// @Tags Share
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param hash path string true "แฮชของ QR Code"
+// @Param pin formData string true "PIN หรือเลข 4 ตัวท้ายของเบอร์โทร"
+// @Success 303 {string} string "Redirect"
+// @Failure 401 {string} string "HTML"
+// @Failure 429 {string} string "HTML"
+// @Router /s/{hash}/unlock [post]
+func shareUnlockDoc() {}
+
+// shareZipDoc godoc
+// @Summary ดาวน์โหลดทุกไฟล์ของเซสชันเป็น ZIP
+// @Tags Share
+// @Produce application/zip
+// @Param hash path string true "แฮชของ QR Code"
+// @Success 200 {file} binary
+// @Failure 404 {string} string "HTML"
+// @Failure 410 {string} string "HTML"
+// @Router /s/{hash}/download.zip [get]
+func shareZipDoc() {}
+
+// shareFileDoc godoc
+// @Summary ดาวน์โหลดไฟล์เดียวจากหน้าแชร์
+// @Tags Share
+// @Produce octet-stream
+// @Param hash path string true "แฮชของ QR Code"
+// @Param index path int true "ลำดับไฟล์บนหน้าแชร์ เริ่มที่ 0"
+// @Success 200 {file} binary
+// @Failure 404 {string} string "HTML"
+// @Failure 410 {string} string "HTML"
+// @Router /s/{hash}/files/{index} [get]
+func shareFileDoc() {}
+
+// userLoginDoc godoc
+// @Summary เข้าสู่ระบบผู้ใช้
+// @Description ขอรับโทเคนสำหรับพนักงานหรือผู้ดูแล ใช้กับการอนุมัติงานพิมพ์ โทเคนมีอายุ 12 ชั่วโมง
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param payload body UserLoginRequest true "อีเมลและรหัสผ่าน"
+// @Success 200 {object} UserTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/users/login [post]
+func userLoginDoc() {}
+
 // userListDoc godoc
 // @Summary ดึงรายการผู้ใช้
 // @Tags Users
@@ -681,12 +1391,16 @@ func userListDoc() {}
 
 // userCreateDoc godoc
 // @Summary สร้างผู้ใช้ใหม่
+// @Description ใช้ได้เฉพาะผู้ดูแล
 // @Tags Users
 // @Accept json
 // @Produce json
+// @Security UserTokenAuth
 // @Param payload body UserCreateRequest true "ข้อมูลผู้ใช้"
 // @Success 201 {object} User
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/users [post]
 func userCreateDoc() {}
 
@@ -702,45 +1416,124 @@ func userGetDoc() {}
 
 // userUpdateDoc godoc
 // @Summary ปรับปรุงข้อมูลผู้ใช้
+// @Description ใช้ได้เฉพาะผู้ดูแล
 // @Tags Users
 // @Accept json
 // @Produce json
+// @Security UserTokenAuth
 // @Param id path string true "รหัสผู้ใช้"
 // @Param payload body UserUpdateRequest true "ข้อมูลที่ต้องแก้ไข"
 // @Success 200 {object} User
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/users/{id} [put]
 func userUpdateDoc() {}
 
 // userDeleteDoc godoc
 // @Summary ลบผู้ใช้
+// @Description ใช้ได้เฉพาะผู้ดูแล
 // @Tags Users
+// @Security UserTokenAuth
 // @Param id path string true "รหัสผู้ใช้"
 // @Success 204 {string} string "No Content"
 // @Failure 404 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/users/{id} [delete]
 func userDeleteDoc() {}
 
 // userAdjustPointsDoc godoc
 // @Summary ปรับแต้มผู้ใช้
+// @Description ใช้ได้เฉพาะผู้ดูแล
 // @Tags Users
 // @Accept json
 // @Produce json
+// @Security UserTokenAuth
 // @Param id path string true "รหัสผู้ใช้"
 // @Param payload body UserAdjustPointsRequest true "ค่าที่ต้องการปรับ"
 // @Success 200 {object} User
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/users/{id}/points [post]
 func userAdjustPointsDoc() {}
 
+// userEarnPointsDoc godoc
+// @Summary เพิ่มแต้มตามตัวคูณของระดับสมาชิก
+// @Description ใช้ได้เฉพาะผู้ดูแล
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Security UserTokenAuth
+// @Param id path string true "รหัสผู้ใช้"
+// @Param payload body UserEarnPointsRequest true "แต้มตั้งต้นก่อนคูณ"
+// @Success 200 {object} User
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/users/{id}/points/earn [post]
+func userEarnPointsDoc() {}
+
+// userTiersRecomputeDoc godoc
+// @Summary คำนวณระดับสมาชิกใหม่ทันที
+// @Description ใช้ได้เฉพาะผู้ดูแล
+// @Tags Users
+// @Produce json
+// @Security UserTokenAuth
+// @Success 200 {object} TierRecomputeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/users/tiers/recompute [post]
+func userTiersRecomputeDoc() {}
+
+// userPointsHistoryDoc godoc
+// @Summary ดูประวัติแต้มของผู้ใช้
+// @Tags Users
+// @Produce json
+// @Param id path string true "รหัสผู้ใช้"
+// @Success 200 {array} PointsEntry
+// @Failure 404 {object} ErrorResponse
+// @Router /api/users/{id}/points/history [get]
+func userPointsHistoryDoc() {}
+
+// userPointsExpiringDoc godoc
+// @Summary รายงานแต้มที่ใกล้หมดอายุ
+// @Tags Users
+// @Produce json
+// @Param days query int false "จำนวนวันล่วงหน้า (ค่าเริ่มต้น 30)"
+// @Success 200 {array} PointsExpiryNotice
+// @Failure 400 {object} ErrorResponse
+// @Router /api/users/points/expiring [get]
+func userPointsExpiringDoc() {}
+
+// userPointsExpireDoc godoc
+// @Summary ตัดแต้มที่หมดอายุทันที
+// @Description ใช้ได้เฉพาะผู้ดูแล
+// @Tags Users
+// @Produce json
+// @Security UserTokenAuth
+// @Success 200 {object} PointsExpireResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/users/points/expire [post]
+func userPointsExpireDoc() {}
+
 // paymentCreateDoc godoc
 // @Summary สร้างข้อมูลการชำระเงิน
+// @Description ใช้ได้กับบูธเจ้าของเซสชันหรือผู้ดูแล
 // @Tags Payments
 // @Accept json
 // @Produce json
+// @Security BoothTokenAuth
+// @Security UserTokenAuth
 // @Param payload body PaymentCreateRequest true "ข้อมูลการชำระเงิน"
 // @Success 201 {object} Payment
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/payments [post]
 func paymentCreateDoc() {}
 
@@ -756,13 +1549,18 @@ func paymentGetDoc() {}
 
 // paymentUpdateDoc godoc
 // @Summary ปรับปรุงข้อมูลการชำระเงิน
+// @Description ใช้ได้กับบูธเจ้าของเซสชันหรือผู้ดูแล
 // @Tags Payments
 // @Accept json
 // @Produce json
+// @Security BoothTokenAuth
+// @Security UserTokenAuth
 // @Param id path string true "รหัสการชำระเงิน"
 // @Param payload body PaymentUpdateRequest true "ข้อมูลที่ต้องแก้ไข"
 // @Success 200 {object} Payment
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/payments/{id} [put]
 func paymentUpdateDoc() {}
 
@@ -828,6 +1626,27 @@ func voucherUpdateDoc() {}
 // @Router /api/vouchers/{id} [delete]
 func voucherDeleteDoc() {}
 
+// voucherRedemptionsDoc godoc
+// @Summary ดูประวัติการใช้คูปอง
+// @Tags Vouchers
+// @Produce json
+// @Param id path string true "รหัสคูปอง"
+// @Success 200 {array} VoucherRedemption
+// @Failure 404 {object} ErrorResponse
+// @Router /api/vouchers/{id}/redemptions [get]
+func voucherRedemptionsDoc() {}
+
+// voucherReversalsDoc godoc
+// @Summary ดูประวัติการยกเลิกการใช้คูปอง
+// @Description รายการที่ถูกคืนสิทธิ์เมื่อเซสชันถูกยกเลิกหรือล้มเหลว
+// @Tags Vouchers
+// @Produce json
+// @Param id path string true "รหัสคูปอง"
+// @Success 200 {array} VoucherReversal
+// @Failure 404 {object} ErrorResponse
+// @Router /api/vouchers/{id}/reversals [get]
+func voucherReversalsDoc() {}
+
 // voucherGetByCodeDoc godoc
 // @Summary ค้นหาคูปองด้วยรหัส
 // @Tags Vouchers
@@ -840,6 +1659,9 @@ func voucherGetByCodeDoc() {}
 
 // voucherRedeemDoc godoc
 // @Summary ใช้งานคูปอง
+// @Description เซิร์ฟเวอร์คำนวณส่วนลดจากเงื่อนไขคูปองและราคาของเซสชันเอง
+// @Description คูปองที่ไม่ได้ตั้งค่า stackable ใช้ร่วมกับคูปองอื่นหรือส่วนลดระดับสมาชิกไม่ได้ (reason = not_stackable)
+// @Description ใช้ได้เฉพาะเซสชันที่ยังอยู่ในสถานะ started เซสชันที่จ่ายแล้ว ล้มเหลว หรือยกเลิกแล้วจะได้ reason = session_closed
 // @Tags Vouchers
 // @Accept json
 // @Produce json
@@ -847,5 +1669,108 @@ func voucherGetByCodeDoc() {}
 // @Param payload body VoucherRedeemRequest true "ข้อมูลการใช้งานคูปอง"
 // @Success 200 {object} VoucherRedeemResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} VoucherRejectionResponse
 // @Router /api/vouchers/redeem [post]
 func voucherRedeemDoc() {}
+
+// voucherValidateDoc godoc
+// @Summary ตรวจสอบคูปองโดยไม่บันทึกการใช้งาน
+// @Description ตรวจเงื่อนไขทั้งหมดแบบเดียวกับการใช้งานคูปองและคำนวณส่วนลด จากเซสชันหรือราคาสมมติ
+// @Description reason: not_found, inactive, not_started, expired, limit_reached, already_redeemed, wrong_branch, wrong_booth, wrong_booth_type, min_spend, customer_required, customer_limit, wrong_day, outside_hours, not_stackable, session_closed
+// @Tags Vouchers
+// @Accept json
+// @Produce json
+// @Security BoothTokenAuth
+// @Param payload body VoucherValidateRequest true "คูปองและเซสชันหรือราคาที่ต้องการตรวจสอบ"
+// @Success 200 {object} VoucherValidateResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/vouchers/validate [post]
+func voucherValidateDoc() {}
+
+// voucherCampaignListDoc godoc
+// @Summary ดึงรายการแคมเปญคูปอง
+// @Tags Voucher Campaigns
+// @Produce json
+// @Success 200 {array} VoucherCampaign
+// @Failure 500 {object} ErrorResponse
+// @Router /api/vouchers/campaigns [get]
+func voucherCampaignListDoc() {}
+
+// voucherCampaignCreateDoc godoc
+// @Summary สร้างแคมเปญและออกรหัสคูปองจำนวนมาก
+// @Description ในรูปแบบรหัส # คือตัวเลขสุ่ม ? คือตัวอักษรหรือตัวเลขสุ่ม อักขระอื่นใช้ตามตัว
+// @Tags Voucher Campaigns
+// @Accept json
+// @Produce json
+// @Param payload body VoucherCampaignCreateRequest true "ข้อมูลแคมเปญ"
+// @Success 201 {object} VoucherCampaign
+// @Failure 400 {object} ErrorResponse
+// @Router /api/vouchers/campaigns [post]
+func voucherCampaignCreateDoc() {}
+
+// voucherCampaignGetDoc godoc
+// @Summary ดูข้อมูลแคมเปญ
+// @Tags Voucher Campaigns
+// @Produce json
+// @Param id path string true "รหัสแคมเปญ"
+// @Success 200 {object} VoucherCampaign
+// @Failure 404 {object} ErrorResponse
+// @Router /api/vouchers/campaigns/{id} [get]
+func voucherCampaignGetDoc() {}
+
+// voucherCampaignStatsDoc godoc
+// @Summary สถิติของแคมเปญ
+// @Tags Voucher Campaigns
+// @Produce json
+// @Param id path string true "รหัสแคมเปญ"
+// @Success 200 {object} VoucherCampaignStats
+// @Failure 404 {object} ErrorResponse
+// @Router /api/vouchers/campaigns/{id}/stats [get]
+func voucherCampaignStatsDoc() {}
+
+// voucherCampaignExportDoc godoc
+// @Summary ส่งออกรหัสคูปองของแคมเปญเป็น CSV
+// @Tags Voucher Campaigns
+// @Produce text/csv
+// @Param id path string true "รหัสแคมเปญ"
+// @Success 200 {string} string "CSV"
+// @Failure 404 {object} ErrorResponse
+// @Router /api/vouchers/campaigns/{id}/codes.csv [get]
+func voucherCampaignExportDoc() {}
+
+// referralListDoc godoc
+// @Summary ดึงรายการการแนะนำเพื่อน
+// @Tags Referrals
+// @Produce json
+// @Param referrer_id query string false "กรองตามผู้แนะนำ"
+// @Success 200 {array} Referral
+// @Router /api/referrals [get]
+func referralListDoc() {}
+
+// referralCodeDoc godoc
+// @Summary ขอรหัสแนะนำเพื่อนของลูกค้า
+// @Description สร้างรหัสให้ในครั้งแรก และคืนรหัสเดิมในครั้งถัดไป
+// @Tags Referrals
+// @Accept json
+// @Produce json
+// @Param payload body ReferralCodeRequest true "ลูกค้าเจ้าของรหัส"
+// @Success 200 {object} ReferralCode
+// @Failure 404 {object} ErrorResponse
+// @Router /api/referrals/codes [post]
+func referralCodeDoc() {}
+
+// referralApplyDoc godoc
+// @Summary ใช้รหัสแนะนำเพื่อนกับเซสชันของลูกค้าใหม่
+// @Description เมื่อเซสชันสำเร็จและชำระเงินแล้ว และเป็นเซสชันที่ชำระเงินครั้งแรกของเบอร์โทรนี้ ทั้งผู้แนะนำและลูกค้าใหม่จะได้รับคูปองใช้ครั้งเดียว
+// @Description รางวัลจะออกเมื่อเซสชันเป็น success และมีการชำระเงินสำเร็จ ไม่ว่าอย่างไหนจะบันทึกก่อน คูปองแต่ละใบใช้ได้เฉพาะบัญชีหรือเบอร์โทรของผู้ที่ได้รับ
+// @Description ใช้ได้เฉพาะเซสชันที่ยังอยู่ในสถานะ started
+// @Tags Referrals
+// @Accept json
+// @Produce json
+// @Security BoothTokenAuth
+// @Param payload body ReferralApplyRequest true "รหัสแนะนำและเซสชัน"
+// @Success 201 {object} Referral
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/referrals/apply [post]
+func referralApplyDoc() {}
@@ -2,12 +2,15 @@ package booth
 
 import (
 	"context"
+	"errors"
 
 	"go-ddd-clean/internal/domain/booth"
 
 	"github.com/google/uuid"
 )
 
+var ErrInvalidExtraCopyPrice = errors.New("extra_copy_price must not be negative")
+
 type Service struct {
 	repo booth.Repository
 }
@@ -22,6 +25,8 @@ type CreateBoothInput struct {
 	Type     booth.BoothType
 	Status   booth.BoothStatus
 	Config   map[string]any
+	// ExtraCopyPrice is nil when the booth does not sell extra copies.
+	ExtraCopyPrice *float64
 }
 
 type UpdateBoothInput struct {
@@ -31,20 +36,26 @@ type UpdateBoothInput struct {
 	Type     booth.BoothType
 	Status   booth.BoothStatus
 	Config   map[string]any
+	// ExtraCopyPrice replaces the booth's; nil stops selling extra copies.
+	ExtraCopyPrice *float64
 }
 
 func (s *Service) Create(ctx context.Context, input CreateBoothInput) (*booth.Booth, error) {
+	if err := validateExtraCopyPrice(input.ExtraCopyPrice); err != nil {
+		return nil, err
+	}
 	status := input.Status
 	if status == "" {
 		status = booth.BoothStatusActive
 	}
 	entity := &booth.Booth{
-		ID:       uuid.NewString(),
-		BranchID: input.BranchID,
-		Name:     input.Name,
-		Type:     input.Type,
-		Status:   status,
-		Config:   input.Config,
+		ID:             uuid.NewString(),
+		BranchID:       input.BranchID,
+		Name:           input.Name,
+		Type:           input.Type,
+		Status:         status,
+		Config:         input.Config,
+		ExtraCopyPrice: input.ExtraCopyPrice,
 	}
 	if err := s.repo.Create(ctx, entity); err != nil {
 		return nil, err
@@ -53,6 +64,9 @@ func (s *Service) Create(ctx context.Context, input CreateBoothInput) (*booth.Bo
 }
 
 func (s *Service) Update(ctx context.Context, input UpdateBoothInput) error {
+	if err := validateExtraCopyPrice(input.ExtraCopyPrice); err != nil {
+		return err
+	}
 	entity, err := s.repo.GetByID(ctx, input.ID)
 	if err != nil {
 		return err
@@ -66,9 +80,17 @@ func (s *Service) Update(ctx context.Context, input UpdateBoothInput) error {
 		entity.Status = input.Status
 	}
 	entity.Config = input.Config
+	entity.ExtraCopyPrice = input.ExtraCopyPrice
 	return s.repo.Update(ctx, entity)
 }
 
+func validateExtraCopyPrice(price *float64) error {
+	if price != nil && *price < 0 {
+		return ErrInvalidExtraCopyPrice
+	}
+	return nil
+}
+
 func (s *Service) Delete(ctx context.Context, id string) error {
 	return s.repo.Delete(ctx, id)
 }
@@ -2,12 +2,15 @@ package branch
 
 import (
 	"context"
+	"errors"
 
 	"go-ddd-clean/internal/domain/branch"
 
 	"github.com/google/uuid"
 )
 
+var ErrInvalidRetention = errors.New("retention days must be at least 1")
+
 type Service struct {
 	repo branch.Repository
 }
@@ -16,22 +19,32 @@ func NewService(repo branch.Repository) *Service {
 	return &Service{repo: repo}
 }
 
+// CreateBranchInput leaves retention unset to keep media until deleted.
 type CreateBranchInput struct {
-	Name     string
-	Location *string
+	Name                  string
+	Location              *string
+	OriginalRetentionDays *int
+	RenderedRetentionDays *int
 }
 
 type UpdateBranchInput struct {
-	ID       string
-	Name     string
-	Location *string
+	ID                    string
+	Name                  string
+	Location              *string
+	OriginalRetentionDays *int
+	RenderedRetentionDays *int
 }
 
 func (s *Service) Create(ctx context.Context, input CreateBranchInput) (*branch.Branch, error) {
+	if err := validateRetention(input.OriginalRetentionDays, input.RenderedRetentionDays); err != nil {
+		return nil, err
+	}
 	entity := &branch.Branch{
-		ID:       uuid.NewString(),
-		Name:     input.Name,
-		Location: input.Location,
+		ID:                    uuid.NewString(),
+		Name:                  input.Name,
+		Location:              input.Location,
+		OriginalRetentionDays: input.OriginalRetentionDays,
+		RenderedRetentionDays: input.RenderedRetentionDays,
 	}
 	if err := s.repo.Create(ctx, entity); err != nil {
 		return nil, err
@@ -40,15 +53,29 @@ func (s *Service) Create(ctx context.Context, input CreateBranchInput) (*branch.
 }
 
 func (s *Service) Update(ctx context.Context, input UpdateBranchInput) error {
+	if err := validateRetention(input.OriginalRetentionDays, input.RenderedRetentionDays); err != nil {
+		return err
+	}
 	entity, err := s.repo.GetByID(ctx, input.ID)
 	if err != nil {
 		return err
 	}
 	entity.Name = input.Name
 	entity.Location = input.Location
+	entity.OriginalRetentionDays = input.OriginalRetentionDays
+	entity.RenderedRetentionDays = input.RenderedRetentionDays
 	return s.repo.Update(ctx, entity)
 }
 
+func validateRetention(days ...*int) error {
+	for _, d := range days {
+		if d != nil && *d < 1 {
+			return ErrInvalidRetention
+		}
+	}
+	return nil
+}
+
 func (s *Service) Delete(ctx context.Context, id string) error {
 	return s.repo.Delete(ctx, id)
 }
@@ -0,0 +1,168 @@
+package media
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"slices"
+)
+
+const (
+	// paletteSize is the most colours a GIF frame can hold.
+	paletteSize = 256
+	// paletteSamples bounds how many pixels the palette is chosen from.
+	paletteSamples = 1 << 16
+)
+
+// encodeGIF writes frames as one animated GIF. All frames share a palette
+// chosen from their pixels, so colours do not flicker between frames.
+// delay is in hundredths of a second; loopCount follows gif.GIF.
+func encodeGIF(w io.Writer, frames []*image.RGBA, delay int, loopCount int) error {
+	pal := medianCut(frames, paletteSize)
+	anim := &gif.GIF{LoopCount: loopCount}
+	q := newQuantizer(pal)
+	for _, frame := range frames {
+		anim.Image = append(anim.Image, q.dither(frame))
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// medianCut picks up to n colours by repeatedly splitting the box of
+// sampled colours with the widest channel range at its median.
+func medianCut(frames []*image.RGBA, n int) color.Palette {
+	total := 0
+	for _, f := range frames {
+		total += f.Rect.Dx() * f.Rect.Dy()
+	}
+	step := max(1, total/paletteSamples)
+	samples := make([][3]uint8, 0, min(total, paletteSamples+len(frames)))
+	for _, f := range frames {
+		for i := 0; i < len(f.Pix); i += 4 * step {
+			samples = append(samples, [3]uint8{f.Pix[i], f.Pix[i+1], f.Pix[i+2]})
+		}
+	}
+	if len(samples) == 0 {
+		return color.Palette{color.Black}
+	}
+
+	boxes := [][][3]uint8{samples}
+	for len(boxes) < n {
+		widest, channel, spread := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if c, s := widestChannel(box); s > spread {
+				widest, channel, spread = i, c, s
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		box := boxes[widest]
+		slices.SortFunc(box, func(a, b [3]uint8) int { return cmp.Compare(a[channel], b[channel]) })
+		mid := len(box) / 2
+		boxes[widest] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	pal := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var sum [3]int
+		for _, c := range box {
+			sum[0], sum[1], sum[2] = sum[0]+int(c[0]), sum[1]+int(c[1]), sum[2]+int(c[2])
+		}
+		k := len(box)
+		pal = append(pal, color.RGBA{uint8(sum[0] / k), uint8(sum[1] / k), uint8(sum[2] / k), 0xff})
+	}
+	return pal
+}
+
+func widestChannel(box [][3]uint8) (int, int) {
+	lo, hi := box[0], box[0]
+	for _, c := range box[1:] {
+		for i := range c {
+			lo[i], hi[i] = min(lo[i], c[i]), max(hi[i], c[i])
+		}
+	}
+	channel, spread := 0, 0
+	for i := range lo {
+		if s := int(hi[i]) - int(lo[i]); s > spread {
+			channel, spread = i, s
+		}
+	}
+	return channel, spread
+}
+
+// quantizer maps colours to palette indexes, caching the nearest entry for
+// each colour at 5 bits per channel.
+type quantizer struct {
+	pal   color.Palette
+	rgb   [][3]int
+	cache [1 << 15]int16
+}
+
+func newQuantizer(pal color.Palette) *quantizer {
+	q := &quantizer{pal: pal, rgb: make([][3]int, len(pal))}
+	for i, c := range pal {
+		rgba := c.(color.RGBA)
+		q.rgb[i] = [3]int{int(rgba.R), int(rgba.G), int(rgba.B)}
+	}
+	for i := range q.cache {
+		q.cache[i] = -1
+	}
+	return q
+}
+
+func (q *quantizer) index(r, g, b int) int {
+	key := r>>3<<10 | g>>3<<5 | b>>3
+	if cached := q.cache[key]; cached >= 0 {
+		return int(cached)
+	}
+	best, bestDist := 0, 1<<30
+	for i, c := range q.rgb {
+		dr, dg, db := c[0]-r, c[1]-g, c[2]-b
+		if d := 2*dr*dr + 4*dg*dg + 3*db*db; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	q.cache[key] = int16(best)
+	return best
+}
+
+// dither converts img to the palette with Floyd-Steinberg error diffusion.
+func (q *quantizer) dither(img *image.RGBA) *image.Paletted {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	out := image.NewPaletted(image.Rect(0, 0, w, h), q.pal)
+	// Errors for the current and next row, with a pixel of padding on
+	// each side.
+	cur, next := make([][3]int, w+2), make([][3]int, w+2)
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			var want [3]int
+			for c := range want {
+				want[c] = clampInt(int(row[x*4+c]) + cur[x+1][c]/16)
+			}
+			i := q.index(want[0], want[1], want[2])
+			out.Pix[y*out.Stride+x] = uint8(i)
+			for c := range want {
+				e := want[c] - q.rgb[i][c]
+				cur[x+2][c] += e * 7
+				next[x][c] += e * 3
+				next[x+1][c] += e * 5
+				next[x+2][c] += e
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+	return out
+}
+
+func clampInt(v int) int {
+	return max(0, min(255, v))
+}
@@ -0,0 +1,310 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/media"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidAnimation = errors.New("invalid animation settings")
+	ErrNotEnoughShots   = errors.New("an animation needs at least two photos")
+)
+
+const (
+	defaultFrameDelayMS = 400
+	// GIF delays are in hundredths of a second; shorter than 20ms is
+	// ignored by most browsers.
+	minFrameDelayMS = 20
+	maxFrameDelayMS = 5000
+	maxLoops        = 100
+	// maxAnimationShots bounds the work a single request can ask for.
+	maxAnimationShots = 20
+
+	defaultAnimationSize = 600
+	minAnimationSize     = 160
+	maxAnimationSize     = 1080
+)
+
+// AnimationService turns a session's photos into animated GIFs that can be
+// shared like photos.
+type AnimationService struct {
+	repo   domain.AnimationRepository
+	photos domain.PhotoRepository
+	frames domain.FrameRepository
+	blobs  domain.BlobStore
+	// source loads frames and never opens originals; only shots, which
+	// reads the photos being animated, does.
+	source *imageSource
+	shots  *imageSource
+	marks  *WatermarkService
+}
+
+func NewAnimationService(
+	repo domain.AnimationRepository,
+	photos domain.PhotoRepository,
+	frames domain.FrameRepository,
+	blobs domain.BlobStore,
+	fetchHosts []string,
+	watermarks *WatermarkService,
+) *AnimationService {
+	source := newImageSource(blobs, fetchHosts)
+	return &AnimationService{
+		repo:   repo,
+		photos: photos,
+		frames: frames,
+		blobs:  blobs,
+		source: source,
+		shots:  source.withOriginals(),
+		marks:  watermarks,
+	}
+}
+
+// CreateAnimationInput describes an animation. Zero values take the
+// defaults: every photo in the session, 400ms per shot, looping forever
+// and a 600px longest edge.
+type CreateAnimationInput struct {
+	SessionID    string
+	Kind         domain.AnimationKind
+	PhotoIDs     []string
+	FrameID      *string
+	FrameDelayMS int
+	Loops        int
+	Size         int
+}
+
+// Create renders and stores an animation of the session's photo originals.
+// With a frame, each shot is laid into the frame's template the way a
+// single-shot strip is rendered, or under the whole frame image when it has
+// no template. A boomerang plays the shots forward then back without
+// repeating the ends. Every frame carries the session's watermark, if any.
+func (s *AnimationService) Create(ctx context.Context, input CreateAnimationInput) (*domain.Animation, error) {
+	input, err := normalizeAnimationInput(input)
+	if err != nil {
+		return nil, err
+	}
+	shots, err := s.loadShots(ctx, input.SessionID, input.PhotoIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(shots) < 2 {
+		return nil, ErrNotEnoughShots
+	}
+
+	var frames []*image.RGBA
+	if input.FrameID != nil {
+		frames, err = s.framed(ctx, *input.FrameID, shots, input.Size)
+	} else {
+		frames = unframed(shots, input.Size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	watermark, err := s.marks.ForSession(ctx, input.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if watermark != nil {
+		for _, frame := range frames {
+			if err := s.marks.Stamp(ctx, frame, watermark); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The way back reuses the forward frames, so this comes after
+	// watermarking.
+	if input.Kind == domain.AnimationBoomerang {
+		for i := len(frames) - 2; i > 0; i-- {
+			frames = append(frames, frames[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGIF(&buf, frames, input.FrameDelayMS/10, gifLoopCount(input.Loops)); err != nil {
+		return nil, err
+	}
+	entity := &domain.Animation{
+		ID:           uuid.NewString(),
+		SessionID:    input.SessionID,
+		Kind:         input.Kind,
+		FrameID:      input.FrameID,
+		FrameDelayMS: input.FrameDelayMS,
+		Loops:        input.Loops,
+		Width:        frames[0].Rect.Dx(),
+		Height:       frames[0].Rect.Dy(),
+		FrameCount:   len(frames),
+		SizeBytes:    int64(buf.Len()),
+	}
+	for _, shot := range shots {
+		entity.PhotoIDs = append(entity.PhotoIDs, shot.photo.ID)
+	}
+	entity.Key = fmt.Sprintf("sessions/%s/animations/%s.gif", entity.SessionID, entity.ID)
+	if err := s.blobs.Put(ctx, entity.Key, &buf, entity.SizeBytes, "image/gif"); err != nil {
+		return nil, err
+	}
+	entity.URL = s.blobs.URL(entity.Key)
+	if err := s.repo.Create(ctx, entity); err != nil {
+		_ = s.blobs.Delete(ctx, entity.Key)
+		return nil, err
+	}
+	return entity, nil
+}
+
+func normalizeAnimationInput(input CreateAnimationInput) (CreateAnimationInput, error) {
+	switch input.Kind {
+	case "":
+		input.Kind = domain.AnimationGIF
+	case domain.AnimationGIF, domain.AnimationBoomerang:
+	default:
+		return input, fmt.Errorf("%w: kind must be %s or %s", ErrInvalidAnimation, domain.AnimationGIF, domain.AnimationBoomerang)
+	}
+	if input.FrameDelayMS == 0 {
+		input.FrameDelayMS = defaultFrameDelayMS
+	}
+	if input.FrameDelayMS < minFrameDelayMS || input.FrameDelayMS > maxFrameDelayMS {
+		return input, fmt.Errorf("%w: frame_delay_ms must be between %d and %d", ErrInvalidAnimation, minFrameDelayMS, maxFrameDelayMS)
+	}
+	if input.Loops < 0 || input.Loops > maxLoops {
+		return input, fmt.Errorf("%w: loops must be between 0 and %d", ErrInvalidAnimation, maxLoops)
+	}
+	if input.Size == 0 {
+		input.Size = defaultAnimationSize
+	}
+	if input.Size < minAnimationSize || input.Size > maxAnimationSize {
+		return input, fmt.Errorf("%w: size must be between %d and %d", ErrInvalidAnimation, minAnimationSize, maxAnimationSize)
+	}
+	if len(input.PhotoIDs) > maxAnimationShots {
+		return input, fmt.Errorf("%w: at most %d photos", ErrInvalidAnimation, maxAnimationShots)
+	}
+	return input, nil
+}
+
+// gifLoopCount converts plays to gif.GIF.LoopCount, which counts repeats
+// after the first play and uses -1 for playing once.
+func gifLoopCount(loops int) int {
+	switch loops {
+	case 0:
+		return 0
+	case 1:
+		return -1
+	}
+	return loops - 1
+}
+
+type animationShot struct {
+	photo *domain.Photo
+	image image.Image
+}
+
+// loadShots decodes the listed photos, or every photo in the session when
+// none are listed.
+func (s *AnimationService) loadShots(ctx context.Context, sessionID string, ids []string) ([]animationShot, error) {
+	var photos []*domain.Photo
+	if len(ids) == 0 {
+		all, err := s.photos.ListBySession(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if len(all) > maxAnimationShots {
+			all = all[:maxAnimationShots]
+		}
+		for i := range all {
+			photos = append(photos, &all[i])
+		}
+	} else {
+		for _, id := range ids {
+			photo, err := s.photos.GetByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if photo.SessionID != sessionID {
+				return nil, ErrShotOutOfSession
+			}
+			photos = append(photos, photo)
+		}
+	}
+	shots := make([]animationShot, 0, len(photos))
+	for _, photo := range photos {
+		img, err := s.shots.decode(ctx, photo.StorageKey, photo.StorageURL)
+		if err != nil {
+			return nil, fmt.Errorf("load shot %s: %w", photo.ID, err)
+		}
+		shots = append(shots, animationShot{photo: photo, image: img})
+	}
+	return shots, nil
+}
+
+func (s *AnimationService) framed(ctx context.Context, frameID string, shots []animationShot, size int) ([]*image.RGBA, error) {
+	frame, err := s.frames.GetByID(ctx, frameID)
+	if err != nil {
+		return nil, err
+	}
+	frameImage, err := s.source.decode(ctx, nil, frame.FileURL)
+	if err != nil {
+		return nil, fmt.Errorf("load frame: %w", err)
+	}
+	template := frame.Template
+	if template == nil || len(template.Slots) == 0 {
+		b := frameImage.Bounds()
+		template = &domain.FrameTemplate{Slots: []domain.Slot{{Width: b.Dx(), Height: b.Dy()}}}
+	}
+	frames := make([]*image.RGBA, 0, len(shots))
+	for _, shot := range shots {
+		canvas, err := composite(frameImage, template, []image.Image{shot.image}, shot.photo.CreatedAt.In(time.Local))
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, toRGBA(fit(canvas, size)))
+	}
+	return frames, nil
+}
+
+// unframed scales every shot to the first shot's proportions, cropping
+// any that differ from the centre.
+func unframed(shots []animationShot, size int) []*image.RGBA {
+	bounds := fit(shots[0].image, size).Bounds()
+	frames := make([]*image.RGBA, 0, len(shots))
+	for _, shot := range shots {
+		canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		drawCover(canvas, canvas.Bounds(), shot.image)
+		frames = append(frames, canvas)
+	}
+	return frames
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+func (s *AnimationService) Get(ctx context.Context, id string) (*domain.Animation, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *AnimationService) ListBySession(ctx context.Context, sessionID string) ([]domain.Animation, error) {
+	return s.repo.ListBySession(ctx, sessionID)
+}
+
+func (s *AnimationService) Delete(ctx context.Context, id string) error {
+	entity, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.blobs.Delete(ctx, entity.Key)
+}
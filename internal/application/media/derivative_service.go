@@ -0,0 +1,177 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"sync"
+
+	domain "go-ddd-clean/internal/domain/media"
+)
+
+// Jobs runs work in the background. Submit reports false when the job was
+// not accepted.
+type Jobs interface {
+	Submit(name string, run func(ctx context.Context) error) bool
+}
+
+// ImageEncoder writes img in some file format.
+type ImageEncoder func(w io.Writer, img image.Image) error
+
+type derivativeSpec struct {
+	kind     domain.DerivativeKind
+	maxEdge  int
+	mimeType string
+	ext      string
+	encode   ImageEncoder
+}
+
+func jpegEncoder(quality int) ImageEncoder {
+	return func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+}
+
+// DerivativeService builds the resized copies galleries and share pages
+// load instead of full-size originals. Builds run on the job queue; a photo
+// already waiting is not queued twice.
+type DerivativeService struct {
+	photos domain.PhotoRepository
+	blobs  domain.BlobStore
+	source *imageSource
+	jobs   Jobs
+	marks  *WatermarkService
+	specs  []derivativeSpec
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// NewDerivativeService takes the WebP encoder from the caller because the
+// standard library has none.
+func NewDerivativeService(
+	photos domain.PhotoRepository,
+	blobs domain.BlobStore,
+	jobs Jobs,
+	webp ImageEncoder,
+	watermarks *WatermarkService,
+) *DerivativeService {
+	return &DerivativeService{
+		photos: photos,
+		blobs:  blobs,
+		source: newImageSource(blobs, nil).withOriginals(),
+		jobs:   jobs,
+		marks:  watermarks,
+		specs: []derivativeSpec{
+			{kind: domain.DerivativeThumb, maxEdge: 320, mimeType: "image/jpeg", ext: ".jpg", encode: jpegEncoder(80)},
+			{kind: domain.DerivativeWebJPEG, maxEdge: 1600, mimeType: "image/jpeg", ext: ".jpg", encode: jpegEncoder(85)},
+			{kind: domain.DerivativeWebWebP, maxEdge: 1600, mimeType: "image/webp", ext: ".webp", encode: webp},
+			// 6 inches at 300 dpi, the long edge of both print sizes.
+			{kind: domain.DerivativePrint, maxEdge: 1800, mimeType: "image/jpeg", ext: ".jpg", encode: jpegEncoder(95)},
+		},
+		pending: map[string]bool{},
+	}
+}
+
+// Schedule queues a derivative build for the photo.
+func (s *DerivativeService) Schedule(photoID string) {
+	s.mu.Lock()
+	if s.pending[photoID] {
+		s.mu.Unlock()
+		return
+	}
+	s.pending[photoID] = true
+	s.mu.Unlock()
+
+	accepted := s.jobs.Submit("derivatives "+photoID, func(ctx context.Context) error {
+		s.mu.Lock()
+		delete(s.pending, photoID)
+		s.mu.Unlock()
+		return s.Build(ctx, photoID)
+	})
+	if !accepted {
+		s.mu.Lock()
+		delete(s.pending, photoID)
+		s.mu.Unlock()
+	}
+}
+
+// Build makes every derivative of the photo's rendered composite, or of its
+// original when it has not been rendered or the composite was purged, and
+// records them on the photo. Photos whose image the API did not store are
+// skipped. Copies of an original get the session's watermark, if it
+// carries one; a composite already has it from rendering.
+func (s *DerivativeService) Build(ctx context.Context, photoID string) error {
+	photo, err := s.photos.GetByID(ctx, photoID)
+	if err != nil {
+		return err
+	}
+	sourceKey, source := photo.StorageKey, domain.SourceOriginal
+	if photo.RenderedKey != nil && photo.RenderedPurgedAt == nil {
+		sourceKey, source = photo.RenderedKey, domain.SourceRendered
+	}
+	if sourceKey == nil {
+		return nil
+	}
+	img, err := s.source.decode(ctx, sourceKey, "")
+	if err != nil {
+		return err
+	}
+	watermarked := photo.Watermarked
+	if source == domain.SourceOriginal {
+		watermark, err := s.marks.ForSession(ctx, photo.SessionID)
+		if err != nil {
+			return err
+		}
+		if watermark != nil {
+			canvas := toRGBA(img)
+			if err := s.marks.Stamp(ctx, canvas, watermark); err != nil {
+				return err
+			}
+			img = canvas
+		}
+		watermarked = watermark != nil
+	}
+
+	derivatives := make(map[domain.DerivativeKind]domain.Derivative, len(s.specs))
+	for _, spec := range s.specs {
+		resized := fit(img, spec.maxEdge)
+		var buf bytes.Buffer
+		if err := spec.encode(&buf, resized); err != nil {
+			return fmt.Errorf("encode %s: %w", spec.kind, err)
+		}
+		size := int64(buf.Len())
+		key := fmt.Sprintf("sessions/%s/derivatives/%s/%s%s", photo.SessionID, photo.ID, spec.kind, spec.ext)
+		if err := s.blobs.Put(ctx, key, &buf, size, spec.mimeType); err != nil {
+			return err
+		}
+		bounds := resized.Bounds()
+		derivatives[spec.kind] = domain.Derivative{
+			Key:      key,
+			URL:      s.blobs.URL(key),
+			Width:    bounds.Dx(),
+			Height:   bounds.Dy(),
+			MimeType: spec.mimeType,
+			Size:     size,
+			Source:   source,
+		}
+	}
+	return s.photos.SetDerivatives(ctx, photo.ID, derivatives, watermarked)
+}
+
+// Backfill queues builds for stored photos that have no derivatives, such
+// as uploads whose job was lost in a restart. It returns how many it
+// queued.
+func (s *DerivativeService) Backfill(ctx context.Context, limit int) (int, error) {
+	photos, err := s.photos.ListWithoutDerivatives(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, photo := range photos {
+		s.Schedule(photo.ID)
+	}
+	return len(photos), nil
+}
@@ -0,0 +1,176 @@
+package media
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	domain "go-ddd-clean/internal/domain/media"
+)
+
+var ErrInvalidLUT = errors.New("lookup table is not a valid .cube file")
+
+// maxLUTSize bounds LUT_3D_SIZE so a bad file cannot allocate gigabytes.
+const maxLUTSize = 128
+
+// lut is a 3D colour lookup table with entries in 0..1, red varying
+// fastest as in the .cube format.
+type lut struct {
+	size  int
+	table [][3]float64
+}
+
+// applyEffect returns a copy of src with the effect applied. The steps run
+// in a fixed order: the LUT sets the base look, then brightness, contrast,
+// temperature, saturation and grayscale adjust it, and the vignette is
+// drawn last. table may be nil when the effect has no LUT.
+func applyEffect(src image.Image, e domain.Effect, table *lut) *image.RGBA {
+	bounds := src.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), src, bounds.Min, draw.Src)
+	if e.IsZero() {
+		return out
+	}
+
+	brightness := 255 * e.Brightness / 100
+	contrast := 1 + e.Contrast/100
+	saturation := 1 + e.Saturation/100
+	warm := e.Temperature / 200
+	width, height := float64(out.Rect.Dx()), float64(out.Rect.Dy())
+	cx, cy := width/2, height/2
+	maxDist := math.Hypot(cx, cy)
+	vignette := e.Vignette / 100
+
+	for y := 0; y < out.Rect.Dy(); y++ {
+		row := out.Pix[y*out.Stride:]
+		for x := 0; x < out.Rect.Dx(); x++ {
+			px := row[x*4 : x*4+4]
+			r, g, b := float64(px[0]), float64(px[1]), float64(px[2])
+			if table != nil {
+				r, g, b = table.lookup(r/255, g/255, b/255)
+				r, g, b = r*255, g*255, b*255
+			}
+			r, g, b = r+brightness, g+brightness, b+brightness
+			r, g, b = (r-128)*contrast+128, (g-128)*contrast+128, (b-128)*contrast+128
+			r, b = r*(1+warm), b*(1-warm)
+			lum := luminance(r, g, b)
+			if e.Grayscale {
+				r, g, b = lum, lum, lum
+			} else {
+				r, g, b = lum+(r-lum)*saturation, lum+(g-lum)*saturation, lum+(b-lum)*saturation
+			}
+			if vignette > 0 {
+				d := math.Hypot(float64(x)-cx, float64(y)-cy) / maxDist
+				f := 1 - vignette*d*d
+				r, g, b = r*f, g*f, b*f
+			}
+			px[0], px[1], px[2] = clamp8(r), clamp8(g), clamp8(b)
+		}
+	}
+	return out
+}
+
+func luminance(r, g, b float64) float64 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+func clamp8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// parseCube reads a 3D LUT in Adobe .cube format. 1D tables and custom
+// domains are not supported.
+func parseCube(r io.Reader) (*lut, error) {
+	scanner := bufio.NewScanner(r)
+	result := &lut{}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "TITLE", "DOMAIN_MIN", "DOMAIN_MAX":
+			continue
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("%w: 1D tables are not supported", ErrInvalidLUT)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, ErrInvalidLUT
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 2 || size > maxLUTSize {
+				return nil, fmt.Errorf("%w: LUT_3D_SIZE must be between 2 and %d", ErrInvalidLUT, maxLUTSize)
+			}
+			result.size = size
+			result.table = make([][3]float64, 0, size*size*size)
+			continue
+		}
+		if result.size == 0 || len(fields) != 3 {
+			return nil, ErrInvalidLUT
+		}
+		var entry [3]float64
+		for i, field := range fields {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, ErrInvalidLUT
+			}
+			entry[i] = v
+		}
+		if len(result.table) == cap(result.table) {
+			return nil, fmt.Errorf("%w: more entries than LUT_3D_SIZE allows", ErrInvalidLUT)
+		}
+		result.table = append(result.table, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if result.size == 0 || len(result.table) != result.size*result.size*result.size {
+		return nil, fmt.Errorf("%w: entry count does not match LUT_3D_SIZE", ErrInvalidLUT)
+	}
+	return result, nil
+}
+
+// lookup maps a colour through the table with trilinear interpolation.
+// Inputs and outputs are in 0..1.
+func (l *lut) lookup(r, g, b float64) (float64, float64, float64) {
+	scale := float64(l.size - 1)
+	fr, fg, fb := clampUnit(r)*scale, clampUnit(g)*scale, clampUnit(b)*scale
+	r0, g0, b0 := int(fr), int(fg), int(fb)
+	r1, g1, b1 := min(r0+1, l.size-1), min(g0+1, l.size-1), min(b0+1, l.size-1)
+	dr, dg, db := fr-float64(r0), fg-float64(g0), fb-float64(b0)
+
+	var out [3]float64
+	for i := range out {
+		c00 := lerp(l.at(r0, g0, b0)[i], l.at(r1, g0, b0)[i], dr)
+		c10 := lerp(l.at(r0, g1, b0)[i], l.at(r1, g1, b0)[i], dr)
+		c01 := lerp(l.at(r0, g0, b1)[i], l.at(r1, g0, b1)[i], dr)
+		c11 := lerp(l.at(r0, g1, b1)[i], l.at(r1, g1, b1)[i], dr)
+		out[i] = lerp(lerp(c00, c10, dg), lerp(c01, c11, dg), db)
+	}
+	return out[0], out[1], out[2]
+}
+
+func (l *lut) at(r, g, b int) [3]float64 {
+	return l.table[r+g*l.size+b*l.size*l.size]
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,241 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"strings"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/media"
+)
+
+// metadataPeek is how much of an upload is read ahead to find its
+// metadata. EXIF blocks are capped at 64 KiB and come before the image
+// data, so this also reaches the frame header of almost every JPEG.
+const metadataPeek = 128 << 10
+
+// exifInfo is what is read from a JPEG's EXIF block. Only these tags are
+// parsed; GPS and everything else is skipped.
+type exifInfo struct {
+	orientation int
+	make        string
+	model       string
+	captured    *time.Time
+}
+
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+	tagOffsetOriginal   = 0x9011
+)
+
+// readEXIF finds the EXIF block of a JPEG, reading segments until the image
+// data starts.
+func readEXIF(data []byte) (exifInfo, bool) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return exifInfo{}, false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return exifInfo{}, false
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			i++
+			continue
+		}
+		// Start of scan or end of image: there is no EXIF block.
+		if marker == 0xda || marker == 0xd9 {
+			return exifInfo{}, false
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return exifInfo{}, false
+		}
+		segment := data[i+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return parseTIFF(segment[6:])
+		}
+		i = end
+	}
+	return exifInfo{}, false
+}
+
+// tiff reads the TIFF structure EXIF is stored in.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(data []byte) (exifInfo, bool) {
+	if len(data) < 8 {
+		return exifInfo{}, false
+	}
+	t := tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return exifInfo{}, false
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return exifInfo{}, false
+	}
+	info := exifInfo{orientation: 1}
+	var exifIFD uint32
+	var dateTime, original, offset string
+	t.walk(t.order.Uint32(data[4:]), func(tag uint16, entry []byte) {
+		switch tag {
+		case tagMake:
+			info.make = t.ascii(entry)
+		case tagModel:
+			info.model = t.ascii(entry)
+		case tagOrientation:
+			info.orientation = int(t.order.Uint16(entry[8:]))
+		case tagDateTime:
+			dateTime = t.ascii(entry)
+		case tagExifIFD:
+			exifIFD = t.order.Uint32(entry[8:])
+		}
+	})
+	if exifIFD != 0 {
+		t.walk(exifIFD, func(tag uint16, entry []byte) {
+			switch tag {
+			case tagDateTimeOriginal:
+				original = t.ascii(entry)
+			case tagOffsetOriginal:
+				offset = t.ascii(entry)
+			}
+		})
+	}
+	if original == "" {
+		original, offset = dateTime, ""
+	}
+	info.captured = exifTime(original, offset)
+	if info.orientation < 1 || info.orientation > 8 {
+		info.orientation = 1
+	}
+	return info, true
+}
+
+// walk calls fn with the tag and 12-byte entry of each field of the IFD at
+// offset. Malformed directories are read as far as they are valid.
+func (t tiff) walk(offset uint32, fn func(tag uint16, entry []byte)) {
+	start := int(offset)
+	if start <= 0 || start+2 > len(t.data) {
+		return
+	}
+	count := int(t.order.Uint16(t.data[start:]))
+	for i := 0; i < count; i++ {
+		at := start + 2 + i*12
+		if at+12 > len(t.data) {
+			return
+		}
+		entry := t.data[at : at+12]
+		fn(t.order.Uint16(entry), entry)
+	}
+}
+
+// ascii reads an ASCII field, stored inline when it fits in four bytes.
+func (t tiff) ascii(entry []byte) string {
+	const typeASCII = 2
+	if t.order.Uint16(entry[2:]) != typeASCII {
+		return ""
+	}
+	n := int(t.order.Uint32(entry[4:]))
+	value := entry[8:12]
+	if n > 4 {
+		at := int(t.order.Uint32(entry[8:]))
+		if at < 0 || at+n > len(t.data) {
+			return ""
+		}
+		value = t.data[at : at+n]
+	} else {
+		value = value[:n]
+	}
+	return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+}
+
+// exifTime parses an EXIF timestamp. Cameras record local time, and only
+// some say which zone; the rest are taken to be in the server's.
+func exifTime(value string, offset string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	loc := time.Local
+	if at, err := time.Parse("-07:00", offset); err == nil {
+		_, secs := at.Zone()
+		loc = time.FixedZone("", secs)
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", value, loc)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// photoMetadata reads the technical metadata of an upload from its first
+// bytes. It returns nil when the image header is not among them.
+func photoMetadata(head []byte) *domain.PhotoMetadata {
+	config, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return nil
+	}
+	metadata := &domain.PhotoMetadata{Width: config.Width, Height: config.Height, Orientation: 1}
+	info, ok := readEXIF(head)
+	if !ok {
+		return metadata
+	}
+	metadata.Orientation = info.orientation
+	if info.orientation >= 5 {
+		metadata.Width, metadata.Height = config.Height, config.Width
+	}
+	metadata.CapturedAt = info.captured
+	if info.make != "" {
+		metadata.CameraMake = &info.make
+	}
+	if info.model != "" {
+		metadata.CameraModel = &info.model
+	}
+	return metadata
+}
+
+// orient turns img upright for its EXIF orientation: 2 to 4 mirror or turn
+// it half way, 5 to 8 also swap its sides.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	// from maps a point of the upright image to the stored one.
+	from := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return w - 1 - x, y },
+		3: func(x, y int) (int, int) { return w - 1 - x, h - 1 - y },
+		4: func(x, y int) (int, int) { return x, h - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, h - 1 - x },
+		7: func(x, y int) (int, int) { return w - 1 - y, h - 1 - x },
+		8: func(x, y int) (int, int) { return w - 1 - y, x },
+	}[orientation]
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := from(x, y)
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
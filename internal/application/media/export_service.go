@@ -0,0 +1,273 @@
+package media
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/media"
+)
+
+var (
+	ErrExportUnfiltered = errors.New("an export needs a session_id, booth_id, or both from and to")
+	ErrExportRange      = errors.New("an export's to must be after its from and, without a session or booth, at most 31 days later")
+)
+
+const (
+	// exportPageSize is how many photos an export reads from the database
+	// at a time.
+	exportPageSize = 200
+	// maxExportRange is the longest date range an export may cover when it
+	// is not narrowed to a session or booth.
+	maxExportRange = 31 * 24 * time.Hour
+)
+
+// ExportService streams archives of stored media for event clients. Files
+// are copied from storage one at a time, so an export of any size runs in
+// constant memory.
+type ExportService struct {
+	photos     domain.PhotoRepository
+	animations domain.AnimationRepository
+	source     *imageSource
+	originals  *imageSource
+}
+
+func NewExportService(photos domain.PhotoRepository, animations domain.AnimationRepository, blobs domain.BlobStore) *ExportService {
+	return &ExportService{
+		photos:     photos,
+		animations: animations,
+		source:     newImageSource(blobs, nil),
+		originals:  newImageSource(blobs, nil).withOriginals(),
+	}
+}
+
+// ExportManifest describes an archive; it is written last, as
+// manifest.json, so it can list files that could not be read.
+type ExportManifest struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	Filter      exportFilter        `json:"filter"`
+	Originals   bool                `json:"originals"`
+	Photos      []ExportedPhoto     `json:"photos"`
+	Animations  []ExportedAnimation `json:"animations"`
+	Failures    []ExportFailure     `json:"failures"`
+}
+
+type exportFilter struct {
+	SessionID *string    `json:"session_id,omitempty"`
+	BoothID   *string    `json:"booth_id,omitempty"`
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"`
+}
+
+type ExportedPhoto struct {
+	ID          string         `json:"id"`
+	SessionID   string         `json:"session_id"`
+	FrameID     *string        `json:"frame_id,omitempty"`
+	FilterID    *string        `json:"filter_id,omitempty"`
+	Composition map[string]any `json:"composition,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Files       []ExportedFile `json:"files"`
+}
+
+type ExportedAnimation struct {
+	ID        string       `json:"id"`
+	SessionID string       `json:"session_id"`
+	Kind      string       `json:"kind"`
+	PhotoIDs  []string     `json:"photo_ids"`
+	CreatedAt time.Time    `json:"created_at"`
+	File      ExportedFile `json:"file"`
+}
+
+// ExportedFile is one entry of the archive. Role is "original",
+// "rendered", "animation" or a derivative kind.
+type ExportedFile struct {
+	Path   string `json:"path"`
+	Role   string `json:"role"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type ExportFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// CheckExport rejects filters that are not narrowed to a session, a booth
+// or a bounded date range. Callers that stream the archive check first so
+// the error can still be returned.
+func CheckExport(filter domain.MediaFilter) error {
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return ErrExportRange
+	}
+	if filter.SessionID != nil || filter.BoothID != nil {
+		return nil
+	}
+	if filter.From == nil || filter.To == nil {
+		return ErrExportUnfiltered
+	}
+	if filter.To.Sub(*filter.From) > maxExportRange {
+		return ErrExportRange
+	}
+	return nil
+}
+
+// WriteZip writes the matching photos' rendered composites and
+// derivatives, then the matching animations, under
+// <session>/photos/<photo>/ and <session>/animations/. Originals are
+// written too only when originals is set: they are the camera's files,
+// EXIF and all, and are for admins alone. Files the retention job has
+// purged are left out; files that cannot be read are skipped and listed
+// in the manifest's failures.
+func (s *ExportService) WriteZip(ctx context.Context, filter domain.MediaFilter, originals bool, w io.Writer) error {
+	if err := CheckExport(filter); err != nil {
+		return err
+	}
+	archive := zip.NewWriter(w)
+	manifest := ExportManifest{
+		GeneratedAt: time.Now().UTC(),
+		Filter:      exportFilter(filter),
+		Originals:   originals,
+		Photos:      []ExportedPhoto{},
+		Animations:  []ExportedAnimation{},
+		Failures:    []ExportFailure{},
+	}
+
+	for offset := 0; ; offset += exportPageSize {
+		page, err := s.photos.ListByFilter(ctx, filter, offset, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, photo := range page {
+			exported, err := s.writePhoto(ctx, archive, &manifest, photo, originals)
+			if err != nil {
+				return err
+			}
+			manifest.Photos = append(manifest.Photos, exported)
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+	}
+
+	animations, err := s.animations.ListByFilter(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, a := range animations {
+		if a.PurgedAt != nil {
+			continue
+		}
+		path := fmt.Sprintf("%s/animations/%s-%s.gif", a.SessionID, a.ID, a.Kind)
+		file, ok, err := s.writeFile(ctx, archive, &manifest, s.source, path, "animation", &a.Key, a.URL)
+		if err != nil {
+			return err
+		}
+		if ok {
+			manifest.Animations = append(manifest.Animations, ExportedAnimation{
+				ID:        a.ID,
+				SessionID: a.SessionID,
+				Kind:      string(a.Kind),
+				PhotoIDs:  a.PhotoIDs,
+				CreatedAt: a.CreatedAt,
+				File:      file,
+			})
+		}
+	}
+
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func (s *ExportService) writePhoto(ctx context.Context, archive *zip.Writer, manifest *ExportManifest, photo domain.Photo, originals bool) (ExportedPhoto, error) {
+	exported := ExportedPhoto{
+		ID:          photo.ID,
+		SessionID:   photo.SessionID,
+		FrameID:     photo.FrameID,
+		FilterID:    photo.FilterID,
+		Composition: photo.Composition,
+		CreatedAt:   photo.CreatedAt,
+		Files:       []ExportedFile{},
+	}
+	dir := fmt.Sprintf("%s/photos/%s/", photo.SessionID, photo.ID)
+	add := func(source *imageSource, name string, role string, key *string, url string) error {
+		file, ok, err := s.writeFile(ctx, archive, manifest, source, dir+name, role, key, url)
+		if ok {
+			exported.Files = append(exported.Files, file)
+		}
+		return err
+	}
+
+	if originals && photo.OriginalPurgedAt == nil && (photo.StorageKey != nil || photo.StorageURL != "") {
+		if err := add(s.originals, "original"+fileExt(keyOrURL(photo.StorageKey, photo.StorageURL), ".jpg"), "original", photo.StorageKey, photo.StorageURL); err != nil {
+			return exported, err
+		}
+	}
+	if hasComposite(&photo) {
+		if err := add(s.source, "rendered"+fileExt(keyOrURL(photo.RenderedKey, *photo.RenderedURL), ".jpg"), "rendered", photo.RenderedKey, *photo.RenderedURL); err != nil {
+			return exported, err
+		}
+	}
+	for _, kind := range []domain.DerivativeKind{domain.DerivativeThumb, domain.DerivativeWebJPEG, domain.DerivativeWebWebP, domain.DerivativePrint} {
+		d, ok := photo.Derivatives[kind]
+		if !ok {
+			continue
+		}
+		if err := add(s.source, "derivatives/"+string(kind)+fileExt(d.Key, ".jpg"), string(kind), &d.Key, d.URL); err != nil {
+			return exported, err
+		}
+	}
+	return exported, nil
+}
+
+// writeFile copies one file into the archive. A file that cannot be opened
+// is recorded as a failure and reported as not written; only errors writing
+// the archive itself are returned.
+func (s *ExportService) writeFile(
+	ctx context.Context,
+	archive *zip.Writer,
+	manifest *ExportManifest,
+	source *imageSource,
+	path string,
+	role string,
+	key *string,
+	url string,
+) (ExportedFile, bool, error) {
+	body, err := source.open(ctx, key, url)
+	if err != nil {
+		manifest.Failures = append(manifest.Failures, ExportFailure{Path: path, Error: err.Error()})
+		return ExportedFile{}, false, nil
+	}
+	defer body.Close()
+	// Photos are already compressed; storing them keeps exports fast.
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return ExportedFile{}, false, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(entry, hash), body)
+	if err != nil {
+		return ExportedFile{}, false, fmt.Errorf("copy %s: %w", path, err)
+	}
+	return ExportedFile{Path: path, Role: role, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, true, nil
+}
+
+func keyOrURL(key *string, url string) string {
+	if key != nil {
+		return *key
+	}
+	return url
+}
@@ -29,11 +29,17 @@ type UpdateFilterInput struct {
 	Active bool
 }
 
+// Create validates the effect against the effect schema and stores it in
+// its normalised form.
 func (s *FilterService) Create(ctx context.Context, input CreateFilterInput) (*domain.Filter, error) {
+	effect, err := domain.ParseEffect(input.Effect)
+	if err != nil {
+		return nil, err
+	}
 	entity := &domain.Filter{
 		ID:     uuid.NewString(),
 		Name:   input.Name,
-		Effect: input.Effect,
+		Effect: effect.Map(),
 		Active: input.Active,
 	}
 	if err := s.repo.Create(ctx, entity); err != nil {
@@ -43,12 +49,16 @@ func (s *FilterService) Create(ctx context.Context, input CreateFilterInput) (*d
 }
 
 func (s *FilterService) Update(ctx context.Context, input UpdateFilterInput) (*domain.Filter, error) {
+	effect, err := domain.ParseEffect(input.Effect)
+	if err != nil {
+		return nil, err
+	}
 	entity, err := s.repo.GetByID(ctx, input.ID)
 	if err != nil {
 		return nil, err
 	}
 	entity.Name = input.Name
-	entity.Effect = input.Effect
+	entity.Effect = effect.Map()
 	entity.Active = input.Active
 	if err := s.repo.Update(ctx, entity); err != nil {
 		return nil, err
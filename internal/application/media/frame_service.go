@@ -17,10 +17,11 @@ func NewFrameService(repo domain.FrameRepository) *FrameService {
 }
 
 type CreateFrameInput struct {
-	Name    string
-	Theme   *string
-	FileURL string
-	Active  bool
+	Name     string
+	Theme    *string
+	FileURL  string
+	Template *domain.FrameTemplate
+	Active   bool
 }
 
 type UpdateFrameInput struct {
@@ -28,16 +29,24 @@ type UpdateFrameInput struct {
 	Name    string
 	Theme   *string
 	FileURL string
-	Active  bool
+	// Template replaces the frame's layout; nil keeps the current one.
+	Template *domain.FrameTemplate
+	Active   bool
 }
 
 func (s *FrameService) Create(ctx context.Context, input CreateFrameInput) (*domain.Frame, error) {
+	if input.Template != nil {
+		if err := input.Template.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	entity := &domain.Frame{
-		ID:      uuid.NewString(),
-		Name:    input.Name,
-		Theme:   input.Theme,
-		FileURL: input.FileURL,
-		Active:  input.Active,
+		ID:       uuid.NewString(),
+		Name:     input.Name,
+		Theme:    input.Theme,
+		FileURL:  input.FileURL,
+		Template: input.Template,
+		Active:   input.Active,
 	}
 	if err := s.repo.Create(ctx, entity); err != nil {
 		return nil, err
@@ -46,6 +55,11 @@ func (s *FrameService) Create(ctx context.Context, input CreateFrameInput) (*dom
 }
 
 func (s *FrameService) Update(ctx context.Context, input UpdateFrameInput) (*domain.Frame, error) {
+	if input.Template != nil {
+		if err := input.Template.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	entity, err := s.repo.GetByID(ctx, input.ID)
 	if err != nil {
 		return nil, err
@@ -53,6 +67,9 @@ func (s *FrameService) Update(ctx context.Context, input UpdateFrameInput) (*dom
 	entity.Name = input.Name
 	entity.Theme = input.Theme
 	entity.FileURL = input.FileURL
+	if input.Template != nil {
+		entity.Template = input.Template
+	}
 	entity.Active = input.Active
 	if err := s.repo.Update(ctx, entity); err != nil {
 		return nil, err
@@ -0,0 +1,160 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/media"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+)
+
+// overlayFont is the face overlays are set in. The Go fonts have no Thai
+// glyphs, so overlays should stick to Latin text and dates.
+var overlayFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// composite draws a frame template. The canvas is the template size, or
+// the frame image's own size for templates without one. Each shot is
+// scaled to cover its slot, cropped from the centre and rotated about the
+// slot's centre; shots repeat when there are fewer than slots. The frame
+// image is then scaled onto the canvas over the shots, so its transparent
+// windows show them, and the overlays are written on top.
+func composite(frame image.Image, template *domain.FrameTemplate, shots []image.Image, taken time.Time) (*image.RGBA, error) {
+	bounds := frame.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if template.Width > 0 && template.Height > 0 {
+		width, height = template.Width, template.Height
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for i, slot := range template.Slots {
+		rect := image.Rect(slot.X, slot.Y, slot.X+slot.Width, slot.Y+slot.Height)
+		shot := shots[i%len(shots)]
+		if slot.Rotation == 0 {
+			drawCover(canvas, rect, shot)
+			continue
+		}
+		tile := image.NewRGBA(image.Rect(0, 0, slot.Width, slot.Height))
+		drawCover(tile, tile.Bounds(), shot)
+		drawRotated(canvas, rect, tile, slot.Rotation)
+	}
+
+	if bounds.Dx() == width && bounds.Dy() == height {
+		draw.Draw(canvas, canvas.Bounds(), frame, bounds.Min, draw.Over)
+	} else {
+		xdraw.CatmullRom.Scale(canvas, canvas.Bounds(), frame, bounds, xdraw.Over, nil)
+	}
+
+	for _, overlay := range template.Overlays {
+		if err := drawOverlay(canvas, overlay, taken); err != nil {
+			return nil, err
+		}
+	}
+	return canvas, nil
+}
+
+// drawCover scales src to fill dst entirely, cropping whichever dimension
+// overflows evenly from both sides.
+func drawCover(canvas draw.Image, dst image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	crop := sb
+	// Compare aspect ratios without floats: src is wider than dst when
+	// sw/sh > dw/dh.
+	if sb.Dx()*dst.Dy() > dst.Dx()*sb.Dy() {
+		w := sb.Dy() * dst.Dx() / dst.Dy()
+		crop.Min.X = sb.Min.X + (sb.Dx()-w)/2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := sb.Dx() * dst.Dy() / dst.Dx()
+		crop.Min.Y = sb.Min.Y + (sb.Dy()-h)/2
+		crop.Max.Y = crop.Min.Y + h
+	}
+	xdraw.CatmullRom.Scale(canvas, dst, src, crop, xdraw.Src, nil)
+}
+
+// drawRotated draws tile centred on dst, turned clockwise by degrees.
+func drawRotated(canvas draw.Image, dst image.Rectangle, tile image.Image, degrees float64) {
+	theta := degrees * math.Pi / 180
+	sin, cos := math.Sincos(theta)
+	tb := tile.Bounds()
+	tcx, tcy := float64(tb.Min.X+tb.Max.X)/2, float64(tb.Min.Y+tb.Max.Y)/2
+	cx, cy := float64(dst.Min.X+dst.Max.X)/2, float64(dst.Min.Y+dst.Max.Y)/2
+	// Maps tile coordinates to canvas coordinates: move the tile centre to
+	// the origin, rotate, then move it to the slot centre.
+	m := f64.Aff3{
+		cos, -sin, cx - (cos*tcx - sin*tcy),
+		sin, cos, cy - (sin*tcx + cos*tcy),
+	}
+	xdraw.CatmullRom.Transform(canvas, m, tile, tb, xdraw.Over, nil)
+}
+
+// drawOverlay writes the overlay's text as large as fits its area,
+// vertically centred.
+func drawOverlay(canvas draw.Image, overlay domain.Overlay, taken time.Time) error {
+	text := overlay.Content(taken)
+	if text == "" {
+		return nil
+	}
+	otf, err := overlayFont()
+	if err != nil {
+		return err
+	}
+	size := float64(overlay.Height) * 0.8
+	face, err := opentype.NewFace(otf, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return err
+	}
+	if advance := font.MeasureString(face, text).Ceil(); advance > overlay.Width {
+		face.Close()
+		size = size * float64(overlay.Width) / float64(advance)
+		face, err = opentype.NewFace(otf, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return err
+		}
+	}
+	defer face.Close()
+
+	advance := font.MeasureString(face, text).Ceil()
+	x := overlay.X
+	switch overlay.Align {
+	case domain.AlignCenter:
+		x += (overlay.Width - advance) / 2
+	case domain.AlignRight:
+		x += overlay.Width - advance
+	}
+	metrics := face.Metrics()
+	baseline := overlay.Y + (overlay.Height+metrics.Ascent.Ceil()-metrics.Descent.Ceil())/2
+	drawer := font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(overlayColor(overlay.Color)),
+		Face: face,
+		Dot:  fixed.P(x, baseline),
+	}
+	drawer.DrawString(text)
+	return nil
+}
+
+// overlayColor parses "#RRGGBB", which templates are validated to use.
+func overlayColor(hex string) color.Color {
+	if len(hex) != 7 {
+		return color.Black
+	}
+	rgb, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return color.Black
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+}
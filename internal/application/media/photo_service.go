@@ -1,19 +1,61 @@
 package media
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
 
 	domain "go-ddd-clean/internal/domain/media"
 
 	"github.com/google/uuid"
 )
 
+var (
+	ErrUnsupportedMedia = errors.New("file must be a JPEG, PNG, WebP or GIF image")
+	ErrUploadTooLarge   = errors.New("file is larger than the upload limit")
+	ErrInvalidUploadID  = errors.New("upload_id is not a valid upload")
+	ErrUploadMissing    = errors.New("no file has been uploaded for this upload_id")
+	ErrChecksumMismatch = errors.New("uploaded file does not match the checksum")
+	ErrStoredURL        = errors.New("storage_url and rendered_url must not point into the API's storage; upload the file instead")
+)
+
+// uploadExtensions are the image types booths may upload, with the file
+// extension used for their storage key.
+var uploadExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
 type PhotoService struct {
-	repo domain.PhotoRepository
+	repo        domain.PhotoRepository
+	blobs       domain.BlobStore
+	derivatives *DerivativeService
+	maxBytes    int64
+	presignTTL  time.Duration
 }
 
-func NewPhotoService(repo domain.PhotoRepository) *PhotoService {
-	return &PhotoService{repo: repo}
+func NewPhotoService(
+	repo domain.PhotoRepository,
+	blobs domain.BlobStore,
+	derivatives *DerivativeService,
+	maxUploadBytes int64,
+	presignTTL time.Duration,
+) *PhotoService {
+	return &PhotoService{
+		repo:        repo,
+		blobs:       blobs,
+		derivatives: derivatives,
+		maxBytes:    maxUploadBytes,
+		presignTTL:  presignTTL,
+	}
 }
 
 type CreatePhotoInput struct {
@@ -34,7 +76,12 @@ type UpdatePhotoInput struct {
 	RenderedURL *string
 }
 
+// Create records a photo the booth stored itself, at URLs outside the
+// API's storage.
 func (s *PhotoService) Create(ctx context.Context, input CreatePhotoInput) (*domain.Photo, error) {
+	if s.stored(input.StorageURL) || (input.RenderedURL != nil && s.stored(*input.RenderedURL)) {
+		return nil, ErrStoredURL
+	}
 	entity := &domain.Photo{
 		ID:          uuid.NewString(),
 		SessionID:   input.SessionID,
@@ -50,6 +97,211 @@ func (s *PhotoService) Create(ctx context.Context, input CreatePhotoInput) (*dom
 	return entity, nil
 }
 
+type UploadPhotoInput struct {
+	SessionID   string
+	FrameID     *string
+	FilterID    *string
+	Composition map[string]any
+	// Size is the length of Body, or -1 when the client streams it without
+	// a known length.
+	Size int64
+	Body io.Reader
+}
+
+// Upload stores the original image and creates the photo pointing at it.
+// The MIME type is sniffed from the content rather than trusted from the
+// client, and the hash and size are measured while the body streams to
+// storage. The original is kept as sent, metadata and all; it is never
+// served publicly.
+func (s *PhotoService) Upload(ctx context.Context, input UploadPhotoInput) (*domain.Photo, error) {
+	if s.maxBytes > 0 && input.Size > s.maxBytes {
+		return nil, ErrUploadTooLarge
+	}
+	body := bufio.NewReaderSize(input.Body, metadataPeek)
+	head, err := body.Peek(metadataPeek)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	mimeType := http.DetectContentType(head)
+	ext, ok := uploadExtensions[mimeType]
+	if !ok {
+		return nil, ErrUnsupportedMedia
+	}
+
+	id := uuid.NewString()
+	key := domain.OriginalKey(input.SessionID, id, ext)
+	hash := sha256.New()
+	counter := &countingReader{r: body}
+	var reader io.Reader = io.TeeReader(counter, hash)
+	if s.maxBytes > 0 {
+		// Read one byte past the limit so an oversized stream is detected
+		// instead of silently truncated.
+		reader = io.LimitReader(reader, s.maxBytes+1)
+	}
+	if err := s.blobs.Put(ctx, key, reader, input.Size, mimeType); err != nil {
+		return nil, err
+	}
+	if s.maxBytes > 0 && counter.n > s.maxBytes {
+		_ = s.blobs.Delete(ctx, key)
+		return nil, ErrUploadTooLarge
+	}
+
+	contentHash := hex.EncodeToString(hash.Sum(nil))
+	size := counter.n
+	metadata := photoMetadata(head)
+	entity := &domain.Photo{
+		ID:          id,
+		SessionID:   input.SessionID,
+		FrameID:     input.FrameID,
+		FilterID:    input.FilterID,
+		Composition: input.Composition,
+		StorageKey:  &key,
+		ContentHash: &contentHash,
+		SizeBytes:   &size,
+		MimeType:    &mimeType,
+		Metadata:    metadata,
+	}
+	if err := s.repo.Create(ctx, entity); err != nil {
+		_ = s.blobs.Delete(ctx, key)
+		return nil, err
+	}
+	s.derivatives.Schedule(entity.ID)
+	return entity, nil
+}
+
+type PresignPhotoInput struct {
+	SessionID   string
+	ContentType string
+}
+
+// PhotoUpload tells a booth where to PUT a photo it uploads directly to
+// storage. UploadID is the ID the photo gets once the upload is finalized.
+type PhotoUpload struct {
+	UploadID  string
+	Key       string
+	URL       string
+	Method    string
+	Headers   map[string]string
+	MaxBytes  int64
+	ExpiresAt time.Time
+}
+
+// PresignUpload reserves a storage key for a session photo and returns a
+// pre-signed URL the booth can upload it to without going through the API.
+// Nothing is recorded until FinalizeUpload confirms the file arrived.
+func (s *PhotoService) PresignUpload(ctx context.Context, input PresignPhotoInput) (*PhotoUpload, error) {
+	ext, ok := uploadExtensions[input.ContentType]
+	if !ok {
+		return nil, ErrUnsupportedMedia
+	}
+	id := uuid.NewString()
+	key := domain.OriginalKey(input.SessionID, id, ext)
+	url, err := s.blobs.PresignPut(ctx, key, input.ContentType, s.presignTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &PhotoUpload{
+		UploadID:  id,
+		Key:       key,
+		URL:       url,
+		Method:    "PUT",
+		Headers:   map[string]string{"Content-Type": input.ContentType},
+		MaxBytes:  s.maxBytes,
+		ExpiresAt: time.Now().Add(s.presignTTL),
+	}, nil
+}
+
+type FinalizePhotoInput struct {
+	UploadID    string
+	SessionID   string
+	ContentType string
+	// ContentHash is the hex SHA-256 of the file as the booth sent it.
+	ContentHash string
+	FrameID     *string
+	FilterID    *string
+	Composition map[string]any
+}
+
+// FinalizeUpload checks a directly uploaded file and creates its photo. The
+// file is read back from storage to confirm its type and checksum; a file
+// that fails either check, or is over the size limit, is deleted so the
+// booth can request a new URL and try again.
+func (s *PhotoService) FinalizeUpload(ctx context.Context, input FinalizePhotoInput) (*domain.Photo, error) {
+	if _, err := uuid.Parse(input.UploadID); err != nil {
+		return nil, ErrInvalidUploadID
+	}
+	ext, ok := uploadExtensions[input.ContentType]
+	if !ok {
+		return nil, ErrUnsupportedMedia
+	}
+	key := domain.OriginalKey(input.SessionID, input.UploadID, ext)
+	info, err := s.blobs.Stat(ctx, key)
+	if errors.Is(err, domain.ErrBlobNotFound) {
+		return nil, ErrUploadMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.maxBytes > 0 && info.Size > s.maxBytes {
+		_ = s.blobs.Delete(ctx, key)
+		return nil, ErrUploadTooLarge
+	}
+
+	mimeType, contentHash, metadata, err := s.inspect(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType != input.ContentType {
+		_ = s.blobs.Delete(ctx, key)
+		return nil, ErrUnsupportedMedia
+	}
+	if !strings.EqualFold(contentHash, input.ContentHash) {
+		_ = s.blobs.Delete(ctx, key)
+		return nil, ErrChecksumMismatch
+	}
+
+	size := info.Size
+	entity := &domain.Photo{
+		ID:          input.UploadID,
+		SessionID:   input.SessionID,
+		FrameID:     input.FrameID,
+		FilterID:    input.FilterID,
+		Composition: input.Composition,
+		StorageKey:  &key,
+		ContentHash: &contentHash,
+		SizeBytes:   &size,
+		MimeType:    &mimeType,
+		Metadata:    metadata,
+	}
+	if err := s.repo.Create(ctx, entity); err != nil {
+		return nil, err
+	}
+	s.derivatives.Schedule(entity.ID)
+	return entity, nil
+}
+
+// inspect reads a stored object back and returns its sniffed MIME type, hex
+// SHA-256 and metadata.
+func (s *PhotoService) inspect(ctx context.Context, key string) (string, string, *domain.PhotoMetadata, error) {
+	body, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer body.Close()
+	reader := bufio.NewReaderSize(body, metadataPeek)
+	head, err := reader.Peek(metadataPeek)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", "", nil, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", "", nil, err
+	}
+	return http.DetectContentType(head), hex.EncodeToString(hash.Sum(nil)), photoMetadata(head), nil
+}
+
+// Update refuses new URLs into the API's storage, but lets a booth send
+// back the URLs the photo already has.
 func (s *PhotoService) Update(ctx context.Context, input UpdatePhotoInput) (*domain.Photo, error) {
 	entity, err := s.repo.GetByID(ctx, input.ID)
 	if err != nil {
@@ -61,13 +313,19 @@ func (s *PhotoService) Update(ctx context.Context, input UpdatePhotoInput) (*dom
 	if input.FilterID != nil {
 		entity.FilterID = input.FilterID
 	}
-	if input.StorageURL != nil {
+	if input.StorageURL != nil && *input.StorageURL != entity.StorageURL {
+		if s.stored(*input.StorageURL) {
+			return nil, ErrStoredURL
+		}
 		entity.StorageURL = *input.StorageURL
 	}
 	if input.Composition != nil {
 		entity.Composition = input.Composition
 	}
-	if input.RenderedURL != nil {
+	if input.RenderedURL != nil && (entity.RenderedURL == nil || *input.RenderedURL != *entity.RenderedURL) {
+		if s.stored(*input.RenderedURL) {
+			return nil, ErrStoredURL
+		}
 		entity.RenderedURL = input.RenderedURL
 	}
 	if err := s.repo.Update(ctx, entity); err != nil {
@@ -76,8 +334,37 @@ func (s *PhotoService) Update(ctx context.Context, input UpdatePhotoInput) (*dom
 	return entity, nil
 }
 
+// stored reports whether url points into the blob store. The API tracks
+// its own files by key, so a client naming one could only be reaching for
+// a file it was not given, such as another session's original.
+func (s *PhotoService) stored(url string) bool {
+	return strings.HasPrefix(url, s.blobs.URL(""))
+}
+
+// Delete removes the photo and any files the API stored for it.
 func (s *PhotoService) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+	entity, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	var keys []string
+	for _, key := range []*string{entity.StorageKey, entity.RenderedKey} {
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	for _, d := range entity.Derivatives {
+		keys = append(keys, d.Key)
+	}
+	for _, key := range keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *PhotoService) Get(ctx context.Context, id string) (*domain.Photo, error) {
@@ -87,3 +374,14 @@ func (s *PhotoService) Get(ctx context.Context, id string) (*domain.Photo, error
 func (s *PhotoService) ListBySession(ctx context.Context, sessionID string) ([]domain.Photo, error) {
 	return s.repo.ListBySession(ctx, sessionID)
 }
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,348 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	domainBranch "go-ddd-clean/internal/domain/branch"
+	domain "go-ddd-clean/internal/domain/media"
+)
+
+const purgePageSize = 200
+
+// PurgeService deletes media once it is older than its branch keeps it.
+// Rows stay, marked as purged, so history and reports still add up; only
+// the files go.
+type PurgeService struct {
+	branches   domainBranch.Repository
+	photos     domain.PhotoRepository
+	animations domain.AnimationRepository
+	qrcodes    domain.QRCodeRepository
+	blobs      domain.BlobStore
+}
+
+func NewPurgeService(
+	branches domainBranch.Repository,
+	photos domain.PhotoRepository,
+	animations domain.AnimationRepository,
+	qrcodes domain.QRCodeRepository,
+	blobs domain.BlobStore,
+) *PurgeService {
+	return &PurgeService{
+		branches:   branches,
+		photos:     photos,
+		animations: animations,
+		qrcodes:    qrcodes,
+		blobs:      blobs,
+	}
+}
+
+type PurgeReport struct {
+	DryRun   bool
+	Branches []BranchPurgeReport
+}
+
+// BranchPurgeReport covers one branch with a retention policy. A dry run
+// counts what would be deleted; it marks nothing, so QRCodes stays 0.
+type BranchPurgeReport struct {
+	BranchID   string
+	BranchName string
+	Originals  PurgeCount
+	Rendered   PurgeCount
+	Animations PurgeCount
+	QRCodes    int
+	// Failures are items whose files could not be deleted. They are left
+	// as they were and retried on the next run.
+	Failures []string
+}
+
+// PurgeCount counts purged items and the stored files and bytes they
+// freed. Derivatives go with the file they were built from.
+type PurgeCount struct {
+	Items int
+	Files int
+	Bytes int64
+}
+
+// Run purges every branch's media that is past its retention at now.
+// Composites go before originals so a photo whose files are both due is
+// seen as fully purged. Animations are made from originals and go with
+// them.
+//
+// QR codes are marked purged once nothing they show is left: those of
+// each fully purged photo or animation, and those of sessions with no
+// media left. Share pages answer 410 Gone for them.
+func (s *PurgeService) Run(ctx context.Context, now time.Time, dryRun bool) (*PurgeReport, error) {
+	branches, err := s.branches.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &PurgeReport{DryRun: dryRun, Branches: []BranchPurgeReport{}}
+	for _, b := range branches {
+		if b.OriginalRetentionDays == nil && b.RenderedRetentionDays == nil {
+			continue
+		}
+		run := &purgeRun{
+			PurgeService: s,
+			now:          now,
+			dryRun:       dryRun,
+			report:       BranchPurgeReport{BranchID: b.ID, BranchName: b.Name, Failures: []string{}},
+			sessions:     map[string]bool{},
+		}
+		if days := b.RenderedRetentionDays; days != nil {
+			if err := run.purgePhotos(ctx, b.ID, domain.SourceRendered, retentionCutoff(now, *days)); err != nil {
+				return nil, err
+			}
+		}
+		if days := b.OriginalRetentionDays; days != nil {
+			cutoff := retentionCutoff(now, *days)
+			if err := run.purgePhotos(ctx, b.ID, domain.SourceOriginal, cutoff); err != nil {
+				return nil, err
+			}
+			if err := run.purgeAnimations(ctx, b.ID, cutoff); err != nil {
+				return nil, err
+			}
+		}
+		if err := run.markQRCodes(ctx); err != nil {
+			return nil, err
+		}
+		report.Branches = append(report.Branches, run.report)
+	}
+	return report, nil
+}
+
+func retentionCutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+// purgeRun is the state of purging one branch.
+type purgeRun struct {
+	*PurgeService
+	now    time.Time
+	dryRun bool
+	report BranchPurgeReport
+
+	purgedPhotos     []string
+	purgedAnimations []string
+	// sessions are those with media purged in this run, in the order
+	// met, to check for session QR codes with nothing left.
+	sessions     map[string]bool
+	sessionOrder []string
+}
+
+// purgePhotos purges the source file of the branch's photos taken before
+// cutoff. Pages are read from the start each time on real runs, since
+// purged photos drop out of the listing; failures and dry runs are
+// skipped past instead.
+func (r *purgeRun) purgePhotos(ctx context.Context, branchID string, source domain.DerivativeSource, cutoff time.Time) error {
+	count := &r.report.Originals
+	if source == domain.SourceRendered {
+		count = &r.report.Rendered
+	}
+	offset := 0
+	for {
+		page, err := r.photos.ListPurgeable(ctx, branchID, source, cutoff, offset, purgePageSize)
+		if err != nil {
+			return err
+		}
+		for i := range page {
+			photo := &page[i]
+			files, kept := photoFiles(photo, source)
+			n, size, err := r.deleteFiles(ctx, files)
+			if err != nil {
+				r.report.Failures = append(r.report.Failures, fmt.Sprintf("photo %s %s: %v", photo.ID, source, err))
+				offset++
+				continue
+			}
+			count.Items++
+			count.Files += n
+			count.Bytes += size
+			if r.dryRun {
+				offset++
+				continue
+			}
+			if err := r.photos.MarkPurged(ctx, photo.ID, source, r.now, kept); err != nil {
+				return err
+			}
+			if source == domain.SourceRendered {
+				photo.RenderedPurgedAt = &r.now
+			} else {
+				photo.OriginalPurgedAt = &r.now
+			}
+			if photo.Purged() {
+				r.purgedPhotos = append(r.purgedPhotos, photo.ID)
+			}
+			r.touch(photo.SessionID)
+		}
+		if len(page) < purgePageSize {
+			return nil
+		}
+	}
+}
+
+func (r *purgeRun) purgeAnimations(ctx context.Context, branchID string, cutoff time.Time) error {
+	offset := 0
+	for {
+		page, err := r.animations.ListPurgeable(ctx, branchID, cutoff, offset, purgePageSize)
+		if err != nil {
+			return err
+		}
+		for _, a := range page {
+			n, size, err := r.deleteFiles(ctx, []storedFile{{key: &a.Key, url: a.URL, size: a.SizeBytes}})
+			if err != nil {
+				r.report.Failures = append(r.report.Failures, fmt.Sprintf("animation %s: %v", a.ID, err))
+				offset++
+				continue
+			}
+			r.report.Animations.Items++
+			r.report.Animations.Files += n
+			r.report.Animations.Bytes += size
+			if r.dryRun {
+				offset++
+				continue
+			}
+			if err := r.animations.MarkPurged(ctx, a.ID, r.now); err != nil {
+				return err
+			}
+			r.purgedAnimations = append(r.purgedAnimations, a.ID)
+			r.touch(a.SessionID)
+		}
+		if len(page) < purgePageSize {
+			return nil
+		}
+	}
+}
+
+func (r *purgeRun) touch(sessionID string) {
+	if !r.sessions[sessionID] {
+		r.sessions[sessionID] = true
+		r.sessionOrder = append(r.sessionOrder, sessionID)
+	}
+}
+
+func (r *purgeRun) markQRCodes(ctx context.Context) error {
+	if r.dryRun {
+		return nil
+	}
+	var emptied []string
+	for _, id := range r.sessionOrder {
+		empty, err := r.sessionPurged(ctx, id)
+		if err != nil {
+			return err
+		}
+		if empty {
+			emptied = append(emptied, id)
+		}
+	}
+	for _, marks := range []struct {
+		target domain.QRTarget
+		ids    []string
+	}{
+		{domain.QRTargetPhoto, r.purgedPhotos},
+		{domain.QRTargetAnimation, r.purgedAnimations},
+		{domain.QRTargetSession, emptied},
+	} {
+		n, err := r.qrcodes.MarkPurged(ctx, marks.target, marks.ids, r.now)
+		if err != nil {
+			return err
+		}
+		r.report.QRCodes += n
+	}
+	return nil
+}
+
+func (r *purgeRun) sessionPurged(ctx context.Context, sessionID string) (bool, error) {
+	photos, err := r.photos.ListBySession(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range photos {
+		if !p.Purged() {
+			return false, nil
+		}
+	}
+	animations, err := r.animations.ListBySession(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range animations {
+		if a.PurgedAt == nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// storedFile is a file to delete; size is -1 when it is not recorded.
+type storedFile struct {
+	key  *string
+	url  string
+	size int64
+}
+
+// photoFiles lists the photo's source file with the derivatives built
+// from it, and returns the derivatives to keep.
+func photoFiles(photo *domain.Photo, source domain.DerivativeSource) ([]storedFile, map[domain.DerivativeKind]domain.Derivative) {
+	var files []storedFile
+	if source == domain.SourceRendered {
+		files = append(files, storedFile{key: photo.RenderedKey, url: *photo.RenderedURL, size: -1})
+	} else {
+		size := int64(-1)
+		if photo.SizeBytes != nil {
+			size = *photo.SizeBytes
+		}
+		files = append(files, storedFile{key: photo.StorageKey, url: photo.StorageURL, size: size})
+	}
+	kept := map[domain.DerivativeKind]domain.Derivative{}
+	for kind, d := range photo.Derivatives {
+		if d.Source != source {
+			kept[kind] = d
+			continue
+		}
+		files = append(files, storedFile{key: &d.Key, url: d.URL, size: d.Size})
+	}
+	return files, kept
+}
+
+// deleteFiles deletes the files the store holds and returns how many it
+// found and their size. Files elsewhere, such as composites booths
+// uploaded to their own storage, cannot be deleted from here and are
+// skipped. Dry runs only measure.
+func (r *purgeRun) deleteFiles(ctx context.Context, files []storedFile) (int, int64, error) {
+	count, total := 0, int64(0)
+	for _, f := range files {
+		key, ok := r.storedKey(f)
+		if !ok {
+			continue
+		}
+		size := f.size
+		if size < 0 {
+			info, err := r.blobs.Stat(ctx, key)
+			if errors.Is(err, domain.ErrBlobNotFound) {
+				continue
+			}
+			if err != nil {
+				return count, total, err
+			}
+			size = info.Size
+		}
+		if !r.dryRun {
+			if err := r.blobs.Delete(ctx, key); err != nil {
+				return count, total, err
+			}
+		}
+		count++
+		total += size
+	}
+	return count, total, nil
+}
+
+func (r *purgeRun) storedKey(f storedFile) (string, bool) {
+	if f.key != nil {
+		return *f.key, true
+	}
+	return strings.CutPrefix(f.url, r.blobs.URL(""))
+}
@@ -2,44 +2,378 @@ package media
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	domain "go-ddd-clean/internal/domain/media"
 
 	"github.com/google/uuid"
+	qrcode "github.com/skip2/go-qrcode"
 )
 
+var (
+	ErrQRCodeTarget  = errors.New("qr code must point at exactly one of photo_id, animation_id, session_id or album")
+	ErrInvalidAlbum  = errors.New("invalid album")
+	ErrInvalidPIN    = errors.New("pin must be 4 to 8 digits and phone must end in 4 digits; give at most one")
+	ErrInvalidQRSize = errors.New("qr image size is out of range")
+	ErrWrongPIN      = errors.New("wrong pin")
+	ErrQRCodeLocked  = errors.New("too many wrong pins; try again later")
+)
+
+const (
+	// hashBytes is the randomness in a share hash; 128 bits cannot be
+	// guessed.
+	hashBytes = 16
+
+	minQRImageSize = 64
+	maxQRImageSize = 2048
+
+	maxAlbumItems = 50
+
+	// A four-digit PIN falls to guessing without a lock: after
+	// maxUnlockAttempts wrong tries the code refuses more for unlockLockout.
+	maxUnlockAttempts = 5
+	unlockLockout     = 15 * time.Minute
+)
+
+var pinPattern = regexp.MustCompile(`^[0-9]{4,8}$`)
+
 type QRCodeService struct {
-	repo domain.QRCodeRepository
+	repo         domain.QRCodeRepository
+	photos       domain.PhotoRepository
+	animations   domain.AnimationRepository
+	shareBaseURL string
+	defaultSize  int
 }
 
-func NewQRCodeService(repo domain.QRCodeRepository) *QRCodeService {
-	return &QRCodeService{repo: repo}
+// NewQRCodeService builds share URLs as shareBaseURL + "/" + hash and
+// renders images at defaultSize pixels unless asked otherwise.
+func NewQRCodeService(
+	repo domain.QRCodeRepository,
+	photos domain.PhotoRepository,
+	animations domain.AnimationRepository,
+	shareBaseURL string,
+	defaultSize int,
+) *QRCodeService {
+	return &QRCodeService{
+		repo:         repo,
+		photos:       photos,
+		animations:   animations,
+		shareBaseURL: strings.TrimRight(shareBaseURL, "/"),
+		defaultSize:  defaultSize,
+	}
 }
 
+// CreateQRCodeInput sets exactly one of PhotoID, AnimationID, SessionID
+// and Album. A PIN, or a phone number whose last four digits become the
+// PIN, protects the share page.
 type CreateQRCodeInput struct {
-	PhotoID  string
-	Hash     string
-	ExpireAt *time.Time
+	PhotoID     *string
+	AnimationID *string
+	SessionID   *string
+	Album       []domain.MediaRef
+	ExpireAt    *time.Time
+	PIN         *string
+	Phone       *string
 }
 
+// Create stores a QR code with a fresh random hash.
 func (s *QRCodeService) Create(ctx context.Context, input CreateQRCodeInput) (*domain.QRCode, error) {
+	targets := 0
+	for _, set := range []bool{input.PhotoID != nil, input.AnimationID != nil, input.SessionID != nil, len(input.Album) > 0} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return nil, ErrQRCodeTarget
+	}
+	if err := s.validateAlbum(ctx, input.Album); err != nil {
+		return nil, err
+	}
+	hash, err := newShareHash()
+	if err != nil {
+		return nil, err
+	}
 	entity := &domain.QRCode{
-		ID:       uuid.NewString(),
-		PhotoID:  input.PhotoID,
-		Hash:     input.Hash,
-		ExpireAt: input.ExpireAt,
+		ID:          uuid.NewString(),
+		PhotoID:     input.PhotoID,
+		AnimationID: input.AnimationID,
+		SessionID:   input.SessionID,
+		Album:       input.Album,
+		Hash:        hash,
+		ExpireAt:    input.ExpireAt,
+	}
+	if err := protect(entity, input.PIN, input.Phone); err != nil {
+		return nil, err
 	}
 	if err := s.repo.Create(ctx, entity); err != nil {
 		return nil, err
 	}
+	entity.ShareURL = s.shareURL(hash)
 	return entity, nil
 }
 
+// validateAlbum checks that every item exists, since album entries have no
+// foreign keys.
+func (s *QRCodeService) validateAlbum(ctx context.Context, album []domain.MediaRef) error {
+	if len(album) > maxAlbumItems {
+		return fmt.Errorf("%w: at most %d items", ErrInvalidAlbum, maxAlbumItems)
+	}
+	for i, ref := range album {
+		if ref.Kind != domain.MediaPhoto && ref.Kind != domain.MediaAnimation {
+			return fmt.Errorf("%w: item %d kind must be %s or %s", ErrInvalidAlbum, i, domain.MediaPhoto, domain.MediaAnimation)
+		}
+	}
+	photos, animations, err := loadMedia(ctx, s.photos, s.animations, album)
+	if err != nil {
+		return err
+	}
+	for i, ref := range album {
+		_, isPhoto := photos[ref.ID]
+		_, isAnimation := animations[ref.ID]
+		if (ref.Kind == domain.MediaPhoto && !isPhoto) || (ref.Kind == domain.MediaAnimation && !isAnimation) {
+			return fmt.Errorf("%w: item %d %s %s not found", ErrInvalidAlbum, i, ref.Kind, ref.ID)
+		}
+	}
+	return nil
+}
+
+// loadMedia fetches the photos and animations refs name that still exist,
+// keyed by ID.
+func loadMedia(
+	ctx context.Context,
+	photoRepo domain.PhotoRepository,
+	animationRepo domain.AnimationRepository,
+	refs []domain.MediaRef,
+) (map[string]*domain.Photo, map[string]*domain.Animation, error) {
+	var photoIDs, animationIDs []string
+	for _, ref := range refs {
+		switch ref.Kind {
+		case domain.MediaPhoto:
+			photoIDs = append(photoIDs, ref.ID)
+		case domain.MediaAnimation:
+			animationIDs = append(animationIDs, ref.ID)
+		}
+	}
+	photos, err := photoRepo.ListByIDs(ctx, photoIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	animations, err := animationRepo.ListByIDs(ctx, animationIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	photoByID := make(map[string]*domain.Photo, len(photos))
+	for i := range photos {
+		photoByID[photos[i].ID] = &photos[i]
+	}
+	animationByID := make(map[string]*domain.Animation, len(animations))
+	for i := range animations {
+		animationByID[animations[i].ID] = &animations[i]
+	}
+	return photoByID, animationByID, nil
+}
+
+// protect sets the code's PIN from pin or from the last four digits of
+// phone.
+func protect(code *domain.QRCode, pin *string, phone *string) error {
+	if pin != nil && phone != nil {
+		return ErrInvalidPIN
+	}
+	switch {
+	case pin != nil:
+		code.Protection = domain.QRProtectPIN
+	case phone != nil:
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, *phone)
+		if len(digits) < 4 {
+			return ErrInvalidPIN
+		}
+		last4 := digits[len(digits)-4:]
+		pin = &last4
+		code.Protection = domain.QRProtectPhone
+	default:
+		return nil
+	}
+	if !pinPattern.MatchString(*pin) {
+		return ErrInvalidPIN
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	code.PINSalt = hex.EncodeToString(salt)
+	code.PINHash = pinHash(code.PINSalt, *pin)
+	return nil
+}
+
+func pinHash(salt string, pin string) string {
+	sum := sha256.Sum256([]byte(salt + pin))
+	return hex.EncodeToString(sum[:])
+}
+
+// Unlock checks pin against a protected code and returns the token that
+// Authorized accepts. Unprotected codes need no token and return "".
+func (s *QRCodeService) Unlock(ctx context.Context, hash string, pin string) (string, error) {
+	code, err := s.GetByHash(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	if code.Protection == domain.QRUnprotected {
+		return "", nil
+	}
+	now := time.Now()
+	if code.LockedUntil != nil && now.Before(*code.LockedUntil) {
+		return "", ErrQRCodeLocked
+	}
+	if subtle.ConstantTimeCompare([]byte(pinHash(code.PINSalt, pin)), []byte(code.PINHash)) != 1 {
+		if err := s.repo.RecordFailedUnlock(ctx, code.ID, maxUnlockAttempts, now.Add(unlockLockout)); err != nil {
+			return "", err
+		}
+		return "", ErrWrongPIN
+	}
+	if code.FailedUnlocks > 0 || code.LockedUntil != nil {
+		if err := s.repo.ResetFailedUnlocks(ctx, code.ID); err != nil {
+			return "", err
+		}
+	}
+	return unlockToken(code), nil
+}
+
+// Authorized reports whether token opens the code. Tokens are keyed by
+// the PIN hash, so they cannot be made without the database and stop
+// working if the PIN changes.
+func (s *QRCodeService) Authorized(code *domain.QRCode, token string) bool {
+	if code.Protection == domain.QRUnprotected {
+		return true
+	}
+	return hmac.Equal([]byte(token), []byte(unlockToken(code)))
+}
+
+func unlockToken(code *domain.QRCode) string {
+	mac := hmac.New(sha256.New, []byte(code.PINHash))
+	mac.Write([]byte(code.Hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CountDownload adds one to the code's download counter.
+func (s *QRCodeService) CountDownload(ctx context.Context, code *domain.QRCode) error {
+	return s.repo.IncrementDownloads(ctx, code.ID)
+}
+
+// GetByHash returns domain.ErrQRCodeExpired once the code's ExpireAt has
+// passed and domain.ErrMediaPurged once the retention job has deleted
+// what it shows.
 func (s *QRCodeService) GetByHash(ctx context.Context, hash string) (*domain.QRCode, error) {
-	return s.repo.GetByHash(ctx, hash)
+	entity, err := s.repo.GetByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if entity.Expired(time.Now()) {
+		return nil, domain.ErrQRCodeExpired
+	}
+	if entity.PurgedAt != nil {
+		return nil, domain.ErrMediaPurged
+	}
+	entity.ShareURL = s.shareURL(entity.Hash)
+	return entity, nil
+}
+
+// Get returns the code with the given ID, expired or purged alike, for
+// the booth that made it.
+func (s *QRCodeService) Get(ctx context.Context, id string) (*domain.QRCode, error) {
+	entity, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entity.ShareURL = s.shareURL(entity.Hash)
+	return entity, nil
 }
 
 func (s *QRCodeService) Delete(ctx context.Context, id string) error {
 	return s.repo.Delete(ctx, id)
 }
+
+// PNG renders the QR code's share URL as a square PNG of size pixels; 0
+// means the configured default.
+func (s *QRCodeService) PNG(ctx context.Context, hash string, size int) ([]byte, error) {
+	code, size, err := s.encode(ctx, hash, size)
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(size)
+}
+
+// SVG renders the QR code's share URL as an SVG document that is size
+// pixels square. Dark modules are drawn as one path, merged along rows.
+func (s *QRCodeService) SVG(ctx context.Context, hash string, size int) ([]byte, error) {
+	code, size, err := s.encode(ctx, hash, size)
+	if err != nil {
+		return nil, err
+	}
+	bitmap := code.Bitmap()
+	n := len(bitmap)
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < n; {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < n && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="%s"/></svg>`,
+		size, size, n, n, n, n, path.String())
+	return []byte(svg), nil
+}
+
+func (s *QRCodeService) encode(ctx context.Context, hash string, size int) (*qrcode.QRCode, int, error) {
+	if size == 0 {
+		size = s.defaultSize
+	}
+	if size < minQRImageSize || size > maxQRImageSize {
+		return nil, 0, fmt.Errorf("%w: size must be between %d and %d", ErrInvalidQRSize, minQRImageSize, maxQRImageSize)
+	}
+	entity, err := s.GetByHash(ctx, hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	code, err := qrcode.New(entity.ShareURL, qrcode.Medium)
+	if err != nil {
+		return nil, 0, err
+	}
+	return code, size, nil
+}
+
+func (s *QRCodeService) shareURL(hash string) string {
+	return s.shareBaseURL + "/" + hash
+}
+
+// newShareHash returns a random URL-safe token.
+func newShareHash() (string, error) {
+	b := make([]byte, hashBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
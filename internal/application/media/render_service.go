@@ -0,0 +1,273 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"sync"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/media"
+
+	// image/draw only copies pixels one to one; x/image/draw adds the
+	// scalers needed to fit shots into slots.
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrNoFrame          = errors.New("photo has no frame to render")
+	ErrFrameHasNoSlots  = errors.New("frame has no photo slots")
+	ErrShotOutOfSession = errors.New("composition shots must belong to the photo's session")
+)
+
+const (
+	renderQuality  = 92
+	previewQuality = 80
+	// previewMaxSize is the longest edge of a filter preview, in pixels.
+	previewMaxSize = 800
+)
+
+// RenderService draws a photo's shots into its frame on the server, for
+// booths that cannot render themselves and for reprints.
+type RenderService struct {
+	photos  domain.PhotoRepository
+	frames  domain.FrameRepository
+	filters domain.FilterRepository
+	blobs   domain.BlobStore
+	// source loads frames and LUTs and never opens originals; only shots,
+	// which reads the photos being rendered, does.
+	source *imageSource
+	shots  *imageSource
+	derivs *DerivativeService
+	marks  *WatermarkService
+
+	// luts caches parsed lookup tables by URL; filters share a handful.
+	mu   sync.Mutex
+	luts map[string]*lut
+}
+
+func NewRenderService(
+	photos domain.PhotoRepository,
+	frames domain.FrameRepository,
+	filters domain.FilterRepository,
+	blobs domain.BlobStore,
+	fetchHosts []string,
+	derivatives *DerivativeService,
+	watermarks *WatermarkService,
+) *RenderService {
+	source := newImageSource(blobs, fetchHosts)
+	return &RenderService{
+		photos:  photos,
+		frames:  frames,
+		filters: filters,
+		blobs:   blobs,
+		source:  source,
+		shots:   source.withOriginals(),
+		derivs:  derivatives,
+		marks:   watermarks,
+		luts:    map[string]*lut{},
+	}
+}
+
+// Render composites the photo and stores the result as its RenderedURL.
+//
+// The shots are the photo IDs listed in Composition["shots"], in slot
+// order; without that list the photo's own original fills every slot. When
+// there are fewer shots than slots they repeat, which is how single-shot
+// strips are printed. The photo's filter, if any, is applied to the shots
+// but not to the frame. See composite for how the layout is drawn. Sessions
+// that carry a watermark get it drawn over the finished composite.
+func (s *RenderService) Render(ctx context.Context, photoID string) (*domain.Photo, error) {
+	photo, err := s.photos.GetByID(ctx, photoID)
+	if err != nil {
+		return nil, err
+	}
+	if photo.FrameID == nil {
+		return nil, ErrNoFrame
+	}
+	frame, err := s.frames.GetByID(ctx, *photo.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	if frame.Template == nil || len(frame.Template.Slots) == 0 {
+		return nil, ErrFrameHasNoSlots
+	}
+	shots, err := s.loadShots(ctx, photo)
+	if err != nil {
+		return nil, err
+	}
+	if photo.FilterID != nil {
+		effect, table, err := s.effect(ctx, *photo.FilterID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range shots {
+			shots[i] = applyEffect(shots[i], effect, table)
+		}
+	}
+	frameImage, err := s.source.decode(ctx, nil, frame.FileURL)
+	if err != nil {
+		return nil, fmt.Errorf("load frame: %w", err)
+	}
+
+	canvas, err := composite(frameImage, frame.Template, shots, photo.CreatedAt.In(time.Local))
+	if err != nil {
+		return nil, err
+	}
+	watermark, err := s.marks.ForSession(ctx, photo.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if watermark != nil {
+		if err := s.marks.Stamp(ctx, canvas, watermark); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: renderQuality}); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("sessions/%s/rendered/%s.jpg", photo.SessionID, photo.ID)
+	if err := s.blobs.Put(ctx, key, &buf, int64(buf.Len()), "image/jpeg"); err != nil {
+		return nil, err
+	}
+	renderedURL := s.blobs.URL(key)
+	photo.RenderedURL = &renderedURL
+	photo.RenderedKey = &key
+	photo.Watermarked = watermark != nil
+	if err := s.photos.Update(ctx, photo); err != nil {
+		return nil, err
+	}
+	s.derivs.Schedule(photo.ID)
+	return photo, nil
+}
+
+// Preview returns a small JPEG of the photo's original with the filter
+// applied, so booths can show filter choices before rendering.
+func (s *RenderService) Preview(ctx context.Context, photoID string, filterID string) ([]byte, error) {
+	photo, err := s.photos.GetByID(ctx, photoID)
+	if err != nil {
+		return nil, err
+	}
+	effect, table, err := s.effect(ctx, filterID)
+	if err != nil {
+		return nil, err
+	}
+	img, err := s.shots.decode(ctx, photo.StorageKey, photo.StorageURL)
+	if err != nil {
+		return nil, err
+	}
+	preview := applyEffect(fit(img, previewMaxSize), effect, table)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, preview, &jpeg.Options{Quality: previewQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// effect loads a filter's effect and its lookup table.
+func (s *RenderService) effect(ctx context.Context, filterID string) (domain.Effect, *lut, error) {
+	filter, err := s.filters.GetByID(ctx, filterID)
+	if err != nil {
+		return domain.Effect{}, nil, err
+	}
+	effect, err := domain.ParseEffect(filter.Effect)
+	if err != nil {
+		return domain.Effect{}, nil, err
+	}
+	if effect.LUT == nil {
+		return effect, nil, nil
+	}
+	table, err := s.lut(ctx, *effect.LUT)
+	if err != nil {
+		return domain.Effect{}, nil, fmt.Errorf("load lut: %w", err)
+	}
+	return effect, table, nil
+}
+
+func (s *RenderService) lut(ctx context.Context, url string) (*lut, error) {
+	s.mu.Lock()
+	table, ok := s.luts[url]
+	s.mu.Unlock()
+	if ok {
+		return table, nil
+	}
+	body, err := s.source.open(ctx, nil, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	table, err = parseCube(io.LimitReader(body, maxSourceBytes))
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.luts[url] = table
+	s.mu.Unlock()
+	return table, nil
+}
+
+func (s *RenderService) loadShots(ctx context.Context, photo *domain.Photo) ([]image.Image, error) {
+	ids := compositionShots(photo.Composition)
+	if len(ids) == 0 {
+		ids = []string{photo.ID}
+	}
+	shots := make([]image.Image, 0, len(ids))
+	for _, id := range ids {
+		shot := photo
+		if id != photo.ID {
+			var err error
+			shot, err = s.photos.GetByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if shot.SessionID != photo.SessionID {
+				return nil, ErrShotOutOfSession
+			}
+		}
+		img, err := s.shots.decode(ctx, shot.StorageKey, shot.StorageURL)
+		if err != nil {
+			return nil, fmt.Errorf("load shot %s: %w", id, err)
+		}
+		shots = append(shots, img)
+	}
+	return shots, nil
+}
+
+// fit scales img down so its longest edge is at most size. Smaller images
+// are returned as they are.
+func fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= size && b.Dy() <= size {
+		return img
+	}
+	w, h := size, b.Dy()*size/b.Dx()
+	if b.Dy() > b.Dx() {
+		w, h = b.Dx()*size/b.Dy(), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// compositionShots reads the ordered shot photo IDs from a composition.
+func compositionShots(composition map[string]any) []string {
+	raw, ok := composition["shots"].([]any)
+	if !ok {
+		return nil
+	}
+	ids := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if id, ok := v.(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
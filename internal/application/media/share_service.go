@@ -0,0 +1,242 @@
+package media
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/media"
+)
+
+// ShareService resolves QR hashes to what customers may see and download.
+type ShareService struct {
+	qrcodes    *QRCodeService
+	photos     domain.PhotoRepository
+	animations domain.AnimationRepository
+	// source never opens originals, whatever a share item names.
+	source *imageSource
+}
+
+func NewShareService(
+	qrcodes *QRCodeService,
+	photos domain.PhotoRepository,
+	animations domain.AnimationRepository,
+	blobs domain.BlobStore,
+) *ShareService {
+	return &ShareService{
+		qrcodes:    qrcodes,
+		photos:     photos,
+		animations: animations,
+		source:     newImageSource(blobs, nil),
+	}
+}
+
+// SharedItem is one file on a share page. ThumbURL and ViewURL are for
+// display and fall back to the full file when no smaller copy exists.
+type SharedItem struct {
+	Kind     domain.MediaKind
+	Name     string
+	ThumbURL string
+	ViewURL  string
+	// FileURL is the full-size file; key is its storage key when the API
+	// stored it.
+	FileURL string
+	key     *string
+}
+
+// Share is the content a QR code opens.
+type Share struct {
+	Code  *domain.QRCode
+	Items []SharedItem
+	// purged is set when media was left out because the retention job
+	// deleted it.
+	purged bool
+}
+
+// Resolve loads the share for hash. Expired codes return
+// domain.ErrQRCodeExpired, and codes whose media has all been purged
+// domain.ErrMediaPurged. Callers check protected codes with
+// QRCodeService.Authorized before showing the items.
+//
+// A session shows its rendered composites and then its animations; a
+// session with no composites shows its originals instead, so booths that
+// never render still share something. Albums keep their own order. A
+// photo whose composite has been purged falls back to its original.
+func (s *ShareService) Resolve(ctx context.Context, hash string) (*Share, error) {
+	code, err := s.qrcodes.GetByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	share := &Share{Code: code}
+	switch code.Target() {
+	case domain.QRTargetPhoto:
+		photo, err := s.photos.GetByID(ctx, *code.PhotoID)
+		if err != nil {
+			return nil, err
+		}
+		share.addPhoto(photo, hasComposite(photo))
+	case domain.QRTargetAnimation:
+		animation, err := s.animations.GetByID(ctx, *code.AnimationID)
+		if err != nil {
+			return nil, err
+		}
+		share.addAnimation(animation)
+	case domain.QRTargetSession:
+		if err := s.addSession(ctx, share, *code.SessionID); err != nil {
+			return nil, err
+		}
+	case domain.QRTargetAlbum:
+		if err := s.addAlbum(ctx, share, code.Album); err != nil {
+			return nil, err
+		}
+	}
+	if len(share.Items) == 0 && share.purged {
+		return nil, domain.ErrMediaPurged
+	}
+	return share, nil
+}
+
+func (s *ShareService) addSession(ctx context.Context, share *Share, sessionID string) error {
+	photos, err := s.photos.ListBySession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	animations, err := s.animations.ListBySession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	rendered := false
+	for i := range photos {
+		rendered = rendered || hasComposite(&photos[i])
+	}
+	for i := range photos {
+		if !rendered || hasComposite(&photos[i]) {
+			share.addPhoto(&photos[i], rendered)
+		}
+	}
+	for i := range animations {
+		share.addAnimation(&animations[i])
+	}
+	return nil
+}
+
+// addAlbum skips items deleted since the album was made.
+func (s *ShareService) addAlbum(ctx context.Context, share *Share, album []domain.MediaRef) error {
+	photos, animations, err := loadMedia(ctx, s.photos, s.animations, album)
+	if err != nil {
+		return err
+	}
+	for _, ref := range album {
+		switch ref.Kind {
+		case domain.MediaPhoto:
+			if photo, ok := photos[ref.ID]; ok {
+				share.addPhoto(photo, hasComposite(photo))
+			}
+		case domain.MediaAnimation:
+			if animation, ok := animations[ref.ID]; ok {
+				share.addAnimation(animation)
+			}
+		}
+	}
+	return nil
+}
+
+// hasComposite reports whether the photo has a composite that is still
+// kept.
+func hasComposite(p *domain.Photo) bool {
+	return p.RenderedURL != nil && p.RenderedPurgedAt == nil
+}
+
+// addPhoto adds the photo's composite when rendered is set and its
+// original otherwise, with derivatives of the same image for display.
+//
+// Originals are never served as uploaded: they may carry GPS positions and
+// device serials, and watermarks are only on copies. Their web copy, which
+// is re-encoded without metadata, stands in for them, so an original shows
+// up once its derivatives are built.
+func (s *Share) addPhoto(p *domain.Photo, rendered bool) {
+	if !rendered && p.OriginalPurgedAt != nil {
+		s.purged = true
+		return
+	}
+	var item SharedItem
+	source := domain.SourceOriginal
+	if rendered {
+		item = SharedItem{Kind: domain.MediaPhoto, FileURL: *p.RenderedURL, key: p.RenderedKey}
+		source = domain.SourceRendered
+	} else {
+		d, ok := p.Derivatives[domain.DerivativeWebJPEG]
+		if !ok || d.Source != source {
+			return
+		}
+		item = SharedItem{Kind: domain.MediaPhoto, FileURL: d.URL, key: &d.Key}
+	}
+	item.ViewURL, item.ThumbURL = item.FileURL, item.FileURL
+	if d, ok := p.Derivatives[domain.DerivativeWebJPEG]; ok && d.Source == source {
+		item.ViewURL = d.URL
+	}
+	if d, ok := p.Derivatives[domain.DerivativeThumb]; ok && d.Source == source {
+		item.ThumbURL = d.URL
+	}
+	item.Name = fmt.Sprintf("%02d-photo%s", len(s.Items)+1, fileExt(item.FileURL, ".jpg"))
+	s.Items = append(s.Items, item)
+}
+
+func (s *Share) addAnimation(a *domain.Animation) {
+	if a.PurgedAt != nil {
+		s.purged = true
+		return
+	}
+	s.Items = append(s.Items, SharedItem{
+		Kind:     domain.MediaAnimation,
+		Name:     fmt.Sprintf("%02d-%s.gif", len(s.Items)+1, a.Kind),
+		ThumbURL: a.URL,
+		ViewURL:  a.URL,
+		FileURL:  a.URL,
+		key:      &a.Key,
+	})
+}
+
+// Open returns the full-size file of one item.
+func (s *ShareService) Open(ctx context.Context, item SharedItem) (io.ReadCloser, error) {
+	return s.source.open(ctx, item.key, item.FileURL)
+}
+
+// WriteZip streams every item into a ZIP archive. Images are already
+// compressed, so entries are stored rather than deflated.
+func (s *ShareService) WriteZip(ctx context.Context, share *Share, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	now := time.Now()
+	for _, item := range share.Items {
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: item.Name, Method: zip.Store, Modified: now})
+		if err != nil {
+			return err
+		}
+		body, err := s.Open(ctx, item)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", item.Name, err)
+		}
+		_, err = io.Copy(entry, body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("copy %s: %w", item.Name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// fileExt returns the extension of a URL's path, or fallback when it has
+// none.
+func fileExt(url string, fallback string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	if ext := path.Ext(url); ext != "" && len(ext) <= 5 {
+		return strings.ToLower(ext)
+	}
+	return fallback
+}
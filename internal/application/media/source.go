@@ -0,0 +1,153 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/media"
+)
+
+const (
+	fetchTimeout = 30 * time.Second
+	// maxSourceBytes caps what is read for one image or LUT.
+	maxSourceBytes = 64 << 20
+	// maxSourcePixels caps an image's dimensions before it is decoded, so a
+	// small file claiming a huge size cannot exhaust memory.
+	maxSourcePixels = 50_000_000
+)
+
+var (
+	ErrSourceHost     = errors.New("asset URL is not in the blob store or an allowed host")
+	ErrSourceTooLarge = errors.New("image is too large to load")
+	ErrSourceOriginal = errors.New("originals can only be read by their photo's storage key")
+)
+
+// imageSource loads images from the blob store, or over HTTP for assets
+// such as frames and LUTs that live elsewhere. HTTP is only used for the
+// hosts it was given; with none it reads the blob store alone.
+//
+// Originals are refused unless the source was made withOriginals, and
+// even then only by key: a URL comes from a client, and could name any
+// session's original.
+type imageSource struct {
+	blobs     domain.BlobStore
+	hosts     []string
+	client    *http.Client
+	originals bool
+}
+
+func newImageSource(blobs domain.BlobStore, hosts []string) *imageSource {
+	s := &imageSource{
+		blobs: blobs,
+		hosts: hosts,
+	}
+	s.client = &http.Client{
+		Timeout: fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !s.allowed(req.URL) {
+				return ErrSourceHost
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+	return s
+}
+
+// withOriginals returns a copy of s that also opens originals by key, for
+// the services that build copies of them.
+func (s *imageSource) withOriginals() *imageSource {
+	copied := *s
+	copied.originals = true
+	return &copied
+}
+
+// decode loads an image from storage when its key is known or its URL
+// points into the blob store, and over HTTP otherwise. JPEGs are turned
+// upright by their EXIF orientation, so nothing built from them needs the
+// tag.
+func (s *imageSource) decode(ctx context.Context, key *string, url string) (image.Image, error) {
+	body, err := s.open(ctx, key, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxSourceBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSourceBytes {
+		return nil, ErrSourceTooLarge
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxSourcePixels {
+		return nil, ErrSourceTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := readEXIF(data); ok {
+		img = orient(img, info.orientation)
+	}
+	return img, nil
+}
+
+func (s *imageSource) open(ctx context.Context, key *string, url string) (io.ReadCloser, error) {
+	if key != nil {
+		if domain.IsOriginalKey(*key) && !s.originals {
+			return nil, ErrSourceOriginal
+		}
+		return s.blobs.Get(ctx, *key)
+	}
+	if stored, ok := strings.CutPrefix(url, s.blobs.URL("")); ok {
+		if domain.IsOriginalKey(stored) {
+			return nil, ErrSourceOriginal
+		}
+		return s.blobs.Get(ctx, stored)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !s.allowed(req.URL) {
+		return nil, fmt.Errorf("%w: %s", ErrSourceHost, url)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s: %s", url, resp.Status)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxSourceBytes), resp.Body}, nil
+}
+
+// allowed reports whether u is an HTTP URL on one of the source's hosts.
+func (s *imageSource) allowed(u *neturl.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := u.Hostname()
+	return slices.ContainsFunc(s.hosts, func(allowed string) bool {
+		return strings.EqualFold(allowed, host)
+	})
+}
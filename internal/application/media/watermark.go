@@ -0,0 +1,90 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	domain "go-ddd-clean/internal/domain/media"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// textMarkSize is the font size text watermarks are set in before they are
+// scaled to the image.
+const textMarkSize = 96
+
+// textMark draws text in white with a black outline, so it reads on light
+// and dark photos alike.
+func textMark(text string) (image.Image, error) {
+	otf, err := overlayFont()
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(otf, &opentype.FaceOptions{Size: textMarkSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	outline := textMarkSize / 16
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil() + 2*outline
+	height := metrics.Ascent.Ceil() + metrics.Descent.Ceil() + 2*outline
+	mark := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	drawer := font.Drawer{Dst: mark, Face: face, Src: image.Black}
+	origin := fixed.P(outline, outline+metrics.Ascent.Ceil())
+	for dy := -outline; dy <= outline; dy += outline {
+		for dx := -outline; dx <= outline; dx += outline {
+			drawer.Dot = origin.Add(fixed.P(dx, dy))
+			drawer.DrawString(text)
+		}
+	}
+	drawer.Src = image.White
+	drawer.Dot = origin
+	drawer.DrawString(text)
+	return mark, nil
+}
+
+// stampWatermark scales mark to the watermark's share of dst's width and
+// draws it at the watermark's position, a small margin in from the edges.
+func stampWatermark(dst *image.RGBA, mark image.Image, watermark *domain.Watermark) {
+	b, mb := dst.Bounds(), mark.Bounds()
+	if mb.Empty() {
+		return
+	}
+	w := max(int(float64(b.Dx())*watermark.Scale), 1)
+	h := max(mb.Dy()*w/mb.Dx(), 1)
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), mark, mb, xdraw.Src, nil)
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(watermark.Opacity * 255))})
+	at := func(x, y int) {
+		draw.DrawMask(dst, image.Rect(x, y, x+w, y+h), scaled, image.Point{}, mask, image.Point{}, draw.Over)
+	}
+
+	margin := min(b.Dx(), b.Dy()) * 3 / 100
+	switch watermark.Position {
+	case domain.WatermarkTopLeft:
+		at(b.Min.X+margin, b.Min.Y+margin)
+	case domain.WatermarkTopRight:
+		at(b.Max.X-margin-w, b.Min.Y+margin)
+	case domain.WatermarkBottomLeft:
+		at(b.Min.X+margin, b.Max.Y-margin-h)
+	case domain.WatermarkCenter:
+		at(b.Min.X+(b.Dx()-w)/2, b.Min.Y+(b.Dy()-h)/2)
+	case domain.WatermarkTiled:
+		// Alternate rows are offset by half a step, like bricks.
+		stepX, stepY := w+w/2, h*2
+		for row, y := 0, b.Min.Y+margin; y < b.Max.Y; row, y = row+1, y+stepY {
+			x := b.Min.X + margin - (row%2)*stepX/2
+			for ; x < b.Max.X; x += stepX {
+				at(x, y)
+			}
+		}
+	default:
+		at(b.Max.X-margin-w, b.Max.Y-margin-h)
+	}
+}
@@ -0,0 +1,120 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	domain "go-ddd-clean/internal/domain/media"
+	domainPayment "go-ddd-clean/internal/domain/payment"
+	domainSession "go-ddd-clean/internal/domain/session"
+)
+
+// Committer runs fn once the transaction ctx carries has committed, or
+// straight away outside one.
+type Committer interface {
+	AfterCommit(ctx context.Context, fn func())
+}
+
+// WatermarkRefresher rebuilds a session's composites and derivatives when
+// a payment, a voucher or any other change to the session decides that
+// they should gain or lose the watermark. It listens to payments and
+// sessions, and checks once their transaction has committed.
+type WatermarkRefresher struct {
+	photos domain.PhotoRepository
+	marks  *WatermarkService
+	render *RenderService
+	derivs *DerivativeService
+	jobs   Jobs
+	tx     Committer
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func NewWatermarkRefresher(
+	photos domain.PhotoRepository,
+	watermarks *WatermarkService,
+	render *RenderService,
+	derivatives *DerivativeService,
+	jobs Jobs,
+	tx Committer,
+) *WatermarkRefresher {
+	return &WatermarkRefresher{
+		photos:  photos,
+		marks:   watermarks,
+		render:  render,
+		derivs:  derivatives,
+		jobs:    jobs,
+		tx:      tx,
+		pending: map[string]bool{},
+	}
+}
+
+func (r *WatermarkRefresher) PaymentSucceeded(ctx context.Context, entity *domainPayment.Payment) error {
+	r.schedule(ctx, entity.SessionID)
+	return nil
+}
+
+func (r *WatermarkRefresher) SessionChanged(ctx context.Context, entity *domainSession.Session) error {
+	r.schedule(ctx, entity.ID)
+	return nil
+}
+
+// schedule queues a refresh of the session after the change commits. A
+// session already waiting is not queued twice.
+func (r *WatermarkRefresher) schedule(ctx context.Context, sessionID string) {
+	r.tx.AfterCommit(ctx, func() {
+		r.mu.Lock()
+		if r.pending[sessionID] {
+			r.mu.Unlock()
+			return
+		}
+		r.pending[sessionID] = true
+		r.mu.Unlock()
+
+		accepted := r.jobs.Submit("watermarks "+sessionID, func(ctx context.Context) error {
+			r.mu.Lock()
+			delete(r.pending, sessionID)
+			r.mu.Unlock()
+			return r.Refresh(ctx, sessionID)
+		})
+		if !accepted {
+			r.mu.Lock()
+			delete(r.pending, sessionID)
+			r.mu.Unlock()
+		}
+	})
+}
+
+// Refresh rebuilds the session's photos whose images disagree with
+// whether the session now carries a watermark. Server-rendered composites
+// are rendered again, which rebuilds their derivatives too; other photos
+// only get new derivatives of their original. Nothing can be rebuilt once
+// the original is purged, nor for photos the booth stored and rendered
+// itself.
+func (r *WatermarkRefresher) Refresh(ctx context.Context, sessionID string) error {
+	watermark, err := r.marks.ForSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	photos, err := r.photos.ListBySession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, photo := range photos {
+		if photo.Watermarked == (watermark != nil) || photo.OriginalPurgedAt != nil {
+			continue
+		}
+		switch {
+		case photo.RenderedKey != nil && photo.RenderedPurgedAt == nil:
+			if _, err := r.render.Render(ctx, photo.ID); err != nil {
+				errs = append(errs, err)
+			}
+		case photo.StorageKey != nil:
+			r.derivs.Schedule(photo.ID)
+		}
+	}
+	return errors.Join(errs...)
+}
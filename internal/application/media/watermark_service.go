@@ -0,0 +1,213 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+
+	domainBooth "go-ddd-clean/internal/domain/booth"
+	domain "go-ddd-clean/internal/domain/media"
+	domainPayment "go-ddd-clean/internal/domain/payment"
+	domainSession "go-ddd-clean/internal/domain/session"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidWatermark = errors.New("invalid watermark")
+
+const (
+	defaultWatermarkText    = "Sample"
+	defaultWatermarkOpacity = 0.5
+	defaultWatermarkScale   = 0.25
+)
+
+// WatermarkService keeps the watermarks of branches and booths and decides
+// which sessions' images carry one.
+type WatermarkService struct {
+	repo     domain.WatermarkRepository
+	sessions domainSession.Repository
+	booths   domainBooth.Repository
+	payments domainPayment.Repository
+	source   *imageSource
+
+	// logos caches decoded watermark images by URL.
+	mu    sync.Mutex
+	logos map[string]image.Image
+}
+
+func NewWatermarkService(
+	repo domain.WatermarkRepository,
+	sessions domainSession.Repository,
+	booths domainBooth.Repository,
+	payments domainPayment.Repository,
+	blobs domain.BlobStore,
+	fetchHosts []string,
+) *WatermarkService {
+	return &WatermarkService{
+		repo:     repo,
+		sessions: sessions,
+		booths:   booths,
+		payments: payments,
+		source:   newImageSource(blobs, fetchHosts),
+		logos:    map[string]image.Image{},
+	}
+}
+
+// WatermarkInput sets exactly one of BranchID and BoothID on create; they
+// are ignored on update. Zero values take the defaults: the text "Sample"
+// at the bottom right, half opaque, a quarter of the image wide.
+type WatermarkInput struct {
+	ID       string
+	BranchID *string
+	BoothID  *string
+	ImageURL *string
+	Text     string
+	Position domain.WatermarkPosition
+	Opacity  float64
+	Scale    float64
+}
+
+func (s *WatermarkService) Create(ctx context.Context, input WatermarkInput) (*domain.Watermark, error) {
+	if (input.BranchID == nil) == (input.BoothID == nil) {
+		return nil, fmt.Errorf("%w: give exactly one of branch_id and booth_id", ErrInvalidWatermark)
+	}
+	entity := &domain.Watermark{ID: uuid.NewString(), BranchID: input.BranchID, BoothID: input.BoothID}
+	if err := applyWatermarkInput(entity, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (s *WatermarkService) Update(ctx context.Context, input WatermarkInput) (*domain.Watermark, error) {
+	entity, err := s.repo.GetByID(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyWatermarkInput(entity, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func applyWatermarkInput(entity *domain.Watermark, input WatermarkInput) error {
+	if input.Text == "" && input.ImageURL == nil {
+		input.Text = defaultWatermarkText
+	}
+	switch input.Position {
+	case "":
+		input.Position = domain.WatermarkBottomRight
+	case domain.WatermarkBottomRight, domain.WatermarkBottomLeft, domain.WatermarkTopRight,
+		domain.WatermarkTopLeft, domain.WatermarkCenter, domain.WatermarkTiled:
+	default:
+		return fmt.Errorf("%w: position must be one of bottom_right, bottom_left, top_right, top_left, center or tiled", ErrInvalidWatermark)
+	}
+	if input.Opacity == 0 {
+		input.Opacity = defaultWatermarkOpacity
+	}
+	if input.Opacity < 0 || input.Opacity > 1 {
+		return fmt.Errorf("%w: opacity must be between 0 and 1", ErrInvalidWatermark)
+	}
+	if input.Scale == 0 {
+		input.Scale = defaultWatermarkScale
+	}
+	if input.Scale < 0.05 || input.Scale > 1 {
+		return fmt.Errorf("%w: scale must be between 0.05 and 1", ErrInvalidWatermark)
+	}
+	entity.ImageURL = input.ImageURL
+	entity.Text = input.Text
+	entity.Position = input.Position
+	entity.Opacity = input.Opacity
+	entity.Scale = input.Scale
+	return nil
+}
+
+func (s *WatermarkService) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *WatermarkService) Get(ctx context.Context, id string) (*domain.Watermark, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *WatermarkService) List(ctx context.Context) ([]domain.Watermark, error) {
+	return s.repo.List(ctx)
+}
+
+// ForSession returns the watermark the session's images carry, or nil.
+// Sessions priced with a free voucher always carry their booth's or
+// branch's watermark; at virtual booths so do sessions without a
+// successful payment. Paid sessions elsewhere never do.
+func (s *WatermarkService) ForSession(ctx context.Context, sessionID string) (*domain.Watermark, error) {
+	session, err := s.sessions.GetByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	booth, err := s.booths.GetByID(ctx, session.BoothID)
+	if err != nil {
+		return nil, err
+	}
+	free := false
+	for _, v := range session.Vouchers {
+		free = free || v.Kind == domainSession.DiscountFree
+	}
+	if !free {
+		if booth.Type != domainBooth.BoothTypeVirtual {
+			return nil, nil
+		}
+		paid, err := s.paid(ctx, session)
+		if err != nil || paid {
+			return nil, err
+		}
+	}
+	return s.repo.FindFor(ctx, booth.ID, booth.BranchID)
+}
+
+func (s *WatermarkService) paid(ctx context.Context, session *domainSession.Session) (bool, error) {
+	if session.PaymentID == nil {
+		return false, nil
+	}
+	payment, err := s.payments.GetByID(ctx, *session.PaymentID)
+	if err != nil {
+		return false, err
+	}
+	return payment.Status == domainPayment.StatusSuccess, nil
+}
+
+// Stamp draws the watermark onto img in place.
+func (s *WatermarkService) Stamp(ctx context.Context, img *image.RGBA, watermark *domain.Watermark) error {
+	mark, err := s.mark(ctx, watermark)
+	if err != nil {
+		return err
+	}
+	stampWatermark(img, mark, watermark)
+	return nil
+}
+
+func (s *WatermarkService) mark(ctx context.Context, watermark *domain.Watermark) (image.Image, error) {
+	if watermark.ImageURL == nil {
+		return textMark(watermark.Text)
+	}
+	url := *watermark.ImageURL
+	s.mu.Lock()
+	logo, ok := s.logos[url]
+	s.mu.Unlock()
+	if ok {
+		return logo, nil
+	}
+	logo, err := s.source.decode(ctx, nil, url)
+	if err != nil {
+		return nil, fmt.Errorf("load watermark: %w", err)
+	}
+	s.mu.Lock()
+	s.logos[url] = logo
+	s.mu.Unlock()
+	return logo, nil
+}
@@ -8,12 +8,31 @@ import (
 	"github.com/google/uuid"
 )
 
+// Transactor runs fn in one database transaction. Repository calls made
+// with the context it passes take part in it.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// SuccessListener is told when a payment is saved as successful. It runs in
+// the transaction that saves the payment, so an error undoes the save.
+type SuccessListener interface {
+	PaymentSucceeded(ctx context.Context, entity *domain.Payment) error
+}
+
 type Service struct {
-	repo domain.Repository
+	repo      domain.Repository
+	tx        Transactor
+	listeners []SuccessListener
 }
 
-func NewService(repo domain.Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo domain.Repository, tx Transactor) *Service {
+	return &Service{repo: repo, tx: tx}
+}
+
+// AddSuccessListener registers l for successful payments.
+func (s *Service) AddSuccessListener(l SuccessListener) {
+	s.listeners = append(s.listeners, l)
 }
 
 type CreatePaymentInput struct {
@@ -52,36 +71,65 @@ func (s *Service) Create(ctx context.Context, input CreatePaymentInput) (*domain
 		Status:         status,
 		TransactionRef: input.TransactionRef,
 	}
-	if err := s.repo.Create(ctx, entity); err != nil {
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, entity); err != nil {
+			return err
+		}
+		return s.succeeded(ctx, entity, "")
+	})
+	if err != nil {
 		return nil, err
 	}
 	return entity, nil
 }
 
 func (s *Service) Update(ctx context.Context, input UpdatePaymentStatusInput) (*domain.Payment, error) {
-	entity, err := s.repo.GetByID(ctx, input.ID)
+	var entity *domain.Payment
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		entity, err = s.repo.GetByID(ctx, input.ID)
+		if err != nil {
+			return err
+		}
+		previous := entity.Status
+		if input.Status != "" {
+			entity.Status = input.Status
+		}
+		if input.TransactionRef != nil {
+			entity.TransactionRef = input.TransactionRef
+		}
+		if input.Amount != nil {
+			entity.Amount = *input.Amount
+		}
+		if input.Currency != nil {
+			entity.Currency = *input.Currency
+		}
+		if input.Method != nil {
+			entity.Method = *input.Method
+		}
+		if err := s.repo.Update(ctx, entity); err != nil {
+			return err
+		}
+		return s.succeeded(ctx, entity, previous)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if input.Status != "" {
-		entity.Status = input.Status
-	}
-	if input.TransactionRef != nil {
-		entity.TransactionRef = input.TransactionRef
-	}
-	if input.Amount != nil {
-		entity.Amount = *input.Amount
-	}
-	if input.Currency != nil {
-		entity.Currency = *input.Currency
-	}
-	if input.Method != nil {
-		entity.Method = *input.Method
+	return entity, nil
+}
+
+// succeeded tells the listeners when the payment has just become
+// successful.
+func (s *Service) succeeded(ctx context.Context, entity *domain.Payment, previous domain.Status) error {
+	if entity.Status != domain.StatusSuccess || previous == domain.StatusSuccess {
+		return nil
 	}
-	if err := s.repo.Update(ctx, entity); err != nil {
-		return nil, err
+	for _, l := range s.listeners {
+		if err := l.PaymentSucceeded(ctx, entity); err != nil {
+			return err
+		}
 	}
-	return entity, nil
+	return nil
 }
 
 func (s *Service) Get(ctx context.Context, id string) (*domain.Payment, error) {
@@ -0,0 +1,44 @@
+package printing
+
+import "sync"
+
+// notifier wakes the booth streams waiting on a booth's queue. It only
+// reaches streams served by this process, so streams also re-read the
+// queue on a timer.
+type notifier struct {
+	mu        sync.Mutex
+	listeners map[string]map[chan struct{}]bool
+}
+
+func newNotifier() *notifier {
+	return &notifier{listeners: map[string]map[chan struct{}]bool{}}
+}
+
+func (n *notifier) subscribe(boothID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	n.mu.Lock()
+	if n.listeners[boothID] == nil {
+		n.listeners[boothID] = map[chan struct{}]bool{}
+	}
+	n.listeners[boothID][ch] = true
+	n.mu.Unlock()
+	return ch, func() {
+		n.mu.Lock()
+		delete(n.listeners[boothID], ch)
+		if len(n.listeners[boothID]) == 0 {
+			delete(n.listeners, boothID)
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *notifier) wake(boothID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.listeners[boothID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package printing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-ddd-clean/internal/domain/booth"
+	"go-ddd-clean/internal/domain/media"
+	domain "go-ddd-clean/internal/domain/printing"
+	"go-ddd-clean/internal/domain/session"
+	"go-ddd-clean/internal/domain/user"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidPrintJob   = errors.New("invalid print job")
+	ErrPhotoNotRendered  = errors.New("photo has no rendered image to print")
+	ErrInvalidTransition = errors.New("print job cannot change to that status")
+	ErrNotStaff          = errors.New("print approvals need a staff or admin user")
+	ErrForeignJob        = errors.New("print job belongs to another booth")
+)
+
+// maxCopies caps a single job so a typo cannot empty the printer.
+const maxCopies = 20
+
+// Sessions prices extra copies into the session they were sold in.
+type Sessions interface {
+	Get(ctx context.Context, id string) (*session.Session, error)
+	AddCharge(ctx context.Context, id string, charge session.Charge) (*session.Session, error)
+}
+
+// Transactor runs an approval and the charge it adds in one transaction.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Booths resolves the booth a job prints on for its extra copy price.
+type Booths interface {
+	Get(ctx context.Context, id string) (*booth.Booth, error)
+}
+
+// Service queues print jobs for physical booths. A photo's first print is
+// queued straight away; reprints and extra copies wait for staff approval.
+type Service struct {
+	repo     domain.Repository
+	photos   media.PhotoRepository
+	frames   media.FrameRepository
+	sessions Sessions
+	booths   Booths
+	users    user.Repository
+	tx       Transactor
+	notify   *notifier
+}
+
+func NewService(
+	repo domain.Repository,
+	photos media.PhotoRepository,
+	frames media.FrameRepository,
+	sessions Sessions,
+	booths Booths,
+	users user.Repository,
+	tx Transactor,
+) *Service {
+	return &Service{
+		repo:     repo,
+		photos:   photos,
+		frames:   frames,
+		sessions: sessions,
+		booths:   booths,
+		users:    users,
+		tx:       tx,
+		notify:   newNotifier(),
+	}
+}
+
+// CreateJobInput asks for a print of a rendered photo. Kind may be left
+// empty: a photo that has been sent to print before becomes a reprint.
+// PaperSize defaults to the photo's frame, then 4x6.
+type CreateJobInput struct {
+	BoothID   string
+	PhotoID   string
+	Kind      domain.Kind
+	Copies    int
+	PaperSize domain.PaperSize
+}
+
+func (s *Service) Create(ctx context.Context, input CreateJobInput) (*domain.Job, error) {
+	copies := input.Copies
+	if copies == 0 {
+		copies = 1
+	}
+	if copies < 1 || copies > maxCopies {
+		return nil, fmt.Errorf("%w: copies must be between 1 and %d", ErrInvalidPrintJob, maxCopies)
+	}
+	photo, err := s.photos.GetByID(ctx, input.PhotoID)
+	if err != nil {
+		return nil, err
+	}
+	if photo.RenderedURL == nil || photo.RenderedPurgedAt != nil {
+		return nil, ErrPhotoNotRendered
+	}
+	sess, err := s.sessions.Get(ctx, photo.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess.BoothID != input.BoothID {
+		return nil, ErrForeignJob
+	}
+	paper, err := s.paperSize(ctx, photo, input.PaperSize)
+	if err != nil {
+		return nil, err
+	}
+	job := &domain.Job{
+		ID:        uuid.NewString(),
+		BoothID:   sess.BoothID,
+		SessionID: sess.ID,
+		PhotoID:   photo.ID,
+		FileURL:   *photo.RenderedURL,
+		Copies:    copies,
+		PaperSize: paper,
+	}
+	if d, ok := photo.Derivatives[media.DerivativePrint]; ok && d.Source == media.SourceRendered {
+		job.FileURL = d.URL
+	}
+	if err := s.classify(ctx, job, input.Kind); err != nil {
+		return nil, err
+	}
+	job.Status = domain.StatusQueued
+	if job.Kind.NeedsApproval() {
+		job.Status = domain.StatusPendingApproval
+	}
+	if err := s.repo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	if job.Status == domain.StatusQueued {
+		s.notify.wake(job.BoothID)
+	}
+	return job, nil
+}
+
+func (s *Service) paperSize(ctx context.Context, photo *media.Photo, requested domain.PaperSize) (domain.PaperSize, error) {
+	switch requested {
+	case domain.PaperStrip2x6, domain.Paper4x6:
+		return requested, nil
+	case "":
+	default:
+		return "", fmt.Errorf("%w: paper_size must be %s or %s", ErrInvalidPrintJob, domain.PaperStrip2x6, domain.Paper4x6)
+	}
+	if photo.FrameID == nil {
+		return domain.Paper4x6, nil
+	}
+	frame, err := s.frames.GetByID(ctx, *photo.FrameID)
+	if err != nil {
+		return "", err
+	}
+	if frame.Template != nil && frame.Template.PrintSize != "" {
+		return domain.PaperSize(frame.Template.PrintSize), nil
+	}
+	return domain.Paper4x6, nil
+}
+
+// classify sets the job's kind. Extra copies take the booth's current
+// price, so later price changes do not affect jobs already asked for.
+func (s *Service) classify(ctx context.Context, job *domain.Job, kind domain.Kind) error {
+	switch kind {
+	case "", domain.KindPrint, domain.KindReprint:
+		previous, err := s.repo.List(ctx, domain.JobFilter{PhotoID: &job.PhotoID})
+		if err != nil {
+			return err
+		}
+		job.Kind = domain.KindPrint
+		for i := len(previous) - 1; i >= 0; i-- {
+			if previous[i].Kind != domain.KindExtraCopies && previous[i].Status != domain.StatusRejected {
+				job.Kind = domain.KindReprint
+				job.ReprintOf = &previous[i].ID
+				break
+			}
+		}
+		return nil
+	case domain.KindExtraCopies:
+		b, err := s.booths.Get(ctx, job.BoothID)
+		if err != nil {
+			return err
+		}
+		if b.ExtraCopyPrice == nil {
+			return fmt.Errorf("%w: booth does not sell extra copies", ErrInvalidPrintJob)
+		}
+		price := *b.ExtraCopyPrice
+		job.Kind = domain.KindExtraCopies
+		job.UnitPrice = &price
+		return nil
+	}
+	return fmt.Errorf("%w: kind must be print, reprint or extra_copies", ErrInvalidPrintJob)
+}
+
+// Approve queues a job waiting for staff. Extra copies are charged to
+// their session in the same transaction, so nothing prints unbilled and a
+// job approved twice at once is charged once.
+func (s *Service) Approve(ctx context.Context, id string, staffID string) (*domain.Job, error) {
+	var job *domain.Job
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		job, err = s.review(ctx, id, staffID, domain.StatusQueued)
+		if err != nil {
+			return err
+		}
+		if job.Kind != domain.KindExtraCopies {
+			return nil
+		}
+		charge := session.NewCharge(session.ChargeExtraCopies, job.ID, job.Copies, *job.UnitPrice)
+		_, err = s.sessions.AddCharge(ctx, job.SessionID, charge)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notify.wake(job.BoothID)
+	return job, nil
+}
+
+func (s *Service) Reject(ctx context.Context, id string, staffID string, reason string) (*domain.Job, error) {
+	return s.review(ctx, id, staffID, domain.StatusRejected, func(job *domain.Job) {
+		if reason != "" {
+			job.Error = &reason
+		}
+	})
+}
+
+// review moves a pending job to next on behalf of staffID. edits are
+// applied before the job is saved.
+func (s *Service) review(ctx context.Context, id string, staffID string, next domain.Status, edits ...func(job *domain.Job)) (*domain.Job, error) {
+	reviewer, err := s.users.GetByID(ctx, staffID)
+	if err != nil {
+		return nil, err
+	}
+	if reviewer.Role != user.RoleStaff && reviewer.Role != user.RoleAdmin {
+		return nil, ErrNotStaff
+	}
+	job, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != domain.StatusPendingApproval || !job.Status.CanBecome(next) {
+		return nil, fmt.Errorf("%w: job is %s", ErrInvalidTransition, job.Status)
+	}
+	now := time.Now()
+	job.Status = next
+	job.ReviewedBy = &reviewer.ID
+	job.ReviewedAt = &now
+	for _, edit := range edits {
+		edit(job)
+	}
+	if err := s.transition(ctx, job, domain.StatusPendingApproval); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// transition saves job if it is still in status from.
+func (s *Service) transition(ctx context.Context, job *domain.Job, from domain.Status) error {
+	err := s.repo.Transition(ctx, job, from)
+	if errors.Is(err, domain.ErrStatusChanged) {
+		return fmt.Errorf("%w: job is no longer %s", ErrInvalidTransition, from)
+	}
+	return err
+}
+
+// Claim hands the booth its oldest queued job, marked printing, or nil
+// when the queue is empty.
+func (s *Service) Claim(ctx context.Context, boothID string) (*domain.Job, error) {
+	return s.repo.ClaimNext(ctx, boothID, time.Now())
+}
+
+// ReportInput is a booth's update from the printer. Message is kept on
+// failed jobs.
+type ReportInput struct {
+	ID      string
+	BoothID string
+	Status  domain.Status
+	Message string
+}
+
+// Report records the printer's progress on a job of the booth's. Booths
+// may only move jobs along queued, printing, then done or failed.
+func (s *Service) Report(ctx context.Context, input ReportInput) (*domain.Job, error) {
+	job, err := s.repo.GetByID(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	if job.BoothID != input.BoothID {
+		return nil, ErrForeignJob
+	}
+	if job.Status == domain.StatusPendingApproval || !job.Status.CanBecome(input.Status) {
+		return nil, fmt.Errorf("%w: job is %s", ErrInvalidTransition, job.Status)
+	}
+	from := job.Status
+	now := time.Now()
+	job.Status = input.Status
+	switch input.Status {
+	case domain.StatusPrinting:
+		job.StartedAt = &now
+	case domain.StatusDone:
+		job.FinishedAt = &now
+	case domain.StatusFailed:
+		job.FinishedAt = &now
+		if input.Message != "" {
+			job.Error = &input.Message
+		}
+	}
+	if err := s.transition(ctx, job, from); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*domain.Job, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Service) List(ctx context.Context, filter domain.JobFilter) ([]domain.Job, error) {
+	return s.repo.List(ctx, filter)
+}
+
+// Subscribe returns a channel that is signalled when jobs are queued for
+// the booth, and a func to stop listening. Signals are dropped while one is
+// pending, so listeners should re-read the queue when woken.
+func (s *Service) Subscribe(boothID string) (<-chan struct{}, func()) {
+	return s.notify.subscribe(boothID)
+}
@@ -0,0 +1,314 @@
+package referral
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	appVoucher "go-ddd-clean/internal/application/voucher"
+	"go-ddd-clean/internal/domain/payment"
+	domain "go-ddd-clean/internal/domain/referral"
+	"go-ddd-clean/internal/domain/session"
+	"go-ddd-clean/internal/domain/user"
+	"go-ddd-clean/internal/domain/voucher"
+
+	"github.com/google/uuid"
+)
+
+const (
+	codePrefix = "REF-"
+	codeLength = 6
+	// codeAlphabet leaves out 0/O and 1/I so codes are easy to read out.
+	codeAlphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	maxCodeRetries = 5
+	// rewardCodePattern is the voucher pattern used for reward vouchers.
+	rewardCodePattern = "RW-????-????"
+)
+
+// Policy holds the reward terms and fraud limits for referrals.
+type Policy struct {
+	RewardValue float64
+	RewardUnit  voucher.Unit
+	RewardValid time.Duration
+	// MaxPerReferrer caps how many pending and rewarded referrals one code
+	// can have. Zero means no cap.
+	MaxPerReferrer int
+}
+
+type Users interface {
+	Get(ctx context.Context, id string) (*user.User, error)
+}
+
+type Sessions interface {
+	Get(ctx context.Context, id string) (*session.Session, error)
+	Lock(ctx context.Context, id string) (*session.Session, error)
+}
+
+type Vouchers interface {
+	Issue(ctx context.Context, pattern string, input appVoucher.CreateVoucherInput) (*voucher.Voucher, error)
+}
+
+// Transactor runs fn in one database transaction, so a referral and the
+// vouchers rewarding it are saved together or not at all.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type Service struct {
+	repo     domain.Repository
+	users    Users
+	sessions Sessions
+	vouchers Vouchers
+	policy   Policy
+	tx       Transactor
+}
+
+func NewService(repo domain.Repository, users Users, sessions Sessions, vouchers Vouchers, policy Policy, tx Transactor) *Service {
+	return &Service{
+		repo:     repo,
+		users:    users,
+		sessions: sessions,
+		vouchers: vouchers,
+		policy:   policy,
+		tx:       tx,
+	}
+}
+
+// CodeFor returns the user's referral code, creating one the first time.
+func (s *Service) CodeFor(ctx context.Context, userID string) (*domain.Code, error) {
+	existing, err := s.repo.FindCodeByUser(ctx, userID)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	if _, err := s.users.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < maxCodeRetries; attempt++ {
+		value, err := randomCode()
+		if err != nil {
+			return nil, err
+		}
+		taken, err := s.repo.FindCode(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		if taken != nil {
+			continue
+		}
+		code := &domain.Code{Code: value, UserID: userID}
+		if err := s.repo.CreateCode(ctx, code); err != nil {
+			return nil, err
+		}
+		return code, nil
+	}
+	return nil, errors.New("could not generate a unique referral code")
+}
+
+type ApplyReferralInput struct {
+	Code      string
+	SessionID string
+	Tel       *string
+}
+
+// Apply attaches a referral code to a new customer's session. Rewards are
+// issued later, when the session completes and turns out to be the phone
+// number's first paid session. The session is locked and must still be in
+// progress: one that has already ended would never be settled, and its
+// referral would hold the phone number pending for good.
+func (s *Service) Apply(ctx context.Context, input ApplyReferralInput) (*domain.Referral, error) {
+	code, err := s.repo.FindCode(ctx, strings.ToUpper(strings.TrimSpace(input.Code)))
+	if err != nil {
+		return nil, err
+	}
+	if code == nil {
+		return nil, domain.ErrUnknownCode
+	}
+	var entity *domain.Referral
+	err = s.tx.InTx(ctx, func(ctx context.Context) error {
+		sess, err := s.sessions.Lock(ctx, input.SessionID)
+		if err != nil {
+			return err
+		}
+		if sess.Status != session.StatusStarted {
+			return domain.ErrSessionClosed
+		}
+		tel := input.Tel
+		if tel == nil {
+			tel = sess.PhoneTemp
+		}
+		if tel == nil || *tel == "" {
+			return domain.ErrPhoneRequired
+		}
+		referrer, err := s.users.Get(ctx, code.UserID)
+		if err != nil {
+			return err
+		}
+		if (sess.UserID != nil && *sess.UserID == referrer.ID) || (referrer.Tel != nil && *referrer.Tel == *tel) {
+			return domain.ErrSelfReferral
+		}
+		pending, err := s.repo.FindPendingBySession(ctx, sess.ID)
+		if err != nil {
+			return err
+		}
+		if pending != nil {
+			return domain.ErrSessionReferred
+		}
+		referred, err := s.repo.ActiveForTel(ctx, *tel)
+		if err != nil {
+			return err
+		}
+		if referred {
+			return domain.ErrAlreadyReferred
+		}
+		paid, err := s.repo.HasPaidSession(ctx, *tel, sess.ID)
+		if err != nil {
+			return err
+		}
+		if paid {
+			return domain.ErrNotNewCustomer
+		}
+		if s.policy.MaxPerReferrer > 0 {
+			count, err := s.repo.CountActiveByReferrer(ctx, referrer.ID)
+			if err != nil {
+				return err
+			}
+			if count >= s.policy.MaxPerReferrer {
+				return domain.ErrReferrerCapReached
+			}
+		}
+		entity = &domain.Referral{
+			ID:            uuid.NewString(),
+			Code:          code.Code,
+			ReferrerID:    referrer.ID,
+			RefereeTel:    *tel,
+			RefereeUserID: sess.UserID,
+			SessionID:     sess.ID,
+			Status:        domain.StatusPending,
+		}
+		return s.repo.Create(ctx, entity)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (s *Service) List(ctx context.Context, referrerID *string) ([]domain.Referral, error) {
+	return s.repo.List(ctx, referrerID)
+}
+
+// SessionStatusChanged settles the session's pending referral once the
+// session has ended.
+func (s *Service) SessionStatusChanged(ctx context.Context, entity *session.Session, previous session.Status) error {
+	if entity.Status == session.StatusStarted {
+		return nil
+	}
+	return s.settle(ctx, entity)
+}
+
+// PaymentSucceeded settles the referral of a session that completed before
+// its payment was recorded. The session is locked first, so this and a
+// concurrent status change cannot both miss the other.
+func (s *Service) PaymentSucceeded(ctx context.Context, p *payment.Payment) error {
+	return s.tx.InTx(ctx, func(ctx context.Context) error {
+		sess, err := s.sessions.Lock(ctx, p.SessionID)
+		if err != nil {
+			return err
+		}
+		if sess.Status != session.StatusSuccess {
+			return nil
+		}
+		return s.settle(ctx, sess)
+	})
+}
+
+// settle resolves the session's pending referral: a successful, paid first
+// session earns both customers a voucher, and a session that failed or was
+// cancelled rejects the referral so the phone number can be referred again.
+// A successful session that is not paid yet stays pending until it is. The
+// referral is locked and re-read as pending, so it is rewarded only once.
+func (s *Service) settle(ctx context.Context, entity *session.Session) error {
+	return s.tx.InTx(ctx, func(ctx context.Context) error {
+		ref, err := s.repo.FindPendingBySessionForUpdate(ctx, entity.ID)
+		if err != nil || ref == nil {
+			return err
+		}
+		if entity.Status != session.StatusSuccess {
+			return s.reject(ctx, ref, "session "+string(entity.Status))
+		}
+		sessionPaid, err := s.repo.SessionPaid(ctx, entity.ID)
+		if err != nil || !sessionPaid {
+			return err
+		}
+		paid, err := s.repo.HasPaidSession(ctx, ref.RefereeTel, entity.ID)
+		if err != nil {
+			return err
+		}
+		if paid {
+			return s.reject(ctx, ref, domain.ErrNotNewCustomer.Error())
+		}
+		return s.reward(ctx, ref)
+	})
+}
+
+// reward issues each customer a voucher only they can redeem. It runs in
+// settle's transaction.
+func (s *Service) reward(ctx context.Context, ref *domain.Referral) error {
+	referrer, err := s.users.Get(ctx, ref.ReferrerID)
+	if err != nil {
+		return err
+	}
+	validTo := time.Now().Add(s.policy.RewardValid)
+	issue := func(userID *string, tel *string) (*voucher.Voucher, error) {
+		return s.vouchers.Issue(ctx, rewardCodePattern, appVoucher.CreateVoucherInput{
+			Type:     voucher.TypeDiscount,
+			Value:    s.policy.RewardValue,
+			Unit:     s.policy.RewardUnit,
+			MaxUsage: 1,
+			ValidTo:  &validTo,
+			Active:   true,
+			Restrictions: voucher.Restrictions{
+				CustomerUserID: userID,
+				CustomerTel:    tel,
+			},
+		})
+	}
+	referrerVoucher, err := issue(&referrer.ID, referrer.Tel)
+	if err != nil {
+		return err
+	}
+	refereeVoucher, err := issue(ref.RefereeUserID, &ref.RefereeTel)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	ref.Status = domain.StatusRewarded
+	ref.ReferrerVoucherID = &referrerVoucher.ID
+	ref.RefereeVoucherID = &refereeVoucher.ID
+	ref.ResolvedAt = &now
+	return s.repo.Update(ctx, ref)
+}
+
+func (s *Service) reject(ctx context.Context, ref *domain.Referral, reason string) error {
+	now := time.Now()
+	ref.Status = domain.StatusRejected
+	ref.RejectReason = &reason
+	ref.ResolvedAt = &now
+	return s.repo.Update(ctx, ref)
+}
+
+func randomCode() (string, error) {
+	var b strings.Builder
+	b.WriteString(codePrefix)
+	for i := 0; i < codeLength; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(codeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
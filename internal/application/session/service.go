@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"go-ddd-clean/internal/domain/session"
@@ -9,21 +10,71 @@ import (
 	"github.com/google/uuid"
 )
 
+var ErrSessionNotPriced = errors.New("session has no price")
+
+// CustomerDiscounts looks up the automatic percentage discount a known
+// customer gets on every session.
+type CustomerDiscounts interface {
+	SessionDiscount(ctx context.Context, userID string) (float64, error)
+}
+
+// StatusListener is told when a session is saved with a different status
+// than it had before. It runs in the transaction that saves the status, so
+// an error undoes the change and the caller can retry the whole update.
+type StatusListener interface {
+	SessionStatusChanged(ctx context.Context, entity *session.Session, previous session.Status) error
+}
+
+// ChangeListener is told whenever an existing session is saved, after any
+// StatusListener. It runs in the same transaction.
+type ChangeListener interface {
+	SessionChanged(ctx context.Context, entity *session.Session) error
+}
+
+// Transactor runs fn in one database transaction. Repository calls made
+// with the context it passes take part in it.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type Service struct {
-	repo session.Repository
+	repo      session.Repository
+	discounts CustomerDiscounts
+	pricing   session.PricingPolicy
+	tx        Transactor
+	listeners []StatusListener
+	changes   []ChangeListener
+}
+
+func NewService(repo session.Repository, discounts CustomerDiscounts, pricing session.PricingPolicy, tx Transactor) *Service {
+	return &Service{
+		repo:      repo,
+		discounts: discounts,
+		pricing:   pricing,
+		tx:        tx,
+	}
 }
 
-func NewService(repo session.Repository) *Service {
-	return &Service{repo: repo}
+// AddStatusListener registers l for status changes. Services that depend on
+// the session service register themselves here after construction.
+func (s *Service) AddStatusListener(l StatusListener) {
+	s.listeners = append(s.listeners, l)
 }
 
+// AddChangeListener registers l for every update, including repricing.
+func (s *Service) AddChangeListener(l ChangeListener) {
+	s.changes = append(s.changes, l)
+}
+
+// CreateSessionInput and UpdateSessionInput leave out vouchers and the
+// total: vouchers are added by redeeming them, and the total is always
+// worked out from the base price.
 type CreateSessionInput struct {
 	BoothID       string
 	UserID        *string
-	VoucherID     *string
 	PaymentID     *string
 	Status        session.Status
-	TotalPrice    *float64
+	BasePrice     *float64
 	BoothSnapshot map[string]any
 	PhoneTemp     *string
 }
@@ -31,10 +82,9 @@ type CreateSessionInput struct {
 type UpdateSessionInput struct {
 	ID            string
 	UserID        *string
-	VoucherID     *string
 	PaymentID     *string
 	Status        *session.Status
-	TotalPrice    *float64
+	BasePrice     *float64
 	FinishedAt    *time.Time
 	BoothSnapshot map[string]any
 	PhoneTemp     *string
@@ -50,52 +100,84 @@ func (s *Service) Create(ctx context.Context, input CreateSessionInput) (*sessio
 		ID:            uuid.NewString(),
 		BoothID:       input.BoothID,
 		UserID:        input.UserID,
-		VoucherID:     input.VoucherID,
 		PaymentID:     input.PaymentID,
 		StartedAt:     &now,
 		Status:        status,
-		TotalPrice:    input.TotalPrice,
+		BasePrice:     input.BasePrice,
 		BoothSnapshot: input.BoothSnapshot,
 		PhoneTemp:     input.PhoneTemp,
 	}
+	if err := s.applyPricing(ctx, entity); err != nil {
+		return nil, err
+	}
 	if err := s.repo.Create(ctx, entity); err != nil {
 		return nil, err
 	}
 	return entity, nil
 }
 
+// Update saves the booth's changes to the session under its row lock, so
+// vouchers and charges added meanwhile are kept. A status change and what
+// its listeners do commit together.
 func (s *Service) Update(ctx context.Context, input UpdateSessionInput) (*session.Session, error) {
-	entity, err := s.repo.GetByID(ctx, input.ID)
+	var entity *session.Session
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		entity, err = s.repo.GetForUpdate(ctx, input.ID)
+		if err != nil {
+			return err
+		}
+		previous := entity.Status
+		if input.UserID != nil {
+			if entity.UserID == nil || *entity.UserID != *input.UserID {
+				entity.TierPercent = nil
+			}
+			entity.UserID = input.UserID
+		}
+		if input.PaymentID != nil {
+			entity.PaymentID = input.PaymentID
+		}
+		if input.Status != nil {
+			entity.Status = *input.Status
+		}
+		if input.BasePrice != nil {
+			entity.BasePrice = input.BasePrice
+		}
+		if input.FinishedAt != nil {
+			entity.FinishedAt = input.FinishedAt
+		}
+		if input.BoothSnapshot != nil {
+			entity.BoothSnapshot = input.BoothSnapshot
+		}
+		if input.PhoneTemp != nil {
+			entity.PhoneTemp = input.PhoneTemp
+		}
+		if err := s.applyPricing(ctx, entity); err != nil {
+			return err
+		}
+		if err := s.repo.Update(ctx, entity); err != nil {
+			return err
+		}
+		if err := s.repo.UpdatePricing(ctx, entity); err != nil {
+			return err
+		}
+		if entity.Status != previous {
+			for _, l := range s.listeners {
+				if err := l.SessionStatusChanged(ctx, entity, previous); err != nil {
+					return err
+				}
+			}
+			// Listeners may have repriced the session, for example by
+			// voiding its vouchers.
+			if entity, err = s.repo.GetByID(ctx, entity.ID); err != nil {
+				return err
+			}
+		}
+		return s.changed(ctx, entity)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if input.UserID != nil {
-		entity.UserID = input.UserID
-	}
-	if input.VoucherID != nil {
-		entity.VoucherID = input.VoucherID
-	}
-	if input.PaymentID != nil {
-		entity.PaymentID = input.PaymentID
-	}
-	if input.Status != nil {
-		entity.Status = *input.Status
-	}
-	if input.TotalPrice != nil {
-		entity.TotalPrice = input.TotalPrice
-	}
-	if input.FinishedAt != nil {
-		entity.FinishedAt = input.FinishedAt
-	}
-	if input.BoothSnapshot != nil {
-		entity.BoothSnapshot = input.BoothSnapshot
-	}
-	if input.PhoneTemp != nil {
-		entity.PhoneTemp = input.PhoneTemp
-	}
-	if err := s.repo.Update(ctx, entity); err != nil {
-		return nil, err
-	}
 	return entity, nil
 }
 
@@ -110,3 +192,171 @@ func (s *Service) Get(ctx context.Context, id string) (*session.Session, error)
 func (s *Service) List(ctx context.Context, boothID *string, status *session.Status) ([]session.Session, error) {
 	return s.repo.List(ctx, boothID, status)
 }
+
+// Quote prices the session as if extra vouchers were applied on top of the
+// ones it already holds, without saving anything.
+func (s *Service) Quote(ctx context.Context, entity *session.Session, extra ...session.AppliedVoucher) (session.Breakdown, error) {
+	base := entity.BasePrice
+	if base == nil {
+		// Sessions created before the booth started sending base_price
+		// are priced from their TotalPrice.
+		base = entity.TotalPrice
+	}
+	if base == nil {
+		return session.Breakdown{}, ErrSessionNotPriced
+	}
+	percent, err := s.tierPercent(ctx, entity)
+	if err != nil {
+		return session.Breakdown{}, err
+	}
+	vouchers := append(append([]session.AppliedVoucher{}, entity.Vouchers...), extra...)
+	return session.Price(*base, percent, vouchers, s.pricing), nil
+}
+
+// Lock returns the session and holds its row lock until ctx's transaction
+// ends, so a voucher can be checked against the session and priced into it
+// without another change slipping in between.
+func (s *Service) Lock(ctx context.Context, id string) (*session.Session, error) {
+	return s.repo.GetForUpdate(ctx, id)
+}
+
+// AddVoucher prices a redeemed voucher into the session.
+func (s *Service) AddVoucher(ctx context.Context, id string, applied session.AppliedVoucher) (*session.Session, error) {
+	return s.reprice(ctx, id, func(entity *session.Session) error {
+		if err := fixBasePrice(entity); err != nil {
+			return err
+		}
+		entity.Vouchers = append(entity.Vouchers, applied)
+		entity.VoucherID = &applied.VoucherID
+		return nil
+	})
+}
+
+// AddCharge adds an extra sold during the session to its price. A charge
+// of the same kind and reference as one already on the session is not added
+// again, so retrying a sale cannot bill it twice.
+func (s *Service) AddCharge(ctx context.Context, id string, charge session.Charge) (*session.Session, error) {
+	return s.reprice(ctx, id, func(entity *session.Session) error {
+		if err := fixBasePrice(entity); err != nil {
+			return err
+		}
+		for _, existing := range entity.Charges {
+			if existing.Kind == charge.Kind && existing.Reference == charge.Reference {
+				return nil
+			}
+		}
+		entity.Charges = append(entity.Charges, charge)
+		return nil
+	})
+}
+
+// RemoveVouchers takes voided redemptions back out of the session's price.
+func (s *Service) RemoveVouchers(ctx context.Context, id string, redemptionIDs []string) (*session.Session, error) {
+	return s.reprice(ctx, id, func(entity *session.Session) error {
+		removed := make(map[string]bool, len(redemptionIDs))
+		for _, rid := range redemptionIDs {
+			removed[rid] = true
+		}
+		kept := make([]session.AppliedVoucher, 0, len(entity.Vouchers))
+		for _, v := range entity.Vouchers {
+			if !removed[v.RedemptionID] {
+				kept = append(kept, v)
+			}
+		}
+		entity.Vouchers = kept
+		entity.VoucherID = nil
+		if len(kept) > 0 {
+			entity.VoucherID = &kept[len(kept)-1].VoucherID
+		}
+		return nil
+	})
+}
+
+// reprice loads the session under its row lock, lets change edit it and
+// saves the new pricing in the same transaction, so concurrent vouchers and
+// charges cannot overwrite each other.
+func (s *Service) reprice(ctx context.Context, id string, change func(entity *session.Session) error) (*session.Session, error) {
+	var entity *session.Session
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		entity, err = s.repo.GetForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := change(entity); err != nil {
+			return err
+		}
+		if err := s.applyPricing(ctx, entity); err != nil {
+			return err
+		}
+		if err := s.repo.UpdatePricing(ctx, entity); err != nil {
+			return err
+		}
+		return s.changed(ctx, entity)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (s *Service) changed(ctx context.Context, entity *session.Session) error {
+	for _, l := range s.changes {
+		if err := l.SessionChanged(ctx, entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixBasePrice takes a session without a BasePrice, priced before the
+// booth started sending one, as based on its TotalPrice.
+func fixBasePrice(entity *session.Session) error {
+	if entity.BasePrice != nil {
+		return nil
+	}
+	if entity.TotalPrice == nil {
+		return ErrSessionNotPriced
+	}
+	base := *entity.TotalPrice
+	entity.BasePrice = &base
+	return nil
+}
+
+// applyPricing derives TotalPrice and the discount breakdown from BasePrice
+// when the booth supplied one, using the stacking rules in session.Price,
+// then adds the session's charges. Sessions without a BasePrice keep
+// whatever TotalPrice the booth sent.
+func (s *Service) applyPricing(ctx context.Context, entity *session.Session) error {
+	if entity.BasePrice == nil {
+		return nil
+	}
+	percent, err := s.tierPercent(ctx, entity)
+	if err != nil {
+		return err
+	}
+	if entity.UserID != nil {
+		entity.TierPercent = &percent
+	}
+	breakdown := session.Price(*entity.BasePrice, percent, entity.Vouchers, s.pricing)
+	tierDiscount := breakdown.Sum(session.SourceTier)
+	voucherDiscount := breakdown.Sum(session.SourceVoucher)
+	entity.Discounts = breakdown.Lines
+	entity.TierDiscount = &tierDiscount
+	entity.VoucherDiscount = &voucherDiscount
+	total := breakdown.TotalWith(entity.Charges)
+	entity.TotalPrice = &total
+	return nil
+}
+
+// tierPercent is the session's snapshot of the customer's tier discount,
+// or their current one when the session has not been priced for them yet.
+func (s *Service) tierPercent(ctx context.Context, entity *session.Session) (float64, error) {
+	if entity.TierPercent != nil {
+		return *entity.TierPercent, nil
+	}
+	if entity.UserID == nil || s.discounts == nil {
+		return 0, nil
+	}
+	return s.discounts.SessionDiscount(ctx, *entity.UserID)
+}
@@ -3,18 +3,40 @@ package user
 import (
 	"context"
 	"errors"
+	"math"
+	"sort"
+	"time"
 
 	domain "go-ddd-clean/internal/domain/user"
 
 	"github.com/google/uuid"
 )
 
+// pointsLifetimeMonths is how long earned points stay valid under the
+// loyalty terms.
+const pointsLifetimeMonths = 12
+
+// tierWindowMonths is the trailing window used to qualify for a tier.
+const tierWindowMonths = 12
+
+// Transactor runs fn in one database transaction. Repository calls made
+// with the context it passes take part in it.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type Service struct {
-	repo domain.Repository
+	repo       domain.Repository
+	pointsRepo domain.PointsRepository
+	tx         Transactor
 }
 
-func NewService(repo domain.Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo domain.Repository, pointsRepo domain.PointsRepository, tx Transactor) *Service {
+	return &Service{
+		repo:       repo,
+		pointsRepo: pointsRepo,
+		tx:         tx,
+	}
 }
 
 type CreateUserInput struct {
@@ -30,7 +52,17 @@ type UpdateUserInput struct {
 	Email    *string
 	Password *string
 	Role     *domain.Role
-	Points   *int
+}
+
+type ExpirePointsResult struct {
+	Lots   int
+	Points int
+	Users  int
+}
+
+type RecomputeTiersResult struct {
+	Users   int
+	Changed int
 }
 
 func (s *Service) Create(ctx context.Context, input CreateUserInput) (*domain.User, error) {
@@ -38,13 +70,18 @@ func (s *Service) Create(ctx context.Context, input CreateUserInput) (*domain.Us
 	if role == "" {
 		role = domain.RoleCustomer
 	}
+	password, err := hashOptional(input.Password)
+	if err != nil {
+		return nil, err
+	}
 	entity := &domain.User{
 		ID:       uuid.NewString(),
 		Tel:      input.Tel,
 		Email:    input.Email,
-		Password: input.Password,
+		Password: password,
 		Role:     role,
 		Points:   0,
+		Tier:     domain.TierMember,
 	}
 	if err := s.repo.Create(ctx, entity); err != nil {
 		return nil, err
@@ -53,45 +90,247 @@ func (s *Service) Create(ctx context.Context, input CreateUserInput) (*domain.Us
 }
 
 func (s *Service) Update(ctx context.Context, input UpdateUserInput) (*domain.User, error) {
-	entity, err := s.repo.GetByID(ctx, input.ID)
+	var entity *domain.User
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		entity, err = s.repo.GetForUpdate(ctx, input.ID)
+		if err != nil {
+			return err
+		}
+		if input.Tel != nil {
+			entity.Tel = input.Tel
+		}
+		if input.Email != nil {
+			entity.Email = input.Email
+		}
+		if input.Password != nil {
+			entity.Password, err = hashOptional(input.Password)
+			if err != nil {
+				return err
+			}
+		}
+		if input.Role != nil {
+			entity.Role = *input.Role
+		}
+		return s.repo.Update(ctx, entity)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if input.Tel != nil {
-		entity.Tel = input.Tel
+	return entity, nil
+}
+
+// AdjustPoints earns or spends delta points. The ledger, the lots and the
+// balance change together under the user's row lock.
+func (s *Service) AdjustPoints(ctx context.Context, userID string, delta int) (*domain.User, error) {
+	var entity *domain.User
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		entity, err = s.repo.GetForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		newPoints := entity.Points + delta
+		if newPoints < 0 {
+			return errors.New("points cannot be negative")
+		}
+		switch {
+		case delta > 0:
+			if err := s.earnPoints(ctx, userID, delta); err != nil {
+				return err
+			}
+		case delta < 0:
+			if err := s.spendPoints(ctx, userID, -delta); err != nil {
+				return err
+			}
+		}
+		entity.Points = newPoints
+		return s.repo.UpdatePoints(ctx, userID, newPoints)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if input.Email != nil {
-		entity.Email = input.Email
+	return entity, nil
+}
+
+// EarnPoints credits base points scaled by the user's tier multiplier.
+func (s *Service) EarnPoints(ctx context.Context, userID string, base int) (*domain.User, error) {
+	if base <= 0 {
+		return nil, errors.New("points to earn must be positive")
 	}
-	if input.Password != nil {
-		entity.Password = input.Password
+	entity, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
-	if input.Role != nil {
-		entity.Role = *input.Role
+	multiplier := domain.RuleFor(entity.Tier).PointsMultiplier
+	return s.AdjustPoints(ctx, userID, int(math.Floor(float64(base)*multiplier)))
+}
+
+// SessionDiscount returns the automatic percentage discount the user's tier
+// grants on a session.
+func (s *Service) SessionDiscount(ctx context.Context, userID string) (float64, error) {
+	entity, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return domain.RuleFor(entity.Tier).SessionDiscount, nil
+}
+
+// RecomputeTiers re-evaluates every user's tier against their trailing
+// twelve months of paid sessions and stores any that changed.
+func (s *Service) RecomputeTiers(ctx context.Context, asOf time.Time) (*RecomputeTiersResult, error) {
+	activity, err := s.repo.ListActivity(ctx, asOf.AddDate(0, -tierWindowMonths, 0))
+	if err != nil {
+		return nil, err
 	}
-	if input.Points != nil {
-		entity.Points = *input.Points
+	byUser := make(map[string]domain.Activity, len(activity))
+	for _, a := range activity {
+		byUser[a.UserID] = a
 	}
-	if err := s.repo.Update(ctx, entity); err != nil {
+	users, err := s.repo.List(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return entity, nil
+	result := &RecomputeTiersResult{Users: len(users)}
+	for i := range users {
+		entity := &users[i]
+		a := byUser[entity.ID]
+		tier := domain.TierFor(a.Spend, a.Sessions)
+		if tier == entity.Tier {
+			continue
+		}
+		if err := s.repo.UpdateTier(ctx, entity.ID, tier, asOf); err != nil {
+			return nil, err
+		}
+		result.Changed++
+	}
+	return result, nil
 }
 
-func (s *Service) AdjustPoints(ctx context.Context, userID string, delta int) (*domain.User, error) {
-	entity, err := s.repo.GetByID(ctx, userID)
+func (s *Service) PointsHistory(ctx context.Context, userID string) ([]domain.PointsEntry, error) {
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.pointsRepo.ListByUser(ctx, userID)
+}
+
+// ExpirePoints closes every earn lot whose expiry has passed, writing an
+// expire entry for whatever was left in the lot and deducting it from the
+// user's balance. Each user's lots are expired in one transaction under the
+// user's row lock, re-read there so points spent meanwhile are not expired
+// again.
+func (s *Service) ExpirePoints(ctx context.Context, asOf time.Time) (*ExpirePointsResult, error) {
+	lots, err := s.pointsRepo.ListExpiredLots(ctx, asOf)
 	if err != nil {
 		return nil, err
 	}
-	newPoints := entity.Points + delta
-	if newPoints < 0 {
-		return nil, errors.New("points cannot be negative")
+	result := &ExpirePointsResult{}
+	seen := make(map[string]bool)
+	for _, lot := range lots {
+		if seen[lot.UserID] {
+			continue
+		}
+		seen[lot.UserID] = true
+		var closed, expired int
+		err := s.tx.InTx(ctx, func(ctx context.Context) error {
+			var err error
+			closed, expired, err = s.expireUserPoints(ctx, lot.UserID, asOf)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Lots += closed
+		result.Points += expired
+		if closed > 0 {
+			result.Users++
+		}
 	}
-	entity.Points = newPoints
-	if err := s.repo.Update(ctx, entity); err != nil {
+	return result, nil
+}
+
+func (s *Service) expireUserPoints(ctx context.Context, userID string, asOf time.Time) (int, int, error) {
+	entity, err := s.repo.GetForUpdate(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	open, err := s.pointsRepo.ListOpenLots(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	closed, total := 0, 0
+	for _, lot := range open {
+		if lot.ExpiresAt == nil || lot.ExpiresAt.After(asOf) {
+			continue
+		}
+		expired := min(lot.Remaining, entity.Points)
+		if err := s.pointsRepo.UpdateRemaining(ctx, lot.ID, 0); err != nil {
+			return 0, 0, err
+		}
+		closed++
+		// A lot the balance no longer covers is closed without an entry.
+		if expired == 0 {
+			continue
+		}
+		lotID := lot.ID
+		entry := &domain.PointsEntry{
+			ID:     uuid.NewString(),
+			UserID: userID,
+			Type:   domain.PointsEntryExpire,
+			Points: -expired,
+			LotID:  &lotID,
+		}
+		if err := s.pointsRepo.Create(ctx, entry); err != nil {
+			return 0, 0, err
+		}
+		entity.Points -= expired
+		total += expired
+	}
+	if total == 0 {
+		return closed, 0, nil
+	}
+	return closed, total, s.repo.UpdatePoints(ctx, userID, entity.Points)
+}
+
+// UpcomingExpiry reports, per user, how many points will lapse between asOf
+// and asOf+within, along with the earliest of those expiry dates.
+func (s *Service) UpcomingExpiry(ctx context.Context, asOf time.Time, within time.Duration) ([]domain.ExpiryNotice, error) {
+	lots, err := s.pointsRepo.ListExpiringLots(ctx, asOf, asOf.Add(within))
+	if err != nil {
 		return nil, err
 	}
-	return entity, nil
+	byUser := make(map[string]*domain.ExpiryNotice)
+	for _, lot := range lots {
+		if lot.Remaining <= 0 || lot.ExpiresAt == nil {
+			continue
+		}
+		notice, ok := byUser[lot.UserID]
+		if !ok {
+			entity, err := s.repo.GetByID(ctx, lot.UserID)
+			if err != nil {
+				return nil, err
+			}
+			notice = &domain.ExpiryNotice{
+				UserID:    entity.ID,
+				Tel:       entity.Tel,
+				Email:     entity.Email,
+				ExpiresAt: *lot.ExpiresAt,
+			}
+			byUser[lot.UserID] = notice
+		}
+		notice.Points += lot.Remaining
+		if lot.ExpiresAt.Before(notice.ExpiresAt) {
+			notice.ExpiresAt = *lot.ExpiresAt
+		}
+	}
+	result := make([]domain.ExpiryNotice, 0, len(byUser))
+	for _, notice := range byUser {
+		result = append(result, *notice)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExpiresAt.Before(result[j].ExpiresAt)
+	})
+	return result, nil
 }
 
 func (s *Service) Delete(ctx context.Context, id string) error {
@@ -109,3 +348,57 @@ func (s *Service) GetByEmail(ctx context.Context, email string) (*domain.User, e
 func (s *Service) List(ctx context.Context) ([]domain.User, error) {
 	return s.repo.List(ctx)
 }
+
+// hashOptional hashes a password that is being set; passwords are never
+// stored as given.
+func hashOptional(password *string) (*string, error) {
+	if password == nil {
+		return nil, nil
+	}
+	hashed, err := hashPassword(*password)
+	if err != nil {
+		return nil, err
+	}
+	return &hashed, nil
+}
+
+func (s *Service) earnPoints(ctx context.Context, userID string, points int) error {
+	expiresAt := time.Now().AddDate(0, pointsLifetimeMonths, 0)
+	return s.pointsRepo.Create(ctx, &domain.PointsEntry{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Type:      domain.PointsEntryEarn,
+		Points:    points,
+		Remaining: points,
+		ExpiresAt: &expiresAt,
+	})
+}
+
+// spendPoints draws points from the oldest open lots first. Any shortfall is
+// taken from balance that predates the points history and has no lot.
+func (s *Service) spendPoints(ctx context.Context, userID string, points int) error {
+	lots, err := s.pointsRepo.ListOpenLots(ctx, userID)
+	if err != nil {
+		return err
+	}
+	left := points
+	for _, lot := range lots {
+		if left == 0 {
+			break
+		}
+		take := lot.Remaining
+		if take > left {
+			take = left
+		}
+		if err := s.pointsRepo.UpdateRemaining(ctx, lot.ID, lot.Remaining-take); err != nil {
+			return err
+		}
+		left -= take
+	}
+	return s.pointsRepo.Create(ctx, &domain.PointsEntry{
+		ID:     uuid.NewString(),
+		UserID: userID,
+		Type:   domain.PointsEntrySpend,
+		Points: -points,
+	})
+}
@@ -0,0 +1,124 @@
+package user
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/user"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	userAccessTokenType = "user_access"
+	// userTokenTTL is how long a login lasts before staff sign in again.
+	userTokenTTL = 12 * time.Hour
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidUserToken   = errors.New("invalid user token")
+)
+
+type userClaims struct {
+	UserID string `json:"user_id"`
+	Type   string `json:"type"`
+	jwt.RegisteredClaims
+}
+
+// ValidatedToken is the signed-in user behind a request. Role is read from
+// the user's current record, so a demotion takes effect straight away.
+type ValidatedToken struct {
+	UserID string
+	Role   domain.Role
+}
+
+// TokenService signs users in with their email and password and checks the
+// tokens it hands out.
+type TokenService struct {
+	repo   domain.Repository
+	secret []byte
+}
+
+func NewTokenService(repo domain.Repository, secret string) *TokenService {
+	return &TokenService{
+		repo:   repo,
+		secret: []byte(secret),
+	}
+}
+
+func (s *TokenService) Login(ctx context.Context, email string, password string) (string, error) {
+	entity, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+	if entity.Password == nil || !checkPassword(*entity.Password, password) {
+		return "", ErrInvalidCredentials
+	}
+	if !isPasswordHash(*entity.Password) {
+		// Passwords stored before hashing are upgraded on first login.
+		hashed, err := hashPassword(password)
+		if err != nil {
+			return "", err
+		}
+		entity.Password = &hashed
+		if err := s.repo.Update(ctx, entity); err != nil {
+			return "", err
+		}
+	}
+	now := time.Now()
+	claims := userClaims{
+		UserID: entity.ID,
+		Type:   userAccessTokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(userTokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+func (s *TokenService) Validate(ctx context.Context, token string) (*ValidatedToken, error) {
+	claims := &userClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return s.secret, nil
+	}, jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidUserToken
+	}
+	if claims.Type != userAccessTokenType || claims.UserID == "" {
+		return nil, ErrInvalidUserToken
+	}
+	entity, err := s.repo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidUserToken
+	}
+	return &ValidatedToken{UserID: entity.ID, Role: entity.Role}, nil
+}
+
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2")
+}
+
+func checkPassword(stored string, password string) bool {
+	if isPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
@@ -0,0 +1,232 @@
+package voucher
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	domain "go-ddd-clean/internal/domain/voucher"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxCampaignQuantity = 20000
+	// codeSpaceFactor is how much larger the pattern's code space must be
+	// than the batch, so random codes rarely collide and are hard to guess.
+	codeSpaceFactor = 100
+	// maxGenerationRounds bounds how often colliding codes are redrawn.
+	maxGenerationRounds = 10
+	existingCodesChunk  = 1000
+)
+
+const (
+	patternDigit = '#'
+	patternAlnum = '?'
+	digits       = "0123456789"
+	// alnum leaves out 0/O and 1/I so printed codes are easy to type.
+	alnum = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+type CampaignService struct {
+	campaignRepo domain.CampaignRepository
+	voucherRepo  domain.Repository
+}
+
+func NewCampaignService(campaignRepo domain.CampaignRepository, voucherRepo domain.Repository) *CampaignService {
+	return &CampaignService{
+		campaignRepo: campaignRepo,
+		voucherRepo:  voucherRepo,
+	}
+}
+
+// CreateCampaignInput describes a batch of codes. In CodePattern '#' is a
+// random digit, '?' a random letter or digit, and anything else is literal,
+// e.g. "PARTNER-????-####".
+type CreateCampaignInput struct {
+	Name         string
+	CodePattern  string
+	Quantity     int
+	Type         domain.Type
+	Value        float64
+	Unit         domain.Unit
+	MaxUsage     int
+	ValidFrom    *time.Time
+	ValidTo      *time.Time
+	Active       bool
+	Restrictions domain.Restrictions
+}
+
+func (s *CampaignService) Create(ctx context.Context, input CreateCampaignInput) (*domain.Campaign, error) {
+	if input.Name == "" {
+		return nil, errors.New("campaign name required")
+	}
+	if input.Quantity <= 0 || input.Quantity > maxCampaignQuantity {
+		return nil, errors.New("quantity must be between 1 and 20000")
+	}
+	pattern := strings.ToUpper(input.CodePattern)
+	if err := validatePattern(pattern, input.Quantity); err != nil {
+		return nil, err
+	}
+	if err := validateRestrictions(input.Restrictions); err != nil {
+		return nil, err
+	}
+	if input.MaxUsage == 0 {
+		input.MaxUsage = 1
+	}
+	codes, err := generateCodes(ctx, s.voucherRepo, pattern, input.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	campaign := &domain.Campaign{
+		ID:           uuid.NewString(),
+		Name:         input.Name,
+		CodePattern:  pattern,
+		Quantity:     input.Quantity,
+		Type:         input.Type,
+		Value:        input.Value,
+		Unit:         input.Unit,
+		MaxUsage:     input.MaxUsage,
+		ValidFrom:    input.ValidFrom,
+		ValidTo:      input.ValidTo,
+		Active:       input.Active,
+		Restrictions: input.Restrictions,
+	}
+	vouchers := make([]domain.Voucher, 0, len(codes))
+	for _, code := range codes {
+		vouchers = append(vouchers, domain.Voucher{
+			ID:           uuid.NewString(),
+			Code:         code,
+			Type:         campaign.Type,
+			Value:        campaign.Value,
+			Unit:         campaign.Unit,
+			MaxUsage:     campaign.MaxUsage,
+			ValidFrom:    campaign.ValidFrom,
+			ValidTo:      campaign.ValidTo,
+			Active:       campaign.Active,
+			CampaignID:   &campaign.ID,
+			Restrictions: campaign.Restrictions,
+		})
+	}
+	if err := s.campaignRepo.Create(ctx, campaign, vouchers); err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+func (s *CampaignService) Get(ctx context.Context, id string) (*domain.Campaign, error) {
+	return s.campaignRepo.GetByID(ctx, id)
+}
+
+func (s *CampaignService) List(ctx context.Context) ([]domain.Campaign, error) {
+	return s.campaignRepo.List(ctx)
+}
+
+func (s *CampaignService) Stats(ctx context.Context, id string) (*domain.CampaignStats, error) {
+	if _, err := s.campaignRepo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.campaignRepo.Stats(ctx, id, time.Now())
+}
+
+func (s *CampaignService) Vouchers(ctx context.Context, id string) ([]domain.Voucher, error) {
+	if _, err := s.campaignRepo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.campaignRepo.ListVouchers(ctx, id)
+}
+
+func validatePattern(pattern string, quantity int) error {
+	space := 1.0
+	for _, r := range pattern {
+		switch r {
+		case patternDigit:
+			space *= float64(len(digits))
+		case patternAlnum:
+			space *= float64(len(alnum))
+		}
+	}
+	if space == 1 {
+		return errors.New("code_pattern needs at least one '#' or '?' placeholder")
+	}
+	if space < float64(quantity)*codeSpaceFactor {
+		return errors.New("code_pattern is too short for this quantity; add more '#' or '?' placeholders")
+	}
+	return nil
+}
+
+// generateCodes draws unique codes from pattern, redrawing any that collide
+// within the batch or with vouchers already in the database. The unique index
+// on voucher codes remains the final guard when the batch is inserted.
+func generateCodes(ctx context.Context, repo domain.Repository, pattern string, quantity int) ([]string, error) {
+	seen := make(map[string]struct{}, quantity)
+	codes := make([]string, 0, quantity)
+	for round := 0; len(codes) < quantity; round++ {
+		if round == maxGenerationRounds {
+			return nil, errors.New("could not generate enough unique codes; use a longer code_pattern")
+		}
+		candidates := make([]string, 0, quantity-len(codes))
+		for len(candidates) < quantity-len(codes) {
+			code, err := randomCode(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := seen[code]; ok {
+				continue
+			}
+			seen[code] = struct{}{}
+			candidates = append(candidates, code)
+		}
+		taken, err := existingCodes(ctx, repo, candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range candidates {
+			if _, ok := taken[code]; !ok {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes, nil
+}
+
+func existingCodes(ctx context.Context, repo domain.Repository, codes []string) (map[string]struct{}, error) {
+	taken := make(map[string]struct{})
+	for start := 0; start < len(codes); start += existingCodesChunk {
+		end := min(start+existingCodesChunk, len(codes))
+		existing, err := repo.ExistingCodes(ctx, codes[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range existing {
+			taken[code] = struct{}{}
+		}
+	}
+	return taken, nil
+}
+
+func randomCode(pattern string) (string, error) {
+	var b strings.Builder
+	b.Grow(len(pattern))
+	for _, r := range pattern {
+		var charset string
+		switch r {
+		case patternDigit:
+			charset = digits
+		case patternAlnum:
+			charset = alnum
+		default:
+			b.WriteRune(r)
+			continue
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(charset[n.Int64()])
+	}
+	return b.String(), nil
+}
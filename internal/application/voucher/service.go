@@ -3,57 +3,105 @@ package voucher
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"go-ddd-clean/internal/domain/booth"
+	"go-ddd-clean/internal/domain/session"
 	domain "go-ddd-clean/internal/domain/voucher"
 
 	"github.com/google/uuid"
 )
 
+// localTime is the shop's wall clock used for weekday and hour
+// restrictions. Thailand has no daylight saving, so a fixed zone is enough.
+var localTime = time.FixedZone("ICT", 7*60*60)
+
+// Sessions prices vouchers into a session using the session's stacking
+// rules.
+type Sessions interface {
+	Get(ctx context.Context, id string) (*session.Session, error)
+	Lock(ctx context.Context, id string) (*session.Session, error)
+	Quote(ctx context.Context, entity *session.Session, extra ...session.AppliedVoucher) (session.Breakdown, error)
+	AddVoucher(ctx context.Context, sessionID string, applied session.AppliedVoucher) (*session.Session, error)
+	RemoveVouchers(ctx context.Context, sessionID string, redemptionIDs []string) (*session.Session, error)
+}
+
+// Booths resolves the booth a session runs on for branch and booth
+// restrictions.
+type Booths interface {
+	Get(ctx context.Context, id string) (*booth.Booth, error)
+}
+
+// Transactor runs fn in one database transaction, so a redemption and the
+// session it discounts are saved together or not at all.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type Service struct {
 	voucherRepo    domain.Repository
 	redemptionRepo domain.RedemptionRepository
+	sessions       Sessions
+	booths         Booths
+	tx             Transactor
 }
 
-func NewService(voucherRepo domain.Repository, redemptionRepo domain.RedemptionRepository) *Service {
+func NewService(voucherRepo domain.Repository, redemptionRepo domain.RedemptionRepository, sessions Sessions, booths Booths, tx Transactor) *Service {
 	return &Service{
 		voucherRepo:    voucherRepo,
 		redemptionRepo: redemptionRepo,
+		sessions:       sessions,
+		booths:         booths,
+		tx:             tx,
 	}
 }
 
 type CreateVoucherInput struct {
-	Code      string
-	Type      domain.Type
-	Value     float64
-	Unit      domain.Unit
-	MaxUsage  int
-	ValidFrom *time.Time
-	ValidTo   *time.Time
-	Active    bool
+	Code         string
+	Type         domain.Type
+	Value        float64
+	Unit         domain.Unit
+	MaxUsage     int
+	ValidFrom    *time.Time
+	ValidTo      *time.Time
+	Active       bool
+	Restrictions domain.Restrictions
 }
 
 type UpdateVoucherInput struct {
-	ID        string
-	Value     *float64
-	Unit      *domain.Unit
-	MaxUsage  *int
-	ValidFrom *time.Time
-	ValidTo   *time.Time
-	Active    *bool
+	ID             string
+	Value          *float64
+	Unit           *domain.Unit
+	MaxUsage       *int
+	ValidFrom      *time.Time
+	ValidTo        *time.Time
+	Active         *bool
+	BranchIDs      []string
+	BoothIDs       []string
+	BoothType      *string
+	MinSpend       *float64
+	MaxPerCustomer *int
+	Weekdays       []time.Weekday
+	HourFrom       *int
+	HourTo         *int
+	Stackable      *bool
 }
 
 type RedeemVoucherInput struct {
 	Code      string
 	SessionID string
 	Tel       *string
-	Discount  *float64
 }
 
 func (s *Service) Create(ctx context.Context, input CreateVoucherInput) (*domain.Voucher, error) {
 	if input.MaxUsage == 0 {
 		input.MaxUsage = 1
 	}
+	if err := validateRestrictions(input.Restrictions); err != nil {
+		return nil, err
+	}
 	entity := &domain.Voucher{
 		ID:        uuid.NewString(),
 		Code:      input.Code,
@@ -64,6 +112,8 @@ func (s *Service) Create(ctx context.Context, input CreateVoucherInput) (*domain
 		ValidFrom: input.ValidFrom,
 		ValidTo:   input.ValidTo,
 		Active:    input.Active,
+
+		Restrictions: input.Restrictions,
 	}
 	if err := s.voucherRepo.Create(ctx, entity); err != nil {
 		return nil, err
@@ -71,6 +121,21 @@ func (s *Service) Create(ctx context.Context, input CreateVoucherInput) (*domain
 	return entity, nil
 }
 
+// Issue creates a voucher with a fresh code drawn from pattern, using the
+// same pattern syntax as campaigns. input.Code is ignored.
+func (s *Service) Issue(ctx context.Context, pattern string, input CreateVoucherInput) (*domain.Voucher, error) {
+	pattern = strings.ToUpper(pattern)
+	if err := validatePattern(pattern, 1); err != nil {
+		return nil, err
+	}
+	codes, err := generateCodes(ctx, s.voucherRepo, pattern, 1)
+	if err != nil {
+		return nil, err
+	}
+	input.Code = codes[0]
+	return s.Create(ctx, input)
+}
+
 func (s *Service) Update(ctx context.Context, input UpdateVoucherInput) (*domain.Voucher, error) {
 	entity, err := s.voucherRepo.GetByID(ctx, input.ID)
 	if err != nil {
@@ -94,6 +159,39 @@ func (s *Service) Update(ctx context.Context, input UpdateVoucherInput) (*domain
 	if input.Active != nil {
 		entity.Active = *input.Active
 	}
+	if input.BranchIDs != nil {
+		entity.BranchIDs = input.BranchIDs
+	}
+	if input.BoothIDs != nil {
+		entity.BoothIDs = input.BoothIDs
+	}
+	if input.BoothType != nil {
+		entity.BoothType = input.BoothType
+		if *input.BoothType == "" {
+			entity.BoothType = nil
+		}
+	}
+	if input.MinSpend != nil {
+		entity.MinSpend = input.MinSpend
+	}
+	if input.MaxPerCustomer != nil {
+		entity.MaxPerCustomer = *input.MaxPerCustomer
+	}
+	if input.Weekdays != nil {
+		entity.Weekdays = input.Weekdays
+	}
+	if input.HourFrom != nil {
+		entity.HourFrom = input.HourFrom
+	}
+	if input.HourTo != nil {
+		entity.HourTo = input.HourTo
+	}
+	if input.Stackable != nil {
+		entity.Stackable = *input.Stackable
+	}
+	if err := validateRestrictions(entity.Restrictions); err != nil {
+		return nil, err
+	}
 	if err := s.voucherRepo.Update(ctx, entity); err != nil {
 		return nil, err
 	}
@@ -116,38 +214,318 @@ func (s *Service) List(ctx context.Context, activeOnly bool) ([]domain.Voucher,
 	return s.voucherRepo.List(ctx, activeOnly)
 }
 
-func (s *Service) Redeem(ctx context.Context, input RedeemVoucherInput) (*domain.Redemption, *domain.Voucher, error) {
+// Redeem applies the voucher to the session. The discount is worked out by
+// the session's stacking rules from the voucher terms and the session's own
+// price, and the session total is updated to match. The session is locked
+// while the voucher is checked against it, and the redemption and the new
+// total commit together. Only a session still in progress takes vouchers:
+// a paid, failed or cancelled one has no price left to change. Every way a voucher can be refused comes back as a
+// *domain.RejectionError.
+func (s *Service) Redeem(ctx context.Context, input RedeemVoucherInput) (*domain.Redemption, *domain.Voucher, *session.Session, error) {
+	var (
+		redemption *domain.Redemption
+		v          *domain.Voucher
+		updated    *session.Session
+	)
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		sess, err := s.sessions.Lock(ctx, input.SessionID)
+		if err != nil {
+			return err
+		}
+		if sess.Status != session.StatusStarted {
+			return domain.ErrSessionClosed
+		}
+		tel := input.Tel
+		if tel == nil {
+			tel = sess.PhoneTemp
+		}
+		redemption = &domain.Redemption{
+			ID:        uuid.NewString(),
+			SessionID: input.SessionID,
+			UserID:    sess.UserID,
+			Tel:       tel,
+		}
+		check, err := s.newRedemptionCheck(ctx, sess, redemption.UserID, redemption.Tel)
+		if err != nil {
+			return err
+		}
+		v, err = s.redemptionRepo.Redeem(ctx, input.Code, redemption, func(v *domain.Voucher, customerUses int) error {
+			quote, err := check.evaluate(ctx, v, customerUses, redemption.ID)
+			if err != nil {
+				return err
+			}
+			line, _ := quote.Line(redemption.ID)
+			redemption.Discount = &line.Amount
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		updated, err = s.sessions.AddVoucher(ctx, input.SessionID, appliedVoucher(v, redemption.ID))
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return redemption, v, updated, nil
+}
+
+type ValidateVoucherInput struct {
+	Code      string
+	SessionID *string
+	// BoothID, Price and the customer fields describe a hypothetical
+	// session when SessionID is not given.
+	BoothID string
+	Price   *float64
+	UserID  *string
+	Tel     *string
+}
+
+// Validation is the outcome of a dry-run redemption. When Valid is false,
+// Reason and Message say why and the amounts are zero.
+type Validation struct {
+	Valid     bool
+	Reason    domain.Reason
+	Message   string
+	Voucher   *domain.Voucher
+	Discount  float64
+	Total     float64
+	Breakdown session.Breakdown
+}
+
+// Validate runs every check Redeem would, plus the discount calculation,
+// without storing anything. Voucher refusals are reported in the result;
+// the error is only for lookups that fail.
+func (s *Service) Validate(ctx context.Context, input ValidateVoucherInput) (*Validation, error) {
+	var sess *session.Session
+	if input.SessionID != nil {
+		found, err := s.sessions.Get(ctx, *input.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if found.Status != session.StatusStarted {
+			return rejected(domain.ErrSessionClosed, nil), nil
+		}
+		sess = found
+	} else {
+		sess = &session.Session{
+			BoothID:   input.BoothID,
+			UserID:    input.UserID,
+			BasePrice: input.Price,
+			PhoneTemp: input.Tel,
+		}
+	}
+	userID := sess.UserID
+	tel := input.Tel
+	if tel == nil {
+		tel = sess.PhoneTemp
+	}
 	v, err := s.voucherRepo.GetByCode(ctx, input.Code)
+	if errors.Is(err, domain.ErrNotFound) {
+		return rejected(domain.ErrNotFound, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	check, err := s.newRedemptionCheck(ctx, sess, userID, tel)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	uses, err := s.redemptionRepo.CountCustomerRedemptions(ctx, v.ID, userID, tel)
+	if err != nil {
+		return nil, err
+	}
+	const previewID = "preview"
+	quote, err := check.evaluate(ctx, v, uses, previewID)
+	var rejection *domain.RejectionError
+	if errors.As(err, &rejection) {
+		return rejected(rejection, v), nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	line, _ := quote.Line(previewID)
+	return &Validation{
+		Valid:     true,
+		Voucher:   v,
+		Discount:  line.Amount,
+		Total:     quote.Total,
+		Breakdown: quote,
+	}, nil
+}
+
+func rejected(err error, v *domain.Voucher) *Validation {
+	var rejection *domain.RejectionError
+	errors.As(err, &rejection)
+	return &Validation{Reason: rejection.Reason, Message: rejection.Message, Voucher: v}
+}
+
+// redemptionCheck holds what a voucher is checked against for one session,
+// loaded once before the voucher row is locked.
+type redemptionCheck struct {
+	sessions Sessions
+	session  *session.Session
+	booth    *booth.Booth
+	spend    float64
+	userID   *string
+	tel      *string
+	now      time.Time
+}
+
+func (s *Service) newRedemptionCheck(ctx context.Context, sess *session.Session, userID *string, tel *string) (*redemptionCheck, error) {
+	b, err := s.booths.Get(ctx, sess.BoothID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.sessions.Quote(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+	return &redemptionCheck{
+		sessions: s.sessions,
+		session:  sess,
+		booth:    b,
+		spend:    current.Total,
+		userID:   userID,
+		tel:      tel,
+		now:      time.Now(),
+	}, nil
+}
+
+// evaluate checks v in the order Redeem reports failures and prices it into
+// the session under redemptionID.
+func (c *redemptionCheck) evaluate(ctx context.Context, v *domain.Voucher, customerUses int, redemptionID string) (session.Breakdown, error) {
+	if err := checkRedeemable(v, c.now); err != nil {
+		return session.Breakdown{}, err
+	}
+	for _, applied := range c.session.Vouchers {
+		if applied.VoucherID == v.ID {
+			return session.Breakdown{}, domain.ErrAlreadyRedeemed
+		}
+	}
+	if err := v.CheckRestrictions(domain.RedemptionContext{
+		BranchID:  c.booth.BranchID,
+		BoothID:   c.booth.ID,
+		BoothType: string(c.booth.Type),
+		Spend:     c.spend,
+		Customer:  c.userID != nil || c.tel != nil,
+		UserID:    c.userID,
+		Tel:       c.tel,
+		Uses:      customerUses,
+		At:        c.now.In(localTime),
+	}); err != nil {
+		return session.Breakdown{}, err
+	}
+	if err := checkStacking(v, c.session.Vouchers); err != nil {
+		return session.Breakdown{}, err
+	}
+	return c.sessions.Quote(ctx, c.session, appliedVoucher(v, redemptionID))
+}
+
+// SessionStatusChanged voids the session's redemptions when it is cancelled
+// or fails, so the customer's code can be used again.
+func (s *Service) SessionStatusChanged(ctx context.Context, entity *session.Session, previous session.Status) error {
+	if entity.Status != session.StatusCancelled && entity.Status != session.StatusFailed {
+		return nil
+	}
+	reversals, err := s.redemptionRepo.VoidBySession(ctx, entity.ID, "session "+string(entity.Status))
+	if err != nil || len(reversals) == 0 {
+		return err
+	}
+	redemptionIDs := make([]string, 0, len(reversals))
+	for _, r := range reversals {
+		redemptionIDs = append(redemptionIDs, r.RedemptionID)
+	}
+	_, err = s.sessions.RemoveVouchers(ctx, entity.ID, redemptionIDs)
+	return err
+}
+
+func (s *Service) ListRedemptions(ctx context.Context, voucherID string) ([]domain.Redemption, error) {
+	if _, err := s.voucherRepo.GetByID(ctx, voucherID); err != nil {
+		return nil, err
+	}
+	return s.redemptionRepo.ListByVoucher(ctx, voucherID)
+}
+
+func (s *Service) ListReversals(ctx context.Context, voucherID string) ([]domain.Reversal, error) {
+	if _, err := s.voucherRepo.GetByID(ctx, voucherID); err != nil {
+		return nil, err
+	}
+	return s.redemptionRepo.ListReversalsByVoucher(ctx, voucherID)
+}
+
+func checkRedeemable(v *domain.Voucher, now time.Time) error {
 	if !v.Active {
-		return nil, nil, errors.New("voucher inactive")
+		return domain.ErrInactive
 	}
-	now := time.Now()
 	if v.ValidFrom != nil && now.Before(*v.ValidFrom) {
-		return nil, nil, errors.New("voucher not yet valid")
+		return domain.ErrNotYetValid
 	}
 	if v.ValidTo != nil && now.After(*v.ValidTo) {
-		return nil, nil, errors.New("voucher expired")
+		return domain.ErrExpired
 	}
 	if v.MaxUsage > 0 && v.UsedCount >= v.MaxUsage {
-		return nil, nil, errors.New("voucher usage limit reached")
+		return domain.ErrUsageLimitReached
 	}
+	return nil
+}
 
-	redemption := &domain.Redemption{
-		ID:        uuid.NewString(),
-		VoucherID: v.ID,
-		SessionID: input.SessionID,
-		Tel:       input.Tel,
-		Discount:  input.Discount,
+// checkStacking allows a second voucher on a session only when it and every
+// voucher already applied are stackable.
+func checkStacking(v *domain.Voucher, applied []session.AppliedVoucher) error {
+	if len(applied) == 0 {
+		return nil
+	}
+	if !v.Stackable {
+		return &domain.RejectionError{Reason: domain.ReasonNotStackable, Message: "voucher cannot be combined with other vouchers"}
+	}
+	for _, a := range applied {
+		if !a.Stackable {
+			return &domain.RejectionError{Reason: domain.ReasonNotStackable, Message: fmt.Sprintf("session already uses %s, which cannot be combined with other vouchers", a.Code)}
+		}
+	}
+	return nil
+}
+
+// appliedVoucher copies the voucher terms the session's pricing needs.
+func appliedVoucher(v *domain.Voucher, redemptionID string) session.AppliedVoucher {
+	kind := session.DiscountBaht
+	switch {
+	case v.Type == domain.TypeFree || v.Unit == domain.UnitSession:
+		kind = session.DiscountFree
+	case v.Unit == domain.UnitPercent:
+		kind = session.DiscountPercent
+	}
+	return session.AppliedVoucher{
+		RedemptionID: redemptionID,
+		VoucherID:    v.ID,
+		Code:         v.Code,
+		Kind:         kind,
+		Value:        v.Value,
+		Stackable:    v.Stackable,
+	}
+}
+
+func validateRestrictions(r domain.Restrictions) error {
+	if r.BoothType != nil && *r.BoothType != string(booth.BoothTypePhysical) && *r.BoothType != string(booth.BoothTypeVirtual) {
+		return errors.New("booth_type must be physical or virtual")
+	}
+	if r.MinSpend != nil && *r.MinSpend < 0 {
+		return errors.New("min_spend cannot be negative")
+	}
+	if r.MaxPerCustomer < 0 {
+		return errors.New("max_per_customer cannot be negative")
+	}
+	for _, d := range r.Weekdays {
+		if d < time.Sunday || d > time.Saturday {
+			return errors.New("weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
 	}
-	if err := s.redemptionRepo.Create(ctx, redemption); err != nil {
-		return nil, nil, err
+	if (r.HourFrom == nil) != (r.HourTo == nil) {
+		return errors.New("hour_from and hour_to must be set together")
 	}
-	v.UsedCount++
-	if err := s.voucherRepo.Update(ctx, v); err != nil {
-		return nil, nil, err
+	if r.HourFrom != nil && (*r.HourFrom < 0 || *r.HourFrom > 23 || *r.HourTo < 0 || *r.HourTo > 24) {
+		return errors.New("hour window must be within 0-24")
 	}
-	return redemption, v, nil
+	return nil
 }
@@ -0,0 +1,66 @@
+package voucher
+
+import (
+	"errors"
+	"testing"
+
+	"go-ddd-clean/internal/domain/session"
+	domain "go-ddd-clean/internal/domain/voucher"
+)
+
+func TestCheckStacking(t *testing.T) {
+	stackable := session.AppliedVoucher{Code: "STACK", Stackable: true}
+	exclusive := session.AppliedVoucher{Code: "ONLY", Stackable: false}
+	cases := []struct {
+		name      string
+		stackable bool
+		applied   []session.AppliedVoucher
+		rejected  bool
+	}{
+		{name: "first voucher that is not stackable", stackable: false, rejected: false},
+		{name: "first stackable voucher", stackable: true, rejected: false},
+		{name: "stackable on stackable", stackable: true, applied: []session.AppliedVoucher{stackable}, rejected: false},
+		{name: "not stackable on stackable", stackable: false, applied: []session.AppliedVoucher{stackable}, rejected: true},
+		{name: "stackable on not stackable", stackable: true, applied: []session.AppliedVoucher{exclusive}, rejected: true},
+		{name: "stackable on a mix", stackable: true, applied: []session.AppliedVoucher{stackable, exclusive}, rejected: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkStacking(&domain.Voucher{Code: "NEW", Restrictions: domain.Restrictions{Stackable: tc.stackable}}, tc.applied)
+			if !tc.rejected {
+				if err != nil {
+					t.Fatalf("expected the voucher to be accepted, got %v", err)
+				}
+				return
+			}
+			var rejection *domain.RejectionError
+			if !errors.As(err, &rejection) || rejection.Reason != domain.ReasonNotStackable {
+				t.Fatalf("expected a not_stackable rejection, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAppliedVoucherKind(t *testing.T) {
+	cases := []struct {
+		voucherType domain.Type
+		unit        domain.Unit
+		kind        session.DiscountKind
+	}{
+		{domain.TypeDiscount, domain.UnitPercent, session.DiscountPercent},
+		{domain.TypeDiscount, domain.UnitBaht, session.DiscountBaht},
+		{domain.TypeDiscount, domain.UnitSession, session.DiscountFree},
+		{domain.TypeFree, domain.UnitPercent, session.DiscountFree},
+		{domain.TypeFree, domain.UnitBaht, session.DiscountFree},
+	}
+	for _, tc := range cases {
+		v := &domain.Voucher{ID: "v", Code: "CODE", Type: tc.voucherType, Unit: tc.unit, Value: 10}
+		got := appliedVoucher(v, "r")
+		if got.Kind != tc.kind {
+			t.Errorf("%s %s: expected %s, got %s", tc.voucherType, tc.unit, tc.kind, got.Kind)
+		}
+		if got.RedemptionID != "r" || got.VoucherID != "v" || got.Code != "CODE" || got.Value != 10 {
+			t.Errorf("%s %s: terms not copied: %+v", tc.voucherType, tc.unit, got)
+		}
+	}
+}
@@ -20,14 +20,17 @@ const (
 )
 
 type Booth struct {
-	ID           string
-	BranchID     string
-	Name         string
-	Type         BoothType
-	Status       BoothStatus
-	Config       map[string]any
-	TokenVersion int
-	CreatedAt    time.Time
+	ID       string
+	BranchID string
+	Name     string
+	Type     BoothType
+	Status   BoothStatus
+	Config   map[string]any
+	// ExtraCopyPrice is what each extra print copy adds to a session; nil
+	// when the booth does not sell them.
+	ExtraCopyPrice *float64
+	TokenVersion   int
+	CreatedAt      time.Time
 }
 
 type Repository interface {
@@ -6,10 +6,15 @@ import (
 )
 
 type Branch struct {
-	ID        string
-	Name      string
-	Location  *string
-	CreatedAt time.Time
+	ID       string
+	Name     string
+	Location *string
+	// OriginalRetentionDays and RenderedRetentionDays are how long the
+	// branch keeps photo originals and rendered composites, counted from
+	// when the photo was taken. Nil keeps them until deleted.
+	OriginalRetentionDays *int
+	RenderedRetentionDays *int
+	CreatedAt             time.Time
 }
 
 type Repository interface {
@@ -0,0 +1,138 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidEffect = errors.New("invalid filter effect")
+
+// Effect is the typed form of Filter.Effect. Adjustments are percentages
+// from -100 to 100 where 0 leaves the image unchanged.
+type Effect struct {
+	Brightness float64
+	Contrast   float64
+	Saturation float64
+	// Temperature warms the image when positive and cools it when negative.
+	Temperature float64
+	Grayscale   bool
+	// Vignette darkens the corners, from 0 (off) to 100.
+	Vignette float64
+	// LUT is the URL of a 3D lookup table in .cube format.
+	LUT *string
+}
+
+const (
+	effectBrightness  = "brightness"
+	effectContrast    = "contrast"
+	effectSaturation  = "saturation"
+	effectTemperature = "temperature"
+	effectGrayscale   = "grayscale"
+	effectVignette    = "vignette"
+	effectLUT         = "lut"
+	// effectDesaturate is the key filters used for grayscale before the
+	// schema existed; it is still read but saved as grayscale.
+	effectDesaturate = "desaturate"
+)
+
+// ParseEffect reads a filter's effect map, rejecting unknown keys and
+// values out of range.
+func ParseEffect(raw map[string]any) (Effect, error) {
+	var e Effect
+	var unknown []string
+	for key, value := range raw {
+		var err error
+		switch key {
+		case effectBrightness:
+			e.Brightness, err = effectAmount(key, value, -100)
+		case effectContrast:
+			e.Contrast, err = effectAmount(key, value, -100)
+		case effectSaturation:
+			e.Saturation, err = effectAmount(key, value, -100)
+		case effectTemperature:
+			e.Temperature, err = effectAmount(key, value, -100)
+		case effectVignette:
+			e.Vignette, err = effectAmount(key, value, 0)
+		case effectGrayscale, effectDesaturate:
+			on, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("%w: %s must be true or false", ErrInvalidEffect, key)
+			}
+			e.Grayscale = e.Grayscale || on
+		case effectLUT:
+			ref, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("%w: lut must be the URL of a .cube file", ErrInvalidEffect)
+			} else if ref = strings.TrimSpace(ref); ref != "" {
+				if !strings.HasSuffix(strings.ToLower(ref), ".cube") {
+					err = fmt.Errorf("%w: lut must be the URL of a .cube file", ErrInvalidEffect)
+				}
+				e.LUT = &ref
+			}
+		default:
+			unknown = append(unknown, key)
+		}
+		if err != nil {
+			return Effect{}, err
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return Effect{}, fmt.Errorf("%w: unknown setting %s", ErrInvalidEffect, strings.Join(unknown, ", "))
+	}
+	return e, nil
+}
+
+// Map is the stored form of the effect. Settings left at their neutral
+// value are omitted.
+func (e Effect) Map() map[string]any {
+	result := map[string]any{}
+	for key, value := range map[string]float64{
+		effectBrightness:  e.Brightness,
+		effectContrast:    e.Contrast,
+		effectSaturation:  e.Saturation,
+		effectTemperature: e.Temperature,
+		effectVignette:    e.Vignette,
+	} {
+		if value != 0 {
+			result[key] = value
+		}
+	}
+	if e.Grayscale {
+		result[effectGrayscale] = true
+	}
+	if e.LUT != nil {
+		result[effectLUT] = *e.LUT
+	}
+	return result
+}
+
+// IsZero reports whether the effect leaves images unchanged.
+func (e Effect) IsZero() bool {
+	return len(e.Map()) == 0
+}
+
+func effectAmount(key string, value any, min float64) (float64, error) {
+	var amount float64
+	switch v := value.(type) {
+	case float64:
+		amount = v
+	case int:
+		amount = float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s must be a number", ErrInvalidEffect, key)
+		}
+		amount = f
+	default:
+		return 0, fmt.Errorf("%w: %s must be a number", ErrInvalidEffect, key)
+	}
+	if amount < min || amount > 100 {
+		return 0, fmt.Errorf("%w: %s must be between %g and 100", ErrInvalidEffect, key, min)
+	}
+	return amount, nil
+}
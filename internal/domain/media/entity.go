@@ -2,25 +2,111 @@ package media
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 )
 
+var (
+	ErrBlobNotFound       = errors.New("stored file not found")
+	ErrPresignUnsupported = errors.New("storage backend does not support direct uploads")
+	ErrQRCodeExpired      = errors.New("qr code has expired")
+	ErrMediaPurged        = errors.New("media has been deleted under the retention policy")
+)
+
 type Photo struct {
-	ID          string
-	SessionID   string
-	FrameID     *string
-	FilterID    *string
-	StorageURL  string
+	ID        string
+	SessionID string
+	FrameID   *string
+	FilterID  *string
+	// StorageURL is where a booth that stored the original itself put it.
+	// Like StorageKey, it never leaves the server: originals keep the
+	// camera's metadata and are not watermarked.
+	StorageURL  string `json:"-"`
 	Composition map[string]any
 	RenderedURL *string
+	// RenderedKey is the storage key of the composite when the server
+	// rendered it.
+	RenderedKey *string
+	// StorageKey, ContentHash (hex SHA-256), SizeBytes and MimeType are set
+	// when the API stored the original itself.
+	StorageKey  *string `json:"-"`
+	ContentHash *string
+	SizeBytes   *int64
+	MimeType    *string
+	// Metadata is read from the original when it is uploaded; nil when the
+	// booth stored the file itself.
+	Metadata *PhotoMetadata
+	// Derivatives are the resized copies built in the background, keyed by
+	// kind. It is empty until the first build finishes.
+	Derivatives map[DerivativeKind]Derivative
+	// OriginalPurgedAt and RenderedPurgedAt are set once the retention job
+	// has deleted the original or the composite, along with the derivatives
+	// built from it.
+	OriginalPurgedAt *time.Time
+	RenderedPurgedAt *time.Time
+	// Watermarked is set when the composite and derivatives carry the
+	// session's watermark. The original never does.
+	Watermarked bool
 	CreatedAt   time.Time
 }
 
+// PhotoMetadata is the technical metadata kept from an upload. Nothing else
+// in the file, such as its GPS position or the device's serial number, is
+// stored, and files served publicly are re-encoded without it.
+type PhotoMetadata struct {
+	// Width and Height are the upright size, after Orientation is applied.
+	Width  int
+	Height int
+	// Orientation is the EXIF orientation the original was taken in; 1 is
+	// upright. Images decoded by the server are turned upright.
+	Orientation int
+	CapturedAt  *time.Time
+	CameraMake  *string
+	CameraModel *string
+}
+
+// Purged reports whether the photo has no file left to show.
+func (p Photo) Purged() bool {
+	return p.OriginalPurgedAt != nil && (p.RenderedURL == nil || p.RenderedPurgedAt != nil)
+}
+
+type DerivativeKind string
+
+const (
+	DerivativeThumb   DerivativeKind = "thumb"
+	DerivativeWebJPEG DerivativeKind = "web_jpeg"
+	DerivativeWebWebP DerivativeKind = "web_webp"
+	DerivativePrint   DerivativeKind = "print"
+)
+
+// Derivative is a resized copy of a photo's image. Source says whether it
+// was built from the original or the rendered composite.
+type Derivative struct {
+	Key      string
+	URL      string
+	Width    int
+	Height   int
+	MimeType string
+	Size     int64
+	Source   DerivativeSource
+}
+
+type DerivativeSource string
+
+const (
+	SourceOriginal DerivativeSource = "original"
+	SourceRendered DerivativeSource = "rendered"
+)
+
 type Frame struct {
 	ID        string
 	Name      string
 	Theme     *string
 	FileURL   string
+	Template  *FrameTemplate
 	Active    bool
 	CreatedAt time.Time
 }
@@ -33,12 +119,201 @@ type Filter struct {
 	CreatedAt time.Time
 }
 
-type QRCode struct {
+// WatermarkPosition is where a watermark sits on an image.
+type WatermarkPosition string
+
+const (
+	WatermarkBottomRight WatermarkPosition = "bottom_right"
+	WatermarkBottomLeft  WatermarkPosition = "bottom_left"
+	WatermarkTopRight    WatermarkPosition = "top_right"
+	WatermarkTopLeft     WatermarkPosition = "top_left"
+	WatermarkCenter      WatermarkPosition = "center"
+	// WatermarkTiled repeats the watermark across the whole image.
+	WatermarkTiled WatermarkPosition = "tiled"
+)
+
+// Watermark brands the shared images of sessions nobody paid for: those
+// with a free voucher, and unpaid ones at virtual booths. It belongs to a
+// branch or to a single booth; a booth's own watermark replaces its
+// branch's.
+type Watermark struct {
+	ID       string
+	BranchID *string
+	BoothID  *string
+	// ImageURL is a logo, best as a PNG with transparency. Without one,
+	// Text is drawn instead.
+	ImageURL *string
+	Text     string
+	Position WatermarkPosition
+	// Opacity runs from 0, invisible, to 1.
+	Opacity float64
+	// Scale is the watermark's width as a fraction of the image's.
+	Scale     float64
+	CreatedAt time.Time
+}
+
+// AnimationKind is how an animation plays its shots.
+type AnimationKind string
+
+const (
+	// AnimationGIF plays the shots in order.
+	AnimationGIF AnimationKind = "gif"
+	// AnimationBoomerang plays the shots forward and then backward.
+	AnimationBoomerang AnimationKind = "boomerang"
+)
+
+// Animation is an animated GIF made from a session's photos. It is stored
+// next to the photos and can be the target of a QR code.
+type Animation struct {
 	ID        string
-	PhotoID   string
-	Hash      string
-	ExpireAt  *time.Time
+	SessionID string
+	Kind      AnimationKind
+	// PhotoIDs are the shots in the order they play forward.
+	PhotoIDs []string
+	// FrameID is the frame drawn over every shot, if any.
+	FrameID *string
+	// FrameDelayMS is how long each shot shows, in milliseconds.
+	FrameDelayMS int
+	// Loops is how many times the animation plays; 0 means forever.
+	Loops      int
+	Key        string
+	URL        string
+	Width      int
+	Height     int
+	FrameCount int
+	SizeBytes  int64
+	// PurgedAt is set once the retention job has deleted the file, which
+	// goes with the originals it was made from.
+	PurgedAt  *time.Time
+	CreatedAt time.Time
+}
+
+// QRTarget is what a QR code's share page shows.
+type QRTarget string
+
+const (
+	QRTargetPhoto     QRTarget = "photo"
+	QRTargetAnimation QRTarget = "animation"
+	QRTargetSession   QRTarget = "session"
+	QRTargetAlbum     QRTarget = "album"
+)
+
+type MediaKind string
+
+const (
+	MediaPhoto     MediaKind = "photo"
+	MediaAnimation MediaKind = "animation"
+)
+
+// MediaRef names one photo or animation in an album.
+type MediaRef struct {
+	Kind MediaKind
+	ID   string
+}
+
+// QRProtection is what a customer must enter before a share page opens.
+type QRProtection string
+
+const (
+	QRUnprotected QRProtection = ""
+	QRProtectPIN  QRProtection = "pin"
+	// QRProtectPhone asks for the last four digits of the customer's phone
+	// number.
+	QRProtectPhone QRProtection = "phone_last4"
+)
+
+// QRCode points at exactly one photo, animation, session or album. Album
+// lists media in the order the share page shows them.
+type QRCode struct {
+	ID          string
+	PhotoID     *string
+	AnimationID *string
+	SessionID   *string
+	Album       []MediaRef
+	Hash        string
+	ExpireAt    *time.Time
+	Protection  QRProtection
+	// PINSalt and PINHash (hex SHA-256 of salt and PIN) check the PIN of a
+	// protected code. They never leave the server.
+	PINSalt string `json:"-"`
+	PINHash string `json:"-"`
+	// FailedUnlocks counts wrong PINs since the last lock; LockedUntil
+	// refuses further tries for a while.
+	FailedUnlocks int `json:"-"`
+	LockedUntil   *time.Time
+	// Downloads counts files and ZIPs fetched through the share page.
+	Downloads int
+	// PurgedAt is set once everything the code shows has been deleted by
+	// the retention job.
+	PurgedAt  *time.Time
 	CreatedAt time.Time
+	// ShareURL is the public link the code encodes. It is built from
+	// configuration rather than stored.
+	ShareURL string
+}
+
+// Target reports which kind of media the code points at.
+func (q QRCode) Target() QRTarget {
+	switch {
+	case q.PhotoID != nil:
+		return QRTargetPhoto
+	case q.AnimationID != nil:
+		return QRTargetAnimation
+	case q.SessionID != nil:
+		return QRTargetSession
+	}
+	return QRTargetAlbum
+}
+
+// Expired reports whether the code no longer opens its share page.
+func (q QRCode) Expired(now time.Time) bool {
+	return q.ExpireAt != nil && !now.Before(*q.ExpireAt)
+}
+
+// BlobInfo describes an object in a BlobStore.
+type BlobInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+}
+
+// BlobStore keeps media files. Keys are slash-separated paths such as
+// "sessions/<id>/rendered/<id>.jpg". Originals, under OriginalKey, are
+// private: stores keep them where their public URLs do not reach.
+type BlobStore interface {
+	// Put stores r under key. size may be -1 when it is not known up front.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	// URL is where clients can fetch the object. It is never handed out for
+	// originals.
+	URL(key string) string
+	// PresignPut returns a URL that accepts a single PUT of the object until
+	// it expires. The client must send contentType as its Content-Type.
+	// Stores that cannot hand out such URLs return ErrPresignUnsupported.
+	PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (string, error)
+}
+
+// OriginalKey is where the API stores a photo's original as uploaded.
+func OriginalKey(sessionID string, photoID string, ext string) string {
+	return fmt.Sprintf("sessions/%s/photos/%s%s", sessionID, photoID, ext)
+}
+
+// IsOriginalKey reports whether key is one OriginalKey makes.
+func IsOriginalKey(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) == 4 && parts[0] == "sessions" && parts[2] == "photos"
+}
+
+// MediaFilter selects photos and animations for bulk work such as
+// exports. Unset fields do not filter; From is inclusive and To exclusive,
+// both on CreatedAt.
+type MediaFilter struct {
+	SessionID *string
+	BoothID   *string
+	From      *time.Time
+	To        *time.Time
 }
 
 type PhotoRepository interface {
@@ -47,6 +322,22 @@ type PhotoRepository interface {
 	Delete(ctx context.Context, id string) error
 	GetByID(ctx context.Context, id string) (*Photo, error)
 	ListBySession(ctx context.Context, sessionID string) ([]Photo, error)
+	// ListByIDs returns the photos that exist among ids, in no set order.
+	ListByIDs(ctx context.Context, ids []string) ([]Photo, error)
+	// ListByFilter returns one page of matching photos, oldest first.
+	ListByFilter(ctx context.Context, filter MediaFilter, offset int, limit int) ([]Photo, error)
+	// SetDerivatives replaces only the photo's derivatives and whether they
+	// are watermarked, so background builds do not overwrite other edits.
+	SetDerivatives(ctx context.Context, id string, derivatives map[DerivativeKind]Derivative, watermarked bool) error
+	// ListWithoutDerivatives returns stored photos that have no derivatives
+	// yet, oldest first.
+	ListWithoutDerivatives(ctx context.Context, limit int) ([]Photo, error)
+	// ListPurgeable returns one page of the branch's photos taken before
+	// before whose source file is still kept, oldest first.
+	ListPurgeable(ctx context.Context, branchID string, source DerivativeSource, before time.Time, offset int, limit int) ([]Photo, error)
+	// MarkPurged records that the photo's source file was deleted at at and
+	// replaces its derivatives with those that remain.
+	MarkPurged(ctx context.Context, id string, source DerivativeSource, at time.Time, derivatives map[DerivativeKind]Derivative) error
 }
 
 type FrameRepository interface {
@@ -65,8 +356,45 @@ type FilterRepository interface {
 	List(ctx context.Context, onlyActive bool) ([]Filter, error)
 }
 
+type WatermarkRepository interface {
+	Create(ctx context.Context, watermark *Watermark) error
+	Update(ctx context.Context, watermark *Watermark) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*Watermark, error)
+	List(ctx context.Context) ([]Watermark, error)
+	// FindFor returns the booth's watermark, or else the branch's, or nil
+	// when neither has one.
+	FindFor(ctx context.Context, boothID string, branchID string) (*Watermark, error)
+}
+
+type AnimationRepository interface {
+	Create(ctx context.Context, animation *Animation) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*Animation, error)
+	ListBySession(ctx context.Context, sessionID string) ([]Animation, error)
+	// ListByIDs returns the animations that exist among ids, in no set
+	// order.
+	ListByIDs(ctx context.Context, ids []string) ([]Animation, error)
+	// ListByFilter returns every matching animation, oldest first.
+	ListByFilter(ctx context.Context, filter MediaFilter) ([]Animation, error)
+	// ListPurgeable returns one page of the branch's animations made before
+	// before that are still kept, oldest first.
+	ListPurgeable(ctx context.Context, branchID string, before time.Time, offset int, limit int) ([]Animation, error)
+	MarkPurged(ctx context.Context, id string, at time.Time) error
+}
+
 type QRCodeRepository interface {
 	Create(ctx context.Context, code *QRCode) error
+	Get(ctx context.Context, id string) (*QRCode, error)
 	GetByHash(ctx context.Context, hash string) (*QRCode, error)
 	Delete(ctx context.Context, id string) error
+	// RecordFailedUnlock counts a wrong PIN. When that makes maxAttempts,
+	// the code is locked until lockedUntil and the count starts over.
+	RecordFailedUnlock(ctx context.Context, id string, maxAttempts int, lockedUntil time.Time) error
+	ResetFailedUnlocks(ctx context.Context, id string) error
+	IncrementDownloads(ctx context.Context, id string) error
+	// MarkPurged marks the codes pointing at any of ids, which are of the
+	// given target kind, and returns how many it marked. Albums are not
+	// matched.
+	MarkPurged(ctx context.Context, target QRTarget, ids []string, at time.Time) (int, error)
 }
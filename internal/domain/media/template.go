@@ -0,0 +1,174 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTemplate = errors.New("invalid frame template")
+
+// PrintSize is the paper a frame prints on, in inches.
+type PrintSize string
+
+const (
+	PrintStrip2x6 PrintSize = "2x6"
+	Print4x6      PrintSize = "4x6"
+)
+
+// inches returns the short and long edge of the paper.
+func (p PrintSize) inches() (int, int, bool) {
+	switch p {
+	case PrintStrip2x6:
+		return 2, 6, true
+	case Print4x6:
+		return 4, 6, true
+	}
+	return 0, 0, false
+}
+
+type OverlayKind string
+
+const (
+	OverlayText OverlayKind = "text"
+	OverlayDate OverlayKind = "date"
+)
+
+type TextAlign string
+
+const (
+	AlignLeft   TextAlign = "left"
+	AlignCenter TextAlign = "center"
+	AlignRight  TextAlign = "right"
+)
+
+// DefaultDateFormat is used by date overlays without a format.
+const DefaultDateFormat = "DD/MM/YYYY"
+
+const (
+	minDPI = 72
+	maxDPI = 1200
+)
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// FrameTemplate is the layout of a frame, shared by booths and the server
+// renderer. Coordinates are pixels on a Width x Height canvas, which is the
+// print size at DPI; the frame image is scaled to the canvas.
+type FrameTemplate struct {
+	Width     int
+	Height    int
+	DPI       int
+	PrintSize PrintSize
+	Slots     []Slot
+	Overlays  []Overlay
+}
+
+// Slot is the rectangle one shot fills. Rotation turns the shot clockwise,
+// in degrees, about the centre of the rectangle.
+type Slot struct {
+	X        int
+	Y        int
+	Width    int
+	Height   int
+	Rotation float64
+}
+
+// Overlay is an area of text drawn over the frame: fixed Text, or the
+// session date in Format, which understands DD, MM, YYYY, HH and mm.
+type Overlay struct {
+	Kind   OverlayKind
+	X      int
+	Y      int
+	Width  int
+	Height int
+	Text   string
+	Format string
+	// Color is "#RRGGBB"; empty means black.
+	Color string
+	// Align is left when empty.
+	Align TextAlign
+}
+
+// Validate checks the canvas against the print size and that every slot
+// and overlay sits inside it.
+func (t FrameTemplate) Validate() error {
+	short, long, ok := t.PrintSize.inches()
+	if !ok {
+		return fmt.Errorf("%w: print_size must be %s or %s", ErrInvalidTemplate, PrintStrip2x6, Print4x6)
+	}
+	if t.DPI < minDPI || t.DPI > maxDPI {
+		return fmt.Errorf("%w: dpi must be between %d and %d", ErrInvalidTemplate, minDPI, maxDPI)
+	}
+	portrait := t.Width == short*t.DPI && t.Height == long*t.DPI
+	landscape := t.Width == long*t.DPI && t.Height == short*t.DPI
+	if !portrait && !landscape {
+		return fmt.Errorf("%w: a %s canvas at %d dpi must be %dx%d or %dx%d pixels", ErrInvalidTemplate,
+			t.PrintSize, t.DPI, short*t.DPI, long*t.DPI, long*t.DPI, short*t.DPI)
+	}
+	if len(t.Slots) == 0 {
+		return fmt.Errorf("%w: at least one photo slot is required", ErrInvalidTemplate)
+	}
+	for i, s := range t.Slots {
+		if !t.contains(s.X, s.Y, s.Width, s.Height) {
+			return fmt.Errorf("%w: slot %d must have a size and fit on the canvas", ErrInvalidTemplate, i)
+		}
+		if s.Rotation < -180 || s.Rotation > 180 {
+			return fmt.Errorf("%w: slot %d rotation must be between -180 and 180", ErrInvalidTemplate, i)
+		}
+	}
+	for i, o := range t.Overlays {
+		if err := t.validateOverlay(o); err != nil {
+			return fmt.Errorf("%w: overlay %d %s", ErrInvalidTemplate, i, err)
+		}
+	}
+	return nil
+}
+
+func (t FrameTemplate) validateOverlay(o Overlay) error {
+	switch o.Kind {
+	case OverlayText:
+		if strings.TrimSpace(o.Text) == "" {
+			return errors.New("needs text")
+		}
+	case OverlayDate:
+	default:
+		return fmt.Errorf("kind must be %s or %s", OverlayText, OverlayDate)
+	}
+	if !t.contains(o.X, o.Y, o.Width, o.Height) {
+		return errors.New("must have a size and fit on the canvas")
+	}
+	if o.Color != "" && !hexColor.MatchString(o.Color) {
+		return errors.New("color must be #RRGGBB")
+	}
+	switch o.Align {
+	case "", AlignLeft, AlignCenter, AlignRight:
+	default:
+		return fmt.Errorf("align must be %s, %s or %s", AlignLeft, AlignCenter, AlignRight)
+	}
+	return nil
+}
+
+func (t FrameTemplate) contains(x, y, width, height int) bool {
+	return width > 0 && height > 0 && x >= 0 && y >= 0 && x+width <= t.Width && y+height <= t.Height
+}
+
+// Content is the text the overlay shows for a photo taken at taken.
+func (o Overlay) Content(taken time.Time) string {
+	if o.Kind != OverlayDate {
+		return o.Text
+	}
+	format := o.Format
+	if format == "" {
+		format = DefaultDateFormat
+	}
+	return strings.NewReplacer(
+		"YYYY", fmt.Sprintf("%04d", taken.Year()),
+		"MM", fmt.Sprintf("%02d", int(taken.Month())),
+		"DD", fmt.Sprintf("%02d", taken.Day()),
+		"HH", fmt.Sprintf("%02d", taken.Hour()),
+		"mm", fmt.Sprintf("%02d", taken.Minute()),
+	).Replace(format)
+}
@@ -0,0 +1,113 @@
+package printing
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrStatusChanged is returned by Transition when another request moved
+// the job first.
+var ErrStatusChanged = errors.New("print job status changed")
+
+type Status string
+
+const (
+	// StatusPendingApproval jobs wait for staff before the booth sees them.
+	StatusPendingApproval Status = "pending_approval"
+	StatusQueued          Status = "queued"
+	StatusPrinting        Status = "printing"
+	StatusDone            Status = "done"
+	StatusFailed          Status = "failed"
+	StatusRejected        Status = "rejected"
+)
+
+// CanBecome reports whether a job may move from s to next. Staff move jobs
+// out of pending_approval; booths report the rest as the printer works.
+func (s Status) CanBecome(next Status) bool {
+	switch s {
+	case StatusPendingApproval:
+		return next == StatusQueued || next == StatusRejected
+	case StatusQueued:
+		return next == StatusPrinting || next == StatusFailed
+	case StatusPrinting:
+		return next == StatusDone || next == StatusFailed
+	}
+	return false
+}
+
+type Kind string
+
+const (
+	// KindPrint is the first print of a photo, included in the session.
+	KindPrint Kind = "print"
+	// KindReprint prints a photo again at no charge, for example after the
+	// printer jammed.
+	KindReprint Kind = "reprint"
+	// KindExtraCopies are copies sold on top of the session.
+	KindExtraCopies Kind = "extra_copies"
+)
+
+// NeedsApproval reports whether jobs of the kind wait for staff.
+func (k Kind) NeedsApproval() bool {
+	return k != KindPrint
+}
+
+// PaperSize is the paper a job prints on, in inches.
+type PaperSize string
+
+const (
+	PaperStrip2x6 PaperSize = "2x6"
+	Paper4x6      PaperSize = "4x6"
+)
+
+type Job struct {
+	ID        string
+	BoothID   string
+	SessionID string
+	PhotoID   string
+	Kind      Kind
+	// FileURL is the print-size copy of the rendered photo, or the
+	// composite itself when no copy has been built.
+	FileURL   string
+	Copies    int
+	PaperSize PaperSize
+	Status    Status
+	// ReprintOf is the job a reprint repeats.
+	ReprintOf *string
+	// UnitPrice is what each copy of an extra-copies job added to the
+	// session.
+	UnitPrice  *float64
+	ReviewedBy *string
+	ReviewedAt *time.Time
+	// Error is the booth's reason for a failed job, or staff's for a
+	// rejected one.
+	Error      *string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// JobFilter narrows a job listing; nil fields match every job.
+type JobFilter struct {
+	BoothID   *string
+	SessionID *string
+	PhotoID   *string
+	Status    *Status
+}
+
+type Repository interface {
+	Create(ctx context.Context, job *Job) error
+	Update(ctx context.Context, job *Job) error
+	// Transition saves the job like Update, but only while it is still
+	// in status from, and returns ErrStatusChanged otherwise.
+	Transition(ctx context.Context, job *Job, from Status) error
+	GetByID(ctx context.Context, id string) (*Job, error)
+	// List returns jobs oldest first, the order booths print them in.
+	List(ctx context.Context, filter JobFilter) ([]Job, error)
+	// ClaimNext moves the booth's oldest queued job to printing and returns
+	// it, or nil when there is none. Concurrent claims never get the same
+	// job.
+	ClaimNext(ctx context.Context, boothID string, at time.Time) (*Job, error)
+}
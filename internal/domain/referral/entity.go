@@ -0,0 +1,78 @@
+package referral
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownCode        = errors.New("referral code not found")
+	ErrPhoneRequired      = errors.New("referral needs the new customer's phone number")
+	ErrSelfReferral       = errors.New("customers cannot use their own referral code")
+	ErrAlreadyReferred    = errors.New("phone number has already been referred")
+	ErrNotNewCustomer     = errors.New("phone number already has a paid session")
+	ErrReferrerCapReached = errors.New("referral code has reached its limit")
+	ErrSessionReferred    = errors.New("session already has a referral")
+	ErrSessionClosed      = errors.New("referrals can only be applied while the session is in progress")
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusRewarded Status = "rewarded"
+	StatusRejected Status = "rejected"
+)
+
+// Code is a customer's personal referral code.
+type Code struct {
+	Code      string
+	UserID    string
+	CreatedAt time.Time
+}
+
+// Referral links a new customer's session to the code they used. It stays
+// pending until the session completes, and is then rewarded or rejected.
+type Referral struct {
+	ID                string
+	Code              string
+	ReferrerID        string
+	RefereeTel        string
+	RefereeUserID     *string
+	SessionID         string
+	Status            Status
+	RejectReason      *string
+	ReferrerVoucherID *string
+	RefereeVoucherID  *string
+	CreatedAt         time.Time
+	ResolvedAt        *time.Time
+}
+
+// Repository lookups named Find return nil without an error when nothing
+// matches.
+type Repository interface {
+	CreateCode(ctx context.Context, code *Code) error
+	FindCode(ctx context.Context, code string) (*Code, error)
+	FindCodeByUser(ctx context.Context, userID string) (*Code, error)
+
+	Create(ctx context.Context, referral *Referral) error
+	Update(ctx context.Context, referral *Referral) error
+	FindPendingBySession(ctx context.Context, sessionID string) (*Referral, error)
+	// FindPendingBySessionForUpdate also locks the referral's row until the
+	// surrounding transaction ends.
+	FindPendingBySessionForUpdate(ctx context.Context, sessionID string) (*Referral, error)
+	List(ctx context.Context, referrerID *string) ([]Referral, error)
+	// CountActiveByReferrer counts the referrer's pending and rewarded
+	// referrals.
+	CountActiveByReferrer(ctx context.Context, referrerID string) (int, error)
+	// ActiveForTel reports whether the phone number has a pending or
+	// rewarded referral.
+	ActiveForTel(ctx context.Context, tel string) (bool, error)
+	// HasPaidSession reports whether the phone number completed a paid
+	// session other than excludeSessionID.
+	HasPaidSession(ctx context.Context, tel string, excludeSessionID string) (bool, error)
+	// SessionPaid reports whether the session has a successful payment of
+	// more than zero.
+	SessionPaid(ctx context.Context, sessionID string) (bool, error)
+}
@@ -15,23 +15,41 @@ const (
 )
 
 type Session struct {
-	ID            string
-	BoothID       string
-	UserID        *string
-	VoucherID     *string
-	PaymentID     *string
-	StartedAt     *time.Time
-	FinishedAt    *time.Time
-	Status        Status
-	TotalPrice    *float64
-	BoothSnapshot map[string]any
-	PhoneTemp     *string
+	ID              string
+	BoothID         string
+	UserID          *string
+	VoucherID       *string
+	PaymentID       *string
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+	Status          Status
+	BasePrice       *float64
+	TierDiscount    *float64
+	VoucherDiscount *float64
+	TotalPrice      *float64
+	BoothSnapshot   map[string]any
+	PhoneTemp       *string
+	// Vouchers are the redeemed vouchers priced into the session, and
+	// Discounts the breakdown of everything taken off BasePrice.
+	Vouchers  []AppliedVoucher
+	Discounts []DiscountLine
+	// Charges are extras sold during the session, added to TotalPrice
+	// after the discounts.
+	Charges []Charge
+	// TierPercent is the customer's tier discount, fixed when the session
+	// is first priced for them so later tier changes leave it alone.
+	TierPercent *float64
 }
 
 type Repository interface {
 	Create(ctx context.Context, session *Session) error
+	// Update saves everything but the pricing, which UpdatePricing saves.
 	Update(ctx context.Context, session *Session) error
+	UpdatePricing(ctx context.Context, session *Session) error
 	Delete(ctx context.Context, id string) error
 	GetByID(ctx context.Context, id string) (*Session, error)
+	// GetForUpdate is GetByID that also locks the session's row until the
+	// surrounding transaction ends.
+	GetForUpdate(ctx context.Context, id string) (*Session, error)
 	List(ctx context.Context, boothID *string, status *Status) ([]Session, error)
 }
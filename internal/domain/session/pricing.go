@@ -0,0 +1,204 @@
+package session
+
+import "math"
+
+// DiscountKind is how a discount line is worked out.
+type DiscountKind string
+
+const (
+	DiscountPercent DiscountKind = "percent"
+	DiscountBaht    DiscountKind = "baht"
+	DiscountFree    DiscountKind = "free"
+)
+
+type DiscountSource string
+
+const (
+	SourceTier    DiscountSource = "tier"
+	SourceVoucher DiscountSource = "voucher"
+)
+
+// AppliedVoucher is a redeemed voucher as the session's pricing sees it: its
+// terms are copied at redemption time so later edits to the voucher do not
+// change a session that already used it.
+type AppliedVoucher struct {
+	RedemptionID string
+	VoucherID    string
+	Code         string
+	Kind         DiscountKind
+	Value        float64
+	Stackable    bool
+}
+
+// DiscountLine is one entry of a session's applied-discount breakdown.
+type DiscountLine struct {
+	Source       DiscountSource
+	Kind         DiscountKind
+	Value        float64
+	Amount       float64
+	RedemptionID *string
+	VoucherID    *string
+	Code         *string
+}
+
+// ChargeKind is what a session charge was sold for.
+type ChargeKind string
+
+const (
+	ChargeExtraCopies ChargeKind = "extra_copies"
+)
+
+// Charge is an extra sold on top of the session, such as print copies
+// beyond those it includes. Discounts do not apply to charges.
+type Charge struct {
+	Kind ChargeKind
+	// Reference is the ID of what was sold, such as the print job.
+	Reference string
+	Quantity  int
+	UnitPrice float64
+	Amount    float64
+}
+
+// NewCharge prices quantity items at unitPrice.
+func NewCharge(kind ChargeKind, reference string, quantity int, unitPrice float64) Charge {
+	return Charge{
+		Kind:      kind,
+		Reference: reference,
+		Quantity:  quantity,
+		UnitPrice: unitPrice,
+		Amount:    roundMoney(float64(quantity) * unitPrice),
+	}
+}
+
+// ChargesTotal adds up the amounts of charges.
+func ChargesTotal(charges []Charge) float64 {
+	total := 0.0
+	for _, c := range charges {
+		total += c.Amount
+	}
+	return roundMoney(total)
+}
+
+// PricingPolicy holds the shop-wide stacking limits.
+type PricingPolicy struct {
+	// MaxStackedDiscountPercent caps the combined discount, as a percentage
+	// of the base price, whenever more than one discount applies. Zero means
+	// no cap.
+	MaxStackedDiscountPercent float64
+}
+
+type Breakdown struct {
+	Base     float64
+	Lines    []DiscountLine
+	Discount float64
+	Total    float64
+	Capped   bool
+}
+
+// Price applies the stacking rules to base:
+//
+//   - a voucher that is not stackable is exclusive: it cannot share a session
+//     with other vouchers and it replaces the customer's tier discount;
+//   - percent discounts apply first, tier before vouchers, each to the price
+//     left by the one before;
+//   - baht discounts then come off what is left, followed by free-session
+//     vouchers which take the remainder;
+//   - when more than one line applies, the total is held to the policy cap by
+//     trimming the lines applied last.
+//
+// Price does not check whether the vouchers are allowed together; callers
+// reject that before a redemption is stored.
+func Price(base float64, tierPercent float64, vouchers []AppliedVoucher, policy PricingPolicy) Breakdown {
+	exclusive := false
+	for _, v := range vouchers {
+		if !v.Stackable {
+			exclusive = true
+		}
+	}
+
+	var lines []DiscountLine
+	if tierPercent > 0 && !exclusive {
+		lines = append(lines, DiscountLine{Source: SourceTier, Kind: DiscountPercent, Value: tierPercent})
+	}
+	for _, kind := range []DiscountKind{DiscountPercent, DiscountBaht, DiscountFree} {
+		for _, v := range vouchers {
+			if v.Kind != kind {
+				continue
+			}
+			redemptionID, voucherID, code := v.RedemptionID, v.VoucherID, v.Code
+			lines = append(lines, DiscountLine{
+				Source:       SourceVoucher,
+				Kind:         v.Kind,
+				Value:        v.Value,
+				RedemptionID: &redemptionID,
+				VoucherID:    &voucherID,
+				Code:         &code,
+			})
+		}
+	}
+
+	remaining := base
+	for i := range lines {
+		var amount float64
+		switch lines[i].Kind {
+		case DiscountPercent:
+			amount = roundMoney(remaining * lines[i].Value / 100)
+		case DiscountBaht:
+			amount = lines[i].Value
+		case DiscountFree:
+			amount = remaining
+		}
+		amount = math.Max(0, math.Min(amount, remaining))
+		lines[i].Amount = amount
+		remaining = roundMoney(remaining - amount)
+	}
+
+	result := Breakdown{Base: base, Lines: lines}
+	discount := roundMoney(base - remaining)
+	if len(lines) > 1 && policy.MaxStackedDiscountPercent > 0 {
+		limit := roundMoney(base * policy.MaxStackedDiscountPercent / 100)
+		excess := roundMoney(discount - limit)
+		for i := len(lines) - 1; i >= 0 && excess > 0; i-- {
+			cut := math.Min(excess, lines[i].Amount)
+			lines[i].Amount = roundMoney(lines[i].Amount - cut)
+			excess = roundMoney(excess - cut)
+			result.Capped = true
+		}
+		if result.Capped {
+			discount = limit
+		}
+	}
+	result.Discount = discount
+	result.Total = roundMoney(base - discount)
+	return result
+}
+
+// Line returns the breakdown line of the given redemption, if it applied.
+func (b Breakdown) Line(redemptionID string) (DiscountLine, bool) {
+	for _, l := range b.Lines {
+		if l.RedemptionID != nil && *l.RedemptionID == redemptionID {
+			return l, true
+		}
+	}
+	return DiscountLine{}, false
+}
+
+// TotalWith returns the total with charges added on top.
+func (b Breakdown) TotalWith(charges []Charge) float64 {
+	return roundMoney(b.Total + ChargesTotal(charges))
+}
+
+// Sum adds up the amounts of the lines from source.
+func (b Breakdown) Sum(source DiscountSource) float64 {
+	total := 0.0
+	for _, l := range b.Lines {
+		if l.Source == source {
+			total += l.Amount
+		}
+	}
+	return roundMoney(total)
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,238 @@
+package session
+
+import "testing"
+
+func voucherOf(code string, kind DiscountKind, value float64, stackable bool) AppliedVoucher {
+	return AppliedVoucher{RedemptionID: "r-" + code, VoucherID: "v-" + code, Code: code, Kind: kind, Value: value, Stackable: stackable}
+}
+
+type wantLine struct {
+	source DiscountSource
+	kind   DiscountKind
+	amount float64
+}
+
+func checkBreakdown(t *testing.T, got Breakdown, lines []wantLine, total float64, capped bool) {
+	t.Helper()
+	if len(got.Lines) != len(lines) {
+		t.Fatalf("expected %d lines, got %d: %+v", len(lines), len(got.Lines), got.Lines)
+	}
+	for i, want := range lines {
+		line := got.Lines[i]
+		if line.Source != want.source || line.Kind != want.kind || line.Amount != want.amount {
+			t.Fatalf("line %d: expected %s %s %.2f, got %s %s %.2f", i, want.source, want.kind, want.amount, line.Source, line.Kind, line.Amount)
+		}
+	}
+	if got.Total != total {
+		t.Fatalf("expected total %.2f, got %.2f", total, got.Total)
+	}
+	if got.Discount != roundMoney(got.Base-total) {
+		t.Fatalf("expected discount %.2f, got %.2f", roundMoney(got.Base-total), got.Discount)
+	}
+	if got.Capped != capped {
+		t.Fatalf("expected capped %v, got %v", capped, got.Capped)
+	}
+}
+
+func TestPriceStacking(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     float64
+		tier     float64
+		vouchers []AppliedVoucher
+		policy   PricingPolicy
+		lines    []wantLine
+		total    float64
+		capped   bool
+	}{
+		{
+			name: "tier then percent then baht, whatever the redemption order",
+			base: 1000,
+			tier: 10,
+			vouchers: []AppliedVoucher{
+				voucherOf("BAHT", DiscountBaht, 50, true),
+				voucherOf("PCT", DiscountPercent, 20, true),
+			},
+			lines: []wantLine{
+				{SourceTier, DiscountPercent, 100},
+				{SourceVoucher, DiscountPercent, 180},
+				{SourceVoucher, DiscountBaht, 50},
+			},
+			total: 670,
+		},
+		{
+			name: "free comes last and takes what is left",
+			base: 1000,
+			tier: 10,
+			vouchers: []AppliedVoucher{
+				voucherOf("FREE", DiscountFree, 0, true),
+				voucherOf("BAHT", DiscountBaht, 50, true),
+				voucherOf("PCT", DiscountPercent, 20, true),
+			},
+			lines: []wantLine{
+				{SourceTier, DiscountPercent, 100},
+				{SourceVoucher, DiscountPercent, 180},
+				{SourceVoucher, DiscountBaht, 50},
+				{SourceVoucher, DiscountFree, 670},
+			},
+			total: 0,
+		},
+		{
+			name:     "cap trims the line applied last",
+			base:     1000,
+			tier:     10,
+			vouchers: []AppliedVoucher{voucherOf("HALF", DiscountPercent, 50, true)},
+			policy:   PricingPolicy{MaxStackedDiscountPercent: 40},
+			lines: []wantLine{
+				{SourceTier, DiscountPercent, 100},
+				{SourceVoucher, DiscountPercent, 300},
+			},
+			total:  600,
+			capped: true,
+		},
+		{
+			name: "cap trims past the last line when it is not enough",
+			base: 1000,
+			tier: 10,
+			vouchers: []AppliedVoucher{
+				voucherOf("PCT", DiscountPercent, 50, true),
+				voucherOf("BAHT", DiscountBaht, 100, true),
+			},
+			policy: PricingPolicy{MaxStackedDiscountPercent: 30},
+			lines: []wantLine{
+				{SourceTier, DiscountPercent, 100},
+				{SourceVoucher, DiscountPercent, 200},
+				{SourceVoucher, DiscountBaht, 0},
+			},
+			total:  700,
+			capped: true,
+		},
+		{
+			name:     "cap does not apply to a single discount",
+			base:     1000,
+			vouchers: []AppliedVoucher{voucherOf("HALF", DiscountPercent, 50, true)},
+			policy:   PricingPolicy{MaxStackedDiscountPercent: 40},
+			lines:    []wantLine{{SourceVoucher, DiscountPercent, 500}},
+			total:    500,
+		},
+		{
+			name:     "cap leaves stacked discounts under it alone",
+			base:     1000,
+			tier:     10,
+			vouchers: []AppliedVoucher{voucherOf("BAHT", DiscountBaht, 100, true)},
+			policy:   PricingPolicy{MaxStackedDiscountPercent: 40},
+			lines: []wantLine{
+				{SourceTier, DiscountPercent, 100},
+				{SourceVoucher, DiscountBaht, 100},
+			},
+			total: 800,
+		},
+		{
+			name:     "a voucher that is not stackable replaces the tier discount",
+			base:     1000,
+			tier:     10,
+			vouchers: []AppliedVoucher{voucherOf("ONLY", DiscountPercent, 20, false)},
+			lines:    []wantLine{{SourceVoucher, DiscountPercent, 200}},
+			total:    800,
+		},
+		{
+			name:  "tier alone",
+			base:  1000,
+			tier:  10,
+			lines: []wantLine{{SourceTier, DiscountPercent, 100}},
+			total: 900,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkBreakdown(t, Price(tc.base, tc.tier, tc.vouchers, tc.policy), tc.lines, tc.total, tc.capped)
+		})
+	}
+}
+
+func TestBreakdownLineAndSum(t *testing.T) {
+	breakdown := Price(1000, 10, []AppliedVoucher{
+		voucherOf("PCT", DiscountPercent, 20, true),
+		voucherOf("BAHT", DiscountBaht, 50, true),
+	}, PricingPolicy{})
+	line, ok := breakdown.Line("r-BAHT")
+	if !ok || line.Amount != 50 {
+		t.Fatalf("expected the BAHT line of 50, got %+v (found %v)", line, ok)
+	}
+	if _, ok := breakdown.Line("r-MISSING"); ok {
+		t.Fatal("expected no line for a redemption that is not applied")
+	}
+	if got := breakdown.Sum(SourceTier); got != 100 {
+		t.Fatalf("expected tier sum 100, got %.2f", got)
+	}
+	if got := breakdown.Sum(SourceVoucher); got != 230 {
+		t.Fatalf("expected voucher sum 230, got %.2f", got)
+	}
+	if got := breakdown.TotalWith([]Charge{NewCharge(ChargeExtraCopies, "job", 2, 35)}); got != 740 {
+		t.Fatalf("expected total with charges 740, got %.2f", got)
+	}
+}
+
+func TestPriceSingleDiscount(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     float64
+		tier     float64
+		vouchers []AppliedVoucher
+		lines    []wantLine
+		total    float64
+	}{
+		{
+			name:     "percent rounds to the satang",
+			base:     99.99,
+			vouchers: []AppliedVoucher{voucherOf("PCT", DiscountPercent, 15, true)},
+			lines:    []wantLine{{SourceVoucher, DiscountPercent, 15}},
+			total:    84.99,
+		},
+		{
+			name:  "tier percent rounds to the satang",
+			base:  149,
+			tier:  7,
+			lines: []wantLine{{SourceTier, DiscountPercent, 10.43}},
+			total: 138.57,
+		},
+		{
+			name:     "baht larger than the price only takes the price",
+			base:     80,
+			vouchers: []AppliedVoucher{voucherOf("BAHT", DiscountBaht, 100, true)},
+			lines:    []wantLine{{SourceVoucher, DiscountBaht, 80}},
+			total:    0,
+		},
+		{
+			name:     "baht smaller than the price",
+			base:     80,
+			vouchers: []AppliedVoucher{voucherOf("BAHT", DiscountBaht, 30, true)},
+			lines:    []wantLine{{SourceVoucher, DiscountBaht, 30}},
+			total:    50,
+		},
+		{
+			name:     "free takes the whole price",
+			base:     250,
+			vouchers: []AppliedVoucher{voucherOf("FREE", DiscountFree, 0, false)},
+			lines:    []wantLine{{SourceVoucher, DiscountFree, 250}},
+			total:    0,
+		},
+		{
+			name:     "free on a zero price",
+			base:     0,
+			vouchers: []AppliedVoucher{voucherOf("FREE", DiscountFree, 0, false)},
+			lines:    []wantLine{{SourceVoucher, DiscountFree, 0}},
+			total:    0,
+		},
+		{
+			name:  "no discount",
+			base:  250,
+			total: 250,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkBreakdown(t, Price(tc.base, tc.tier, tc.vouchers, PricingPolicy{}), tc.lines, tc.total, false)
+		})
+	}
+}
@@ -13,15 +13,104 @@ const (
 	RoleAdmin    Role = "admin"
 )
 
+type Tier string
+
+const (
+	TierMember   Tier = "member"
+	TierSilver   Tier = "silver"
+	TierGold     Tier = "gold"
+	TierPlatinum Tier = "platinum"
+)
+
 type User struct {
+	ID    string
+	Tel   *string
+	Email *string
+	// Password is a bcrypt hash. It never leaves the server.
+	Password      *string `json:"-"`
+	Role          Role
+	Points        int
+	Tier          Tier
+	TierUpdatedAt *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TierRule describes what it takes to reach a tier and what the tier gives
+// back. A customer qualifies on either trailing spend or session count.
+type TierRule struct {
+	Tier             Tier
+	MinSpend         float64
+	MinSessions      int
+	PointsMultiplier float64
+	SessionDiscount  float64
+}
+
+// TierRules is ordered from the highest tier down so the first match wins.
+var TierRules = []TierRule{
+	{Tier: TierPlatinum, MinSpend: 6000, MinSessions: 30, PointsMultiplier: 2, SessionDiscount: 15},
+	{Tier: TierGold, MinSpend: 3000, MinSessions: 15, PointsMultiplier: 1.5, SessionDiscount: 10},
+	{Tier: TierSilver, MinSpend: 1000, MinSessions: 5, PointsMultiplier: 1.25, SessionDiscount: 5},
+	{Tier: TierMember, PointsMultiplier: 1},
+}
+
+func RuleFor(tier Tier) TierRule {
+	for _, rule := range TierRules {
+		if rule.Tier == tier {
+			return rule
+		}
+	}
+	return TierRules[len(TierRules)-1]
+}
+
+func TierFor(spend float64, sessions int) Tier {
+	for _, rule := range TierRules {
+		if rule.MinSpend == 0 && rule.MinSessions == 0 {
+			return rule.Tier
+		}
+		if spend >= rule.MinSpend || sessions >= rule.MinSessions {
+			return rule.Tier
+		}
+	}
+	return TierMember
+}
+
+// Activity is a user's paid activity over the tier qualification window.
+type Activity struct {
+	UserID   string
+	Spend    float64
+	Sessions int
+}
+
+type PointsEntryType string
+
+const (
+	PointsEntryEarn   PointsEntryType = "earn"
+	PointsEntrySpend  PointsEntryType = "spend"
+	PointsEntryExpire PointsEntryType = "expire"
+)
+
+// PointsEntry is one line of a user's points history. Earn entries double as
+// FIFO lots: Remaining tracks how much of the lot has not been spent or
+// expired yet.
+type PointsEntry struct {
 	ID        string
+	UserID    string
+	Type      PointsEntryType
+	Points    int
+	Remaining int
+	ExpiresAt *time.Time
+	LotID     *string
+	CreatedAt time.Time
+}
+
+// ExpiryNotice is one row of the upcoming-expiry report.
+type ExpiryNotice struct {
+	UserID    string
 	Tel       *string
 	Email     *string
-	Password  *string
-	Role      Role
 	Points    int
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ExpiresAt time.Time
 }
 
 type Repository interface {
@@ -29,6 +118,23 @@ type Repository interface {
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id string) error
 	GetByID(ctx context.Context, id string) (*User, error)
+	// GetForUpdate is GetByID that also locks the user's row until the
+	// surrounding transaction ends, so balance changes apply one at a time.
+	GetForUpdate(ctx context.Context, id string) (*User, error)
+	// UpdatePoints and UpdateTier write only those columns, leaving changes
+	// made to the rest of the row meanwhile in place.
+	UpdatePoints(ctx context.Context, id string, points int) error
+	UpdateTier(ctx context.Context, id string, tier Tier, at time.Time) error
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	List(ctx context.Context) ([]User, error)
+	ListActivity(ctx context.Context, since time.Time) ([]Activity, error)
+}
+
+type PointsRepository interface {
+	Create(ctx context.Context, entry *PointsEntry) error
+	UpdateRemaining(ctx context.Context, id string, remaining int) error
+	ListByUser(ctx context.Context, userID string) ([]PointsEntry, error)
+	ListOpenLots(ctx context.Context, userID string) ([]PointsEntry, error)
+	ListExpiredLots(ctx context.Context, asOf time.Time) ([]PointsEntry, error)
+	ListExpiringLots(ctx context.Context, from time.Time, to time.Time) ([]PointsEntry, error)
 }
@@ -2,9 +2,20 @@ package voucher
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
+var (
+	ErrNotFound          error = &RejectionError{Reason: ReasonNotFound, Message: "voucher not found"}
+	ErrInactive          error = &RejectionError{Reason: ReasonInactive, Message: "voucher inactive"}
+	ErrNotYetValid       error = &RejectionError{Reason: ReasonNotStarted, Message: "voucher not yet valid"}
+	ErrExpired           error = &RejectionError{Reason: ReasonExpired, Message: "voucher expired"}
+	ErrUsageLimitReached error = &RejectionError{Reason: ReasonLimitReached, Message: "voucher usage limit reached"}
+	ErrAlreadyRedeemed   error = &RejectionError{Reason: ReasonAlreadyRedeemed, Message: "voucher already redeemed for this session"}
+	ErrSessionClosed     error = &RejectionError{Reason: ReasonSessionClosed, Message: "session is no longer open for vouchers"}
+)
+
 type Type string
 
 const (
@@ -21,26 +32,219 @@ const (
 )
 
 type Voucher struct {
-	ID        string
-	Code      string
-	Type      Type
-	Value     float64
-	Unit      Unit
-	MaxUsage  int
-	UsedCount int
-	ValidFrom *time.Time
-	ValidTo   *time.Time
-	Active    bool
-	CreatedAt time.Time
+	ID         string
+	Code       string
+	Type       Type
+	Value      float64
+	Unit       Unit
+	MaxUsage   int
+	UsedCount  int
+	ValidFrom  *time.Time
+	ValidTo    *time.Time
+	Active     bool
+	CampaignID *string
+	CreatedAt  time.Time
+
+	Restrictions
 }
 
-type Redemption struct {
-	ID        string
-	VoucherID string
-	SessionID string
+// Campaign owns a batch of generated vouchers that share the same terms.
+type Campaign struct {
+	ID          string
+	Name        string
+	CodePattern string
+	Quantity    int
+	Type        Type
+	Value       float64
+	Unit        Unit
+	MaxUsage    int
+	ValidFrom   *time.Time
+	ValidTo     *time.Time
+	Active      bool
+	CreatedAt   time.Time
+
+	Restrictions
+}
+
+type CampaignStats struct {
+	CampaignID string
+	Issued     int
+	Redeemed   int
+	Expired    int
+	Available  int
+}
+
+// Restrictions are optional redemption rules on top of the validity dates
+// and MaxUsage. Empty lists and nil pointers mean "no restriction".
+type Restrictions struct {
+	BranchIDs      []string
+	BoothIDs       []string
+	BoothType      *string
+	MinSpend       *float64
+	MaxPerCustomer int
+	Weekdays       []time.Weekday
+	HourFrom       *int
+	HourTo         *int
+	// Stackable vouchers can be combined with other stackable vouchers and
+	// the customer's tier discount on one session. Vouchers are exclusive
+	// unless marked stackable.
+	Stackable bool
+	// CustomerUserID and CustomerTel tie the voucher to one customer: only
+	// a session of that account or phone number may redeem it. Vouchers
+	// issued to a person set them; campaigns do not.
+	CustomerUserID *string
+	CustomerTel    *string
+}
+
+// Reason is the machine-readable code clients get when a voucher cannot be
+// used.
+type Reason string
+
+const (
+	ReasonNotFound         Reason = "not_found"
+	ReasonInactive         Reason = "inactive"
+	ReasonNotStarted       Reason = "not_started"
+	ReasonExpired          Reason = "expired"
+	ReasonLimitReached     Reason = "limit_reached"
+	ReasonAlreadyRedeemed  Reason = "already_redeemed"
+	ReasonWrongBranch      Reason = "wrong_branch"
+	ReasonWrongBooth       Reason = "wrong_booth"
+	ReasonWrongBoothType   Reason = "wrong_booth_type"
+	ReasonMinSpend         Reason = "min_spend"
+	ReasonCustomerRequired Reason = "customer_required"
+	ReasonCustomerLimit    Reason = "customer_limit"
+	ReasonWrongCustomer    Reason = "wrong_customer"
+	ReasonWrongDay         Reason = "wrong_day"
+	ReasonOutsideHours     Reason = "outside_hours"
+	ReasonNotStackable     Reason = "not_stackable"
+	ReasonSessionClosed    Reason = "session_closed"
+)
+
+// RejectionError says why a voucher cannot be redeemed. Message is meant for
+// people; clients should branch on Reason.
+type RejectionError struct {
+	Reason  Reason
+	Message string
+}
+
+func (e *RejectionError) Error() string {
+	return e.Message
+}
+
+// RedemptionContext is what a redemption is checked against.
+type RedemptionContext struct {
+	BranchID  string
+	BoothID   string
+	BoothType string
+	Spend     float64
+	Customer  bool
+	UserID    *string
 	Tel       *string
-	Discount  *float64
-	CreatedAt time.Time
+	Uses      int
+	At        time.Time
+}
+
+// CheckRestrictions returns a *RejectionError for the first restriction
+// that ctx does not satisfy. At must already be in the shop's local time.
+func (r Restrictions) CheckRestrictions(ctx RedemptionContext) error {
+	if len(r.BranchIDs) > 0 && !contains(r.BranchIDs, ctx.BranchID) {
+		return &RejectionError{Reason: ReasonWrongBranch, Message: "voucher not valid at this branch"}
+	}
+	if len(r.BoothIDs) > 0 && !contains(r.BoothIDs, ctx.BoothID) {
+		return &RejectionError{Reason: ReasonWrongBooth, Message: "voucher not valid at this booth"}
+	}
+	if r.BoothType != nil && *r.BoothType != ctx.BoothType {
+		return &RejectionError{Reason: ReasonWrongBoothType, Message: fmt.Sprintf("voucher only valid at %s booths", *r.BoothType)}
+	}
+	if r.MinSpend != nil && ctx.Spend < *r.MinSpend {
+		return &RejectionError{Reason: ReasonMinSpend, Message: fmt.Sprintf("minimum spend of %.2f not met", *r.MinSpend)}
+	}
+	if r.MaxPerCustomer > 0 {
+		if !ctx.Customer {
+			return &RejectionError{Reason: ReasonCustomerRequired, Message: "voucher requires a customer phone number or account"}
+		}
+		if ctx.Uses >= r.MaxPerCustomer {
+			return &RejectionError{Reason: ReasonCustomerLimit, Message: "customer has already used this voucher the maximum number of times"}
+		}
+	}
+	if (r.CustomerUserID != nil || r.CustomerTel != nil) && !r.heldBy(ctx.UserID, ctx.Tel) {
+		return &RejectionError{Reason: ReasonWrongCustomer, Message: "voucher belongs to another customer"}
+	}
+	if len(r.Weekdays) > 0 && !containsWeekday(r.Weekdays, ctx.At.Weekday()) {
+		return &RejectionError{Reason: ReasonWrongDay, Message: fmt.Sprintf("voucher not valid on %s", ctx.At.Weekday())}
+	}
+	if r.HourFrom != nil && r.HourTo != nil && !inHourWindow(ctx.At.Hour(), *r.HourFrom, *r.HourTo) {
+		return &RejectionError{Reason: ReasonOutsideHours, Message: fmt.Sprintf("voucher only valid between %02d:00 and %02d:00", *r.HourFrom, *r.HourTo)}
+	}
+	return nil
+}
+
+// heldBy reports whether the account or phone number is the customer the
+// voucher was issued to.
+func (r Restrictions) heldBy(userID *string, tel *string) bool {
+	if r.CustomerUserID != nil && userID != nil && *r.CustomerUserID == *userID {
+		return true
+	}
+	return r.CustomerTel != nil && tel != nil && *r.CustomerTel == *tel
+}
+
+// inHourWindow treats from as inclusive and to as exclusive; a window with
+// from after to wraps past midnight.
+func inHourWindow(hour int, from int, to int) bool {
+	if from <= to {
+		return hour >= from && hour < to
+	}
+	return hour >= from || hour < to
+}
+
+func contains(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWeekday(values []time.Weekday, target time.Weekday) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+type RedemptionStatus string
+
+const (
+	RedemptionApplied RedemptionStatus = "applied"
+	RedemptionVoided  RedemptionStatus = "voided"
+)
+
+type Redemption struct {
+	ID         string
+	VoucherID  string
+	SessionID  string
+	UserID     *string
+	Tel        *string
+	Discount   *float64
+	Status     RedemptionStatus
+	VoidedAt   *time.Time
+	VoidReason *string
+	CreatedAt  time.Time
+}
+
+// Reversal is the audit record written when a redemption is voided and its
+// use is handed back to the voucher.
+type Reversal struct {
+	ID           string
+	RedemptionID string
+	VoucherID    string
+	SessionID    string
+	Discount     *float64
+	Reason       string
+	CreatedAt    time.Time
 }
 
 type Repository interface {
@@ -50,9 +254,33 @@ type Repository interface {
 	GetByID(ctx context.Context, id string) (*Voucher, error)
 	GetByCode(ctx context.Context, code string) (*Voucher, error)
 	List(ctx context.Context, activeOnly bool) ([]Voucher, error)
+	// ExistingCodes returns the subset of codes that are already taken.
+	ExistingCodes(ctx context.Context, codes []string) ([]string, error)
+}
+
+type CampaignRepository interface {
+	// Create stores the campaign and all of its vouchers atomically.
+	Create(ctx context.Context, campaign *Campaign, vouchers []Voucher) error
+	GetByID(ctx context.Context, id string) (*Campaign, error)
+	List(ctx context.Context) ([]Campaign, error)
+	ListVouchers(ctx context.Context, campaignID string) ([]Voucher, error)
+	Stats(ctx context.Context, campaignID string, asOf time.Time) (*CampaignStats, error)
 }
 
 type RedemptionRepository interface {
 	Create(ctx context.Context, redemption *Redemption) error
 	ListByVoucher(ctx context.Context, voucherID string) ([]Redemption, error)
+	// CountCustomerRedemptions counts applied redemptions of the voucher by
+	// the given account or phone number.
+	CountCustomerRedemptions(ctx context.Context, voucherID string, userID *string, tel *string) (int, error)
+	// Redeem locks the voucher with the given code, runs check against the
+	// locked row and, when it passes, stores the redemption and increments
+	// UsedCount in the same transaction. customerUses is how many applied
+	// redemptions of the voucher share the redemption's UserID or Tel.
+	Redeem(ctx context.Context, code string, redemption *Redemption, check func(v *Voucher, customerUses int) error) (*Voucher, error)
+	// VoidBySession voids every applied redemption of the session, gives
+	// each use back to its voucher and writes a Reversal, all in one
+	// transaction.
+	VoidBySession(ctx context.Context, sessionID string, reason string) ([]Reversal, error)
+	ListReversalsByVoucher(ctx context.Context, voucherID string) ([]Reversal, error)
 }
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +14,58 @@ type Config struct {
 	AppPort          string
 	DB_DSN           string
 	BoothTokenSecret string
+	// UserTokenSecret signs staff and admin logins; it defaults to
+	// BoothTokenSecret.
+	UserTokenSecret string
+
+	PointsExpiryInterval   time.Duration
+	PointsExpiryNoticeDays int
+	TierRecomputeInterval  time.Duration
+
+	MaxStackedDiscountPercent int
+
+	ReferralRewardBaht     int
+	ReferralRewardDays     int
+	ReferralMaxPerReferrer int
+
+	// StorageDriver is "local" or "s3". S3 settings also work for MinIO.
+	StorageDriver    string
+	StorageLocalRoot string
+	// StoragePrivateRoot and S3PrivateBucket keep originals apart from the
+	// files served publicly.
+	StoragePrivateRoot string
+	StoragePublicURL   string
+	S3Endpoint         string
+	S3AccessKey        string
+	S3SecretKey        string
+	S3Bucket           string
+	S3PrivateBucket    string
+	S3Region           string
+	S3UseSSL           bool
+	UploadMaxMB        int
+	// UploadURLTTLMinutes is how long a pre-signed upload URL stays valid.
+	UploadURLTTLMinutes int
+
+	// MediaWorkers and MediaQueueSize size the background queue that builds
+	// photo derivatives.
+	MediaWorkers               int
+	MediaQueueSize             int
+	DerivativeBackfillInterval time.Duration
+	// MediaFetchHosts are the hosts frames, filter LUTs and watermark logos
+	// may be fetched from when they are not in the blob store.
+	MediaFetchHosts []string
+
+	// ShareBaseURL is the public address of the API's /s share pages; a QR
+	// code encodes ShareBaseURL + "/" + its hash.
+	ShareBaseURL string
+	// QRImageSize is the default width of rendered QR images, in pixels.
+	QRImageSize int
+
+	// MediaPurgeInterval is how often media past its branch's retention is
+	// deleted; with MediaPurgeDryRun the job only reports what it would
+	// delete.
+	MediaPurgeInterval time.Duration
+	MediaPurgeDryRun   bool
 }
 
 func LoadConfig() *Config {
@@ -20,11 +75,113 @@ func LoadConfig() *Config {
 		AppPort:          os.Getenv("APP_PORT"),
 		DB_DSN:           os.Getenv("DB_DSN"),
 		BoothTokenSecret: os.Getenv("BOOTH_TOKEN_SECRET"),
+		UserTokenSecret:  os.Getenv("USER_TOKEN_SECRET"),
+
+		PointsExpiryInterval:   getDuration("POINTS_EXPIRY_INTERVAL", 24*time.Hour),
+		PointsExpiryNoticeDays: getInt("POINTS_EXPIRY_NOTICE_DAYS", 30),
+		TierRecomputeInterval:  getDuration("TIER_RECOMPUTE_INTERVAL", 24*time.Hour),
+
+		MaxStackedDiscountPercent: getInt("MAX_STACKED_DISCOUNT_PERCENT", 50),
+
+		ReferralRewardBaht:     getInt("REFERRAL_REWARD_BAHT", 50),
+		ReferralRewardDays:     getInt("REFERRAL_REWARD_DAYS", 90),
+		ReferralMaxPerReferrer: getInt("REFERRAL_MAX_PER_REFERRER", 20),
+
+		StorageDriver:              getString("STORAGE_DRIVER", "local"),
+		StorageLocalRoot:           getString("STORAGE_LOCAL_ROOT", "./data/media"),
+		StoragePrivateRoot:         getString("STORAGE_PRIVATE_ROOT", "./data/originals"),
+		StoragePublicURL:           os.Getenv("STORAGE_PUBLIC_URL"),
+		S3Endpoint:                 os.Getenv("S3_ENDPOINT"),
+		S3AccessKey:                os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:                os.Getenv("S3_SECRET_KEY"),
+		S3Bucket:                   getString("S3_BUCKET", "photobooth"),
+		S3PrivateBucket:            os.Getenv("S3_PRIVATE_BUCKET"),
+		S3Region:                   os.Getenv("S3_REGION"),
+		S3UseSSL:                   getBool("S3_USE_SSL", true),
+		UploadMaxMB:                getInt("UPLOAD_MAX_MB", 25),
+		UploadURLTTLMinutes:        getInt("UPLOAD_URL_TTL_MINUTES", 15),
+		MediaWorkers:               getInt("MEDIA_WORKERS", 2),
+		MediaQueueSize:             getInt("MEDIA_QUEUE_SIZE", 256),
+		DerivativeBackfillInterval: getDuration("DERIVATIVE_BACKFILL_INTERVAL", 10*time.Minute),
+		MediaFetchHosts:            getList("MEDIA_FETCH_HOSTS"),
+		ShareBaseURL:               os.Getenv("SHARE_BASE_URL"),
+		QRImageSize:                getInt("QR_IMAGE_SIZE", 512),
+		MediaPurgeInterval:         getDuration("MEDIA_PURGE_INTERVAL", 24*time.Hour),
+		MediaPurgeDryRun:           getBool("MEDIA_PURGE_DRY_RUN", false),
 	}
 
 	if cfg.AppPort == "" || cfg.DB_DSN == "" || cfg.BoothTokenSecret == "" {
 		log.Fatal("Missing required environment variables")
 	}
+	if cfg.UserTokenSecret == "" {
+		cfg.UserTokenSecret = cfg.BoothTokenSecret
+	}
+	if cfg.S3PrivateBucket == "" {
+		cfg.S3PrivateBucket = cfg.S3Bucket + "-originals"
+	}
+	if cfg.ShareBaseURL == "" {
+		cfg.ShareBaseURL = "http://localhost:" + cfg.AppPort + "/s"
+	}
+	if cfg.StorageDriver != "local" && cfg.StorageDriver != "s3" {
+		log.Fatalf("Invalid STORAGE_DRIVER %q: use local or s3", cfg.StorageDriver)
+	}
+	if cfg.StorageDriver == "s3" && (cfg.S3Endpoint == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "") {
+		log.Fatal("S3_ENDPOINT, S3_ACCESS_KEY and S3_SECRET_KEY are required when STORAGE_DRIVER=s3")
+	}
 
 	return cfg
 }
+
+func getString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getList reads a comma-separated list, dropping empty entries.
+func getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getBool(key string, fallback bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatalf("Invalid boolean for %s: %v", key, err)
+	}
+	return value
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Fatalf("Invalid duration for %s: %v", key, err)
+	}
+	return value
+}
+
+func getInt(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Fatalf("Invalid integer for %s: %v", key, err)
+	}
+	return value
+}
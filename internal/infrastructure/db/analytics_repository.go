@@ -24,7 +24,7 @@ func (r *analyticsRepository) Create(ctx context.Context, event *analytics.Event
 		EventName: event.EventName,
 		Payload:   toJSONMap(event.Payload),
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	event.CreatedAt = model.CreatedAt
@@ -32,7 +32,7 @@ func (r *analyticsRepository) Create(ctx context.Context, event *analytics.Event
 }
 
 func (r *analyticsRepository) ListByBooth(ctx context.Context, boothID string, limit int) ([]analytics.Event, error) {
-	query := r.db.WithContext(ctx).Where("booth_id = ?", boothID).Order("created_at desc")
+	query := conn(ctx, r.db).Where("booth_id = ?", boothID).Order("created_at desc")
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go-ddd-clean/internal/domain/media"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type animationRepository struct {
+	db *gorm.DB
+}
+
+func NewAnimationRepository(db *gorm.DB) media.AnimationRepository {
+	return &animationRepository{db: db}
+}
+
+func (r *animationRepository) Create(ctx context.Context, a *media.Animation) error {
+	model := AnimationModel{
+		ID:           a.ID,
+		SessionID:    a.SessionID,
+		Kind:         string(a.Kind),
+		PhotoIDs:     datatypes.NewJSONSlice(a.PhotoIDs),
+		FrameID:      a.FrameID,
+		FrameDelayMS: a.FrameDelayMS,
+		Loops:        a.Loops,
+		Key:          a.Key,
+		URL:          a.URL,
+		Width:        a.Width,
+		Height:       a.Height,
+		FrameCount:   a.FrameCount,
+		SizeBytes:    a.SizeBytes,
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
+		return err
+	}
+	a.CreatedAt = model.CreatedAt
+	return nil
+}
+
+func (r *animationRepository) Delete(ctx context.Context, id string) error {
+	return conn(ctx, r.db).Delete(&AnimationModel{ID: id}).Error
+}
+
+func (r *animationRepository) GetByID(ctx context.Context, id string) (*media.Animation, error) {
+	var model AnimationModel
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return mapAnimationModelToDomain(&model), nil
+}
+
+func (r *animationRepository) ListBySession(ctx context.Context, sessionID string) ([]media.Animation, error) {
+	var models []AnimationModel
+	if err := conn(ctx, r.db).
+		Where("session_id = ?", sessionID).
+		Order("created_at asc").
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Animation, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapAnimationModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *animationRepository) ListByIDs(ctx context.Context, ids []string) ([]media.Animation, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var models []AnimationModel
+	if err := conn(ctx, r.db).Where("id IN ?", ids).Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Animation, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapAnimationModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *animationRepository) ListByFilter(ctx context.Context, filter media.MediaFilter) ([]media.Animation, error) {
+	var models []AnimationModel
+	if err := applyMediaFilter(conn(ctx, r.db), filter).
+		Order("created_at asc, id asc").
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Animation, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapAnimationModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *animationRepository) ListPurgeable(ctx context.Context, branchID string, before time.Time, offset int, limit int) ([]media.Animation, error) {
+	var models []AnimationModel
+	if err := conn(ctx, r.db).
+		Where("session_id IN (?)", branchSessions(r.db, branchID)).
+		Where("created_at < ? AND purged_at IS NULL", before).
+		Order("created_at asc, id asc").
+		Offset(offset).
+		Limit(limit).
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Animation, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapAnimationModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *animationRepository) MarkPurged(ctx context.Context, id string, at time.Time) error {
+	return conn(ctx, r.db).
+		Model(&AnimationModel{ID: id}).
+		Update("purged_at", at).Error
+}
+
+func mapAnimationModelToDomain(model *AnimationModel) *media.Animation {
+	return &media.Animation{
+		ID:           model.ID,
+		SessionID:    model.SessionID,
+		Kind:         media.AnimationKind(model.Kind),
+		PhotoIDs:     []string(model.PhotoIDs),
+		FrameID:      model.FrameID,
+		FrameDelayMS: model.FrameDelayMS,
+		Loops:        model.Loops,
+		Key:          model.Key,
+		URL:          model.URL,
+		Width:        model.Width,
+		Height:       model.Height,
+		FrameCount:   model.FrameCount,
+		SizeBytes:    model.SizeBytes,
+		PurgedAt:     model.PurgedAt,
+		CreatedAt:    model.CreatedAt,
+	}
+}
@@ -18,11 +18,13 @@ func NewBranchRepository(db *gorm.DB) branch.Repository {
 
 func (r *branchRepository) Create(ctx context.Context, b *branch.Branch) error {
 	model := BranchModel{
-		ID:       b.ID,
-		Name:     b.Name,
-		Location: b.Location,
+		ID:                    b.ID,
+		Name:                  b.Name,
+		Location:              b.Location,
+		OriginalRetentionDays: b.OriginalRetentionDays,
+		RenderedRetentionDays: b.RenderedRetentionDays,
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	b.CreatedAt = model.CreatedAt
@@ -30,43 +32,49 @@ func (r *branchRepository) Create(ctx context.Context, b *branch.Branch) error {
 }
 
 func (r *branchRepository) Update(ctx context.Context, b *branch.Branch) error {
-	return r.db.WithContext(ctx).
+	return conn(ctx, r.db).
 		Model(&BranchModel{ID: b.ID}).
 		Updates(map[string]any{
-			"name":     b.Name,
-			"location": b.Location,
+			"name":                    b.Name,
+			"location":                b.Location,
+			"original_retention_days": b.OriginalRetentionDays,
+			"rendered_retention_days": b.RenderedRetentionDays,
 		}).Error
 }
 
 func (r *branchRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&BranchModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&BranchModel{ID: id}).Error
 }
 
 func (r *branchRepository) GetByID(ctx context.Context, id string) (*branch.Branch, error) {
 	var model BranchModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &branch.Branch{
-		ID:        model.ID,
-		Name:      model.Name,
-		Location:  model.Location,
-		CreatedAt: model.CreatedAt,
+		ID:                    model.ID,
+		Name:                  model.Name,
+		Location:              model.Location,
+		OriginalRetentionDays: model.OriginalRetentionDays,
+		RenderedRetentionDays: model.RenderedRetentionDays,
+		CreatedAt:             model.CreatedAt,
 	}, nil
 }
 
 func (r *branchRepository) List(ctx context.Context) ([]branch.Branch, error) {
 	var models []BranchModel
-	if err := r.db.WithContext(ctx).Find(&models).Error; err != nil {
+	if err := conn(ctx, r.db).Find(&models).Error; err != nil {
 		return nil, err
 	}
 	result := make([]branch.Branch, 0, len(models))
 	for _, m := range models {
 		result = append(result, branch.Branch{
-			ID:        m.ID,
-			Name:      m.Name,
-			Location:  m.Location,
-			CreatedAt: m.CreatedAt,
+			ID:                    m.ID,
+			Name:                  m.Name,
+			Location:              m.Location,
+			OriginalRetentionDays: m.OriginalRetentionDays,
+			RenderedRetentionDays: m.RenderedRetentionDays,
+			CreatedAt:             m.CreatedAt,
 		})
 	}
 	return result, nil
@@ -11,7 +11,8 @@ import (
 
 func ConnectDB(dsn string) *gorm.DB {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Warn),
+		Logger:         logger.Default.LogMode(logger.Warn),
+		TranslateError: true,
 		NowFunc: func() time.Time {
 			return time.Now().UTC()
 		},
@@ -23,6 +24,7 @@ func ConnectDB(dsn string) *gorm.DB {
 		&BranchModel{},
 		&UserModel{},
 		&PaymentModel{},
+		&VoucherCampaignModel{},
 		&VoucherModel{},
 		&FrameModel{},
 		&FilterModel{},
@@ -31,15 +33,29 @@ func ConnectDB(dsn string) *gorm.DB {
 	}
 	if err := db.AutoMigrate(
 		&BoothModel{},
+		&WatermarkModel{},
 		&SessionModel{},
 		&PhotoModel{},
+		&PrintJobModel{},
+		&AnimationModel{},
 		&QRCodeModel{},
 		&VoucherRedemptionModel{},
+		&VoucherReversalModel{},
+		&PointsEntryModel{},
+		&ReferralCodeModel{},
+		&ReferralModel{},
 		&BoothLogModel{},
 		&AnalyticsEventModel{},
 	); err != nil {
 		log.Fatal("❌ Failed to run migrations:", err)
 	}
+	// Redemptions used to be unique per voucher and session regardless of
+	// status; voided ones must not block a fresh redemption.
+	if db.Migrator().HasIndex(&VoucherRedemptionModel{}, "idx_voucher_redemption_session") {
+		if err := db.Migrator().DropIndex(&VoucherRedemptionModel{}, "idx_voucher_redemption_session"); err != nil {
+			log.Fatal("❌ Failed to drop legacy redemption index:", err)
+		}
+	}
 	log.Println("✅ Connected to database and ran migrations")
 	return db
 }
@@ -23,7 +23,7 @@ func (r *filterRepository) Create(ctx context.Context, f *media.Filter) error {
 		Effect: toJSONMap(f.Effect),
 		Active: f.Active,
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	f.CreatedAt = model.CreatedAt
@@ -31,7 +31,7 @@ func (r *filterRepository) Create(ctx context.Context, f *media.Filter) error {
 }
 
 func (r *filterRepository) Update(ctx context.Context, f *media.Filter) error {
-	return r.db.WithContext(ctx).
+	return conn(ctx, r.db).
 		Model(&FilterModel{ID: f.ID}).
 		Updates(map[string]any{
 			"name":   f.Name,
@@ -41,12 +41,12 @@ func (r *filterRepository) Update(ctx context.Context, f *media.Filter) error {
 }
 
 func (r *filterRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&FilterModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&FilterModel{ID: id}).Error
 }
 
 func (r *filterRepository) GetByID(ctx context.Context, id string) (*media.Filter, error) {
 	var model FilterModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &media.Filter{
@@ -59,7 +59,7 @@ func (r *filterRepository) GetByID(ctx context.Context, id string) (*media.Filte
 }
 
 func (r *filterRepository) List(ctx context.Context, onlyActive bool) ([]media.Filter, error) {
-	query := r.db.WithContext(ctx)
+	query := conn(ctx, r.db)
 	if onlyActive {
 		query = query.Where("active = ?", true)
 	}
@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 
 	"go-ddd-clean/internal/domain/media"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -17,14 +19,19 @@ func NewFrameRepository(db *gorm.DB) media.FrameRepository {
 }
 
 func (r *frameRepository) Create(ctx context.Context, f *media.Frame) error {
+	template, err := toFrameTemplateJSON(f.Template)
+	if err != nil {
+		return err
+	}
 	model := FrameModel{
-		ID:      f.ID,
-		Name:    f.Name,
-		Theme:   f.Theme,
-		FileURL: f.FileURL,
-		Active:  f.Active,
+		ID:       f.ID,
+		Name:     f.Name,
+		Theme:    f.Theme,
+		FileURL:  f.FileURL,
+		Template: template,
+		Active:   f.Active,
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	f.CreatedAt = model.CreatedAt
@@ -32,23 +39,56 @@ func (r *frameRepository) Create(ctx context.Context, f *media.Frame) error {
 }
 
 func (r *frameRepository) Update(ctx context.Context, f *media.Frame) error {
-	return r.db.WithContext(ctx).
+	template, err := toFrameTemplateJSON(f.Template)
+	if err != nil {
+		return err
+	}
+	return conn(ctx, r.db).
 		Model(&FrameModel{ID: f.ID}).
 		Updates(map[string]any{
 			"name":     f.Name,
 			"theme":    f.Theme,
 			"file_url": f.FileURL,
+			"template": template,
 			"active":   f.Active,
 		}).Error
 }
 
 func (r *frameRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&FrameModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&FrameModel{ID: id}).Error
 }
 
 func (r *frameRepository) GetByID(ctx context.Context, id string) (*media.Frame, error) {
 	var model FrameModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return mapFrameModelToDomain(&model)
+}
+
+func (r *frameRepository) List(ctx context.Context, onlyActive bool) ([]media.Frame, error) {
+	query := conn(ctx, r.db)
+	if onlyActive {
+		query = query.Where("active = ?", true)
+	}
+	var models []FrameModel
+	if err := query.Order("created_at desc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Frame, 0, len(models))
+	for _, m := range models {
+		frame, err := mapFrameModelToDomain(&m)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *frame)
+	}
+	return result, nil
+}
+
+func mapFrameModelToDomain(model *FrameModel) (*media.Frame, error) {
+	template, err := fromFrameTemplateJSON(model.Template)
+	if err != nil {
 		return nil, err
 	}
 	return &media.Frame{
@@ -56,30 +96,84 @@ func (r *frameRepository) GetByID(ctx context.Context, id string) (*media.Frame,
 		Name:      model.Name,
 		Theme:     model.Theme,
 		FileURL:   model.FileURL,
+		Template:  template,
 		Active:    model.Active,
 		CreatedAt: model.CreatedAt,
 	}, nil
 }
 
-func (r *frameRepository) List(ctx context.Context, onlyActive bool) ([]media.Frame, error) {
-	query := r.db.WithContext(ctx)
-	if onlyActive {
-		query = query.Where("active = ?", true)
+func toFrameTemplateJSON(template *media.FrameTemplate) (datatypes.JSON, error) {
+	if template == nil {
+		return nil, nil
 	}
-	var models []FrameModel
-	if err := query.Order("created_at desc").Find(&models).Error; err != nil {
+	record := FrameTemplateRecord{
+		Width:     template.Width,
+		Height:    template.Height,
+		DPI:       template.DPI,
+		PrintSize: string(template.PrintSize),
+		Slots:     make([]SlotRecord, 0, len(template.Slots)),
+	}
+	for _, s := range template.Slots {
+		record.Slots = append(record.Slots, SlotRecord{
+			X:        s.X,
+			Y:        s.Y,
+			Width:    s.Width,
+			Height:   s.Height,
+			Rotation: s.Rotation,
+		})
+	}
+	for _, o := range template.Overlays {
+		record.Overlays = append(record.Overlays, OverlayRecord{
+			Kind:   string(o.Kind),
+			X:      o.X,
+			Y:      o.Y,
+			Width:  o.Width,
+			Height: o.Height,
+			Text:   o.Text,
+			Format: o.Format,
+			Color:  o.Color,
+			Align:  string(o.Align),
+		})
+	}
+	return json.Marshal(record)
+}
+
+func fromFrameTemplateJSON(data datatypes.JSON) (*media.FrameTemplate, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var record FrameTemplateRecord
+	if err := json.Unmarshal(data, &record); err != nil {
 		return nil, err
 	}
-	result := make([]media.Frame, 0, len(models))
-	for _, m := range models {
-		result = append(result, media.Frame{
-			ID:        m.ID,
-			Name:      m.Name,
-			Theme:     m.Theme,
-			FileURL:   m.FileURL,
-			Active:    m.Active,
-			CreatedAt: m.CreatedAt,
+	template := &media.FrameTemplate{
+		Width:     record.Width,
+		Height:    record.Height,
+		DPI:       record.DPI,
+		PrintSize: media.PrintSize(record.PrintSize),
+		Slots:     make([]media.Slot, 0, len(record.Slots)),
+	}
+	for _, s := range record.Slots {
+		template.Slots = append(template.Slots, media.Slot{
+			X:        s.X,
+			Y:        s.Y,
+			Width:    s.Width,
+			Height:   s.Height,
+			Rotation: s.Rotation,
 		})
 	}
-	return result, nil
+	for _, o := range record.Overlays {
+		template.Overlays = append(template.Overlays, media.Overlay{
+			Kind:   media.OverlayKind(o.Kind),
+			X:      o.X,
+			Y:      o.Y,
+			Width:  o.Width,
+			Height: o.Height,
+			Text:   o.Text,
+			Format: o.Format,
+			Color:  o.Color,
+			Align:  media.TextAlign(o.Align),
+		})
+	}
+	return template, nil
 }
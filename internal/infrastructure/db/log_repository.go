@@ -24,7 +24,7 @@ func (r *logRepository) Create(ctx context.Context, logEntry *logging.BoothLog)
 		Level:     string(logEntry.Level),
 		Message:   logEntry.Message,
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	logEntry.CreatedAt = model.CreatedAt
@@ -32,7 +32,7 @@ func (r *logRepository) Create(ctx context.Context, logEntry *logging.BoothLog)
 }
 
 func (r *logRepository) ListByBooth(ctx context.Context, boothID string, limit int) ([]logging.BoothLog, error) {
-	query := r.db.WithContext(ctx).Where("booth_id = ?", boothID).Order("created_at desc")
+	query := conn(ctx, r.db).Where("booth_id = ?", boothID).Order("created_at desc")
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -7,58 +7,112 @@ import (
 )
 
 type BranchModel struct {
-	ID        string `gorm:"type:uuid;primaryKey"`
-	Name      string
-	Location  *string
-	CreatedAt time.Time `gorm:"autoCreateTime"`
+	ID                    string `gorm:"type:uuid;primaryKey"`
+	Name                  string
+	Location              *string
+	OriginalRetentionDays *int
+	RenderedRetentionDays *int
+	CreatedAt             time.Time `gorm:"autoCreateTime"`
 
-	Booths []BoothModel `gorm:"foreignKey:BranchID"`
+	Booths     []BoothModel     `gorm:"foreignKey:BranchID"`
+	Watermarks []WatermarkModel `gorm:"foreignKey:BranchID"`
 }
 
 type BoothModel struct {
-	ID           string `gorm:"type:uuid;primaryKey"`
-	BranchID     string `gorm:"type:uuid;index"`
-	Name         string
-	Type         string
-	Status       string            `gorm:"default:active"`
-	Config       datatypes.JSONMap `gorm:"type:jsonb"`
-	TokenVersion int               `gorm:"default:0"`
-	CreatedAt    time.Time         `gorm:"autoCreateTime"`
+	ID             string `gorm:"type:uuid;primaryKey"`
+	BranchID       string `gorm:"type:uuid;index"`
+	Name           string
+	Type           string
+	Status         string            `gorm:"default:active"`
+	Config         datatypes.JSONMap `gorm:"type:jsonb"`
+	ExtraCopyPrice *float64
+	TokenVersion   int       `gorm:"default:0"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
 
-	Branch    BranchModel
-	Sessions  []SessionModel        `gorm:"foreignKey:BoothID"`
-	Logs      []BoothLogModel       `gorm:"foreignKey:BoothID"`
-	Analytics []AnalyticsEventModel `gorm:"foreignKey:BoothID"`
+	Branch     BranchModel
+	Sessions   []SessionModel        `gorm:"foreignKey:BoothID"`
+	Logs       []BoothLogModel       `gorm:"foreignKey:BoothID"`
+	Analytics  []AnalyticsEventModel `gorm:"foreignKey:BoothID"`
+	Watermarks []WatermarkModel      `gorm:"foreignKey:BoothID"`
 }
 
 type SessionModel struct {
-	ID            string     `gorm:"type:uuid;primaryKey"`
-	BoothID       string     `gorm:"type:uuid;index"`
-	UserID        *string    `gorm:"type:uuid"`
-	VoucherID     *string    `gorm:"type:uuid"`
-	PaymentID     *string    `gorm:"type:uuid"`
-	StartedAt     *time.Time `gorm:"autoCreateTime"`
-	FinishedAt    *time.Time
-	Status        string `gorm:"default:started"`
-	TotalPrice    *float64
-	BoothSnapshot datatypes.JSONMap `gorm:"type:jsonb"`
-	PhoneTemp     *string
+	ID              string     `gorm:"type:uuid;primaryKey"`
+	BoothID         string     `gorm:"type:uuid;index"`
+	UserID          *string    `gorm:"type:uuid"`
+	VoucherID       *string    `gorm:"type:uuid"`
+	PaymentID       *string    `gorm:"type:uuid"`
+	StartedAt       *time.Time `gorm:"autoCreateTime"`
+	FinishedAt      *time.Time
+	Status          string `gorm:"default:started"`
+	BasePrice       *float64
+	TierPercent     *float64
+	TierDiscount    *float64
+	VoucherDiscount *float64
+	TotalPrice      *float64
+	BoothSnapshot   datatypes.JSONMap `gorm:"type:jsonb"`
+	PhoneTemp       *string
+	Vouchers        datatypes.JSONSlice[AppliedVoucherRecord] `gorm:"type:jsonb"`
+	Discounts       datatypes.JSONSlice[DiscountLineRecord]   `gorm:"type:jsonb"`
+	Charges         datatypes.JSONSlice[ChargeRecord]         `gorm:"type:jsonb"`
 
 	Photos      []PhotoModel             `gorm:"foreignKey:SessionID"`
 	Analytics   []AnalyticsEventModel    `gorm:"foreignKey:SessionID"`
 	Redemptions []VoucherRedemptionModel `gorm:"foreignKey:SessionID"`
+	QRCodes     []QRCodeModel            `gorm:"foreignKey:SessionID"`
+	PrintJobs   []PrintJobModel          `gorm:"foreignKey:SessionID"`
 	Payment     PaymentModel
 }
 
+// AppliedVoucherRecord is the stored form of session.AppliedVoucher.
+type AppliedVoucherRecord struct {
+	RedemptionID string  `json:"redemption_id"`
+	VoucherID    string  `json:"voucher_id"`
+	Code         string  `json:"code"`
+	Kind         string  `json:"kind"`
+	Value        float64 `json:"value"`
+	Stackable    bool    `json:"stackable"`
+}
+
+// DiscountLineRecord is the stored form of session.DiscountLine.
+type DiscountLineRecord struct {
+	Source       string  `json:"source"`
+	Kind         string  `json:"kind"`
+	Value        float64 `json:"value"`
+	Amount       float64 `json:"amount"`
+	RedemptionID *string `json:"redemption_id,omitempty"`
+	VoucherID    *string `json:"voucher_id,omitempty"`
+	Code         *string `json:"code,omitempty"`
+}
+
+// ChargeRecord is the stored form of session.Charge.
+type ChargeRecord struct {
+	Kind      string  `json:"kind"`
+	Reference string  `json:"reference"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Amount    float64 `json:"amount"`
+}
+
 type PhotoModel struct {
-	ID          string  `gorm:"type:uuid;primaryKey"`
-	SessionID   string  `gorm:"type:uuid;index"`
-	FrameID     *string `gorm:"type:uuid"`
-	FilterID    *string `gorm:"type:uuid"`
-	StorageURL  string
-	Composition datatypes.JSONMap `gorm:"type:jsonb"`
-	RenderedURL *string
-	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	ID               string  `gorm:"type:uuid;primaryKey"`
+	SessionID        string  `gorm:"type:uuid;index"`
+	FrameID          *string `gorm:"type:uuid"`
+	FilterID         *string `gorm:"type:uuid"`
+	StorageURL       string
+	Composition      datatypes.JSONMap `gorm:"type:jsonb"`
+	RenderedURL      *string
+	RenderedKey      *string
+	StorageKey       *string
+	ContentHash      *string `gorm:"index"`
+	SizeBytes        *int64
+	MimeType         *string
+	Metadata         datatypes.JSON `gorm:"type:jsonb"`
+	Derivatives      datatypes.JSON `gorm:"type:jsonb"`
+	OriginalPurgedAt *time.Time
+	RenderedPurgedAt *time.Time
+	Watermarked      bool      `gorm:"default:false"`
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
 
 	QRCodes []QRCodeModel `gorm:"foreignKey:PhotoID"`
 }
@@ -68,12 +122,65 @@ type FrameModel struct {
 	Name      string
 	Theme     *string
 	FileURL   string
-	Active    bool      `gorm:"default:true"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
+	Template  datatypes.JSON `gorm:"type:jsonb"`
+	Active    bool           `gorm:"default:true"`
+	CreatedAt time.Time      `gorm:"autoCreateTime"`
 
 	Photos []PhotoModel `gorm:"foreignKey:FrameID"`
 }
 
+// DerivativeRecord is the stored form of media.Derivative; photos keep a
+// JSON object of them keyed by kind.
+type DerivativeRecord struct {
+	Key      string `json:"key"`
+	URL      string `json:"url"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Source   string `json:"source"`
+}
+
+// PhotoMetadataRecord is the stored form of media.PhotoMetadata.
+type PhotoMetadataRecord struct {
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	Orientation int        `json:"orientation"`
+	CapturedAt  *time.Time `json:"captured_at,omitempty"`
+	CameraMake  *string    `json:"camera_make,omitempty"`
+	CameraModel *string    `json:"camera_model,omitempty"`
+}
+
+// FrameTemplateRecord is the stored form of media.FrameTemplate.
+type FrameTemplateRecord struct {
+	Width     int             `json:"width,omitempty"`
+	Height    int             `json:"height,omitempty"`
+	DPI       int             `json:"dpi,omitempty"`
+	PrintSize string          `json:"print_size,omitempty"`
+	Slots     []SlotRecord    `json:"slots"`
+	Overlays  []OverlayRecord `json:"overlays,omitempty"`
+}
+
+type SlotRecord struct {
+	X        int     `json:"x"`
+	Y        int     `json:"y"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Rotation float64 `json:"rotation,omitempty"`
+}
+
+type OverlayRecord struct {
+	Kind   string `json:"kind"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Text   string `json:"text,omitempty"`
+	Format string `json:"format,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Align  string `json:"align,omitempty"`
+}
+
 type FilterModel struct {
 	ID        string `gorm:"type:uuid;primaryKey"`
 	Name      string
@@ -84,25 +191,132 @@ type FilterModel struct {
 	Photos []PhotoModel `gorm:"foreignKey:FilterID"`
 }
 
-type QRCodeModel struct {
-	ID        string `gorm:"type:uuid;primaryKey"`
-	PhotoID   string `gorm:"type:uuid;index"`
-	Hash      string `gorm:"uniqueIndex"`
-	ExpireAt  *time.Time
+// WatermarkModel belongs to a branch or a booth, and each has at most one.
+type WatermarkModel struct {
+	ID        string  `gorm:"type:uuid;primaryKey"`
+	BranchID  *string `gorm:"type:uuid;uniqueIndex"`
+	BoothID   *string `gorm:"type:uuid;uniqueIndex"`
+	ImageURL  *string
+	Text      string
+	Position  string
+	Opacity   float64
+	Scale     float64
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
+type AnimationModel struct {
+	ID           string `gorm:"type:uuid;primaryKey"`
+	SessionID    string `gorm:"type:uuid;index"`
+	Kind         string
+	PhotoIDs     datatypes.JSONSlice[string] `gorm:"type:jsonb"`
+	FrameID      *string                     `gorm:"type:uuid"`
+	FrameDelayMS int
+	Loops        int
+	Key          string
+	URL          string
+	Width        int
+	Height       int
+	FrameCount   int
+	SizeBytes    int64
+	PurgedAt     *time.Time
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+
+	QRCodes []QRCodeModel `gorm:"foreignKey:AnimationID"`
+}
+
+type QRCodeModel struct {
+	ID            string                              `gorm:"type:uuid;primaryKey"`
+	PhotoID       *string                             `gorm:"type:uuid;index"`
+	AnimationID   *string                             `gorm:"type:uuid;index"`
+	SessionID     *string                             `gorm:"type:uuid;index"`
+	Album         datatypes.JSONSlice[MediaRefRecord] `gorm:"type:jsonb"`
+	Hash          string                              `gorm:"uniqueIndex"`
+	ExpireAt      *time.Time
+	Protection    string
+	PINSalt       string
+	PINHash       string
+	FailedUnlocks int `gorm:"default:0"`
+	LockedUntil   *time.Time
+	Downloads     int `gorm:"default:0"`
+	PurgedAt      *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+type PrintJobModel struct {
+	ID         string `gorm:"type:uuid;primaryKey"`
+	BoothID    string `gorm:"type:uuid;index:idx_print_job_queue,priority:1"`
+	SessionID  string `gorm:"type:uuid;index"`
+	PhotoID    string `gorm:"type:uuid;index"`
+	Kind       string
+	FileURL    string
+	Copies     int
+	PaperSize  string
+	Status     string  `gorm:"index:idx_print_job_queue,priority:2"`
+	ReprintOf  *string `gorm:"type:uuid"`
+	UnitPrice  *float64
+	ReviewedBy *string `gorm:"type:uuid"`
+	ReviewedAt *time.Time
+	Error      *string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+// MediaRefRecord is the stored form of media.MediaRef.
+type MediaRefRecord struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+}
+
 type UserModel struct {
-	ID        string  `gorm:"type:uuid;primaryKey"`
-	Tel       *string `gorm:"unique"`
-	Email     *string `gorm:"unique"`
-	Password  *string
-	Role      string    `gorm:"default:customer"`
-	Points    int       `gorm:"default:0"`
+	ID            string  `gorm:"type:uuid;primaryKey"`
+	Tel           *string `gorm:"unique"`
+	Email         *string `gorm:"unique"`
+	Password      *string
+	Role          string `gorm:"default:customer"`
+	Points        int    `gorm:"default:0"`
+	Tier          string `gorm:"default:member"`
+	TierUpdatedAt *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+
+	Sessions      []SessionModel     `gorm:"foreignKey:UserID"`
+	PointsEntries []PointsEntryModel `gorm:"foreignKey:UserID"`
+}
+
+type PointsEntryModel struct {
+	ID        string `gorm:"type:uuid;primaryKey"`
+	UserID    string `gorm:"type:uuid;index"`
+	Type      string
+	Points    int
+	Remaining int        `gorm:"default:0"`
+	ExpiresAt *time.Time `gorm:"index"`
+	LotID     *string    `gorm:"type:uuid"`
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+type ReferralCodeModel struct {
+	Code      string    `gorm:"primaryKey"`
+	UserID    string    `gorm:"type:uuid;uniqueIndex"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
 
-	Sessions []SessionModel `gorm:"foreignKey:UserID"`
+// ReferralModel allows one active (pending or rewarded) referral per phone
+// number and per session; rejected ones do not count.
+type ReferralModel struct {
+	ID                string  `gorm:"type:uuid;primaryKey"`
+	Code              string  `gorm:"index"`
+	ReferrerID        string  `gorm:"type:uuid;index"`
+	RefereeTel        string  `gorm:"uniqueIndex:idx_referral_active_tel,where:status <> 'rejected'"`
+	RefereeUserID     *string `gorm:"type:uuid"`
+	SessionID         string  `gorm:"type:uuid;uniqueIndex:idx_referral_active_session,where:status <> 'rejected'"`
+	Status            string  `gorm:"default:pending;index"`
+	RejectReason      *string
+	ReferrerVoucherID *string   `gorm:"type:uuid"`
+	RefereeVoucherID  *string   `gorm:"type:uuid"`
+	CreatedAt         time.Time `gorm:"autoCreateTime"`
+	ResolvedAt        *time.Time
 }
 
 type PaymentModel struct {
@@ -116,29 +330,86 @@ type PaymentModel struct {
 	CreatedAt      time.Time `gorm:"autoCreateTime"`
 }
 
+type VoucherCampaignModel struct {
+	ID          string `gorm:"type:uuid;primaryKey"`
+	Name        string
+	CodePattern string
+	Quantity    int
+	Type        string
+	Value       float64
+	Unit        string
+	MaxUsage    int `gorm:"default:1"`
+	ValidFrom   *time.Time
+	ValidTo     *time.Time
+	// Active has no default: GORM would insert the default in place of a
+	// false value, and every campaign would start switched on.
+	Active    bool
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	BranchIDs      datatypes.JSONSlice[string] `gorm:"type:jsonb"`
+	BoothIDs       datatypes.JSONSlice[string] `gorm:"type:jsonb"`
+	BoothType      *string
+	MinSpend       *float64
+	MaxPerCustomer int                      `gorm:"default:0"`
+	Weekdays       datatypes.JSONSlice[int] `gorm:"type:jsonb"`
+	HourFrom       *int
+	HourTo         *int
+	Stackable      bool `gorm:"default:false"`
+
+	Vouchers []VoucherModel `gorm:"foreignKey:CampaignID"`
+}
+
 type VoucherModel struct {
-	ID        string `gorm:"type:uuid;primaryKey"`
-	Code      string `gorm:"uniqueIndex"`
-	Type      string
-	Value     float64
-	Unit      string
-	MaxUsage  int `gorm:"default:1"`
-	UsedCount int `gorm:"default:0"`
-	ValidFrom *time.Time
-	ValidTo   *time.Time
-	Active    bool      `gorm:"default:true"`
+	ID         string  `gorm:"type:uuid;primaryKey"`
+	CampaignID *string `gorm:"type:uuid;index"`
+	Code       string  `gorm:"uniqueIndex"`
+	Type       string
+	Value      float64
+	Unit       string
+	MaxUsage   int `gorm:"default:1"`
+	UsedCount  int `gorm:"default:0"`
+	ValidFrom  *time.Time
+	ValidTo    *time.Time
+	// Active has no default, for the same reason as the campaign's.
+	Active    bool
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 
+	BranchIDs      datatypes.JSONSlice[string] `gorm:"type:jsonb"`
+	BoothIDs       datatypes.JSONSlice[string] `gorm:"type:jsonb"`
+	BoothType      *string
+	MinSpend       *float64
+	MaxPerCustomer int                      `gorm:"default:0"`
+	Weekdays       datatypes.JSONSlice[int] `gorm:"type:jsonb"`
+	HourFrom       *int
+	HourTo         *int
+	Stackable      bool    `gorm:"default:false"`
+	CustomerUserID *string `gorm:"type:uuid"`
+	CustomerTel    *string
+
 	Redemptions []VoucherRedemptionModel `gorm:"foreignKey:VoucherID"`
 }
 
 type VoucherRedemptionModel struct {
-	ID        string `gorm:"type:uuid;primaryKey"`
-	VoucherID string `gorm:"type:uuid;index"`
-	SessionID string `gorm:"type:uuid;index"`
-	Tel       *string
-	Discount  *float64
-	CreatedAt time.Time `gorm:"autoCreateTime"`
+	ID         string  `gorm:"type:uuid;primaryKey"`
+	VoucherID  string  `gorm:"type:uuid;index;uniqueIndex:idx_voucher_redemption_applied,where:status = 'applied'"`
+	SessionID  string  `gorm:"type:uuid;index;uniqueIndex:idx_voucher_redemption_applied,where:status = 'applied'"`
+	UserID     *string `gorm:"type:uuid;index"`
+	Tel        *string `gorm:"index"`
+	Discount   *float64
+	Status     string `gorm:"default:applied;index"`
+	VoidedAt   *time.Time
+	VoidReason *string
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+type VoucherReversalModel struct {
+	ID           string `gorm:"type:uuid;primaryKey"`
+	RedemptionID string `gorm:"type:uuid;index"`
+	VoucherID    string `gorm:"type:uuid;index"`
+	SessionID    string `gorm:"type:uuid;index"`
+	Discount     *float64
+	Reason       string
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
 }
 
 type BoothLogModel struct {
@@ -26,7 +26,7 @@ func (r *paymentRepository) Create(ctx context.Context, p *payment.Payment) erro
 		Status:         string(p.Status),
 		TransactionRef: p.TransactionRef,
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	p.CreatedAt = model.CreatedAt
@@ -34,7 +34,7 @@ func (r *paymentRepository) Create(ctx context.Context, p *payment.Payment) erro
 }
 
 func (r *paymentRepository) Update(ctx context.Context, p *payment.Payment) error {
-	return r.db.WithContext(ctx).
+	return conn(ctx, r.db).
 		Model(&PaymentModel{ID: p.ID}).
 		Updates(map[string]any{
 			"status":          string(p.Status),
@@ -47,7 +47,7 @@ func (r *paymentRepository) Update(ctx context.Context, p *payment.Payment) erro
 
 func (r *paymentRepository) GetByID(ctx context.Context, id string) (*payment.Payment, error) {
 	var model PaymentModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return mapPaymentModelToDomain(&model), nil
@@ -55,7 +55,7 @@ func (r *paymentRepository) GetByID(ctx context.Context, id string) (*payment.Pa
 
 func (r *paymentRepository) GetBySessionID(ctx context.Context, sessionID string) (*payment.Payment, error) {
 	var model PaymentModel
-	if err := r.db.WithContext(ctx).First(&model, "session_id = ?", sessionID).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "session_id = ?", sessionID).Error; err != nil {
 		return nil, err
 	}
 	return mapPaymentModelToDomain(&model), nil
@@ -2,9 +2,12 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"go-ddd-clean/internal/domain/media"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -17,6 +20,10 @@ func NewPhotoRepository(db *gorm.DB) media.PhotoRepository {
 }
 
 func (r *photoRepository) Create(ctx context.Context, p *media.Photo) error {
+	metadata, err := toPhotoMetadataJSON(p.Metadata)
+	if err != nil {
+		return err
+	}
 	model := PhotoModel{
 		ID:          p.ID,
 		SessionID:   p.SessionID,
@@ -25,8 +32,14 @@ func (r *photoRepository) Create(ctx context.Context, p *media.Photo) error {
 		StorageURL:  p.StorageURL,
 		Composition: toJSONMap(p.Composition),
 		RenderedURL: p.RenderedURL,
+		RenderedKey: p.RenderedKey,
+		StorageKey:  p.StorageKey,
+		ContentHash: p.ContentHash,
+		SizeBytes:   p.SizeBytes,
+		MimeType:    p.MimeType,
+		Metadata:    metadata,
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	p.CreatedAt = model.CreatedAt
@@ -34,7 +47,11 @@ func (r *photoRepository) Create(ctx context.Context, p *media.Photo) error {
 }
 
 func (r *photoRepository) Update(ctx context.Context, p *media.Photo) error {
-	return r.db.WithContext(ctx).
+	metadata, err := toPhotoMetadataJSON(p.Metadata)
+	if err != nil {
+		return err
+	}
+	return conn(ctx, r.db).
 		Model(&PhotoModel{ID: p.ID}).
 		Updates(map[string]any{
 			"session_id":   p.SessionID,
@@ -43,16 +60,23 @@ func (r *photoRepository) Update(ctx context.Context, p *media.Photo) error {
 			"storage_url":  p.StorageURL,
 			"composition":  toJSONMap(p.Composition),
 			"rendered_url": p.RenderedURL,
+			"rendered_key": p.RenderedKey,
+			"storage_key":  p.StorageKey,
+			"content_hash": p.ContentHash,
+			"size_bytes":   p.SizeBytes,
+			"mime_type":    p.MimeType,
+			"metadata":     metadata,
+			"watermarked":  p.Watermarked,
 		}).Error
 }
 
 func (r *photoRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&PhotoModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&PhotoModel{ID: id}).Error
 }
 
 func (r *photoRepository) GetByID(ctx context.Context, id string) (*media.Photo, error) {
 	var model PhotoModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return mapPhotoModelToDomain(&model), nil
@@ -60,7 +84,7 @@ func (r *photoRepository) GetByID(ctx context.Context, id string) (*media.Photo,
 
 func (r *photoRepository) ListBySession(ctx context.Context, sessionID string) ([]media.Photo, error) {
 	var models []PhotoModel
-	if err := r.db.WithContext(ctx).
+	if err := conn(ctx, r.db).
 		Where("session_id = ?", sessionID).
 		Order("created_at asc").
 		Find(&models).Error; err != nil {
@@ -73,18 +97,250 @@ func (r *photoRepository) ListBySession(ctx context.Context, sessionID string) (
 	return result, nil
 }
 
+func (r *photoRepository) ListByIDs(ctx context.Context, ids []string) ([]media.Photo, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var models []PhotoModel
+	if err := conn(ctx, r.db).Where("id IN ?", ids).Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Photo, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapPhotoModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *photoRepository) ListByFilter(ctx context.Context, filter media.MediaFilter, offset int, limit int) ([]media.Photo, error) {
+	var models []PhotoModel
+	if err := applyMediaFilter(conn(ctx, r.db), filter).
+		Order("created_at asc, id asc").
+		Offset(offset).
+		Limit(limit).
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Photo, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapPhotoModelToDomain(&m))
+	}
+	return result, nil
+}
+
+// applyMediaFilter narrows a query on a table with session_id and
+// created_at columns. Booths are matched through their sessions.
+func applyMediaFilter(query *gorm.DB, filter media.MediaFilter) *gorm.DB {
+	if filter.SessionID != nil {
+		query = query.Where("session_id = ?", *filter.SessionID)
+	}
+	if filter.BoothID != nil {
+		sessions := query.Session(&gorm.Session{NewDB: true}).
+			Model(&SessionModel{}).
+			Select("id").
+			Where("booth_id = ?", *filter.BoothID)
+		query = query.Where("session_id IN (?)", sessions)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// branchSessions selects the IDs of the branch's sessions, for filtering
+// media by branch.
+func branchSessions(db *gorm.DB, branchID string) *gorm.DB {
+	booths := db.Session(&gorm.Session{NewDB: true}).
+		Model(&BoothModel{}).
+		Select("id").
+		Where("branch_id = ?", branchID)
+	return db.Session(&gorm.Session{NewDB: true}).
+		Model(&SessionModel{}).
+		Select("id").
+		Where("booth_id IN (?)", booths)
+}
+
+func (r *photoRepository) ListPurgeable(
+	ctx context.Context,
+	branchID string,
+	source media.DerivativeSource,
+	before time.Time,
+	offset int,
+	limit int,
+) ([]media.Photo, error) {
+	query := conn(ctx, r.db).
+		Where("session_id IN (?)", branchSessions(r.db, branchID)).
+		Where("created_at < ?", before)
+	if source == media.SourceRendered {
+		query = query.Where("rendered_url IS NOT NULL AND rendered_purged_at IS NULL")
+	} else {
+		query = query.Where("original_purged_at IS NULL")
+	}
+	var models []PhotoModel
+	if err := query.
+		Order("created_at asc, id asc").
+		Offset(offset).
+		Limit(limit).
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Photo, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapPhotoModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *photoRepository) MarkPurged(
+	ctx context.Context,
+	id string,
+	source media.DerivativeSource,
+	at time.Time,
+	derivatives map[media.DerivativeKind]media.Derivative,
+) error {
+	data, err := toDerivativesJSON(derivatives)
+	if err != nil {
+		return err
+	}
+	column := "original_purged_at"
+	if source == media.SourceRendered {
+		column = "rendered_purged_at"
+	}
+	return conn(ctx, r.db).
+		Model(&PhotoModel{ID: id}).
+		Updates(map[string]any{column: at, "derivatives": data}).Error
+}
+
+func (r *photoRepository) SetDerivatives(ctx context.Context, id string, derivatives map[media.DerivativeKind]media.Derivative, watermarked bool) error {
+	data, err := toDerivativesJSON(derivatives)
+	if err != nil {
+		return err
+	}
+	return conn(ctx, r.db).
+		Model(&PhotoModel{ID: id}).
+		Updates(map[string]any{"derivatives": data, "watermarked": watermarked}).Error
+}
+
+func toDerivativesJSON(derivatives map[media.DerivativeKind]media.Derivative) (datatypes.JSON, error) {
+	records := make(map[string]DerivativeRecord, len(derivatives))
+	for kind, d := range derivatives {
+		records[string(kind)] = DerivativeRecord{
+			Key:      d.Key,
+			URL:      d.URL,
+			Width:    d.Width,
+			Height:   d.Height,
+			MimeType: d.MimeType,
+			Size:     d.Size,
+			Source:   string(d.Source),
+		}
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+func (r *photoRepository) ListWithoutDerivatives(ctx context.Context, limit int) ([]media.Photo, error) {
+	var models []PhotoModel
+	if err := conn(ctx, r.db).
+		Where("derivatives IS NULL AND (storage_key IS NOT NULL OR rendered_key IS NOT NULL)").
+		Order("created_at asc").
+		Limit(limit).
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Photo, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapPhotoModelToDomain(&m))
+	}
+	return result, nil
+}
+
 func mapPhotoModelToDomain(model *PhotoModel) *media.Photo {
 	if model == nil {
 		return nil
 	}
 	return &media.Photo{
-		ID:          model.ID,
-		SessionID:   model.SessionID,
-		FrameID:     model.FrameID,
-		FilterID:    model.FilterID,
-		StorageURL:  model.StorageURL,
-		Composition: fromJSONMap(model.Composition),
-		RenderedURL: model.RenderedURL,
-		CreatedAt:   model.CreatedAt,
+		ID:               model.ID,
+		SessionID:        model.SessionID,
+		FrameID:          model.FrameID,
+		FilterID:         model.FilterID,
+		StorageURL:       model.StorageURL,
+		Composition:      fromJSONMap(model.Composition),
+		RenderedURL:      model.RenderedURL,
+		RenderedKey:      model.RenderedKey,
+		StorageKey:       model.StorageKey,
+		ContentHash:      model.ContentHash,
+		SizeBytes:        model.SizeBytes,
+		MimeType:         model.MimeType,
+		Metadata:         fromPhotoMetadataJSON(model.Metadata),
+		Derivatives:      fromDerivativesJSON(model.Derivatives),
+		OriginalPurgedAt: model.OriginalPurgedAt,
+		RenderedPurgedAt: model.RenderedPurgedAt,
+		Watermarked:      model.Watermarked,
+		CreatedAt:        model.CreatedAt,
+	}
+}
+
+func toPhotoMetadataJSON(metadata *media.PhotoMetadata) (datatypes.JSON, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	return json.Marshal(PhotoMetadataRecord{
+		Width:       metadata.Width,
+		Height:      metadata.Height,
+		Orientation: metadata.Orientation,
+		CapturedAt:  metadata.CapturedAt,
+		CameraMake:  metadata.CameraMake,
+		CameraModel: metadata.CameraModel,
+	})
+}
+
+// fromPhotoMetadataJSON reads stored metadata; unreadable data is treated
+// as none.
+func fromPhotoMetadataJSON(data datatypes.JSON) *media.PhotoMetadata {
+	if len(data) == 0 {
+		return nil
+	}
+	var record PhotoMetadataRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil
+	}
+	return &media.PhotoMetadata{
+		Width:       record.Width,
+		Height:      record.Height,
+		Orientation: record.Orientation,
+		CapturedAt:  record.CapturedAt,
+		CameraMake:  record.CameraMake,
+		CameraModel: record.CameraModel,
+	}
+}
+
+// fromDerivativesJSON reads stored derivatives. They can always be rebuilt,
+// so unreadable data is treated as none.
+func fromDerivativesJSON(data datatypes.JSON) map[media.DerivativeKind]media.Derivative {
+	if len(data) == 0 {
+		return nil
+	}
+	var records map[string]DerivativeRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil
+	}
+	result := make(map[media.DerivativeKind]media.Derivative, len(records))
+	for kind, d := range records {
+		result[media.DerivativeKind(kind)] = media.Derivative{
+			Key:      d.Key,
+			URL:      d.URL,
+			Width:    d.Width,
+			Height:   d.Height,
+			MimeType: d.MimeType,
+			Size:     d.Size,
+			Source:   media.DerivativeSource(d.Source),
+		}
 	}
+	return result
 }
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go-ddd-clean/internal/domain/printing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type printJobRepository struct {
+	db *gorm.DB
+}
+
+func NewPrintJobRepository(db *gorm.DB) printing.Repository {
+	return &printJobRepository{db: db}
+}
+
+func (r *printJobRepository) Create(ctx context.Context, j *printing.Job) error {
+	model := PrintJobModel{
+		ID:         j.ID,
+		BoothID:    j.BoothID,
+		SessionID:  j.SessionID,
+		PhotoID:    j.PhotoID,
+		Kind:       string(j.Kind),
+		FileURL:    j.FileURL,
+		Copies:     j.Copies,
+		PaperSize:  string(j.PaperSize),
+		Status:     string(j.Status),
+		ReprintOf:  j.ReprintOf,
+		UnitPrice:  j.UnitPrice,
+		ReviewedBy: j.ReviewedBy,
+		ReviewedAt: j.ReviewedAt,
+		Error:      j.Error,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
+		return err
+	}
+	j.CreatedAt = model.CreatedAt
+	j.UpdatedAt = model.UpdatedAt
+	return nil
+}
+
+func (r *printJobRepository) Update(ctx context.Context, j *printing.Job) error {
+	j.UpdatedAt = time.Now()
+	return conn(ctx, r.db).
+		Model(&PrintJobModel{ID: j.ID}).
+		Updates(printJobColumns(j)).Error
+}
+
+func (r *printJobRepository) Transition(ctx context.Context, j *printing.Job, from printing.Status) error {
+	j.UpdatedAt = time.Now()
+	result := conn(ctx, r.db).
+		Model(&PrintJobModel{ID: j.ID}).
+		Where("status = ?", string(from)).
+		Updates(printJobColumns(j))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return printing.ErrStatusChanged
+	}
+	return nil
+}
+
+func printJobColumns(j *printing.Job) map[string]any {
+	return map[string]any{
+		"file_url":    j.FileURL,
+		"copies":      j.Copies,
+		"paper_size":  string(j.PaperSize),
+		"status":      string(j.Status),
+		"unit_price":  j.UnitPrice,
+		"reviewed_by": j.ReviewedBy,
+		"reviewed_at": j.ReviewedAt,
+		"error":       j.Error,
+		"started_at":  j.StartedAt,
+		"finished_at": j.FinishedAt,
+		"updated_at":  j.UpdatedAt,
+	}
+}
+
+func (r *printJobRepository) GetByID(ctx context.Context, id string) (*printing.Job, error) {
+	var model PrintJobModel
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return mapPrintJobModelToDomain(&model), nil
+}
+
+func (r *printJobRepository) List(ctx context.Context, filter printing.JobFilter) ([]printing.Job, error) {
+	query := conn(ctx, r.db).Model(&PrintJobModel{})
+	if filter.BoothID != nil {
+		query = query.Where("booth_id = ?", *filter.BoothID)
+	}
+	if filter.SessionID != nil {
+		query = query.Where("session_id = ?", *filter.SessionID)
+	}
+	if filter.PhotoID != nil {
+		query = query.Where("photo_id = ?", *filter.PhotoID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", string(*filter.Status))
+	}
+	var models []PrintJobModel
+	if err := query.Order("created_at asc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]printing.Job, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapPrintJobModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *printJobRepository) ClaimNext(ctx context.Context, boothID string, at time.Time) (*printing.Job, error) {
+	var result *printing.Job
+	err := conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		// SKIP LOCKED lets a second poller take the next job instead of
+		// waiting on the one already being claimed.
+		var models []PrintJobModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("booth_id = ? AND status = ?", boothID, string(printing.StatusQueued)).
+			Order("created_at asc").
+			Limit(1).
+			Find(&models).Error; err != nil {
+			return err
+		}
+		if len(models) == 0 {
+			return nil
+		}
+		model := &models[0]
+		model.Status = string(printing.StatusPrinting)
+		model.StartedAt = &at
+		model.UpdatedAt = at
+		if err := tx.Model(&PrintJobModel{ID: model.ID}).
+			Updates(map[string]any{
+				"status":     model.Status,
+				"started_at": model.StartedAt,
+				"updated_at": model.UpdatedAt,
+			}).Error; err != nil {
+			return err
+		}
+		result = mapPrintJobModelToDomain(model)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func mapPrintJobModelToDomain(model *PrintJobModel) *printing.Job {
+	return &printing.Job{
+		ID:         model.ID,
+		BoothID:    model.BoothID,
+		SessionID:  model.SessionID,
+		PhotoID:    model.PhotoID,
+		Kind:       printing.Kind(model.Kind),
+		FileURL:    model.FileURL,
+		Copies:     model.Copies,
+		PaperSize:  printing.PaperSize(model.PaperSize),
+		Status:     printing.Status(model.Status),
+		ReprintOf:  model.ReprintOf,
+		UnitPrice:  model.UnitPrice,
+		ReviewedBy: model.ReviewedBy,
+		ReviewedAt: model.ReviewedAt,
+		Error:      model.Error,
+		StartedAt:  model.StartedAt,
+		FinishedAt: model.FinishedAt,
+		CreatedAt:  model.CreatedAt,
+		UpdatedAt:  model.UpdatedAt,
+	}
+}
@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"go-ddd-clean/internal/domain/media"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -18,32 +20,109 @@ func NewQRCodeRepository(db *gorm.DB) media.QRCodeRepository {
 
 func (r *qrCodeRepository) Create(ctx context.Context, code *media.QRCode) error {
 	model := QRCodeModel{
-		ID:       code.ID,
-		PhotoID:  code.PhotoID,
-		Hash:     code.Hash,
-		ExpireAt: code.ExpireAt,
+		ID:          code.ID,
+		PhotoID:     code.PhotoID,
+		AnimationID: code.AnimationID,
+		SessionID:   code.SessionID,
+		Hash:        code.Hash,
+		ExpireAt:    code.ExpireAt,
+		Protection:  string(code.Protection),
+		PINSalt:     code.PINSalt,
+		PINHash:     code.PINHash,
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if len(code.Album) > 0 {
+		album := make([]MediaRefRecord, 0, len(code.Album))
+		for _, ref := range code.Album {
+			album = append(album, MediaRefRecord{Kind: string(ref.Kind), ID: ref.ID})
+		}
+		model.Album = datatypes.NewJSONSlice(album)
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	code.CreatedAt = model.CreatedAt
 	return nil
 }
 
+func (r *qrCodeRepository) Get(ctx context.Context, id string) (*media.QRCode, error) {
+	var model QRCodeModel
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return toQRCode(model), nil
+}
+
 func (r *qrCodeRepository) GetByHash(ctx context.Context, hash string) (*media.QRCode, error) {
 	var model QRCodeModel
-	if err := r.db.WithContext(ctx).First(&model, "hash = ?", hash).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "hash = ?", hash).Error; err != nil {
 		return nil, err
 	}
-	return &media.QRCode{
-		ID:        model.ID,
-		PhotoID:   model.PhotoID,
-		Hash:      model.Hash,
-		ExpireAt:  model.ExpireAt,
-		CreatedAt: model.CreatedAt,
-	}, nil
+	return toQRCode(model), nil
+}
+
+func toQRCode(model QRCodeModel) *media.QRCode {
+	code := &media.QRCode{
+		ID:            model.ID,
+		PhotoID:       model.PhotoID,
+		AnimationID:   model.AnimationID,
+		SessionID:     model.SessionID,
+		Hash:          model.Hash,
+		ExpireAt:      model.ExpireAt,
+		Protection:    media.QRProtection(model.Protection),
+		PINSalt:       model.PINSalt,
+		PINHash:       model.PINHash,
+		FailedUnlocks: model.FailedUnlocks,
+		LockedUntil:   model.LockedUntil,
+		Downloads:     model.Downloads,
+		PurgedAt:      model.PurgedAt,
+		CreatedAt:     model.CreatedAt,
+	}
+	for _, ref := range model.Album {
+		code.Album = append(code.Album, media.MediaRef{Kind: media.MediaKind(ref.Kind), ID: ref.ID})
+	}
+	return code
 }
 
 func (r *qrCodeRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&QRCodeModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&QRCodeModel{ID: id}).Error
+}
+
+func (r *qrCodeRepository) RecordFailedUnlock(ctx context.Context, id string, maxAttempts int, lockedUntil time.Time) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&QRCodeModel{ID: id}).
+			Update("failed_unlocks", gorm.Expr("failed_unlocks + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&QRCodeModel{}).
+			Where("id = ? AND failed_unlocks >= ?", id, maxAttempts).
+			Updates(map[string]any{"failed_unlocks": 0, "locked_until": lockedUntil}).Error
+	})
+}
+
+func (r *qrCodeRepository) ResetFailedUnlocks(ctx context.Context, id string) error {
+	return conn(ctx, r.db).
+		Model(&QRCodeModel{ID: id}).
+		Updates(map[string]any{"failed_unlocks": 0, "locked_until": nil}).Error
+}
+
+func (r *qrCodeRepository) IncrementDownloads(ctx context.Context, id string) error {
+	return conn(ctx, r.db).
+		Model(&QRCodeModel{ID: id}).
+		Update("downloads", gorm.Expr("downloads + 1")).Error
+}
+
+func (r *qrCodeRepository) MarkPurged(ctx context.Context, target media.QRTarget, ids []string, at time.Time) (int, error) {
+	column := map[media.QRTarget]string{
+		media.QRTargetPhoto:     "photo_id",
+		media.QRTargetAnimation: "animation_id",
+		media.QRTargetSession:   "session_id",
+	}[target]
+	if column == "" || len(ids) == 0 {
+		return 0, nil
+	}
+	result := conn(ctx, r.db).
+		Model(&QRCodeModel{}).
+		Where(column+" IN ? AND purged_at IS NULL", ids).
+		Update("purged_at", at)
+	return int(result.RowsAffected), result.Error
 }
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"go-ddd-clean/internal/domain/referral"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type referralRepository struct {
+	db *gorm.DB
+}
+
+func NewReferralRepository(db *gorm.DB) referral.Repository {
+	return &referralRepository{db: db}
+}
+
+func (r *referralRepository) CreateCode(ctx context.Context, c *referral.Code) error {
+	model := ReferralCodeModel{
+		Code:   c.Code,
+		UserID: c.UserID,
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
+		return err
+	}
+	c.CreatedAt = model.CreatedAt
+	return nil
+}
+
+func (r *referralRepository) FindCode(ctx context.Context, code string) (*referral.Code, error) {
+	return r.findCode(ctx, "code = ?", code)
+}
+
+func (r *referralRepository) FindCodeByUser(ctx context.Context, userID string) (*referral.Code, error) {
+	return r.findCode(ctx, "user_id = ?", userID)
+}
+
+func (r *referralRepository) findCode(ctx context.Context, query string, arg string) (*referral.Code, error) {
+	var model ReferralCodeModel
+	err := conn(ctx, r.db).First(&model, query, arg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &referral.Code{
+		Code:      model.Code,
+		UserID:    model.UserID,
+		CreatedAt: model.CreatedAt,
+	}, nil
+}
+
+func (r *referralRepository) Create(ctx context.Context, ref *referral.Referral) error {
+	model := ReferralModel{
+		ID:            ref.ID,
+		Code:          ref.Code,
+		ReferrerID:    ref.ReferrerID,
+		RefereeTel:    ref.RefereeTel,
+		RefereeUserID: ref.RefereeUserID,
+		SessionID:     ref.SessionID,
+		Status:        string(ref.Status),
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return referral.ErrAlreadyReferred
+		}
+		return err
+	}
+	ref.CreatedAt = model.CreatedAt
+	return nil
+}
+
+func (r *referralRepository) Update(ctx context.Context, ref *referral.Referral) error {
+	return conn(ctx, r.db).
+		Model(&ReferralModel{ID: ref.ID}).
+		Updates(map[string]any{
+			"status":              string(ref.Status),
+			"reject_reason":       ref.RejectReason,
+			"referrer_voucher_id": ref.ReferrerVoucherID,
+			"referee_voucher_id":  ref.RefereeVoucherID,
+			"resolved_at":         ref.ResolvedAt,
+		}).Error
+}
+
+func (r *referralRepository) FindPendingBySession(ctx context.Context, sessionID string) (*referral.Referral, error) {
+	return r.findPendingBySession(conn(ctx, r.db), sessionID)
+}
+
+func (r *referralRepository) FindPendingBySessionForUpdate(ctx context.Context, sessionID string) (*referral.Referral, error) {
+	return r.findPendingBySession(conn(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}), sessionID)
+}
+
+func (r *referralRepository) findPendingBySession(query *gorm.DB, sessionID string) (*referral.Referral, error) {
+	var model ReferralModel
+	err := query.
+		First(&model, "session_id = ? AND status = ?", sessionID, string(referral.StatusPending)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mapReferralModelToDomain(&model), nil
+}
+
+func (r *referralRepository) List(ctx context.Context, referrerID *string) ([]referral.Referral, error) {
+	query := conn(ctx, r.db).Model(&ReferralModel{})
+	if referrerID != nil {
+		query = query.Where("referrer_id = ?", *referrerID)
+	}
+	var models []ReferralModel
+	if err := query.Order("created_at desc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]referral.Referral, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapReferralModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *referralRepository) CountActiveByReferrer(ctx context.Context, referrerID string) (int, error) {
+	var count int64
+	err := conn(ctx, r.db).
+		Model(&ReferralModel{}).
+		Where("referrer_id = ? AND status <> ?", referrerID, string(referral.StatusRejected)).
+		Count(&count).Error
+	return int(count), err
+}
+
+func (r *referralRepository) ActiveForTel(ctx context.Context, tel string) (bool, error) {
+	var count int64
+	err := conn(ctx, r.db).
+		Model(&ReferralModel{}).
+		Where("referee_tel = ? AND status <> ?", tel, string(referral.StatusRejected)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// HasPaidSession matches the phone number both on sessions that only carry
+// it temporarily and on sessions of an account registered with it.
+func (r *referralRepository) HasPaidSession(ctx context.Context, tel string, excludeSessionID string) (bool, error) {
+	var count int64
+	err := conn(ctx, r.db).
+		Table("session_models AS s").
+		Joins("JOIN payment_models AS p ON p.session_id = s.id AND p.status = ? AND p.amount > 0", "success").
+		Joins("LEFT JOIN user_models AS u ON u.id = s.user_id").
+		Where("s.status = ? AND s.id <> ?", "success", excludeSessionID).
+		Where("s.phone_temp = ? OR u.tel = ?", tel, tel).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *referralRepository) SessionPaid(ctx context.Context, sessionID string) (bool, error) {
+	var count int64
+	err := conn(ctx, r.db).
+		Model(&PaymentModel{}).
+		Where("session_id = ? AND status = ? AND amount > 0", sessionID, "success").
+		Count(&count).Error
+	return count > 0, err
+}
+
+func mapReferralModelToDomain(model *ReferralModel) *referral.Referral {
+	if model == nil {
+		return nil
+	}
+	return &referral.Referral{
+		ID:                model.ID,
+		Code:              model.Code,
+		ReferrerID:        model.ReferrerID,
+		RefereeTel:        model.RefereeTel,
+		RefereeUserID:     model.RefereeUserID,
+		SessionID:         model.SessionID,
+		Status:            referral.Status(model.Status),
+		RejectReason:      model.RejectReason,
+		ReferrerVoucherID: model.ReferrerVoucherID,
+		RefereeVoucherID:  model.RefereeVoucherID,
+		CreatedAt:         model.CreatedAt,
+		ResolvedAt:        model.ResolvedAt,
+	}
+}
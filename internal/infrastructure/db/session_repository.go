@@ -5,7 +5,9 @@ import (
 
 	"go-ddd-clean/internal/domain/session"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type sessionRepository struct {
@@ -18,55 +20,84 @@ func NewSessionRepository(db *gorm.DB) session.Repository {
 
 func (r *sessionRepository) Create(ctx context.Context, s *session.Session) error {
 	model := SessionModel{
-		ID:            s.ID,
-		BoothID:       s.BoothID,
-		UserID:        s.UserID,
-		VoucherID:     s.VoucherID,
-		PaymentID:     s.PaymentID,
-		StartedAt:     s.StartedAt,
-		FinishedAt:    s.FinishedAt,
-		Status:        string(s.Status),
-		TotalPrice:    s.TotalPrice,
-		BoothSnapshot: toJSONMap(s.BoothSnapshot),
-		PhoneTemp:     s.PhoneTemp,
-	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+		ID:              s.ID,
+		BoothID:         s.BoothID,
+		UserID:          s.UserID,
+		VoucherID:       s.VoucherID,
+		PaymentID:       s.PaymentID,
+		StartedAt:       s.StartedAt,
+		FinishedAt:      s.FinishedAt,
+		Status:          string(s.Status),
+		BasePrice:       s.BasePrice,
+		TierPercent:     s.TierPercent,
+		TierDiscount:    s.TierDiscount,
+		VoucherDiscount: s.VoucherDiscount,
+		TotalPrice:      s.TotalPrice,
+		BoothSnapshot:   toJSONMap(s.BoothSnapshot),
+		PhoneTemp:       s.PhoneTemp,
+		Vouchers:        toAppliedVoucherRecords(s.Vouchers),
+		Discounts:       toDiscountLineRecords(s.Discounts),
+		Charges:         toChargeRecords(s.Charges),
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *sessionRepository) Update(ctx context.Context, s *session.Session) error {
-	return r.db.WithContext(ctx).
+	return conn(ctx, r.db).
 		Model(&SessionModel{ID: s.ID}).
 		Updates(map[string]any{
 			"booth_id":       s.BoothID,
 			"user_id":        s.UserID,
-			"voucher_id":     s.VoucherID,
 			"payment_id":     s.PaymentID,
 			"started_at":     s.StartedAt,
 			"finished_at":    s.FinishedAt,
 			"status":         string(s.Status),
-			"total_price":    s.TotalPrice,
 			"booth_snapshot": toJSONMap(s.BoothSnapshot),
 			"phone_temp":     s.PhoneTemp,
 		}).Error
 }
 
+func (r *sessionRepository) UpdatePricing(ctx context.Context, s *session.Session) error {
+	return conn(ctx, r.db).
+		Model(&SessionModel{ID: s.ID}).
+		Updates(map[string]any{
+			"voucher_id":       s.VoucherID,
+			"base_price":       s.BasePrice,
+			"tier_percent":     s.TierPercent,
+			"tier_discount":    s.TierDiscount,
+			"voucher_discount": s.VoucherDiscount,
+			"total_price":      s.TotalPrice,
+			"vouchers":         toAppliedVoucherRecords(s.Vouchers),
+			"discounts":        toDiscountLineRecords(s.Discounts),
+			"charges":          toChargeRecords(s.Charges),
+		}).Error
+}
+
 func (r *sessionRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&SessionModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&SessionModel{ID: id}).Error
 }
 
 func (r *sessionRepository) GetByID(ctx context.Context, id string) (*session.Session, error) {
 	var model SessionModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return mapSessionModelToDomain(&model), nil
+}
+
+func (r *sessionRepository) GetForUpdate(ctx context.Context, id string) (*session.Session, error) {
+	var model SessionModel
+	if err := conn(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return mapSessionModelToDomain(&model), nil
 }
 
 func (r *sessionRepository) List(ctx context.Context, boothID *string, status *session.Status) ([]session.Session, error) {
-	query := r.db.WithContext(ctx).Model(&SessionModel{})
+	query := conn(ctx, r.db).Model(&SessionModel{})
 	if boothID != nil {
 		query = query.Where("booth_id = ?", *boothID)
 	}
@@ -89,16 +120,113 @@ func mapSessionModelToDomain(model *SessionModel) *session.Session {
 		return nil
 	}
 	return &session.Session{
-		ID:            model.ID,
-		BoothID:       model.BoothID,
-		UserID:        model.UserID,
-		VoucherID:     model.VoucherID,
-		PaymentID:     model.PaymentID,
-		StartedAt:     model.StartedAt,
-		FinishedAt:    model.FinishedAt,
-		Status:        session.Status(model.Status),
-		TotalPrice:    model.TotalPrice,
-		BoothSnapshot: fromJSONMap(model.BoothSnapshot),
-		PhoneTemp:     model.PhoneTemp,
+		ID:              model.ID,
+		BoothID:         model.BoothID,
+		UserID:          model.UserID,
+		VoucherID:       model.VoucherID,
+		PaymentID:       model.PaymentID,
+		StartedAt:       model.StartedAt,
+		FinishedAt:      model.FinishedAt,
+		Status:          session.Status(model.Status),
+		BasePrice:       model.BasePrice,
+		TierPercent:     model.TierPercent,
+		TierDiscount:    model.TierDiscount,
+		VoucherDiscount: model.VoucherDiscount,
+		TotalPrice:      model.TotalPrice,
+		BoothSnapshot:   fromJSONMap(model.BoothSnapshot),
+		PhoneTemp:       model.PhoneTemp,
+		Vouchers:        fromAppliedVoucherRecords(model.Vouchers),
+		Discounts:       fromDiscountLineRecords(model.Discounts),
+		Charges:         fromChargeRecords(model.Charges),
+	}
+}
+
+func toAppliedVoucherRecords(vouchers []session.AppliedVoucher) datatypes.JSONSlice[AppliedVoucherRecord] {
+	records := make(datatypes.JSONSlice[AppliedVoucherRecord], 0, len(vouchers))
+	for _, v := range vouchers {
+		records = append(records, AppliedVoucherRecord{
+			RedemptionID: v.RedemptionID,
+			VoucherID:    v.VoucherID,
+			Code:         v.Code,
+			Kind:         string(v.Kind),
+			Value:        v.Value,
+			Stackable:    v.Stackable,
+		})
+	}
+	return records
+}
+
+func fromAppliedVoucherRecords(records datatypes.JSONSlice[AppliedVoucherRecord]) []session.AppliedVoucher {
+	vouchers := make([]session.AppliedVoucher, 0, len(records))
+	for _, r := range records {
+		vouchers = append(vouchers, session.AppliedVoucher{
+			RedemptionID: r.RedemptionID,
+			VoucherID:    r.VoucherID,
+			Code:         r.Code,
+			Kind:         session.DiscountKind(r.Kind),
+			Value:        r.Value,
+			Stackable:    r.Stackable,
+		})
+	}
+	return vouchers
+}
+
+func toDiscountLineRecords(lines []session.DiscountLine) datatypes.JSONSlice[DiscountLineRecord] {
+	records := make(datatypes.JSONSlice[DiscountLineRecord], 0, len(lines))
+	for _, l := range lines {
+		records = append(records, DiscountLineRecord{
+			Source:       string(l.Source),
+			Kind:         string(l.Kind),
+			Value:        l.Value,
+			Amount:       l.Amount,
+			RedemptionID: l.RedemptionID,
+			VoucherID:    l.VoucherID,
+			Code:         l.Code,
+		})
+	}
+	return records
+}
+
+func fromDiscountLineRecords(records datatypes.JSONSlice[DiscountLineRecord]) []session.DiscountLine {
+	lines := make([]session.DiscountLine, 0, len(records))
+	for _, r := range records {
+		lines = append(lines, session.DiscountLine{
+			Source:       session.DiscountSource(r.Source),
+			Kind:         session.DiscountKind(r.Kind),
+			Value:        r.Value,
+			Amount:       r.Amount,
+			RedemptionID: r.RedemptionID,
+			VoucherID:    r.VoucherID,
+			Code:         r.Code,
+		})
+	}
+	return lines
+}
+
+func toChargeRecords(charges []session.Charge) datatypes.JSONSlice[ChargeRecord] {
+	records := make(datatypes.JSONSlice[ChargeRecord], 0, len(charges))
+	for _, c := range charges {
+		records = append(records, ChargeRecord{
+			Kind:      string(c.Kind),
+			Reference: c.Reference,
+			Quantity:  c.Quantity,
+			UnitPrice: c.UnitPrice,
+			Amount:    c.Amount,
+		})
+	}
+	return records
+}
+
+func fromChargeRecords(records datatypes.JSONSlice[ChargeRecord]) []session.Charge {
+	charges := make([]session.Charge, 0, len(records))
+	for _, r := range records {
+		charges = append(charges, session.Charge{
+			Kind:      session.ChargeKind(r.Kind),
+			Reference: r.Reference,
+			Quantity:  r.Quantity,
+			UnitPrice: r.UnitPrice,
+			Amount:    r.Amount,
+		})
 	}
+	return charges
 }
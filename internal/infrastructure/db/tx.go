@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+// txState is what a context inside InTx carries: the transaction and the
+// work waiting for it to commit.
+type txState struct {
+	tx        *gorm.DB
+	committed []func()
+}
+
+// Transactor runs work that spans several repositories in one database
+// transaction.
+type Transactor struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// InTx calls fn with a context carrying a transaction, committed when fn
+// returns nil and rolled back otherwise. Repositories called with that
+// context take part in the transaction. Nested calls join the outer one.
+func (t *Transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+	state := &txState{}
+	err := t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state.tx = tx
+		return fn(context.WithValue(ctx, txKey{}, state))
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range state.committed {
+		f()
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the transaction ctx carries has committed, or
+// straight away when there is none. It never runs after a rollback.
+func (t *Transactor) AfterCommit(ctx context.Context, fn func()) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		fn()
+		return
+	}
+	state.committed = append(state.committed, fn)
+}
+
+// conn returns the transaction carried by ctx, or db when there is none.
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return db.WithContext(ctx)
+}
@@ -2,10 +2,12 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"go-ddd-clean/internal/domain/user"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userRepository struct {
@@ -24,8 +26,9 @@ func (r *userRepository) Create(ctx context.Context, u *user.User) error {
 		Password: u.Password,
 		Role:     string(u.Role),
 		Points:   u.Points,
+		Tier:     string(u.Tier),
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	u.CreatedAt = model.CreatedAt
@@ -34,24 +37,49 @@ func (r *userRepository) Create(ctx context.Context, u *user.User) error {
 }
 
 func (r *userRepository) Update(ctx context.Context, u *user.User) error {
-	return r.db.WithContext(ctx).
+	return conn(ctx, r.db).
 		Model(&UserModel{ID: u.ID}).
 		Updates(map[string]any{
-			"tel":      u.Tel,
-			"email":    u.Email,
-			"password": u.Password,
-			"role":     string(u.Role),
-			"points":   u.Points,
+			"tel":             u.Tel,
+			"email":           u.Email,
+			"password":        u.Password,
+			"role":            string(u.Role),
+			"points":          u.Points,
+			"tier":            string(u.Tier),
+			"tier_updated_at": u.TierUpdatedAt,
+		}).Error
+}
+
+func (r *userRepository) UpdatePoints(ctx context.Context, id string, points int) error {
+	return conn(ctx, r.db).
+		Model(&UserModel{ID: id}).
+		Update("points", points).Error
+}
+
+func (r *userRepository) UpdateTier(ctx context.Context, id string, tier user.Tier, at time.Time) error {
+	return conn(ctx, r.db).
+		Model(&UserModel{ID: id}).
+		Updates(map[string]any{
+			"tier":            string(tier),
+			"tier_updated_at": at,
 		}).Error
 }
 
 func (r *userRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&UserModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&UserModel{ID: id}).Error
 }
 
 func (r *userRepository) GetByID(ctx context.Context, id string) (*user.User, error) {
 	var model UserModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return mapUserModelToDomain(&model), nil
+}
+
+func (r *userRepository) GetForUpdate(ctx context.Context, id string) (*user.User, error) {
+	var model UserModel
+	if err := conn(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return mapUserModelToDomain(&model), nil
@@ -59,7 +87,7 @@ func (r *userRepository) GetByID(ctx context.Context, id string) (*user.User, er
 
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
 	var model UserModel
-	if err := r.db.WithContext(ctx).First(&model, "email = ?", email).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "email = ?", email).Error; err != nil {
 		return nil, err
 	}
 	return mapUserModelToDomain(&model), nil
@@ -67,7 +95,7 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*user.Us
 
 func (r *userRepository) List(ctx context.Context) ([]user.User, error) {
 	var models []UserModel
-	if err := r.db.WithContext(ctx).Find(&models).Error; err != nil {
+	if err := conn(ctx, r.db).Find(&models).Error; err != nil {
 		return nil, err
 	}
 	result := make([]user.User, 0, len(models))
@@ -77,18 +105,123 @@ func (r *userRepository) List(ctx context.Context) ([]user.User, error) {
 	return result, nil
 }
 
+func (r *userRepository) ListActivity(ctx context.Context, since time.Time) ([]user.Activity, error) {
+	var rows []struct {
+		UserID   string
+		Spend    float64
+		Sessions int
+	}
+	err := conn(ctx, r.db).
+		Table("session_models AS s").
+		Select("s.user_id, COALESCE(SUM(p.amount), 0) AS spend, COUNT(DISTINCT s.id) AS sessions").
+		Joins("LEFT JOIN payment_models AS p ON p.session_id = s.id AND p.status = ?", "success").
+		Where("s.user_id IS NOT NULL AND s.status = ? AND s.started_at >= ?", "success", since).
+		Group("s.user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make([]user.Activity, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, user.Activity{
+			UserID:   row.UserID,
+			Spend:    row.Spend,
+			Sessions: row.Sessions,
+		})
+	}
+	return result, nil
+}
+
 func mapUserModelToDomain(model *UserModel) *user.User {
 	if model == nil {
 		return nil
 	}
 	return &user.User{
-		ID:        model.ID,
-		Tel:       model.Tel,
-		Email:     model.Email,
-		Password:  model.Password,
-		Role:      user.Role(model.Role),
-		Points:    model.Points,
-		CreatedAt: model.CreatedAt,
-		UpdatedAt: model.UpdatedAt,
+		ID:            model.ID,
+		Tel:           model.Tel,
+		Email:         model.Email,
+		Password:      model.Password,
+		Role:          user.Role(model.Role),
+		Points:        model.Points,
+		Tier:          user.Tier(model.Tier),
+		TierUpdatedAt: model.TierUpdatedAt,
+		CreatedAt:     model.CreatedAt,
+		UpdatedAt:     model.UpdatedAt,
 	}
 }
+
+type pointsRepository struct {
+	db *gorm.DB
+}
+
+func NewPointsRepository(db *gorm.DB) user.PointsRepository {
+	return &pointsRepository{db: db}
+}
+
+func (r *pointsRepository) Create(ctx context.Context, e *user.PointsEntry) error {
+	model := PointsEntryModel{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		Type:      string(e.Type),
+		Points:    e.Points,
+		Remaining: e.Remaining,
+		ExpiresAt: e.ExpiresAt,
+		LotID:     e.LotID,
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
+		return err
+	}
+	e.CreatedAt = model.CreatedAt
+	return nil
+}
+
+func (r *pointsRepository) UpdateRemaining(ctx context.Context, id string, remaining int) error {
+	return conn(ctx, r.db).
+		Model(&PointsEntryModel{ID: id}).
+		Update("remaining", remaining).Error
+}
+
+func (r *pointsRepository) ListByUser(ctx context.Context, userID string) ([]user.PointsEntry, error) {
+	return r.find(conn(ctx, r.db).
+		Where("user_id = ?", userID).
+		Order("created_at desc"))
+}
+
+func (r *pointsRepository) ListOpenLots(ctx context.Context, userID string) ([]user.PointsEntry, error) {
+	return r.find(conn(ctx, r.db).
+		Where("user_id = ? AND type = ? AND remaining > 0", userID, string(user.PointsEntryEarn)).
+		Order("created_at asc"))
+}
+
+func (r *pointsRepository) ListExpiredLots(ctx context.Context, asOf time.Time) ([]user.PointsEntry, error) {
+	return r.find(conn(ctx, r.db).
+		Where("type = ? AND remaining > 0 AND expires_at <= ?", string(user.PointsEntryEarn), asOf).
+		Order("expires_at asc"))
+}
+
+func (r *pointsRepository) ListExpiringLots(ctx context.Context, from time.Time, to time.Time) ([]user.PointsEntry, error) {
+	return r.find(conn(ctx, r.db).
+		Where("type = ? AND remaining > 0 AND expires_at > ? AND expires_at <= ?", string(user.PointsEntryEarn), from, to).
+		Order("expires_at asc"))
+}
+
+func (r *pointsRepository) find(query *gorm.DB) ([]user.PointsEntry, error) {
+	var models []PointsEntryModel
+	if err := query.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]user.PointsEntry, 0, len(models))
+	for _, m := range models {
+		result = append(result, user.PointsEntry{
+			ID:        m.ID,
+			UserID:    m.UserID,
+			Type:      user.PointsEntryType(m.Type),
+			Points:    m.Points,
+			Remaining: m.Remaining,
+			ExpiresAt: m.ExpiresAt,
+			LotID:     m.LotID,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	return result, nil
+}
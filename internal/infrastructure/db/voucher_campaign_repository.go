@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go-ddd-clean/internal/domain/voucher"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// campaignInsertBatchSize keeps each INSERT well under Postgres' bind
+// parameter limit.
+const campaignInsertBatchSize = 500
+
+type voucherCampaignRepository struct {
+	db *gorm.DB
+}
+
+func NewVoucherCampaignRepository(db *gorm.DB) voucher.CampaignRepository {
+	return &voucherCampaignRepository{db: db}
+}
+
+func (r *voucherCampaignRepository) Create(ctx context.Context, c *voucher.Campaign, vouchers []voucher.Voucher) error {
+	model := VoucherCampaignModel{
+		ID:          c.ID,
+		Name:        c.Name,
+		CodePattern: c.CodePattern,
+		Quantity:    c.Quantity,
+		Type:        string(c.Type),
+		Value:       c.Value,
+		Unit:        string(c.Unit),
+		MaxUsage:    c.MaxUsage,
+		ValidFrom:   c.ValidFrom,
+		ValidTo:     c.ValidTo,
+		Active:      c.Active,
+
+		BranchIDs:      datatypes.NewJSONSlice(c.BranchIDs),
+		BoothIDs:       datatypes.NewJSONSlice(c.BoothIDs),
+		BoothType:      c.BoothType,
+		MinSpend:       c.MinSpend,
+		MaxPerCustomer: c.MaxPerCustomer,
+		Weekdays:       toWeekdayInts(c.Weekdays),
+		HourFrom:       c.HourFrom,
+		HourTo:         c.HourTo,
+		Stackable:      c.Stackable,
+	}
+	voucherModels := make([]VoucherModel, 0, len(vouchers))
+	for _, v := range vouchers {
+		voucherModels = append(voucherModels, VoucherModel{
+			ID:         v.ID,
+			CampaignID: v.CampaignID,
+			Code:       v.Code,
+			Type:       string(v.Type),
+			Value:      v.Value,
+			Unit:       string(v.Unit),
+			MaxUsage:   v.MaxUsage,
+			ValidFrom:  v.ValidFrom,
+			ValidTo:    v.ValidTo,
+			Active:     v.Active,
+
+			BranchIDs:      datatypes.NewJSONSlice(v.BranchIDs),
+			BoothIDs:       datatypes.NewJSONSlice(v.BoothIDs),
+			BoothType:      v.BoothType,
+			MinSpend:       v.MinSpend,
+			MaxPerCustomer: v.MaxPerCustomer,
+			Weekdays:       toWeekdayInts(v.Weekdays),
+			HourFrom:       v.HourFrom,
+			HourTo:         v.HourTo,
+			Stackable:      v.Stackable,
+		})
+	}
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model).Error; err != nil {
+			return err
+		}
+		if len(voucherModels) > 0 {
+			if err := tx.CreateInBatches(&voucherModels, campaignInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		c.CreatedAt = model.CreatedAt
+		return nil
+	})
+}
+
+func (r *voucherCampaignRepository) GetByID(ctx context.Context, id string) (*voucher.Campaign, error) {
+	var model VoucherCampaignModel
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return mapCampaignModelToDomain(&model), nil
+}
+
+func (r *voucherCampaignRepository) List(ctx context.Context) ([]voucher.Campaign, error) {
+	var models []VoucherCampaignModel
+	if err := conn(ctx, r.db).Order("created_at desc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]voucher.Campaign, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapCampaignModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *voucherCampaignRepository) ListVouchers(ctx context.Context, campaignID string) ([]voucher.Voucher, error) {
+	var models []VoucherModel
+	if err := conn(ctx, r.db).
+		Where("campaign_id = ?", campaignID).
+		Order("code asc").
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]voucher.Voucher, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapVoucherModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *voucherCampaignRepository) Stats(ctx context.Context, campaignID string, asOf time.Time) (*voucher.CampaignStats, error) {
+	var row struct {
+		Issued   int
+		Redeemed int
+		Expired  int
+	}
+	err := conn(ctx, r.db).
+		Model(&VoucherModel{}).
+		Select(
+			"COUNT(*) AS issued, "+
+				"COUNT(*) FILTER (WHERE used_count > 0) AS redeemed, "+
+				"COUNT(*) FILTER (WHERE used_count = 0 AND valid_to IS NOT NULL AND valid_to < ?) AS expired",
+			asOf,
+		).
+		Where("campaign_id = ?", campaignID).
+		Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+	return &voucher.CampaignStats{
+		CampaignID: campaignID,
+		Issued:     row.Issued,
+		Redeemed:   row.Redeemed,
+		Expired:    row.Expired,
+		Available:  row.Issued - row.Redeemed - row.Expired,
+	}, nil
+}
+
+func mapCampaignModelToDomain(model *VoucherCampaignModel) *voucher.Campaign {
+	if model == nil {
+		return nil
+	}
+	return &voucher.Campaign{
+		ID:          model.ID,
+		Name:        model.Name,
+		CodePattern: model.CodePattern,
+		Quantity:    model.Quantity,
+		Type:        voucher.Type(model.Type),
+		Value:       model.Value,
+		Unit:        voucher.Unit(model.Unit),
+		MaxUsage:    model.MaxUsage,
+		ValidFrom:   model.ValidFrom,
+		ValidTo:     model.ValidTo,
+		Active:      model.Active,
+		CreatedAt:   model.CreatedAt,
+		Restrictions: voucher.Restrictions{
+			BranchIDs:      model.BranchIDs,
+			BoothIDs:       model.BoothIDs,
+			BoothType:      model.BoothType,
+			MinSpend:       model.MinSpend,
+			MaxPerCustomer: model.MaxPerCustomer,
+			Weekdays:       fromWeekdayInts(model.Weekdays),
+			HourFrom:       model.HourFrom,
+			HourTo:         model.HourTo,
+			Stackable:      model.Stackable,
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"go-ddd-clean/internal/domain/voucher"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateInactiveCampaignStaysInactive(t *testing.T) {
+	database := connectTestDB(t)
+	ctx := context.Background()
+
+	campaign := &voucher.Campaign{
+		ID:          uuid.NewString(),
+		Name:        "paused",
+		CodePattern: "OFF-####",
+		Quantity:    2,
+		Type:        voucher.TypeDiscount,
+		Value:       10,
+		Unit:        voucher.UnitPercent,
+		MaxUsage:    1,
+		Active:      false,
+	}
+	vouchers := make([]voucher.Voucher, 0, campaign.Quantity)
+	for i := 0; i < campaign.Quantity; i++ {
+		vouchers = append(vouchers, voucher.Voucher{
+			ID:         uuid.NewString(),
+			CampaignID: &campaign.ID,
+			Code:       "OFF-" + uuid.NewString()[:8],
+			Type:       campaign.Type,
+			Value:      campaign.Value,
+			Unit:       campaign.Unit,
+			MaxUsage:   campaign.MaxUsage,
+			Active:     campaign.Active,
+		})
+	}
+	repo := NewVoucherCampaignRepository(database)
+	if err := repo.Create(ctx, campaign, vouchers); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := repo.GetByID(ctx, campaign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Active {
+		t.Fatal("expected the campaign to be stored inactive")
+	}
+	codes, err := repo.ListVouchers(ctx, campaign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != len(vouchers) {
+		t.Fatalf("expected %d vouchers, got %d", len(vouchers), len(codes))
+	}
+	for _, v := range codes {
+		if v.Active {
+			t.Fatalf("expected voucher %s to be stored inactive", v.Code)
+		}
+	}
+}
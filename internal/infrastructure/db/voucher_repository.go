@@ -2,10 +2,16 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"go-ddd-clean/internal/domain/voucher"
 
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type voucherRepository struct {
@@ -18,18 +24,31 @@ func NewVoucherRepository(db *gorm.DB) voucher.Repository {
 
 func (r *voucherRepository) Create(ctx context.Context, v *voucher.Voucher) error {
 	model := VoucherModel{
-		ID:        v.ID,
-		Code:      v.Code,
-		Type:      string(v.Type),
-		Value:     v.Value,
-		Unit:      string(v.Unit),
-		MaxUsage:  v.MaxUsage,
-		UsedCount: v.UsedCount,
-		ValidFrom: v.ValidFrom,
-		ValidTo:   v.ValidTo,
-		Active:    v.Active,
-	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+		ID:         v.ID,
+		CampaignID: v.CampaignID,
+		Code:       v.Code,
+		Type:       string(v.Type),
+		Value:      v.Value,
+		Unit:       string(v.Unit),
+		MaxUsage:   v.MaxUsage,
+		UsedCount:  v.UsedCount,
+		ValidFrom:  v.ValidFrom,
+		ValidTo:    v.ValidTo,
+		Active:     v.Active,
+
+		BranchIDs:      datatypes.NewJSONSlice(v.BranchIDs),
+		BoothIDs:       datatypes.NewJSONSlice(v.BoothIDs),
+		BoothType:      v.BoothType,
+		MinSpend:       v.MinSpend,
+		MaxPerCustomer: v.MaxPerCustomer,
+		Weekdays:       toWeekdayInts(v.Weekdays),
+		HourFrom:       v.HourFrom,
+		HourTo:         v.HourTo,
+		Stackable:      v.Stackable,
+		CustomerUserID: v.CustomerUserID,
+		CustomerTel:    v.CustomerTel,
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
 	v.CreatedAt = model.CreatedAt
@@ -37,7 +56,7 @@ func (r *voucherRepository) Create(ctx context.Context, v *voucher.Voucher) erro
 }
 
 func (r *voucherRepository) Update(ctx context.Context, v *voucher.Voucher) error {
-	return r.db.WithContext(ctx).
+	return conn(ctx, r.db).
 		Model(&VoucherModel{ID: v.ID}).
 		Updates(map[string]any{
 			"code":       v.Code,
@@ -45,20 +64,31 @@ func (r *voucherRepository) Update(ctx context.Context, v *voucher.Voucher) erro
 			"value":      v.Value,
 			"unit":       string(v.Unit),
 			"max_usage":  v.MaxUsage,
-			"used_count": v.UsedCount,
 			"valid_from": v.ValidFrom,
 			"valid_to":   v.ValidTo,
 			"active":     v.Active,
+
+			"branch_ids":       datatypes.NewJSONSlice(v.BranchIDs),
+			"booth_ids":        datatypes.NewJSONSlice(v.BoothIDs),
+			"booth_type":       v.BoothType,
+			"min_spend":        v.MinSpend,
+			"max_per_customer": v.MaxPerCustomer,
+			"weekdays":         toWeekdayInts(v.Weekdays),
+			"hour_from":        v.HourFrom,
+			"hour_to":          v.HourTo,
+			"stackable":        v.Stackable,
+			"customer_user_id": v.CustomerUserID,
+			"customer_tel":     v.CustomerTel,
 		}).Error
 }
 
 func (r *voucherRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Delete(&VoucherModel{ID: id}).Error
+	return conn(ctx, r.db).Delete(&VoucherModel{ID: id}).Error
 }
 
 func (r *voucherRepository) GetByID(ctx context.Context, id string) (*voucher.Voucher, error) {
 	var model VoucherModel
-	if err := r.db.WithContext(ctx).First(&model, "id = ?", id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return mapVoucherModelToDomain(&model), nil
@@ -66,14 +96,18 @@ func (r *voucherRepository) GetByID(ctx context.Context, id string) (*voucher.Vo
 
 func (r *voucherRepository) GetByCode(ctx context.Context, code string) (*voucher.Voucher, error) {
 	var model VoucherModel
-	if err := r.db.WithContext(ctx).First(&model, "code = ?", code).Error; err != nil {
+	if err := conn(ctx, r.db).First(&model, "code = ?", code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Keep the gorm error in the chain so handlers still answer 404.
+			return nil, fmt.Errorf("%w: %w", voucher.ErrNotFound, err)
+		}
 		return nil, err
 	}
 	return mapVoucherModelToDomain(&model), nil
 }
 
 func (r *voucherRepository) List(ctx context.Context, activeOnly bool) ([]voucher.Voucher, error) {
-	query := r.db.WithContext(ctx)
+	query := conn(ctx, r.db)
 	if activeOnly {
 		query = query.Where("active = ?", true)
 	}
@@ -88,6 +122,20 @@ func (r *voucherRepository) List(ctx context.Context, activeOnly bool) ([]vouche
 	return result, nil
 }
 
+func (r *voucherRepository) ExistingCodes(ctx context.Context, codes []string) ([]string, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	var existing []string
+	if err := conn(ctx, r.db).
+		Model(&VoucherModel{}).
+		Where("code IN ?", codes).
+		Pluck("code", &existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
 type voucherRedemptionRepository struct {
 	db *gorm.DB
 }
@@ -101,50 +149,263 @@ func (r *voucherRedemptionRepository) Create(ctx context.Context, red *voucher.R
 		ID:        red.ID,
 		VoucherID: red.VoucherID,
 		SessionID: red.SessionID,
+		UserID:    red.UserID,
 		Tel:       red.Tel,
 		Discount:  red.Discount,
+		Status:    string(redemptionStatusOrApplied(red.Status)),
 	}
-	if err := r.db.WithContext(ctx).Create(&model).Error; err != nil {
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
 		return err
 	}
+	red.Status = voucher.RedemptionStatus(model.Status)
 	red.CreatedAt = model.CreatedAt
 	return nil
 }
 
 func (r *voucherRedemptionRepository) ListByVoucher(ctx context.Context, voucherID string) ([]voucher.Redemption, error) {
 	var models []VoucherRedemptionModel
-	if err := r.db.WithContext(ctx).Where("voucher_id = ?", voucherID).Find(&models).Error; err != nil {
+	if err := conn(ctx, r.db).Where("voucher_id = ?", voucherID).Find(&models).Error; err != nil {
 		return nil, err
 	}
 	result := make([]voucher.Redemption, 0, len(models))
 	for _, m := range models {
-		result = append(result, voucher.Redemption{
-			ID:        m.ID,
-			VoucherID: m.VoucherID,
-			SessionID: m.SessionID,
-			Tel:       m.Tel,
-			Discount:  m.Discount,
-			CreatedAt: m.CreatedAt,
-		})
+		result = append(result, *mapRedemptionModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *voucherRedemptionRepository) Redeem(ctx context.Context, code string, red *voucher.Redemption, check func(v *voucher.Voucher, customerUses int) error) (*voucher.Voucher, error) {
+	var result *voucher.Voucher
+	err := conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var model VoucherModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&model, "code = ?", code).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %w", voucher.ErrNotFound, err)
+			}
+			return err
+		}
+		v := mapVoucherModelToDomain(&model)
+		uses, err := countCustomerRedemptions(tx, v.ID, red.UserID, red.Tel)
+		if err != nil {
+			return err
+		}
+		if err := check(v, uses); err != nil {
+			return err
+		}
+		red.VoucherID = v.ID
+		redModel := VoucherRedemptionModel{
+			ID:        red.ID,
+			VoucherID: red.VoucherID,
+			SessionID: red.SessionID,
+			UserID:    red.UserID,
+			Tel:       red.Tel,
+			Discount:  red.Discount,
+			Status:    string(voucher.RedemptionApplied),
+		}
+		if err := tx.Create(&redModel).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return voucher.ErrAlreadyRedeemed
+			}
+			return err
+		}
+		// The row lock already serialises redeemers; the guarded increment
+		// keeps the limit even if a caller skips the check.
+		update := tx.Model(&VoucherModel{}).
+			Where("id = ? AND (max_usage <= 0 OR used_count < max_usage)", v.ID).
+			UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return voucher.ErrUsageLimitReached
+		}
+		red.Status = voucher.RedemptionApplied
+		red.CreatedAt = redModel.CreatedAt
+		v.UsedCount++
+		result = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *voucherRedemptionRepository) VoidBySession(ctx context.Context, sessionID string, reason string) ([]voucher.Reversal, error) {
+	var reversals []voucher.Reversal
+	err := conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var models []VoucherRedemptionModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("session_id = ? AND status = ?", sessionID, string(voucher.RedemptionApplied)).
+			Find(&models).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, m := range models {
+			if err := tx.Model(&VoucherRedemptionModel{ID: m.ID}).Updates(map[string]any{
+				"status":      string(voucher.RedemptionVoided),
+				"voided_at":   now,
+				"void_reason": reason,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&VoucherModel{}).
+				Where("id = ? AND used_count > 0", m.VoucherID).
+				UpdateColumn("used_count", gorm.Expr("used_count - 1")).Error; err != nil {
+				return err
+			}
+			reversal := VoucherReversalModel{
+				ID:           uuid.NewString(),
+				RedemptionID: m.ID,
+				VoucherID:    m.VoucherID,
+				SessionID:    m.SessionID,
+				Discount:     m.Discount,
+				Reason:       reason,
+			}
+			if err := tx.Create(&reversal).Error; err != nil {
+				return err
+			}
+			reversals = append(reversals, mapReversalModelToDomain(&reversal))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversals, nil
+}
+
+func (r *voucherRedemptionRepository) ListReversalsByVoucher(ctx context.Context, voucherID string) ([]voucher.Reversal, error) {
+	var models []VoucherReversalModel
+	if err := conn(ctx, r.db).
+		Where("voucher_id = ?", voucherID).
+		Order("created_at desc").
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]voucher.Reversal, 0, len(models))
+	for _, m := range models {
+		result = append(result, mapReversalModelToDomain(&m))
 	}
 	return result, nil
 }
 
+func (r *voucherRedemptionRepository) CountCustomerRedemptions(ctx context.Context, voucherID string, userID *string, tel *string) (int, error) {
+	return countCustomerRedemptions(conn(ctx, r.db), voucherID, userID, tel)
+}
+
+// countCustomerRedemptions counts earlier redemptions of a voucher by the
+// same account or phone number. It runs inside the redeem transaction so the
+// voucher row lock also covers the per-customer cap.
+func countCustomerRedemptions(tx *gorm.DB, voucherID string, userID *string, tel *string) (int, error) {
+	if userID == nil && tel == nil {
+		return 0, nil
+	}
+	query := tx.Model(&VoucherRedemptionModel{}).
+		Where("voucher_id = ? AND status = ?", voucherID, string(voucher.RedemptionApplied))
+	switch {
+	case userID != nil && tel != nil:
+		query = query.Where("user_id = ? OR tel = ?", *userID, *tel)
+	case userID != nil:
+		query = query.Where("user_id = ?", *userID)
+	default:
+		query = query.Where("tel = ?", *tel)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+func toWeekdayInts(days []time.Weekday) datatypes.JSONSlice[int] {
+	if days == nil {
+		return nil
+	}
+	result := make([]int, 0, len(days))
+	for _, d := range days {
+		result = append(result, int(d))
+	}
+	return datatypes.NewJSONSlice(result)
+}
+
+func fromWeekdayInts(days datatypes.JSONSlice[int]) []time.Weekday {
+	if days == nil {
+		return nil
+	}
+	result := make([]time.Weekday, 0, len(days))
+	for _, d := range days {
+		result = append(result, time.Weekday(d))
+	}
+	return result
+}
+
+func redemptionStatusOrApplied(status voucher.RedemptionStatus) voucher.RedemptionStatus {
+	if status == "" {
+		return voucher.RedemptionApplied
+	}
+	return status
+}
+
+func mapRedemptionModelToDomain(model *VoucherRedemptionModel) *voucher.Redemption {
+	if model == nil {
+		return nil
+	}
+	return &voucher.Redemption{
+		ID:         model.ID,
+		VoucherID:  model.VoucherID,
+		SessionID:  model.SessionID,
+		UserID:     model.UserID,
+		Tel:        model.Tel,
+		Discount:   model.Discount,
+		Status:     voucher.RedemptionStatus(model.Status),
+		VoidedAt:   model.VoidedAt,
+		VoidReason: model.VoidReason,
+		CreatedAt:  model.CreatedAt,
+	}
+}
+
+func mapReversalModelToDomain(model *VoucherReversalModel) voucher.Reversal {
+	return voucher.Reversal{
+		ID:           model.ID,
+		RedemptionID: model.RedemptionID,
+		VoucherID:    model.VoucherID,
+		SessionID:    model.SessionID,
+		Discount:     model.Discount,
+		Reason:       model.Reason,
+		CreatedAt:    model.CreatedAt,
+	}
+}
+
 func mapVoucherModelToDomain(model *VoucherModel) *voucher.Voucher {
 	if model == nil {
 		return nil
 	}
 	return &voucher.Voucher{
-		ID:        model.ID,
-		Code:      model.Code,
-		Type:      voucher.Type(model.Type),
-		Value:     model.Value,
-		Unit:      voucher.Unit(model.Unit),
-		MaxUsage:  model.MaxUsage,
-		UsedCount: model.UsedCount,
-		ValidFrom: model.ValidFrom,
-		ValidTo:   model.ValidTo,
-		Active:    model.Active,
-		CreatedAt: model.CreatedAt,
+		ID:         model.ID,
+		Code:       model.Code,
+		Type:       voucher.Type(model.Type),
+		Value:      model.Value,
+		Unit:       voucher.Unit(model.Unit),
+		MaxUsage:   model.MaxUsage,
+		UsedCount:  model.UsedCount,
+		ValidFrom:  model.ValidFrom,
+		ValidTo:    model.ValidTo,
+		Active:     model.Active,
+		CampaignID: model.CampaignID,
+		CreatedAt:  model.CreatedAt,
+		Restrictions: voucher.Restrictions{
+			BranchIDs:      model.BranchIDs,
+			BoothIDs:       model.BoothIDs,
+			BoothType:      model.BoothType,
+			MinSpend:       model.MinSpend,
+			MaxPerCustomer: model.MaxPerCustomer,
+			Weekdays:       fromWeekdayInts(model.Weekdays),
+			HourFrom:       model.HourFrom,
+			HourTo:         model.HourTo,
+			Stackable:      model.Stackable,
+			CustomerUserID: model.CustomerUserID,
+			CustomerTel:    model.CustomerTel,
+		},
 	}
 }
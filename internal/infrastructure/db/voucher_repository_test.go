@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"go-ddd-clean/internal/domain/voucher"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// connectTestDB needs a disposable Postgres database; the row locking under
+// test cannot be reproduced with an in-memory fake.
+func connectTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+	return ConnectDB(dsn)
+}
+
+func seedTestSessions(t *testing.T, database *gorm.DB, count int) []string {
+	t.Helper()
+	branch := BranchModel{ID: uuid.NewString(), Name: "test-" + uuid.NewString()}
+	if err := database.Create(&branch).Error; err != nil {
+		t.Fatal(err)
+	}
+	booth := BoothModel{ID: uuid.NewString(), BranchID: branch.ID, Name: "test", Type: "physical"}
+	if err := database.Create(&booth).Error; err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		session := SessionModel{ID: uuid.NewString(), BoothID: booth.ID}
+		if err := database.Create(&session).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func TestRedeemConcurrentRespectsMaxUsage(t *testing.T) {
+	database := connectTestDB(t)
+	ctx := context.Background()
+
+	const (
+		maxUsage  = 3
+		redeemers = 20
+	)
+	code := "RACE-" + uuid.NewString()[:8]
+	if err := NewVoucherRepository(database).Create(ctx, &voucher.Voucher{
+		ID:       uuid.NewString(),
+		Code:     code,
+		Type:     voucher.TypeDiscount,
+		Value:    50,
+		Unit:     voucher.UnitBaht,
+		MaxUsage: maxUsage,
+		Active:   true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sessions := seedTestSessions(t, database, redeemers)
+	repo := NewVoucherRedemptionRepository(database)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for _, sessionID := range sessions {
+		wg.Add(1)
+		go func(sessionID string) {
+			defer wg.Done()
+			_, err := repo.Redeem(ctx, code, &voucher.Redemption{
+				ID:        uuid.NewString(),
+				SessionID: sessionID,
+			}, func(v *voucher.Voucher, _ int) error {
+				if v.MaxUsage > 0 && v.UsedCount >= v.MaxUsage {
+					return voucher.ErrUsageLimitReached
+				}
+				return nil
+			})
+			switch {
+			case err == nil:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			case !errors.Is(err, voucher.ErrUsageLimitReached):
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(sessionID)
+	}
+	wg.Wait()
+
+	if succeeded != maxUsage {
+		t.Fatalf("expected %d successful redemptions, got %d", maxUsage, succeeded)
+	}
+	v, err := NewVoucherRepository(database).GetByCode(ctx, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.UsedCount != maxUsage {
+		t.Fatalf("expected used_count %d, got %d", maxUsage, v.UsedCount)
+	}
+	redemptions, err := repo.ListByVoucher(ctx, v.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redemptions) != maxUsage {
+		t.Fatalf("expected %d redemption rows, got %d", maxUsage, len(redemptions))
+	}
+}
+
+func TestRedeemTwiceForSameSessionFails(t *testing.T) {
+	database := connectTestDB(t)
+	ctx := context.Background()
+
+	code := "ONCE-" + uuid.NewString()[:8]
+	if err := NewVoucherRepository(database).Create(ctx, &voucher.Voucher{
+		ID:       uuid.NewString(),
+		Code:     code,
+		Type:     voucher.TypeDiscount,
+		Value:    10,
+		Unit:     voucher.UnitPercent,
+		MaxUsage: 10,
+		Active:   true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sessionID := seedTestSessions(t, database, 1)[0]
+	repo := NewVoucherRedemptionRepository(database)
+	accept := func(*voucher.Voucher, int) error { return nil }
+
+	if _, err := repo.Redeem(ctx, code, &voucher.Redemption{ID: uuid.NewString(), SessionID: sessionID}, accept); err != nil {
+		t.Fatal(err)
+	}
+	_, err := repo.Redeem(ctx, code, &voucher.Redemption{ID: uuid.NewString(), SessionID: sessionID}, accept)
+	if !errors.Is(err, voucher.ErrAlreadyRedeemed) {
+		t.Fatalf("expected ErrAlreadyRedeemed, got %v", err)
+	}
+	v, err := NewVoucherRepository(database).GetByCode(ctx, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.UsedCount != 1 {
+		t.Fatalf("expected used_count 1, got %d", v.UsedCount)
+	}
+}
+
+func TestVoidBySessionGivesUseBack(t *testing.T) {
+	database := connectTestDB(t)
+	ctx := context.Background()
+
+	code := "VOID-" + uuid.NewString()[:8]
+	if err := NewVoucherRepository(database).Create(ctx, &voucher.Voucher{
+		ID:       uuid.NewString(),
+		Code:     code,
+		Type:     voucher.TypeFree,
+		Value:    1,
+		Unit:     voucher.UnitSession,
+		MaxUsage: 1,
+		Active:   true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sessionID := seedTestSessions(t, database, 1)[0]
+	repo := NewVoucherRedemptionRepository(database)
+	accept := func(*voucher.Voucher, int) error { return nil }
+
+	if _, err := repo.Redeem(ctx, code, &voucher.Redemption{ID: uuid.NewString(), SessionID: sessionID}, accept); err != nil {
+		t.Fatal(err)
+	}
+	reversals, err := repo.VoidBySession(ctx, sessionID, "session cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reversals) != 1 {
+		t.Fatalf("expected 1 reversal, got %d", len(reversals))
+	}
+	v, err := NewVoucherRepository(database).GetByCode(ctx, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.UsedCount != 0 {
+		t.Fatalf("expected used_count 0 after void, got %d", v.UsedCount)
+	}
+	if _, err := repo.Redeem(ctx, code, &voucher.Redemption{ID: uuid.NewString(), SessionID: sessionID}, accept); err != nil {
+		t.Fatalf("expected voided code to be redeemable again, got %v", err)
+	}
+}
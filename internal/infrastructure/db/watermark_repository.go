@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+
+	"go-ddd-clean/internal/domain/media"
+
+	"gorm.io/gorm"
+)
+
+type watermarkRepository struct {
+	db *gorm.DB
+}
+
+func NewWatermarkRepository(db *gorm.DB) media.WatermarkRepository {
+	return &watermarkRepository{db: db}
+}
+
+func (r *watermarkRepository) Create(ctx context.Context, w *media.Watermark) error {
+	model := WatermarkModel{
+		ID:       w.ID,
+		BranchID: w.BranchID,
+		BoothID:  w.BoothID,
+		ImageURL: w.ImageURL,
+		Text:     w.Text,
+		Position: string(w.Position),
+		Opacity:  w.Opacity,
+		Scale:    w.Scale,
+	}
+	if err := conn(ctx, r.db).Create(&model).Error; err != nil {
+		return err
+	}
+	w.CreatedAt = model.CreatedAt
+	return nil
+}
+
+func (r *watermarkRepository) Update(ctx context.Context, w *media.Watermark) error {
+	return conn(ctx, r.db).
+		Model(&WatermarkModel{ID: w.ID}).
+		Updates(map[string]any{
+			"image_url": w.ImageURL,
+			"text":      w.Text,
+			"position":  string(w.Position),
+			"opacity":   w.Opacity,
+			"scale":     w.Scale,
+		}).Error
+}
+
+func (r *watermarkRepository) Delete(ctx context.Context, id string) error {
+	return conn(ctx, r.db).Delete(&WatermarkModel{ID: id}).Error
+}
+
+func (r *watermarkRepository) GetByID(ctx context.Context, id string) (*media.Watermark, error) {
+	var model WatermarkModel
+	if err := conn(ctx, r.db).First(&model, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return mapWatermarkModelToDomain(&model), nil
+}
+
+func (r *watermarkRepository) List(ctx context.Context) ([]media.Watermark, error) {
+	var models []WatermarkModel
+	if err := conn(ctx, r.db).Order("created_at desc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]media.Watermark, 0, len(models))
+	for _, m := range models {
+		result = append(result, *mapWatermarkModelToDomain(&m))
+	}
+	return result, nil
+}
+
+func (r *watermarkRepository) FindFor(ctx context.Context, boothID string, branchID string) (*media.Watermark, error) {
+	var models []WatermarkModel
+	if err := conn(ctx, r.db).
+		Where("booth_id = ? OR branch_id = ?", boothID, branchID).
+		Order("booth_id IS NULL").
+		Limit(1).
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, nil
+	}
+	return mapWatermarkModelToDomain(&models[0]), nil
+}
+
+func mapWatermarkModelToDomain(model *WatermarkModel) *media.Watermark {
+	return &media.Watermark{
+		ID:        model.ID,
+		BranchID:  model.BranchID,
+		BoothID:   model.BoothID,
+		ImageURL:  model.ImageURL,
+		Text:      model.Text,
+		Position:  media.WatermarkPosition(model.Position),
+		Opacity:   model.Opacity,
+		Scale:     model.Scale,
+		CreatedAt: model.CreatedAt,
+	}
+}
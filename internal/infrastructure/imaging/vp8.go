@@ -0,0 +1,864 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+)
+
+// The lossy encoder follows RFC 6386 as simply as it can: every macroblock
+// is predicted as a whole (16x16 luma, 8x8 chroma) with the best of the DC,
+// vertical, horizontal and TrueMotion predictors, one quantizer covers the
+// frame, and coefficient probabilities are fitted to the frame in a first
+// pass and sent in the header.
+
+const (
+	// vp8QuantIndex is the quantizer EncodeWebP uses, from 0 (finest) to
+	// maxQuantIndex. 30 is close to libwebp's default quality of 75.
+	vp8QuantIndex = 30
+	maxQuantIndex = 127
+	// vp8FilterLevel is how strongly decoders smooth macroblock edges,
+	// from 0 to 63.
+	vp8FilterLevel = 20
+	// maxFirstPartition is the largest first partition the frame header
+	// can describe.
+	maxFirstPartition = 1<<19 - 1
+)
+
+// Predictors, numbered as the decoder numbers them.
+const (
+	predDC = iota
+	predTM
+	predVE
+	predHE
+)
+
+// Coefficient planes, as numbered in section 13.3.
+const (
+	planeYAfterY2 = iota
+	planeY2
+	planeUV
+	planeYWithoutY2 // unused: luma always goes through Y2 here
+	vp8Planes
+)
+
+const (
+	vp8Bands    = 8
+	vp8Contexts = 3
+	vp8Probs    = 11
+	// maxLevel is the largest quantized coefficient a token can carry.
+	maxLevel = 67 + 2047
+)
+
+var (
+	// coeffBands maps a coefficient's position to its probability band.
+	coeffBands = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+	// zigzag is the order coefficients are coded in.
+	zigzag = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	// catProbs code the extra bits of DCT_CAT3 to DCT_CAT6.
+	catProbs = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+	// The dequantization tables of section 14.1.
+	dcQuant = [128]int32{
+		4, 5, 6, 7, 8, 9, 10, 10, 11, 12, 13, 14, 15, 16, 17, 17,
+		18, 19, 20, 20, 21, 21, 22, 22, 23, 23, 24, 25, 25, 26, 27, 28,
+		29, 30, 31, 32, 33, 34, 35, 36, 37, 37, 38, 39, 40, 41, 42, 43,
+		44, 45, 46, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58,
+		59, 60, 61, 62, 63, 64, 65, 66, 67, 68, 69, 70, 71, 72, 73, 74,
+		75, 76, 76, 77, 78, 79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 89,
+		91, 93, 95, 96, 98, 100, 101, 102, 104, 106, 108, 110, 112, 114, 116, 118,
+		122, 124, 126, 128, 130, 132, 134, 136, 138, 140, 143, 145, 148, 151, 154, 157,
+	}
+	acQuant = [128]int32{
+		4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35,
+		36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
+		52, 53, 54, 55, 56, 57, 58, 60, 62, 64, 66, 68, 70, 72, 74, 76,
+		78, 80, 82, 84, 86, 88, 90, 92, 94, 96, 98, 100, 102, 104, 106, 108,
+		110, 112, 114, 116, 119, 122, 125, 128, 131, 134, 137, 140, 143, 146, 149, 152,
+		155, 158, 161, 164, 167, 170, 173, 177, 181, 185, 189, 193, 197, 201, 205, 209,
+		213, 217, 221, 225, 229, 234, 239, 245, 249, 254, 259, 264, 269, 274, 279, 284,
+	}
+)
+
+// quantizer holds the DC and AC step sizes of one kind of block.
+type quantizer [2]int32
+
+func (q quantizer) step(i int) int32 {
+	if i == 0 {
+		return q[0]
+	}
+	return q[1]
+}
+
+// quantize rounds c to a multiple of the step, returning the level.
+// Decoders keep dequantized coefficients in 16 bits, so levels stop short
+// of overflowing them.
+func (q quantizer) quantize(i int, c int32) int32 {
+	step := q.step(i)
+	level := (abs32(c) + step/2) / step
+	level = min(level, maxLevel, 32767/step)
+	if c < 0 {
+		return -level
+	}
+	return level
+}
+
+// yuvImage holds 4:2:0 planes padded to whole macroblocks.
+type yuvImage struct {
+	y, u, v          []uint8
+	yStride, cStride int
+}
+
+func newYUVImage(mbw, mbh int) *yuvImage {
+	return &yuvImage{
+		y:       make([]uint8, mbw*16*mbh*16),
+		u:       make([]uint8, mbw*8*mbh*8),
+		v:       make([]uint8, mbw*8*mbh*8),
+		yStride: mbw * 16,
+		cStride: mbw * 8,
+	}
+}
+
+// macroblock is one 16x16 area's predictors and quantized coefficients in
+// coding order: the Y2 block, 16 luma blocks, then 4 U and 4 V blocks.
+type macroblock struct {
+	yMode, uvMode int
+	skip          bool
+	levels        [25][16]int32
+}
+
+type vp8Encoder struct {
+	width, height int
+	mbw, mbh      int
+	src, rec      *yuvImage
+	quantIndex    int
+	y1, y2, uv    quantizer
+	mbs           []macroblock
+}
+
+// encodeVP8 returns img's colour as a VP8 key frame quantized at
+// quantIndex.
+func encodeVP8(img *image.NRGBA, quantIndex int) ([]byte, error) {
+	if quantIndex < 0 || quantIndex > maxQuantIndex {
+		return nil, errors.New("webp: quantizer out of range")
+	}
+	e := newVP8Encoder(img, quantIndex)
+	for mby := 0; mby < e.mbh; mby++ {
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby, &e.mbs[mby*e.mbw+mbx])
+		}
+	}
+	probs, skipProb := e.fitProbs()
+	first := e.writeHeader(probs, skipProb)
+	if len(first) > maxFirstPartition {
+		return nil, errors.New("webp: image too large for one VP8 partition")
+	}
+	tokens := newBoolEncoder()
+	e.writeTokens(&coeffWriter{enc: tokens, probs: &probs})
+	second := tokens.flush()
+
+	frame := make([]byte, 0, 10+len(first)+len(second))
+	tag := uint32(len(first))<<5 | 1<<4
+	frame = append(frame, byte(tag), byte(tag>>8), byte(tag>>16))
+	frame = append(frame, 0x9d, 0x01, 0x2a)
+	frame = append(frame, byte(e.width), byte(e.width>>8), byte(e.height), byte(e.height>>8))
+	frame = append(frame, first...)
+	return append(frame, second...), nil
+}
+
+func newVP8Encoder(img *image.NRGBA, q int) *vp8Encoder {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	e := &vp8Encoder{
+		width:      width,
+		height:     height,
+		mbw:        (width + 15) / 16,
+		mbh:        (height + 15) / 16,
+		quantIndex: q,
+		y1:         quantizer{dcQuant[q], acQuant[q]},
+		y2:         quantizer{dcQuant[q] * 2, max(acQuant[q]*155/100, 8)},
+		uv:         quantizer{dcQuant[min(q, 117)], acQuant[q]},
+	}
+	e.src = newYUVImage(e.mbw, e.mbh)
+	e.rec = newYUVImage(e.mbw, e.mbh)
+	e.mbs = make([]macroblock, e.mbw*e.mbh)
+
+	// Pixels past the right and bottom edges repeat the last ones, which
+	// keeps the padding cheap to code.
+	pixel := func(x, y int) (int32, int32, int32) {
+		x, y = min(x, width-1), min(y, height-1)
+		p := img.Pix[y*img.Stride+x*4:]
+		return int32(p[0]), int32(p[1]), int32(p[2])
+	}
+	for y := 0; y < e.mbh*16; y++ {
+		for x := 0; x < e.mbw*16; x++ {
+			r, g, b := pixel(x, y)
+			e.src.y[y*e.src.yStride+x] = uint8((16839*r + 33059*g + 6420*b + 16<<16 + 1<<15) >> 16)
+		}
+	}
+	for y := 0; y < e.mbh*8; y++ {
+		for x := 0; x < e.mbw*8; x++ {
+			var r, g, b int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := pixel(2*x+d[0], 2*y+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			// r, g and b are sums of four pixels, hence the extra shift.
+			e.src.u[y*e.src.cStride+x] = clip8((-9719*r - 19081*g + 28800*b + 128<<18 + 1<<17) >> 18)
+			e.src.v[y*e.src.cStride+x] = clip8((28800*r - 24116*g - 4684*b + 128<<18 + 1<<17) >> 18)
+		}
+	}
+	return e
+}
+
+// encodeMacroblock picks the macroblock's predictors, quantizes its
+// residuals and reconstructs it exactly as a decoder will, so the
+// macroblocks after it predict from the same pixels.
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int, mb *macroblock) {
+	var pred [256]uint8
+	mb.yMode = bestPredictor(pred[:], e.src.y, e.rec.y, e.src.yStride, mbx*16, mby*16, 16)
+	var dc [16]int32
+	var coeffs [16][16]int32
+	for b := range 16 {
+		coeffs[b] = forwardDCT(e.src.y, pred[:], e.src.yStride, 16, mbx*16+b%4*4, mby*16+b/4*4, b%4*4, b/4*4)
+		dc[b] = coeffs[b][0]
+	}
+	y2 := forwardWHT(dc)
+	var y2Dequant [16]int32
+	for i := range 16 {
+		level := e.y2.quantize(i, y2[i])
+		mb.levels[0][inverseZigzag[i]] = level
+		y2Dequant[i] = level * e.y2.step(i)
+	}
+	dc = inverseWHT(y2Dequant)
+	for b := range 16 {
+		block := [16]int32{0: dc[b]}
+		for i := 1; i < 16; i++ {
+			level := e.y1.quantize(i, coeffs[b][i])
+			mb.levels[1+b][inverseZigzag[i]] = level
+			block[i] = level * e.y1.step(i)
+		}
+		reconstruct(e.rec.y, pred[:], e.rec.yStride, 16, mbx*16+b%4*4, mby*16+b/4*4, b%4*4, b/4*4, block)
+	}
+
+	var predU, predV [64]uint8
+	mb.uvMode = bestChromaPredictor(predU[:], predV[:], e.src, e.rec, mbx*8, mby*8)
+	for i, plane := range []struct {
+		src, rec, pred []uint8
+	}{{e.src.u, e.rec.u, predU[:]}, {e.src.v, e.rec.v, predV[:]}} {
+		for b := range 4 {
+			x, y := mbx*8+b%2*4, mby*8+b/2*4
+			c := forwardDCT(plane.src, plane.pred, e.src.cStride, 8, x, y, b%2*4, b/2*4)
+			var block [16]int32
+			for k := range 16 {
+				level := e.uv.quantize(k, c[k])
+				mb.levels[17+i*4+b][inverseZigzag[k]] = level
+				block[k] = level * e.uv.step(k)
+			}
+			reconstruct(plane.rec, plane.pred, e.rec.cStride, 8, x, y, b%2*4, b/2*4, block)
+		}
+	}
+
+	mb.skip = true
+	for _, block := range mb.levels {
+		for _, level := range block {
+			if level != 0 {
+				mb.skip = false
+			}
+		}
+	}
+}
+
+// inverseZigzag gives each coefficient's place in coding order.
+var inverseZigzag = func() (inv [16]uint8) {
+	for i, z := range zigzag {
+		inv[z] = uint8(i)
+	}
+	return inv
+}()
+
+// bestPredictor fills pred with whichever predictor of the n×n block at
+// x, y is closest to src, and returns it.
+func bestPredictor(pred, src, rec []uint8, stride, x, y, n int) int {
+	best, bestCost := 0, -1
+	candidate := make([]uint8, n*n)
+	for _, mode := range []int{predDC, predTM, predVE, predHE} {
+		predictBlock(candidate, rec, stride, x, y, n, mode)
+		cost := 0
+		for j := range n {
+			for i := range n {
+				d := int(src[(y+j)*stride+x+i]) - int(candidate[j*n+i])
+				cost += d * d
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = mode, cost
+			copy(pred, candidate)
+		}
+	}
+	return best
+}
+
+// bestChromaPredictor picks one predictor for both chroma planes.
+func bestChromaPredictor(predU, predV []uint8, src, rec *yuvImage, x, y int) int {
+	best, bestCost := 0, -1
+	var u, v [64]uint8
+	for _, mode := range []int{predDC, predTM, predVE, predHE} {
+		predictBlock(u[:], rec.u, rec.cStride, x, y, 8, mode)
+		predictBlock(v[:], rec.v, rec.cStride, x, y, 8, mode)
+		cost := 0
+		for j := range 8 {
+			for i := range 8 {
+				du := int(src.u[(y+j)*src.cStride+x+i]) - int(u[j*8+i])
+				dv := int(src.v[(y+j)*src.cStride+x+i]) - int(v[j*8+i])
+				cost += du*du + dv*dv
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = mode, cost
+			copy(predU, u[:])
+			copy(predV, v[:])
+		}
+	}
+	return best
+}
+
+// predictBlock fills pred with the n×n block at x, y predicted from its
+// reconstructed neighbours. Decoders treat the row above the image as 127
+// and the column left of it as 129, and so does this.
+func predictBlock(pred, rec []uint8, stride, x, y, n int, mode int) {
+	var above, left [16]int32
+	for i := range n {
+		above[i], left[i] = 127, 129
+		if y > 0 {
+			above[i] = int32(rec[(y-1)*stride+x+i])
+		}
+		if x > 0 {
+			left[i] = int32(rec[(y+i)*stride+x-1])
+		}
+	}
+	var corner int32
+	switch {
+	case y == 0:
+		corner = 127
+	case x == 0:
+		corner = 129
+	default:
+		corner = int32(rec[(y-1)*stride+x-1])
+	}
+	shift := 3
+	if n == 16 {
+		shift = 4
+	}
+	var dc int32
+	if mode == predDC {
+		// Edges fall back to whichever neighbours exist, or to 128.
+		switch {
+		case x == 0 && y == 0:
+			dc = 128
+		case y == 0:
+			dc = (sum32(left[:n]) + int32(n/2)) >> shift
+		case x == 0:
+			dc = (sum32(above[:n]) + int32(n/2)) >> shift
+		default:
+			dc = (sum32(above[:n]) + sum32(left[:n]) + int32(n)) >> (shift + 1)
+		}
+	}
+	for j := range n {
+		for i := range n {
+			var p int32
+			switch mode {
+			case predDC:
+				p = dc
+			case predTM:
+				p = left[j] + above[i] - corner
+			case predVE:
+				p = above[i]
+			case predHE:
+				p = left[j]
+			}
+			pred[j*n+i] = clip8(p)
+		}
+	}
+}
+
+// forwardDCT transforms the residual of the 4x4 block at x, y of src,
+// whose prediction is at px, py of the predStride-wide pred. It is
+// libvpx's integer DCT.
+func forwardDCT(src, pred []uint8, stride, predStride, x, y, px, py int) [16]int32 {
+	var in, tmp, out [16]int32
+	for j := range 4 {
+		for i := range 4 {
+			in[j*4+i] = int32(src[(y+j)*stride+x+i]) - int32(pred[(py+j)*predStride+px+i])
+		}
+	}
+	for j := range 4 {
+		r := in[j*4:]
+		a := (r[0] + r[3]) * 8
+		b := (r[1] + r[2]) * 8
+		c := (r[1] - r[2]) * 8
+		d := (r[0] - r[3]) * 8
+		tmp[j*4+0] = a + b
+		tmp[j*4+2] = a - b
+		tmp[j*4+1] = (c*2217 + d*5352 + 14500) >> 12
+		tmp[j*4+3] = (d*2217 - c*5352 + 7500) >> 12
+	}
+	for i := range 4 {
+		a := tmp[i] + tmp[12+i]
+		b := tmp[4+i] + tmp[8+i]
+		c := tmp[4+i] - tmp[8+i]
+		d := tmp[i] - tmp[12+i]
+		out[i] = (a + b + 7) >> 4
+		out[8+i] = (a - b + 7) >> 4
+		out[4+i] = (c*2217+d*5352+12000)>>16 + boolInt32(d != 0)
+		out[12+i] = (d*2217 - c*5352 + 51000) >> 16
+	}
+	return out
+}
+
+// forwardWHT transforms the 16 luma DC coefficients into the Y2 block. It
+// is libvpx's integer Walsh-Hadamard transform.
+func forwardWHT(in [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for j := range 4 {
+		r := in[j*4:]
+		a := (r[0] + r[2]) * 4
+		d := (r[1] + r[3]) * 4
+		c := (r[1] - r[3]) * 4
+		b := (r[0] - r[2]) * 4
+		tmp[j*4+0] = a + d + boolInt32(a != 0)
+		tmp[j*4+1] = b + c
+		tmp[j*4+2] = b - c
+		tmp[j*4+3] = a - d
+	}
+	for i := range 4 {
+		a := tmp[i] + tmp[8+i]
+		d := tmp[4+i] + tmp[12+i]
+		c := tmp[4+i] - tmp[12+i]
+		b := tmp[i] - tmp[8+i]
+		for k, v := range [4]int32{a + d, b + c, b - c, a - d} {
+			if v < 0 {
+				v++
+			}
+			out[k*4+i] = (v + 3) >> 3
+		}
+	}
+	return out
+}
+
+// inverseWHT is the decoder's inverse of forwardWHT, section 14.3.
+func inverseWHT(in [16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := range 4 {
+		a0 := in[i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[i] - in[12+i]
+		m[i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := range 4 {
+		dc := m[i*4] + 3
+		a0 := dc + m[i*4+3]
+		a1 := m[i*4+1] + m[i*4+2]
+		a2 := m[i*4+1] - m[i*4+2]
+		a3 := dc - m[i*4+3]
+		out[i*4+0] = int32(int16((a0 + a1) >> 3))
+		out[i*4+1] = int32(int16((a3 + a2) >> 3))
+		out[i*4+2] = int32(int16((a0 - a1) >> 3))
+		out[i*4+3] = int32(int16((a3 - a2) >> 3))
+	}
+	return out
+}
+
+// reconstruct adds the inverse DCT of coeffs, section 14.4, to the
+// prediction and stores the result in the 4x4 block at x, y of rec.
+func reconstruct(rec, pred []uint8, stride, predStride, x, y, px, py int, coeffs [16]int32) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2).
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2).
+	)
+	var m [4][4]int32
+	for i := range 4 {
+		in := func(k int) int32 { return int32(int16(coeffs[k+i])) }
+		a := in(0) + in(8)
+		b := in(0) - in(8)
+		c := (in(4)*c2)>>16 - (in(12)*c1)>>16
+		d := (in(4)*c1)>>16 + (in(12)*c2)>>16
+		m[i][0] = a + d
+		m[i][1] = b + c
+		m[i][2] = b - c
+		m[i][3] = a - d
+	}
+	for j := range 4 {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		p := pred[(py+j)*predStride+px:]
+		r := rec[(y+j)*stride+x:]
+		r[0] = clip8(int32(p[0]) + (a+d)>>3)
+		r[1] = clip8(int32(p[1]) + (b+c)>>3)
+		r[2] = clip8(int32(p[2]) + (b-c)>>3)
+		r[3] = clip8(int32(p[3]) + (a-d)>>3)
+	}
+}
+
+type coeffProbs [vp8Planes][vp8Bands][vp8Contexts][vp8Probs]uint8
+
+// fitProbs returns the coefficient probabilities that code this frame's
+// tokens best, and the probability that a macroblock is not skipped.
+func (e *vp8Encoder) fitProbs() (coeffProbs, uint8) {
+	var counts [vp8Planes][vp8Bands][vp8Contexts][vp8Probs][2]int
+	e.writeTokens(&coeffWriter{counts: &counts})
+	var probs coeffProbs
+	for i := range probs {
+		for j := range probs[i] {
+			for k := range probs[i][j] {
+				for l := range probs[i][j][k] {
+					probs[i][j][k][l] = fitProb(counts[i][j][k][l])
+				}
+			}
+		}
+	}
+	var skips [2]int
+	for _, mb := range e.mbs {
+		skips[boolInt(mb.skip)]++
+	}
+	return probs, fitProb(skips)
+}
+
+// fitProb returns the probability of a zero given counts of zeros and
+// ones, or 0 when neither was seen.
+func fitProb(counts [2]int) uint8 {
+	total := counts[0] + counts[1]
+	if total == 0 {
+		return 0
+	}
+	return uint8(min(max((counts[0]*256+total/2)/total, 1), 255))
+}
+
+// writeHeader returns the first partition: the frame header, then each
+// macroblock's predictors.
+func (e *vp8Encoder) writeHeader(probs coeffProbs, skipProb uint8) []byte {
+	h := newBoolEncoder()
+	h.putBit(false) // colour space
+	h.putBit(false) // clamping required
+	h.putBit(false) // no segmentation
+	h.putBit(false) // normal loop filter
+	h.putLiteral(vp8FilterLevel, 6)
+	h.putLiteral(0, 3) // sharpness
+	h.putBit(false)    // no loop filter deltas
+	h.putLiteral(0, 2) // one token partition
+	h.putLiteral(uint32(e.quantIndex), 7)
+	for range 5 {
+		h.putBit(false) // no quantizer deltas
+	}
+	h.putBit(false) // refresh entropy probabilities
+	for i := range probs {
+		for j := range probs[i] {
+			for k := range probs[i][j] {
+				for l, p := range probs[i][j][k] {
+					h.put(p != 0, coeffUpdateProbs[i][j][k][l])
+					if p != 0 {
+						h.putLiteral(uint32(p), 8)
+					}
+				}
+			}
+		}
+	}
+	h.putBit(true) // macroblocks may be skipped
+	skipProb = max(skipProb, 1)
+	h.putLiteral(uint32(skipProb), 8)
+	for _, mb := range e.mbs {
+		h.put(mb.skip, skipProb)
+		h.put(true, 145) // whole-macroblock luma prediction
+		switch mb.yMode {
+		case predDC:
+			h.put(false, 156)
+			h.put(false, 163)
+		case predVE:
+			h.put(false, 156)
+			h.put(true, 163)
+		case predHE:
+			h.put(true, 156)
+			h.put(false, 128)
+		case predTM:
+			h.put(true, 156)
+			h.put(true, 128)
+		}
+		switch mb.uvMode {
+		case predDC:
+			h.put(false, 142)
+		case predVE:
+			h.put(true, 142)
+			h.put(false, 114)
+		case predHE:
+			h.put(true, 142)
+			h.put(true, 114)
+			h.put(false, 183)
+		case predTM:
+			h.put(true, 142)
+			h.put(true, 114)
+			h.put(true, 183)
+		}
+	}
+	return h.flush()
+}
+
+// nonZero tracks which neighbouring blocks had coefficients, the context
+// for coding a block's first token.
+type nonZero struct {
+	y2   uint8
+	y    [4]uint8
+	u, v [2]uint8
+}
+
+// writeTokens codes every macroblock's coefficients in order.
+func (e *vp8Encoder) writeTokens(w *coeffWriter) {
+	above := make([]nonZero, e.mbw)
+	for mby := 0; mby < e.mbh; mby++ {
+		var left nonZero
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb := &e.mbs[mby*e.mbw+mbx]
+			up := &above[mbx]
+			if mb.skip {
+				*up, left = nonZero{}, nonZero{}
+				continue
+			}
+			nz := w.block(planeY2, left.y2+up.y2, 0, &mb.levels[0])
+			left.y2, up.y2 = nz, nz
+			for b := range 16 {
+				x, y := b%4, b/4
+				nz := w.block(planeYAfterY2, left.y[y]+up.y[x], 1, &mb.levels[1+b])
+				left.y[y], up.y[x] = nz, nz
+			}
+			for b := range 4 {
+				x, y := b%2, b/2
+				nz := w.block(planeUV, left.u[y]+up.u[x], 0, &mb.levels[17+b])
+				left.u[y], up.u[x] = nz, nz
+			}
+			for b := range 4 {
+				x, y := b%2, b/2
+				nz := w.block(planeUV, left.v[y]+up.v[x], 0, &mb.levels[21+b])
+				left.v[y], up.v[x] = nz, nz
+			}
+		}
+	}
+}
+
+// coeffWriter codes coefficient tokens, or only counts the branches they
+// take when counts is set.
+type coeffWriter struct {
+	enc    *boolEncoder
+	probs  *coeffProbs
+	counts *[vp8Planes][vp8Bands][vp8Contexts][vp8Probs][2]int
+}
+
+// block codes the levels of one block from position first, section 13,
+// and returns 1 if any were non-zero.
+func (w *coeffWriter) block(plane int, ctx uint8, first int, levels *[16]int32) uint8 {
+	last := -1
+	for i := 15; i >= first; i-- {
+		if levels[i] != 0 {
+			last = i
+			break
+		}
+	}
+	band, c := int(coeffBands[first]), int(ctx)
+	if last < 0 {
+		w.branch(plane, band, c, 0, false)
+		return 0
+	}
+	w.branch(plane, band, c, 0, true)
+	for i := first; i < 16; {
+		v := abs32(levels[i])
+		i++
+		if v == 0 {
+			w.branch(plane, band, c, 1, false)
+			band, c = int(coeffBands[i]), 0
+			continue
+		}
+		w.branch(plane, band, c, 1, true)
+		w.token(plane, band, c, v)
+		w.fixed(levels[i-1] < 0, 128)
+		band, c = int(coeffBands[i]), 2
+		if v == 1 {
+			c = 1
+		}
+		if i == 16 {
+			break
+		}
+		w.branch(plane, band, c, 0, i <= last)
+		if i > last {
+			break
+		}
+	}
+	return 1
+}
+
+// token codes a non-zero level's size, section 13.2.
+func (w *coeffWriter) token(plane, band, c int, v int32) {
+	if v == 1 {
+		w.branch(plane, band, c, 2, false)
+		return
+	}
+	w.branch(plane, band, c, 2, true)
+	if v <= 4 {
+		w.branch(plane, band, c, 3, false)
+		w.branch(plane, band, c, 4, v != 2)
+		if v != 2 {
+			w.branch(plane, band, c, 5, v == 4)
+		}
+		return
+	}
+	w.branch(plane, band, c, 3, true)
+	if v <= 10 {
+		w.branch(plane, band, c, 6, false)
+		w.branch(plane, band, c, 7, v > 6)
+		if v <= 6 {
+			w.fixed(v == 6, 159)
+		} else {
+			w.fixed((v-7)&2 != 0, 165)
+			w.fixed((v-7)&1 != 0, 145)
+		}
+		return
+	}
+	w.branch(plane, band, c, 6, true)
+	cat := 0
+	for cat < 3 && v >= 3+(8<<(cat+1)) {
+		cat++
+	}
+	w.branch(plane, band, c, 8, cat >= 2)
+	w.branch(plane, band, c, 9+cat/2, cat%2 == 1)
+	extra := v - (3 + 8<<cat)
+	probs := catProbs[cat]
+	for k, p := range probs {
+		w.fixed(extra>>(len(probs)-1-k)&1 != 0, p)
+	}
+}
+
+func (w *coeffWriter) branch(plane, band, ctx, node int, bit bool) {
+	if w.counts != nil {
+		w.counts[plane][band][ctx][node][boolInt(bit)]++
+		return
+	}
+	w.enc.put(bit, w.probs[plane][band][ctx][node])
+}
+
+func (w *coeffWriter) fixed(bit bool, prob uint8) {
+	if w.counts == nil {
+		w.enc.put(bit, prob)
+	}
+}
+
+// boolEncoder is the arithmetic coder of section 7.
+type boolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCount: 24}
+}
+
+// put codes bit, which is false with probability prob/256.
+func (e *boolEncoder) put(bit bool, prob uint8) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+func (e *boolEncoder) putBit(bit bool) {
+	e.put(bit, 128)
+}
+
+// putLiteral codes the n low bits of v, most significant first.
+func (e *boolEncoder) putLiteral(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.putBit(v>>i&1 != 0)
+	}
+}
+
+// carry adds one to the bytes already written.
+func (e *boolEncoder) carry() {
+	for i := len(e.buf) - 1; i >= 0; i-- {
+		e.buf[i]++
+		if e.buf[i] != 0 {
+			return
+		}
+	}
+}
+
+// flush writes out the bits still held and returns the coded bytes.
+func (e *boolEncoder) flush() []byte {
+	c := e.bitCount
+	v := e.bottom
+	if v&(1<<(32-c)) != 0 {
+		e.carry()
+	}
+	v <<= c & 7
+	for c >>= 3; c > 0; c-- {
+		v <<= 8
+	}
+	for range 4 {
+		e.buf = append(e.buf, byte(v>>24))
+		v <<= 8
+	}
+	return e.buf
+}
+
+func clip8(v int32) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sum32(values []int32) int32 {
+	var sum int32
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func boolInt32(b bool) int32 {
+	return int32(boolInt(b))
+}
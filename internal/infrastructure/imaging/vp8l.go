@@ -0,0 +1,437 @@
+package imaging
+
+import (
+	"container/heap"
+	"image"
+)
+
+// predictorBits sets the predictor block size to 32x32 pixels.
+const predictorBits = 5
+
+// predictorModes are the VP8L predictors tried for each block: left, top,
+// average of left and top, select, and clamped gradient.
+var predictorModes = []uint32{1, 2, 7, 11, 12}
+
+// codeLengthOrder is the order code-length code lengths are written in.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lHeaderSize is the length of the signature and header that start a
+// VP8L bitstream. ALPH chunks carry the bitstream without them.
+const vp8lHeaderSize = 5
+
+// encodeVP8L returns img as a lossless VP8L bitstream. It uses the subtract
+// green and predictor transforms with one set of prefix codes; there is no
+// colour cache or backward referencing, so output is larger than libwebp's
+// but decodes anywhere WebP does.
+func encodeVP8L(img *image.NRGBA) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	pix := make([]uint32, width*height)
+	alphaUsed := false
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x := 0; x < width; x++ {
+			p := row[x*4 : x*4+4]
+			pix[y*width+x] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+			alphaUsed = alphaUsed || p[3] != 0xff
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(boolBit(alphaUsed), 1)
+	bw.write(0, 3)
+
+	// Subtract green transform.
+	bw.write(1, 1)
+	bw.write(2, 2)
+	for i, p := range pix {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		bl := (p - g) & 0xff
+		pix[i] = p&0xff00ff00 | r<<16 | bl
+	}
+
+	// Predictor transform.
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(predictorBits-2, 3)
+	modes, residuals := predict(pix, width, height)
+	writeEntropyImage(bw, modes, false)
+
+	bw.write(0, 1)
+	writeEntropyImage(bw, residuals, true)
+	return bw.bytes()
+}
+
+// predict picks the predictor with the smallest residuals for each block
+// and returns the predictor image and the residual image.
+func predict(pix []uint32, width, height int) ([]uint32, []uint32) {
+	size := 1 << predictorBits
+	tilesX := (width + size - 1) / size
+	tilesY := (height + size - 1) / size
+	modes := make([]uint32, tilesX*tilesY)
+	residuals := make([]uint32, len(pix))
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx*size, ty*size
+			x1, y1 := min(x0+size, width), min(y0+size, height)
+			best, bestCost := predictorModes[0], -1
+			for _, mode := range predictorModes {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						cost += residualCost(subPixels(pix[y*width+x], predictPixel(pix, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | best<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					residuals[y*width+x] = subPixels(pix[y*width+x], predictPixel(pix, width, x, y, best))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+func predictPixel(pix []uint32, width, x, y int, mode uint32) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pix[x-1]
+	case x == 0:
+		return pix[(y-1)*width]
+	}
+	l, t, tl := pix[y*width+x-1], pix[(y-1)*width+x], pix[(y-1)*width+x-1]
+	switch mode {
+	case 1:
+		return l
+	case 2:
+		return t
+	case 7:
+		return average2(l, t)
+	case 11:
+		return selectPredictor(l, t, tl)
+	case 12:
+		return clampAddSubtract(l, t, tl)
+	}
+	return 0xff000000
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func selectPredictor(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		cl, ct, ctl := int(l>>shift&0xff), int(t>>shift&0xff), int(tl>>shift&0xff)
+		p := cl + ct - ctl
+		pl += abs(p - cl)
+		pt += abs(p - ct)
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+func clampAddSubtract(a, b, c uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		out |= uint32(max(0, min(255, v))) << shift
+	}
+	return out
+}
+
+func subPixels(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		out |= ((a>>shift - b>>shift) & 0xff) << shift
+	}
+	return out
+}
+
+// residualCost approximates how expensive a residual is to code: small
+// differences in either direction are cheap.
+func residualCost(p uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(p >> shift & 0xff)
+		cost += min(v, 256-v)
+	}
+	return cost
+}
+
+// writeEntropyImage writes pixels with one set of prefix codes and no
+// colour cache. Only the main image carries the meta prefix code bit.
+func writeEntropyImage(bw *bitWriter, pix []uint32, main bool) {
+	bw.write(0, 1)
+	if main {
+		bw.write(0, 1)
+	}
+	green := make([]int, 256+24)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	for _, p := range pix {
+		green[p>>8&0xff]++
+		red[p>>16&0xff]++
+		blue[p&0xff]++
+		alpha[p>>24]++
+	}
+	greenCode := writePrefixCode(bw, green)
+	redCode := writePrefixCode(bw, red)
+	blueCode := writePrefixCode(bw, blue)
+	alphaCode := writePrefixCode(bw, alpha)
+	writePrefixCode(bw, []int{1}) // distance: unused
+	for _, p := range pix {
+		greenCode.write(bw, int(p>>8&0xff))
+		redCode.write(bw, int(p>>16&0xff))
+		blueCode.write(bw, int(p&0xff))
+		alphaCode.write(bw, int(p>>24))
+	}
+}
+
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	if n := c.lengths[symbol]; n > 0 {
+		bw.write(c.codes[symbol], uint(n))
+	}
+}
+
+// writePrefixCode writes a prefix code for the symbol counts and returns it.
+// One or two symbols below 256 use the compact simple form.
+func writePrefixCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for s, n := range counts {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+	lengths := make([]int, len(counts))
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+	}
+
+	lengths = huffmanLengths(counts, 15)
+	bw.write(0, 1)
+	lengthCounts := make([]int, 19)
+	for _, n := range lengths {
+		lengthCounts[n]++
+	}
+	lengthCode := huffmanLengths(lengthCounts, 7)
+	ensureTwoCodes(lengthCode)
+	written := len(codeLengthOrder)
+	for written > 4 && lengthCode[codeLengthOrder[written-1]] == 0 {
+		written--
+	}
+	bw.write(uint32(written-4), 4)
+	for _, s := range codeLengthOrder[:written] {
+		bw.write(uint32(lengthCode[s]), 3)
+	}
+	bw.write(0, 1)
+	code := prefixCode{lengths: lengthCode, codes: canonicalCodes(lengthCode)}
+	for _, n := range lengths {
+		code.write(bw, n)
+	}
+	return prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// ensureTwoCodes gives a code that would have a single symbol a second,
+// unused one, so it forms a complete one-bit tree.
+func ensureTwoCodes(lengths []int) {
+	used := -1
+	for s, n := range lengths {
+		if n > 0 {
+			if used >= 0 {
+				return
+			}
+			used = s
+		}
+	}
+	lengths[used] = 1
+	if used == 0 {
+		lengths[1] = 1
+	} else {
+		lengths[0] = 1
+	}
+}
+
+// huffmanLengths builds code lengths no longer than maxLen. When the tree
+// is too deep the counts are flattened and it is built again.
+func huffmanLengths(counts []int, maxLen int) []int {
+	weights := append([]int(nil), counts...)
+	for {
+		lengths := buildHuffman(weights)
+		deepest := 0
+		for _, n := range lengths {
+			deepest = max(deepest, n)
+		}
+		if deepest <= maxLen {
+			return lengths
+		}
+		for i, w := range weights {
+			if w > 0 {
+				weights[i] = w/2 + 1
+			}
+		}
+	}
+}
+
+type huffmanNode struct {
+	weight int
+	symbol int
+	left   *huffmanNode
+	right  *huffmanNode
+}
+
+type nodeHeap []*huffmanNode
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].symbol < h[j].symbol
+}
+func (h nodeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *nodeHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+func buildHuffman(weights []int) []int {
+	lengths := make([]int, len(weights))
+	nodes := &nodeHeap{}
+	for s, w := range weights {
+		if w > 0 {
+			*nodes = append(*nodes, &huffmanNode{weight: w, symbol: s})
+		}
+	}
+	if nodes.Len() == 1 {
+		lengths[(*nodes)[0].symbol] = 1
+		return lengths
+	}
+	heap.Init(nodes)
+	for nodes.Len() > 1 {
+		a := heap.Pop(nodes).(*huffmanNode)
+		b := heap.Pop(nodes).(*huffmanNode)
+		heap.Push(nodes, &huffmanNode{weight: a.weight + b.weight, symbol: min(a.symbol, b.symbol), left: a, right: b})
+	}
+	var walk func(n *huffmanNode, depth int)
+	walk = func(n *huffmanNode, depth int) {
+		if n.left == nil {
+			lengths[n.symbol] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	if nodes.Len() == 1 {
+		walk((*nodes)[0], 0)
+	}
+	return lengths
+}
+
+// canonicalCodes assigns codes as DEFLATE does, returned bit-reversed
+// because VP8L reads codes from the least significant bit.
+func canonicalCodes(lengths []int) []uint32 {
+	var count [16]int
+	for _, n := range lengths {
+		if n > 0 {
+			count[n]++
+		}
+	}
+	var next [16]uint32
+	code := uint32(0)
+	for bits := 1; bits < 16; bits++ {
+		code = (code + uint32(count[bits-1])) << 1
+		next[bits] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for s, n := range lengths {
+		if n == 0 {
+			continue
+		}
+		codes[s] = reverseBits(next[n], n)
+		next[n]++
+	}
+	return codes
+}
+
+func reverseBits(code uint32, n int) uint32 {
+	var out uint32
+	for i := 0; i < n; i++ {
+		out = out<<1 | code&1
+		code >>= 1
+	}
+	return out
+}
+
+// bitWriter packs values least significant bit first.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,94 @@
+// Package imaging holds image encoders the standard library lacks.
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// maxWebPDimension is the largest width or height a VP8 frame can describe.
+const maxWebPDimension = 1<<14 - 1
+
+// EncodeWebP writes img as a lossy WebP. Colour is a VP8 key frame; when
+// img has transparent pixels their alpha is kept exactly in a lossless
+// ALPH chunk, as libwebp does.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxWebPDimension || height > maxWebPDimension {
+		return errors.New("webp: image dimensions out of range")
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	frame, err := encodeVP8(nrgba, vp8QuantIndex)
+	if err != nil {
+		return err
+	}
+	alpha := encodeAlpha(nrgba)
+	if alpha == nil {
+		return writeRIFF(w, chunk{"VP8 ", frame})
+	}
+	header := make([]byte, 10)
+	header[0] = 0x10 // alpha
+	putUint24(header[4:], uint32(width-1))
+	putUint24(header[7:], uint32(height-1))
+	return writeRIFF(w, chunk{"VP8X", header}, chunk{"ALPH", alpha}, chunk{"VP8 ", frame})
+}
+
+// encodeAlpha returns the contents of an ALPH chunk holding img's alpha,
+// or nil when img is opaque. The alpha plane is coded as the green channel
+// of a VP8L image.
+func encodeAlpha(img *image.NRGBA) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	plane := image.NewNRGBA(img.Rect)
+	opaque := true
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a := img.Pix[y*img.Stride+x*4+3]
+			opaque = opaque && a == 0xff
+			plane.Pix[y*plane.Stride+x*4+1] = a
+			plane.Pix[y*plane.Stride+x*4+3] = 0xff
+		}
+	}
+	if opaque {
+		return nil
+	}
+	// The header byte asks for lossless compression with no filtering.
+	return append([]byte{0x01}, encodeVP8L(plane)[vp8lHeaderSize:]...)
+}
+
+type chunk struct {
+	fourCC string
+	data   []byte
+}
+
+// writeRIFF writes a WebP file made of chunks, padding each to an even
+// length.
+func writeRIFF(w io.Writer, chunks ...chunk) error {
+	size := 4
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+	out := make([]byte, 0, 8+size)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(size))
+	out = append(out, "WEBP"...)
+	for _, c := range chunks {
+		out = append(out, c.fourCC...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(c.data)))
+		out = append(out, c.data...)
+		if len(c.data)&1 == 1 {
+			out = append(out, 0)
+		}
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
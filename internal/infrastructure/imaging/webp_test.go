@@ -0,0 +1,236 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// testImage draws gradients under a hard-edged square, so blocks exercise
+// both smooth prediction and large coefficients. Alpha ramps across the
+// image when withAlpha is set.
+func testImage(width, height int, withAlpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: uint8((x + y) * 255 / (width + height)),
+				A: 0xff,
+			}
+			if x > width/4 && x < width*3/4 && y > height/4 && y < height*3/4 {
+				c.R, c.G, c.B = 240, 235, 230
+			}
+			if withAlpha {
+				c.A = uint8((x*7 + y*13) % 256)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// noiseImage is the worst case for the coefficient coder.
+func noiseImage(width, height int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+func roundTrip(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got, want := decoded.Bounds().Size(), img.Bounds().Size(); got != want {
+		t.Fatalf("decoded size %v, want %v", got, want)
+	}
+	return decoded
+}
+
+// lumaPSNR compares the decoded luma with the original's. Chroma is
+// subsampled 2x2 whatever the quality, so it is checked separately.
+func lumaPSNR(original *image.NRGBA, decoded image.Image) float64 {
+	b := original.Bounds()
+	var sum float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := original.NRGBAAt(x, y)
+			want := 0.257*float64(c.R) + 0.504*float64(c.G) + 0.098*float64(c.B) + 16
+			d := float64(decodedYCbCr(decoded, x-b.Min.X, y-b.Min.Y).Y) - want
+			sum += d * d
+		}
+	}
+	mse := sum / float64(b.Dx()*b.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func decodedYCbCr(img image.Image, x, y int) color.YCbCr {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return img.YCbCrAt(x, y)
+	case *image.NYCbCrA:
+		return img.YCbCrAt(x, y)
+	}
+	return color.YCbCr{}
+}
+
+// decodedRGB converts a decoded pixel back to RGB. VP8 uses limited-range
+// BT.601, where the standard library's YCbCr conversion assumes full range.
+func decodedRGB(img image.Image, x, y int) [3]float64 {
+	c := decodedYCbCr(img, x, y)
+	yy := 1.164 * (float64(c.Y) - 16)
+	cb, cr := float64(c.Cb)-128, float64(c.Cr)-128
+	return [3]float64{yy + 1.596*cr, yy - 0.813*cr - 0.391*cb, yy + 2.018*cb}
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	for _, size := range []image.Point{{1, 1}, {3, 5}, {16, 16}, {17, 9}, {33, 31}, {200, 120}} {
+		img := testImage(size.X, size.Y, false)
+		decoded := roundTrip(t, img)
+		if _, ok := decoded.(*image.YCbCr); !ok {
+			t.Errorf("%v: decoded %T, want an opaque *image.YCbCr", size, decoded)
+		}
+		if got := lumaPSNR(img, decoded); got < 35 {
+			t.Errorf("%v: PSNR %.1f dB, want at least 35", size, got)
+		}
+	}
+}
+
+func TestEncodeWebPKeepsColours(t *testing.T) {
+	colours := []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}, {200, 80, 30, 255}, {20, 120, 220, 255}, {90, 200, 60, 255}}
+	for _, c := range colours {
+		img := image.NewNRGBA(image.Rect(0, 0, 21, 13))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		decoded := roundTrip(t, img)
+		got := decodedRGB(decoded, 20, 12)
+		for i, want := range []uint8{c.R, c.G, c.B} {
+			if math.Abs(got[i]-float64(want)) > 4 {
+				t.Errorf("%v decoded as %.0f", c, got)
+				break
+			}
+		}
+	}
+}
+
+func TestEncodeWebPNoise(t *testing.T) {
+	img := noiseImage(48, 40)
+	if got := lumaPSNR(img, roundTrip(t, img)); got < 30 {
+		t.Errorf("PSNR %.1f dB, want at least 30", got)
+	}
+}
+
+func TestEncodeWebPKeepsAlphaExactly(t *testing.T) {
+	for _, size := range []image.Point{{1, 1}, {3, 5}, {17, 9}, {33, 31}} {
+		img := testImage(size.X, size.Y, true)
+		decoded, ok := roundTrip(t, img).(*image.NYCbCrA)
+		if !ok {
+			t.Fatalf("%v: decoded %T, want *image.NYCbCrA", size, decoded)
+		}
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				want := img.NRGBAAt(x, y).A
+				if got := decoded.A[decoded.AOffset(x, y)]; got != want {
+					t.Fatalf("%v: alpha at (%d, %d) = %d, want %d", size, x, y, got, want)
+				}
+			}
+		}
+		if got := lumaPSNR(img, decoded); got < 35 {
+			t.Errorf("%v: PSNR %.1f dB, want at least 35", size, got)
+		}
+	}
+}
+
+func TestEncodeWebPHonoursBoundsOrigin(t *testing.T) {
+	img := testImage(40, 30, false)
+	sub := img.SubImage(image.Rect(7, 5, 30, 26)).(*image.NRGBA)
+	if got := lumaPSNR(sub, roundTrip(t, sub)); got < 35 {
+		t.Errorf("PSNR %.1f dB, want at least 35", got)
+	}
+}
+
+func TestEncodeWebPRejectsOversizedImages(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, maxWebPDimension+1, 1))
+	if err := EncodeWebP(&bytes.Buffer{}, img); err == nil {
+		t.Fatal("encoded an image wider than VP8 allows")
+	}
+}
+
+// TestEncodeWebPOddSizes covers frames whose edges cut through macroblocks
+// and chroma pairs, including strips a single pixel wide or tall.
+func TestEncodeWebPOddSizes(t *testing.T) {
+	for _, size := range []image.Point{{1, 33}, {33, 1}, {2, 2}, {15, 17}, {31, 33}, {513, 7}, {7, 513}} {
+		for _, withAlpha := range []bool{false, true} {
+			img := testImage(size.X, size.Y, withAlpha)
+			decoded := roundTrip(t, img)
+			if got := lumaPSNR(img, decoded); got < 35 {
+				t.Errorf("%v alpha %v: PSNR %.1f dB, want at least 35", size, withAlpha, got)
+			}
+		}
+	}
+}
+
+// encodeAt round-trips img's colour through a VP8 frame quantized at q,
+// returning the frame's size and the decoded luma's PSNR.
+func encodeAt(t *testing.T, img *image.NRGBA, q int) (int, float64) {
+	t.Helper()
+	frame, err := encodeVP8(img, q)
+	if err != nil {
+		t.Fatalf("quantizer %d: encode: %v", q, err)
+	}
+	var buf bytes.Buffer
+	if err := writeRIFF(&buf, chunk{"VP8 ", frame}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatalf("quantizer %d: decode: %v", q, err)
+	}
+	return len(frame), lumaPSNR(img, decoded)
+}
+
+func TestEncodeVP8QuantizerBounds(t *testing.T) {
+	for name, img := range map[string]*image.NRGBA{"gradient": testImage(64, 48, false), "noise": noiseImage(64, 48)} {
+		finest, finePSNR := encodeAt(t, img, 0)
+		standard, _ := encodeAt(t, img, vp8QuantIndex)
+		coarsest, coarsePSNR := encodeAt(t, img, maxQuantIndex)
+		if !(finest > standard && standard > coarsest) {
+			t.Errorf("%s: sizes %d, %d, %d bytes should shrink as the quantizer grows", name, finest, standard, coarsest)
+		}
+		if finePSNR < 45 {
+			t.Errorf("%s: PSNR %.1f dB at quantizer 0, want at least 45", name, finePSNR)
+		}
+		if coarsePSNR >= finePSNR {
+			t.Errorf("%s: PSNR %.1f dB at quantizer %d, want less than %.1f at 0", name, coarsePSNR, maxQuantIndex, finePSNR)
+		}
+	}
+}
+
+func TestEncodeVP8RejectsQuantizerOutOfRange(t *testing.T) {
+	img := testImage(8, 8, false)
+	for _, q := range []int{-1, maxQuantIndex + 1} {
+		if _, err := encodeVP8(img, q); err == nil {
+			t.Errorf("encoded with quantizer %d", q)
+		}
+	}
+}
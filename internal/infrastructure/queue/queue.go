@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+type job struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Queue runs background jobs on a fixed pool of workers. Jobs live in
+// memory only; work that must survive a restart needs a scheduler job that
+// finds and resubmits it.
+type Queue struct {
+	jobs    chan job
+	workers int
+}
+
+func New(workers int, size int) *Queue {
+	return &Queue{
+		jobs:    make(chan job, size),
+		workers: max(workers, 1),
+	}
+}
+
+// Start runs the workers until ctx is cancelled.
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+// Submit adds a job without blocking. It reports false when the queue is
+// full and the job was dropped.
+func (q *Queue) Submit(name string, run func(ctx context.Context) error) bool {
+	select {
+	case q.jobs <- job{name: name, run: run}:
+		return true
+	default:
+		log.Printf("⚠️ Queue full, dropped job %s", name)
+		return false
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-q.jobs:
+			started := time.Now()
+			if err := j.run(ctx); err != nil {
+				log.Printf("❌ Job %s failed: %v", j.name, err)
+				continue
+			}
+			log.Printf("✅ Job %s finished in %s", j.name, time.Since(started).Round(time.Millisecond))
+		}
+	}
+}
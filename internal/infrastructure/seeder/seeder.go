@@ -183,8 +183,8 @@ func seedFilters(tx *gorm.DB) error {
 		{
 			Name: "Black & White",
 			Effect: datatypes.JSONMap{
-				"desaturate": true,
-				"contrast":   6,
+				"grayscale": true,
+				"contrast":  6,
 			},
 			Active: true,
 		},
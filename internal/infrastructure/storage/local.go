@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-ddd-clean/internal/domain/media"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// LocalStore keeps blobs under a directory on the API host. The API serves
+// the directory itself, so baseURL is the public prefix it is mounted on.
+// Originals go under privateRoot instead, which is never served.
+type LocalStore struct {
+	root        string
+	privateRoot string
+	baseURL     string
+}
+
+// NewLocalStore prepares both directories and moves into privateRoot any
+// originals stored under root before they were kept apart.
+func NewLocalStore(root string, privateRoot string, baseURL string) (*LocalStore, error) {
+	for _, dir := range []string{root, privateRoot} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	s := &LocalStore{
+		root:        root,
+		privateRoot: privateRoot,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+	}
+	if err := s.moveOriginals(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Root is the directory the store writes public blobs to.
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+func (s *LocalStore) moveOriginals() error {
+	files, err := filepath.Glob(filepath.Join(s.root, "sessions", "*", "photos", "*"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(s.root, file)
+		if err != nil {
+			return err
+		}
+		if !media.IsOriginalKey(filepath.ToSlash(rel)) {
+			continue
+		}
+		target := filepath.Join(s.privateRoot, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(file, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put writes to a temporary file next to the target and renames it into
+// place, so readers never see a half-written blob.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, contextReader{ctx: ctx, r: r}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, media.ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*media.BlobInfo, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, media.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &media.BlobInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+	}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// PresignPut is not supported: uploads to the local store have to go
+// through the API.
+func (s *LocalStore) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (string, error) {
+	return "", media.ErrPresignUnsupported
+}
+
+// path maps key into its directory, refusing keys that would escape it.
+func (s *LocalStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", ErrInvalidKey
+	}
+	root := s.root
+	if media.IsOriginalKey(key) {
+		root = s.privateRoot
+	}
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+// contextReader stops a copy once ctx is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-ddd-clean/internal/domain/media"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	// PrivateBucket holds originals. It must not be readable without
+	// credentials, unlike Bucket.
+	PrivateBucket string
+	Region        string
+	UseSSL        bool
+	// PublicURL is the prefix clients use to fetch objects, e.g. a CDN in
+	// front of the bucket. It defaults to the bucket on Endpoint.
+	PublicURL string
+}
+
+// S3Store keeps blobs in an S3-compatible bucket, and originals in a
+// private one. MinIO works as a local stand-in.
+type S3Store struct {
+	client        *minio.Client
+	bucket        string
+	privateBucket string
+	publicURL     string
+}
+
+// NewS3Store connects to the bucket and creates it when it does not exist.
+func NewS3Store(ctx context.Context, cfg S3Config) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range []string{cfg.Bucket, cfg.PrivateBucket} {
+		exists, err := client.BucketExists(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		scheme := "http"
+		if cfg.UseSSL {
+			scheme = "https"
+		}
+		publicURL = scheme + "://" + cfg.Endpoint + "/" + cfg.Bucket
+	}
+	return &S3Store{
+		client:        client,
+		bucket:        cfg.Bucket,
+		privateBucket: cfg.PrivateBucket,
+		publicURL:     strings.TrimRight(publicURL, "/"),
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucketFor(key), key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// GetObject is lazy; Stat first so a missing key fails here rather than
+	// on the first read.
+	bucket, _, err := s.stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*media.BlobInfo, error) {
+	_, info, err := s.stat(ctx, key)
+	return info, err
+}
+
+// stat also returns the bucket the object was found in: originals stored
+// before they were kept apart are still in the public bucket.
+func (s *S3Store) stat(ctx context.Context, key string) (string, *media.BlobInfo, error) {
+	bucket := s.bucketFor(key)
+	info, err := s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	err = translateS3Error(err)
+	if errors.Is(err, media.ErrBlobNotFound) && bucket != s.bucket {
+		bucket = s.bucket
+		info, err = s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+		err = translateS3Error(err)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return bucket, &media.BlobInfo{
+		Key:         key,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+	}, nil
+}
+
+// Delete removes an original from both buckets, wherever it was stored.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if bucket := s.bucketFor(key); bucket != s.bucket {
+		if err := s.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) URL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+// PresignPut signs the Content-Type header too, so the upload cannot store
+// a different type than the one the API agreed to.
+func (s *S3Store) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (string, error) {
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	u, err := s.client.PresignHeader(ctx, http.MethodPut, s.bucketFor(key), key, expires, nil, headers)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *S3Store) bucketFor(key string) string {
+	if media.IsOriginalKey(key) {
+		return s.privateBucket
+	}
+	return s.bucket
+}
+
+func translateS3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return media.ErrBlobNotFound
+	}
+	return err
+}
@@ -60,11 +60,12 @@ func (h *boothHandler) list(c *fiber.Ctx) error {
 
 func (h *boothHandler) create(c *fiber.Ctx) error {
 	var body struct {
-		BranchID string         `json:"branch_id"`
-		Name     string         `json:"name"`
-		Type     string         `json:"type"`
-		Status   string         `json:"status"`
-		Config   map[string]any `json:"config"`
+		BranchID       string         `json:"branch_id"`
+		Name           string         `json:"name"`
+		Type           string         `json:"type"`
+		Status         string         `json:"status"`
+		Config         map[string]any `json:"config"`
+		ExtraCopyPrice *float64       `json:"extra_copy_price"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -78,11 +79,12 @@ func (h *boothHandler) create(c *fiber.Ctx) error {
 	}
 	status := domainBooth.BoothStatus(body.Status)
 	entity, err := h.boothService.Create(context.Background(), appBooth.CreateBoothInput{
-		BranchID: body.BranchID,
-		Name:     body.Name,
-		Type:     boothType,
-		Status:   status,
-		Config:   body.Config,
+		BranchID:       body.BranchID,
+		Name:           body.Name,
+		Type:           boothType,
+		Status:         status,
+		Config:         body.Config,
+		ExtraCopyPrice: body.ExtraCopyPrice,
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -102,11 +104,12 @@ func (h *boothHandler) get(c *fiber.Ctx) error {
 func (h *boothHandler) update(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var body struct {
-		BranchID string         `json:"branch_id"`
-		Name     string         `json:"name"`
-		Type     *string        `json:"type"`
-		Status   *string        `json:"status"`
-		Config   map[string]any `json:"config"`
+		BranchID       string         `json:"branch_id"`
+		Name           string         `json:"name"`
+		Type           *string        `json:"type"`
+		Status         *string        `json:"status"`
+		Config         map[string]any `json:"config"`
+		ExtraCopyPrice *float64       `json:"extra_copy_price"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -120,12 +123,13 @@ func (h *boothHandler) update(c *fiber.Ctx) error {
 		currentStatus = domainBooth.BoothStatus(*body.Status)
 	}
 	err := h.boothService.Update(context.Background(), appBooth.UpdateBoothInput{
-		ID:       id,
-		BranchID: body.BranchID,
-		Name:     body.Name,
-		Type:     currentType,
-		Status:   currentStatus,
-		Config:   body.Config,
+		ID:             id,
+		BranchID:       body.BranchID,
+		Name:           body.Name,
+		Type:           currentType,
+		Status:         currentStatus,
+		Config:         body.Config,
+		ExtraCopyPrice: body.ExtraCopyPrice,
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -34,8 +34,10 @@ func (h *branchHandler) list(c *fiber.Ctx) error {
 
 func (h *branchHandler) create(c *fiber.Ctx) error {
 	var body struct {
-		Name     string  `json:"name"`
-		Location *string `json:"location"`
+		Name                  string  `json:"name"`
+		Location              *string `json:"location"`
+		OriginalRetentionDays *int    `json:"original_retention_days"`
+		RenderedRetentionDays *int    `json:"rendered_retention_days"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -44,8 +46,10 @@ func (h *branchHandler) create(c *fiber.Ctx) error {
 		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "name is required"))
 	}
 	branch, err := h.service.Create(context.Background(), appBranch.CreateBranchInput{
-		Name:     body.Name,
-		Location: body.Location,
+		Name:                  body.Name,
+		Location:              body.Location,
+		OriginalRetentionDays: body.OriginalRetentionDays,
+		RenderedRetentionDays: body.RenderedRetentionDays,
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -65,8 +69,10 @@ func (h *branchHandler) get(c *fiber.Ctx) error {
 func (h *branchHandler) update(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var body struct {
-		Name     string  `json:"name"`
-		Location *string `json:"location"`
+		Name                  string  `json:"name"`
+		Location              *string `json:"location"`
+		OriginalRetentionDays *int    `json:"original_retention_days"`
+		RenderedRetentionDays *int    `json:"rendered_retention_days"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -75,9 +81,11 @@ func (h *branchHandler) update(c *fiber.Ctx) error {
 		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "name is required"))
 	}
 	err := h.service.Update(context.Background(), appBranch.UpdateBranchInput{
-		ID:       id,
-		Name:     body.Name,
-		Location: body.Location,
+		ID:                    id,
+		Name:                  body.Name,
+		Location:              body.Location,
+		OriginalRetentionDays: body.OriginalRetentionDays,
+		RenderedRetentionDays: body.RenderedRetentionDays,
 	})
 	if err != nil {
 		return respondError(c, err)
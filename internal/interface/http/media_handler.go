@@ -1,7 +1,15 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
 	"time"
 
 	appMedia "go-ddd-clean/internal/application/media"
@@ -9,6 +17,7 @@ import (
 	domainMedia "go-ddd-clean/internal/domain/media"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type mediaHandler struct {
@@ -17,6 +26,11 @@ type mediaHandler struct {
 	frameService   *appMedia.FrameService
 	filterService  *appMedia.FilterService
 	qrService      *appMedia.QRCodeService
+	renderService  *appMedia.RenderService
+	animations     *appMedia.AnimationService
+	exports        *appMedia.ExportService
+	purges         *appMedia.PurgeService
+	watermarks     *appMedia.WatermarkService
 }
 
 func newMediaHandler(
@@ -25,6 +39,11 @@ func newMediaHandler(
 	frameService *appMedia.FrameService,
 	filterService *appMedia.FilterService,
 	qrService *appMedia.QRCodeService,
+	renderService *appMedia.RenderService,
+	animations *appMedia.AnimationService,
+	exports *appMedia.ExportService,
+	purges *appMedia.PurgeService,
+	watermarks *appMedia.WatermarkService,
 ) *mediaHandler {
 	return &mediaHandler{
 		sessionService: sessionService,
@@ -32,21 +51,42 @@ func newMediaHandler(
 		frameService:   frameService,
 		filterService:  filterService,
 		qrService:      qrService,
+		renderService:  renderService,
+		animations:     animations,
+		exports:        exports,
+		purges:         purges,
+		watermarks:     watermarks,
 	}
 }
 
-func (h *mediaHandler) register(router fiber.Router, boothAuth fiber.Handler) {
+func (h *mediaHandler) register(router fiber.Router, boothAuth fiber.Handler, adminAuth fiber.Handler, boothOrAdminAuth fiber.Handler) {
 	photos := router.Group("/photos", boothAuth)
 	photos.Get("/", h.listPhotos)
 	photos.Post("/", h.createPhoto)
+	photos.Post("/upload", h.uploadPhoto)
+	photos.Post("/upload/stream", h.streamPhoto)
+	photos.Post("/uploads", h.presignPhoto)
+	photos.Post("/uploads/:uploadId/finalize", h.finalizePhoto)
 	photos.Get("/:id", h.getPhoto)
 	photos.Put("/:id", h.updatePhoto)
+	photos.Post("/:id/render", h.renderPhoto)
+	photos.Get("/:id/preview", h.previewPhoto)
 	photos.Delete("/:id", h.deletePhoto)
 
+	animations := router.Group("/animations", boothAuth)
+	animations.Get("/", h.listAnimations)
+	animations.Post("/", h.createAnimation)
+	animations.Get("/:id", h.getAnimation)
+	animations.Delete("/:id", h.deleteAnimation)
+
+	router.Get("/exports", boothOrAdminAuth, h.exportMedia)
+	router.Post("/purge", adminAuth, h.purgeMedia)
+
 	frames := router.Group("/frames")
 	frames.Get("/", h.listFrames)
 	frames.Post("/", h.createFrame)
 	frames.Get("/:id", h.getFrame)
+	frames.Get("/:id/template", h.getFrameTemplate)
 	frames.Put("/:id", h.updateFrame)
 	frames.Delete("/:id", h.deleteFrame)
 
@@ -57,10 +97,19 @@ func (h *mediaHandler) register(router fiber.Router, boothAuth fiber.Handler) {
 	filters.Put("/:id", h.updateFilter)
 	filters.Delete("/:id", h.deleteFilter)
 
+	watermarks := router.Group("/watermarks")
+	watermarks.Get("/", h.listWatermarks)
+	watermarks.Post("/", adminAuth, h.createWatermark)
+	watermarks.Get("/:id", h.getWatermark)
+	watermarks.Put("/:id", adminAuth, h.updateWatermark)
+	watermarks.Delete("/:id", adminAuth, h.deleteWatermark)
+
 	qrcodes := router.Group("/qrcodes")
-	qrcodes.Post("/", h.createQRCode)
+	qrcodes.Post("/", boothAuth, h.createQRCode)
 	qrcodes.Get("/:hash", h.getQRCode)
-	qrcodes.Delete("/:id", h.deleteQRCode)
+	qrcodes.Get("/:hash/image.png", h.getQRCodePNG)
+	qrcodes.Get("/:hash/image.svg", h.getQRCodeSVG)
+	qrcodes.Delete("/:id", boothAuth, h.deleteQRCode)
 }
 
 func (h *mediaHandler) listPhotos(c *fiber.Ctx) error {
@@ -118,6 +167,189 @@ func (h *mediaHandler) createPhoto(c *fiber.Ctx) error {
 	return respondSuccess(c, fiber.StatusCreated, entity)
 }
 
+// uploadPhoto takes a multipart form with the image in "file" and the photo
+// fields as form values; composition is a JSON object.
+func (h *mediaHandler) uploadPhoto(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	sessionID := c.FormValue("session_id")
+	if sessionID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "session_id required"))
+	}
+	if err := h.ensureSessionBelongs(context.Background(), sessionID, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	var composition map[string]any
+	if raw := c.FormValue("composition"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &composition); err != nil {
+			return respondError(c, fiber.NewError(fiber.StatusBadRequest, "composition must be a JSON object"))
+		}
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "file required"))
+	}
+	file, err := header.Open()
+	if err != nil {
+		return respondError(c, err)
+	}
+	defer file.Close()
+	entity, err := h.photoService.Upload(context.Background(), appMedia.UploadPhotoInput{
+		SessionID:   sessionID,
+		FrameID:     optionalFormValue(c, "frame_id"),
+		FilterID:    optionalFormValue(c, "filter_id"),
+		Composition: composition,
+		Size:        header.Size,
+		Body:        file,
+	})
+	if err != nil {
+		return respondUploadError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
+
+// streamPhoto takes the raw image as the request body, with the photo
+// fields in the query string, and streams it to storage without buffering.
+func (h *mediaHandler) streamPhoto(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "session_id query param required"))
+	}
+	if err := h.ensureSessionBelongs(context.Background(), sessionID, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+	size := int64(c.Request().Header.ContentLength())
+	if size < 0 {
+		size = -1
+	}
+	entity, err := h.photoService.Upload(context.Background(), appMedia.UploadPhotoInput{
+		SessionID: sessionID,
+		FrameID:   optionalQuery(c, "frame_id"),
+		FilterID:  optionalQuery(c, "filter_id"),
+		Size:      size,
+		Body:      body,
+	})
+	if err != nil {
+		return respondUploadError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
+
+// presignPhoto hands the booth a pre-signed URL to PUT a photo straight to
+// storage; finalizePhoto then records it.
+func (h *mediaHandler) presignPhoto(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		SessionID   string `json:"session_id"`
+		ContentType string `json:"content_type"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.SessionID == "" || body.ContentType == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "session_id and content_type are required"))
+	}
+	if err := h.ensureSessionBelongs(context.Background(), body.SessionID, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	upload, err := h.photoService.PresignUpload(context.Background(), appMedia.PresignPhotoInput{
+		SessionID:   body.SessionID,
+		ContentType: body.ContentType,
+	})
+	if err != nil {
+		return respondUploadError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, fiber.Map{
+		"upload_id":  upload.UploadID,
+		"key":        upload.Key,
+		"url":        upload.URL,
+		"method":     upload.Method,
+		"headers":    upload.Headers,
+		"max_bytes":  upload.MaxBytes,
+		"expires_at": upload.ExpiresAt,
+	})
+}
+
+func (h *mediaHandler) finalizePhoto(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		SessionID   string         `json:"session_id"`
+		ContentType string         `json:"content_type"`
+		SHA256      string         `json:"sha256"`
+		FrameID     *string        `json:"frame_id"`
+		FilterID    *string        `json:"filter_id"`
+		Composition map[string]any `json:"composition"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.SessionID == "" || body.ContentType == "" || body.SHA256 == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "session_id, content_type and sha256 are required"))
+	}
+	if err := h.ensureSessionBelongs(context.Background(), body.SessionID, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.photoService.FinalizeUpload(context.Background(), appMedia.FinalizePhotoInput{
+		UploadID:    c.Params("uploadId"),
+		SessionID:   body.SessionID,
+		ContentType: body.ContentType,
+		ContentHash: body.SHA256,
+		FrameID:     body.FrameID,
+		FilterID:    body.FilterID,
+		Composition: body.Composition,
+	})
+	if err != nil {
+		return respondUploadError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
+
+func respondUploadError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, domainMedia.ErrPresignUnsupported):
+		return respondError(c, fiber.NewError(fiber.StatusNotImplemented, err.Error()))
+	case errors.Is(err, appMedia.ErrUploadMissing):
+		return respondError(c, fiber.NewError(fiber.StatusConflict, err.Error()))
+	case errors.Is(err, appMedia.ErrChecksumMismatch):
+		return respondError(c, fiber.NewError(fiber.StatusUnprocessableEntity, err.Error()))
+	case errors.Is(err, appMedia.ErrUnsupportedMedia):
+		return respondError(c, fiber.NewError(fiber.StatusUnsupportedMediaType, err.Error()))
+	case errors.Is(err, appMedia.ErrUploadTooLarge):
+		return respondError(c, fiber.NewError(fiber.StatusRequestEntityTooLarge, err.Error()))
+	}
+	return respondError(c, err)
+}
+
+func optionalFormValue(c *fiber.Ctx, key string) *string {
+	if value := c.FormValue(key); value != "" {
+		return &value
+	}
+	return nil
+}
+
+func optionalQuery(c *fiber.Ctx, key string) *string {
+	if value := c.Query(key); value != "" {
+		return &value
+	}
+	return nil
+}
+
 func (h *mediaHandler) getPhoto(c *fiber.Ctx) error {
 	token, err := requireBoothToken(c)
 	if err != nil {
@@ -164,6 +396,44 @@ func (h *mediaHandler) updatePhoto(c *fiber.Ctx) error {
 	return respondSuccess(c, fiber.StatusOK, entity)
 }
 
+func (h *mediaHandler) renderPhoto(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	id := c.Params("id")
+	if _, err := h.ensurePhotoBelongs(context.Background(), id, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.renderService.Render(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+// previewPhoto returns a small JPEG of the photo with a filter applied.
+func (h *mediaHandler) previewPhoto(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	filterID := c.Query("filter_id")
+	if filterID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "filter_id query param required"))
+	}
+	id := c.Params("id")
+	if _, err := h.ensurePhotoBelongs(context.Background(), id, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	preview, err := h.renderService.Preview(context.Background(), id, filterID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, "image/jpeg")
+	return c.Status(fiber.StatusOK).Send(preview)
+}
+
 func (h *mediaHandler) deletePhoto(c *fiber.Ctx) error {
 	token, err := requireBoothToken(c)
 	if err != nil {
@@ -179,6 +449,162 @@ func (h *mediaHandler) deletePhoto(c *fiber.Ctx) error {
 	return respondSuccess(c, fiber.StatusNoContent, nil)
 }
 
+func (h *mediaHandler) listAnimations(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	sessionID := c.Query("session_id", "")
+	if sessionID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "session_id query param required"))
+	}
+	if err := h.ensureSessionBelongs(context.Background(), sessionID, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	result, err := h.animations.ListBySession(context.Background(), sessionID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+// createAnimation builds an animated GIF from the session's photos. It
+// runs inline, so booths should keep animations short.
+func (h *mediaHandler) createAnimation(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		SessionID    string   `json:"session_id"`
+		Kind         string   `json:"kind"`
+		PhotoIDs     []string `json:"photo_ids"`
+		FrameID      *string  `json:"frame_id"`
+		FrameDelayMS int      `json:"frame_delay_ms"`
+		Loops        int      `json:"loops"`
+		Size         int      `json:"size"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.SessionID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "session_id required"))
+	}
+	if err := h.ensureSessionBelongs(context.Background(), body.SessionID, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.animations.Create(context.Background(), appMedia.CreateAnimationInput{
+		SessionID:    body.SessionID,
+		Kind:         domainMedia.AnimationKind(body.Kind),
+		PhotoIDs:     body.PhotoIDs,
+		FrameID:      body.FrameID,
+		FrameDelayMS: body.FrameDelayMS,
+		Loops:        body.Loops,
+		Size:         body.Size,
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
+
+func (h *mediaHandler) getAnimation(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.ensureAnimationBelongs(context.Background(), c.Params("id"), token.BoothID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *mediaHandler) deleteAnimation(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	id := c.Params("id")
+	if _, err := h.ensureAnimationBelongs(context.Background(), id, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	if err := h.animations.Delete(context.Background(), id); err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusNoContent, nil)
+}
+
+// exportMedia streams a ZIP of the matching photos and animations with a
+// manifest.json. The filter is checked before the response starts; after
+// that, failures can only be logged. Admins get every booth's media,
+// originals included; a booth gets its own media without the originals.
+func (h *mediaHandler) exportMedia(c *fiber.Ctx) error {
+	var filter domainMedia.MediaFilter
+	if id := c.Query("session_id", ""); id != "" {
+		filter.SessionID = &id
+	}
+	if id := c.Query("booth_id", ""); id != "" {
+		filter.BoothID = &id
+	}
+	originals := true
+	if token, err := requireBoothToken(c); err == nil {
+		if filter.BoothID != nil && *filter.BoothID != token.BoothID {
+			return respondError(c, fiber.ErrForbidden)
+		}
+		filter.BoothID = &token.BoothID
+		originals = false
+	}
+	var err error
+	if filter.From, err = queryUnix(c, "from"); err != nil {
+		return respondError(c, err)
+	}
+	if filter.To, err = queryUnix(c, "to"); err != nil {
+		return respondError(c, err)
+	}
+	if err := appMedia.CheckExport(filter); err != nil {
+		return respondError(c, err)
+	}
+	name := time.Now().Format("20060102-150405")
+	if filter.SessionID != nil {
+		name = *filter.SessionID
+	}
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="export-%s.zip"`, name))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.exports.WriteZip(context.Background(), filter, originals, w); err != nil {
+			log.Printf("media export %s: %v", name, err)
+		}
+	})
+	return nil
+}
+
+// purgeMedia runs the retention purge now. It is a dry run unless
+// dry_run=false is given, so the report can be checked first.
+func (h *mediaHandler) purgeMedia(c *fiber.Ctx) error {
+	dryRun, ok := parseBoolQuery(c, "dry_run")
+	report, err := h.purges.Run(context.Background(), time.Now(), dryRun || !ok)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, report)
+}
+
+// queryUnix reads an optional unix-seconds query parameter.
+func queryUnix(c *fiber.Ctx, key string) (*time.Time, error) {
+	raw := c.Query(key, "")
+	if raw == "" {
+		return nil, nil
+	}
+	seconds, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, key+" must be unix seconds")
+	}
+	t := time.Unix(seconds, 0)
+	return &t, nil
+}
+
 func (h *mediaHandler) listFrames(c *fiber.Ctx) error {
 	active, ok := parseBoolQuery(c, "active")
 	result, err := h.frameService.List(context.Background(), ok && active)
@@ -190,10 +616,11 @@ func (h *mediaHandler) listFrames(c *fiber.Ctx) error {
 
 func (h *mediaHandler) createFrame(c *fiber.Ctx) error {
 	var body struct {
-		Name    string  `json:"name"`
-		Theme   *string `json:"theme"`
-		FileURL string  `json:"file_url"`
-		Active  *bool   `json:"active"`
+		Name     string             `json:"name"`
+		Theme    *string            `json:"theme"`
+		FileURL  string             `json:"file_url"`
+		Template *frameTemplateBody `json:"template"`
+		Active   *bool              `json:"active"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -206,10 +633,11 @@ func (h *mediaHandler) createFrame(c *fiber.Ctx) error {
 		active = *body.Active
 	}
 	entity, err := h.frameService.Create(context.Background(), appMedia.CreateFrameInput{
-		Name:    body.Name,
-		Theme:   body.Theme,
-		FileURL: body.FileURL,
-		Active:  active,
+		Name:     body.Name,
+		Theme:    body.Theme,
+		FileURL:  body.FileURL,
+		Template: body.Template.toDomain(),
+		Active:   active,
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -229,20 +657,22 @@ func (h *mediaHandler) getFrame(c *fiber.Ctx) error {
 func (h *mediaHandler) updateFrame(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var body struct {
-		Name    string  `json:"name"`
-		Theme   *string `json:"theme"`
-		FileURL string  `json:"file_url"`
-		Active  bool    `json:"active"`
+		Name     string             `json:"name"`
+		Theme    *string            `json:"theme"`
+		FileURL  string             `json:"file_url"`
+		Template *frameTemplateBody `json:"template"`
+		Active   bool               `json:"active"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
 	}
 	entity, err := h.frameService.Update(context.Background(), appMedia.UpdateFrameInput{
-		ID:      id,
-		Name:    body.Name,
-		Theme:   body.Theme,
-		FileURL: body.FileURL,
-		Active:  body.Active,
+		ID:       id,
+		Name:     body.Name,
+		Theme:    body.Theme,
+		FileURL:  body.FileURL,
+		Template: body.Template.toDomain(),
+		Active:   body.Active,
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -250,6 +680,111 @@ func (h *mediaHandler) updateFrame(c *fiber.Ctx) error {
 	return respondSuccess(c, fiber.StatusOK, entity)
 }
 
+// frameTemplateBody is the JSON form of a frame template, used both to
+// create frames and to hand layouts to booths.
+type frameTemplateBody struct {
+	Width     int                `json:"width"`
+	Height    int                `json:"height"`
+	DPI       int                `json:"dpi"`
+	PrintSize string             `json:"print_size"`
+	Slots     []frameSlotBody    `json:"slots"`
+	Overlays  []frameOverlayBody `json:"overlays"`
+}
+
+type frameSlotBody struct {
+	X        int     `json:"x"`
+	Y        int     `json:"y"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Rotation float64 `json:"rotation"`
+}
+
+type frameOverlayBody struct {
+	Kind   string `json:"kind"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Text   string `json:"text,omitempty"`
+	Format string `json:"format,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Align  string `json:"align,omitempty"`
+}
+
+func (b *frameTemplateBody) toDomain() *domainMedia.FrameTemplate {
+	if b == nil {
+		return nil
+	}
+	template := &domainMedia.FrameTemplate{
+		Width:     b.Width,
+		Height:    b.Height,
+		DPI:       b.DPI,
+		PrintSize: domainMedia.PrintSize(b.PrintSize),
+	}
+	for _, s := range b.Slots {
+		template.Slots = append(template.Slots, domainMedia.Slot(s))
+	}
+	for _, o := range b.Overlays {
+		template.Overlays = append(template.Overlays, domainMedia.Overlay{
+			Kind:   domainMedia.OverlayKind(o.Kind),
+			X:      o.X,
+			Y:      o.Y,
+			Width:  o.Width,
+			Height: o.Height,
+			Text:   o.Text,
+			Format: o.Format,
+			Color:  o.Color,
+			Align:  domainMedia.TextAlign(o.Align),
+		})
+	}
+	return template
+}
+
+func newFrameTemplateBody(template *domainMedia.FrameTemplate) *frameTemplateBody {
+	body := &frameTemplateBody{
+		Width:     template.Width,
+		Height:    template.Height,
+		DPI:       template.DPI,
+		PrintSize: string(template.PrintSize),
+		Slots:     make([]frameSlotBody, 0, len(template.Slots)),
+		Overlays:  make([]frameOverlayBody, 0, len(template.Overlays)),
+	}
+	for _, s := range template.Slots {
+		body.Slots = append(body.Slots, frameSlotBody(s))
+	}
+	for _, o := range template.Overlays {
+		body.Overlays = append(body.Overlays, frameOverlayBody{
+			Kind:   string(o.Kind),
+			X:      o.X,
+			Y:      o.Y,
+			Width:  o.Width,
+			Height: o.Height,
+			Text:   o.Text,
+			Format: o.Format,
+			Color:  o.Color,
+			Align:  string(o.Align),
+		})
+	}
+	return body
+}
+
+// getFrameTemplate returns the frame's layout in the same form frames are
+// created with, for booths that render locally.
+func (h *mediaHandler) getFrameTemplate(c *fiber.Ctx) error {
+	entity, err := h.frameService.Get(context.Background(), c.Params("id"))
+	if err != nil {
+		return respondError(c, err)
+	}
+	if entity.Template == nil {
+		return respondError(c, fiber.NewError(fiber.StatusNotFound, "frame has no template"))
+	}
+	return respondSuccess(c, fiber.StatusOK, fiber.Map{
+		"frame_id": entity.ID,
+		"file_url": entity.FileURL,
+		"template": newFrameTemplateBody(entity.Template),
+	})
+}
+
 func (h *mediaHandler) deleteFrame(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if err := h.frameService.Delete(context.Background(), id); err != nil {
@@ -333,45 +868,186 @@ func (h *mediaHandler) deleteFilter(c *fiber.Ctx) error {
 	return respondSuccess(c, fiber.StatusNoContent, nil)
 }
 
+// watermarkBody is the request body of watermark creates and updates;
+// branch_id and booth_id are only read on create.
+type watermarkBody struct {
+	BranchID *string `json:"branch_id"`
+	BoothID  *string `json:"booth_id"`
+	ImageURL *string `json:"image_url"`
+	Text     string  `json:"text"`
+	Position string  `json:"position"`
+	Opacity  float64 `json:"opacity"`
+	Scale    float64 `json:"scale"`
+}
+
+func (b watermarkBody) input(id string) appMedia.WatermarkInput {
+	return appMedia.WatermarkInput{
+		ID:       id,
+		BranchID: b.BranchID,
+		BoothID:  b.BoothID,
+		ImageURL: b.ImageURL,
+		Text:     b.Text,
+		Position: domainMedia.WatermarkPosition(b.Position),
+		Opacity:  b.Opacity,
+		Scale:    b.Scale,
+	}
+}
+
+func (h *mediaHandler) listWatermarks(c *fiber.Ctx) error {
+	result, err := h.watermarks.List(context.Background())
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *mediaHandler) createWatermark(c *fiber.Ctx) error {
+	var body watermarkBody
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.watermarks.Create(context.Background(), body.input(""))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
+
+func (h *mediaHandler) getWatermark(c *fiber.Ctx) error {
+	id := c.Params("id")
+	entity, err := h.watermarks.Get(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *mediaHandler) updateWatermark(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var body watermarkBody
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.watermarks.Update(context.Background(), body.input(id))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *mediaHandler) deleteWatermark(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := h.watermarks.Delete(context.Background(), id); err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusNoContent, nil)
+}
+
 func (h *mediaHandler) createQRCode(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
 	var body struct {
-		PhotoID  string `json:"photo_id"`
-		Hash     string `json:"hash"`
-		ExpireAt *int64 `json:"expire_at"`
+		PhotoID     *string `json:"photo_id"`
+		AnimationID *string `json:"animation_id"`
+		SessionID   *string `json:"session_id"`
+		Album       []struct {
+			Kind string `json:"kind"`
+			ID   string `json:"id"`
+		} `json:"album"`
+		ExpireAt *int64  `json:"expire_at"`
+		PIN      *string `json:"pin"`
+		Phone    *string `json:"phone"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
 	}
-	if body.PhotoID == "" || body.Hash == "" {
-		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "photo_id and hash required"))
+	album := make([]domainMedia.MediaRef, 0, len(body.Album))
+	for _, item := range body.Album {
+		album = append(album, domainMedia.MediaRef{Kind: domainMedia.MediaKind(item.Kind), ID: item.ID})
 	}
 	var expire *time.Time
 	if body.ExpireAt != nil {
 		ts := time.Unix(*body.ExpireAt, 0)
 		expire = &ts
 	}
-	entity, err := h.qrService.Create(context.Background(), appMedia.CreateQRCodeInput{
-		PhotoID:  body.PhotoID,
-		Hash:     body.Hash,
-		ExpireAt: expire,
-	})
+	input := appMedia.CreateQRCodeInput{
+		PhotoID:     body.PhotoID,
+		AnimationID: body.AnimationID,
+		SessionID:   body.SessionID,
+		Album:       album,
+		ExpireAt:    expire,
+		PIN:         body.PIN,
+		Phone:       body.Phone,
+	}
+	target := domainMedia.QRCode{PhotoID: input.PhotoID, AnimationID: input.AnimationID, SessionID: input.SessionID, Album: input.Album}
+	if err := h.ensureQRTargetBelongs(context.Background(), target, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.qrService.Create(context.Background(), input)
 	if err != nil {
 		return respondError(c, err)
 	}
 	return respondSuccess(c, fiber.StatusCreated, entity)
 }
 
+// getQRCode is public, since anyone holding the QR knows its hash. It
+// says only what the share page will ask for, never which media the code
+// points at.
 func (h *mediaHandler) getQRCode(c *fiber.Ctx) error {
 	hash := c.Params("hash")
 	entity, err := h.qrService.GetByHash(context.Background(), hash)
 	if err != nil {
 		return respondError(c, err)
 	}
-	return respondSuccess(c, fiber.StatusOK, entity)
+	return respondSuccess(c, fiber.StatusOK, fiber.Map{
+		"hash":      entity.Hash,
+		"target":    entity.Target(),
+		"expire_at": entity.ExpireAt,
+		"protected": entity.Protection != "",
+	})
+}
+
+// getQRCodePNG and getQRCodeSVG return the QR image itself, so booth
+// screens can use the URL as an image source. size is in pixels.
+func (h *mediaHandler) getQRCodePNG(c *fiber.Ctx) error {
+	image, err := h.qrService.PNG(context.Background(), c.Params("hash"), c.QueryInt("size", 0))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return sendQRImage(c, "image/png", image)
+}
+
+func (h *mediaHandler) getQRCodeSVG(c *fiber.Ctx) error {
+	image, err := h.qrService.SVG(context.Background(), c.Params("hash"), c.QueryInt("size", 0))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return sendQRImage(c, "image/svg+xml", image)
+}
+
+// sendQRImage lets clients cache the image: a hash always encodes the
+// same URL.
+func sendQRImage(c *fiber.Ctx, contentType string, image []byte) error {
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return c.Status(fiber.StatusOK).Send(image)
 }
 
 func (h *mediaHandler) deleteQRCode(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
 	id := c.Params("id")
+	entity, err := h.qrService.Get(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	if err := h.ensureQRTargetBelongs(context.Background(), *entity, token.BoothID); err != nil {
+		return respondError(c, err)
+	}
 	if err := h.qrService.Delete(context.Background(), id); err != nil {
 		return respondError(c, err)
 	}
@@ -399,3 +1075,43 @@ func (h *mediaHandler) ensurePhotoBelongs(ctx context.Context, photoID string, b
 	}
 	return photo, nil
 }
+
+func (h *mediaHandler) ensureAnimationBelongs(ctx context.Context, animationID string, boothID string) (*domainMedia.Animation, error) {
+	animation, err := h.animations.Get(ctx, animationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.ensureSessionBelongs(ctx, animation.SessionID, boothID); err != nil {
+		return nil, err
+	}
+	return animation, nil
+}
+
+// ensureQRTargetBelongs checks that everything code points at was taken
+// in the booth's sessions. Album items that no longer exist are left to
+// the service, which rejects them.
+func (h *mediaHandler) ensureQRTargetBelongs(ctx context.Context, code domainMedia.QRCode, boothID string) error {
+	switch {
+	case code.PhotoID != nil:
+		_, err := h.ensurePhotoBelongs(ctx, *code.PhotoID, boothID)
+		return err
+	case code.AnimationID != nil:
+		_, err := h.ensureAnimationBelongs(ctx, *code.AnimationID, boothID)
+		return err
+	case code.SessionID != nil:
+		return h.ensureSessionBelongs(ctx, *code.SessionID, boothID)
+	}
+	for _, ref := range code.Album {
+		var err error
+		switch ref.Kind {
+		case domainMedia.MediaPhoto:
+			_, err = h.ensurePhotoBelongs(ctx, ref.ID, boothID)
+		case domainMedia.MediaAnimation:
+			_, err = h.ensureAnimationBelongs(ctx, ref.ID, boothID)
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,23 +4,28 @@ import (
 	"context"
 
 	appPayment "go-ddd-clean/internal/application/payment"
+	appSession "go-ddd-clean/internal/application/session"
 	domainPayment "go-ddd-clean/internal/domain/payment"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type paymentHandler struct {
-	service *appPayment.Service
+	service        *appPayment.Service
+	sessionService *appSession.Service
 }
 
-func newPaymentHandler(service *appPayment.Service) *paymentHandler {
-	return &paymentHandler{service: service}
+func newPaymentHandler(service *appPayment.Service, sessionService *appSession.Service) *paymentHandler {
+	return &paymentHandler{service: service, sessionService: sessionService}
 }
 
-func (h *paymentHandler) register(router fiber.Router) {
-	router.Post("/", h.create)
+// register mounts the payment routes. Recording or changing a payment can
+// mark a session paid, which settles referrals and lifts watermarks, so it
+// takes the session's booth token or an admin's.
+func (h *paymentHandler) register(router fiber.Router, boothOrAdminAuth fiber.Handler) {
+	router.Post("/", boothOrAdminAuth, h.create)
 	router.Get("/:id", h.get)
-	router.Put("/:id", h.update)
+	router.Put("/:id", boothOrAdminAuth, h.update)
 	router.Get("/session/:sessionID", h.getBySession)
 }
 
@@ -39,6 +44,9 @@ func (h *paymentHandler) create(c *fiber.Ctx) error {
 	if body.SessionID == "" || body.Method == "" {
 		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "session_id and method required"))
 	}
+	if err := h.ensureSessionBelongs(c, body.SessionID); err != nil {
+		return respondError(c, err)
+	}
 	entity, err := h.service.Create(context.Background(), appPayment.CreatePaymentInput{
 		SessionID:      body.SessionID,
 		Method:         domainPayment.Method(body.Method),
@@ -64,6 +72,13 @@ func (h *paymentHandler) get(c *fiber.Ctx) error {
 
 func (h *paymentHandler) update(c *fiber.Ctx) error {
 	id := c.Params("id")
+	existing, err := h.service.Get(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	if err := h.ensureSessionBelongs(c, existing.SessionID); err != nil {
+		return respondError(c, err)
+	}
 	var body struct {
 		Status         *string  `json:"status"`
 		TransactionRef *string  `json:"transaction_ref"`
@@ -105,3 +120,20 @@ func (h *paymentHandler) getBySession(c *fiber.Ctx) error {
 	}
 	return respondSuccess(c, fiber.StatusOK, entity)
 }
+
+// ensureSessionBelongs lets a booth touch only its own sessions' payments.
+// Callers without a booth token got past the middleware as admins.
+func (h *paymentHandler) ensureSessionBelongs(c *fiber.Ctx, sessionID string) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return nil
+	}
+	session, err := h.sessionService.Get(context.Background(), sessionID)
+	if err != nil {
+		return err
+	}
+	if session.BoothID != token.BoothID {
+		return fiber.ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	appPrinting "go-ddd-clean/internal/application/printing"
+	domainPrinting "go-ddd-clean/internal/domain/printing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// printStreamPoll is how often a job stream re-reads the queue when it has
+// not been woken, which also keeps idle connections alive.
+const printStreamPoll = 15 * time.Second
+
+type printHandler struct {
+	service *appPrinting.Service
+}
+
+func newPrintHandler(service *appPrinting.Service) *printHandler {
+	return &printHandler{service: service}
+}
+
+func (h *printHandler) register(router fiber.Router, boothAuth fiber.Handler, staffAuth fiber.Handler) {
+	router.Get("/", h.list)
+	router.Post("/", boothAuth, h.create)
+	router.Post("/claim", boothAuth, h.claim)
+	router.Get("/stream", boothAuth, h.stream)
+	router.Get("/:id", h.get)
+	router.Put("/:id/status", boothAuth, h.report)
+	router.Post("/:id/approve", staffAuth, h.approve)
+	router.Post("/:id/reject", staffAuth, h.reject)
+}
+
+func (h *printHandler) list(c *fiber.Ctx) error {
+	filter := domainPrinting.JobFilter{
+		BoothID:   optionalQuery(c, "booth_id"),
+		SessionID: optionalQuery(c, "session_id"),
+	}
+	if st := c.Query("status", ""); st != "" {
+		status := domainPrinting.Status(st)
+		filter.Status = &status
+	}
+	result, err := h.service.List(context.Background(), filter)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *printHandler) create(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		PhotoID   string `json:"photo_id"`
+		Kind      string `json:"kind"`
+		Copies    int    `json:"copies"`
+		PaperSize string `json:"paper_size"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.PhotoID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "photo_id required"))
+	}
+	entity, err := h.service.Create(context.Background(), appPrinting.CreateJobInput{
+		BoothID:   token.BoothID,
+		PhotoID:   body.PhotoID,
+		Kind:      domainPrinting.Kind(body.Kind),
+		Copies:    body.Copies,
+		PaperSize: domainPrinting.PaperSize(body.PaperSize),
+	})
+	if err != nil {
+		return respondPrintError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
+
+// claim is the polling alternative to stream: it hands the booth its next
+// job, already marked printing, or 204 when there is none.
+func (h *printHandler) claim(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	job, err := h.service.Claim(context.Background(), token.BoothID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	if job == nil {
+		return respondSuccess(c, fiber.StatusNoContent, nil)
+	}
+	return respondSuccess(c, fiber.StatusOK, job)
+}
+
+// stream sends the booth's queued jobs as server-sent events: a "jobs"
+// event with the whole queue on connect, whenever a job is queued, and
+// every printStreamPoll. Booths then claim or report each job.
+func (h *printHandler) stream(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	boothID := token.BoothID
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		wake, stop := h.service.Subscribe(boothID)
+		defer stop()
+		poll := time.NewTicker(printStreamPoll)
+		defer poll.Stop()
+		queued := domainPrinting.StatusQueued
+		for {
+			jobs, err := h.service.List(context.Background(), domainPrinting.JobFilter{BoothID: &boothID, Status: &queued})
+			if err != nil {
+				log.Printf("print stream %s: %v", boothID, err)
+				return
+			}
+			data, err := json.Marshal(jobs)
+			if err != nil {
+				log.Printf("print stream %s: %v", boothID, err)
+				return
+			}
+			fmt.Fprintf(w, "event: jobs\ndata: %s\n\n", data)
+			// A failed flush means the booth has gone.
+			if err := w.Flush(); err != nil {
+				return
+			}
+			select {
+			case <-wake:
+			case <-poll.C:
+			}
+		}
+	})
+	return nil
+}
+
+func (h *printHandler) get(c *fiber.Ctx) error {
+	id := c.Params("id")
+	entity, err := h.service.Get(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *printHandler) report(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.service.Report(context.Background(), appPrinting.ReportInput{
+		ID:      c.Params("id"),
+		BoothID: token.BoothID,
+		Status:  domainPrinting.Status(body.Status),
+		Message: body.Error,
+	})
+	if err != nil {
+		return respondPrintError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *printHandler) approve(c *fiber.Ctx) error {
+	token, err := requireUserToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.service.Approve(context.Background(), c.Params("id"), token.UserID)
+	if err != nil {
+		return respondPrintError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *printHandler) reject(c *fiber.Ctx) error {
+	token, err := requireUserToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.service.Reject(context.Background(), c.Params("id"), token.UserID, body.Reason)
+	if err != nil {
+		return respondPrintError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func respondPrintError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, appPrinting.ErrNotStaff), errors.Is(err, appPrinting.ErrForeignJob):
+		return respondError(c, fiber.NewError(fiber.StatusForbidden, err.Error()))
+	case errors.Is(err, appPrinting.ErrInvalidTransition), errors.Is(err, appPrinting.ErrPhotoNotRendered):
+		return respondError(c, fiber.NewError(fiber.StatusConflict, err.Error()))
+	}
+	return respondError(c, err)
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+
+	appReferral "go-ddd-clean/internal/application/referral"
+	appSession "go-ddd-clean/internal/application/session"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type referralHandler struct {
+	service        *appReferral.Service
+	sessionService *appSession.Service
+}
+
+func newReferralHandler(service *appReferral.Service, sessionService *appSession.Service) *referralHandler {
+	return &referralHandler{
+		service:        service,
+		sessionService: sessionService,
+	}
+}
+
+func (h *referralHandler) register(router fiber.Router, boothAuth fiber.Handler) {
+	router.Get("/", h.list)
+	router.Post("/codes", h.code)
+	router.Post("/apply", boothAuth, h.apply)
+}
+
+func (h *referralHandler) list(c *fiber.Ctx) error {
+	var referrerID *string
+	if value := c.Query("referrer_id"); value != "" {
+		referrerID = &value
+	}
+	result, err := h.service.List(context.Background(), referrerID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *referralHandler) code(c *fiber.Ctx) error {
+	var body struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.UserID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "user_id required"))
+	}
+	code, err := h.service.CodeFor(context.Background(), body.UserID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, code)
+}
+
+func (h *referralHandler) apply(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		Code      string  `json:"code"`
+		SessionID string  `json:"session_id"`
+		Tel       *string `json:"tel"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.Code == "" || body.SessionID == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "code and session_id required"))
+	}
+	session, err := h.sessionService.Get(context.Background(), body.SessionID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	if session.BoothID != token.BoothID {
+		return respondError(c, fiber.ErrForbidden)
+	}
+	entity, err := h.service.Apply(context.Background(), appReferral.ApplyReferralInput{
+		Code:      body.Code,
+		SessionID: body.SessionID,
+		Tel:       body.Tel,
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
@@ -9,9 +9,12 @@ import (
 	appLogging "go-ddd-clean/internal/application/logging"
 	appMedia "go-ddd-clean/internal/application/media"
 	appPayment "go-ddd-clean/internal/application/payment"
+	appPrinting "go-ddd-clean/internal/application/printing"
+	appReferral "go-ddd-clean/internal/application/referral"
 	appSession "go-ddd-clean/internal/application/session"
 	appUser "go-ddd-clean/internal/application/user"
 	appVoucher "go-ddd-clean/internal/application/voucher"
+	domainUser "go-ddd-clean/internal/domain/user"
 )
 
 type Router struct {
@@ -23,9 +26,19 @@ type Router struct {
 	frames      *appMedia.FrameService
 	filters     *appMedia.FilterService
 	qrcodes     *appMedia.QRCodeService
+	renders     *appMedia.RenderService
+	animations  *appMedia.AnimationService
+	shares      *appMedia.ShareService
+	exports     *appMedia.ExportService
+	purges      *appMedia.PurgeService
+	watermarks  *appMedia.WatermarkService
+	prints      *appPrinting.Service
 	user        *appUser.Service
+	userTokens  *appUser.TokenService
 	payment     *appPayment.Service
 	voucher     *appVoucher.Service
+	campaigns   *appVoucher.CampaignService
+	referrals   *appReferral.Service
 	logging     *appLogging.Service
 	analytics   *appAnalytics.Service
 }
@@ -39,9 +52,19 @@ func NewRouter(
 	frames *appMedia.FrameService,
 	filters *appMedia.FilterService,
 	qrcodes *appMedia.QRCodeService,
+	renders *appMedia.RenderService,
+	animations *appMedia.AnimationService,
+	shares *appMedia.ShareService,
+	exports *appMedia.ExportService,
+	purges *appMedia.PurgeService,
+	watermarks *appMedia.WatermarkService,
+	prints *appPrinting.Service,
 	user *appUser.Service,
+	userTokens *appUser.TokenService,
 	payment *appPayment.Service,
 	voucher *appVoucher.Service,
+	campaigns *appVoucher.CampaignService,
+	referrals *appReferral.Service,
 	logging *appLogging.Service,
 	analytics *appAnalytics.Service,
 ) *Router {
@@ -54,9 +77,19 @@ func NewRouter(
 		frames:      frames,
 		filters:     filters,
 		qrcodes:     qrcodes,
+		renders:     renders,
+		animations:  animations,
+		shares:      shares,
+		exports:     exports,
+		purges:      purges,
+		watermarks:  watermarks,
+		prints:      prints,
 		user:        user,
+		userTokens:  userTokens,
 		payment:     payment,
 		voucher:     voucher,
+		campaigns:   campaigns,
+		referrals:   referrals,
 		logging:     logging,
 		analytics:   analytics,
 	}
@@ -66,20 +99,33 @@ func (r *Router) RegisterRoutes(router fiber.Router) {
 	branchHandler := newBranchHandler(r.branch)
 	boothHandler := newBoothHandler(r.booth, r.logging, r.analytics)
 	sessionHandler := newSessionHandler(r.session, r.photos, r.payment)
-	mediaHandler := newMediaHandler(r.session, r.photos, r.frames, r.filters, r.qrcodes)
-	userHandler := newUserHandler(r.user)
-	paymentHandler := newPaymentHandler(r.payment)
-	voucherHandler := newVoucherHandler(r.voucher, r.session)
+	mediaHandler := newMediaHandler(r.session, r.photos, r.frames, r.filters, r.qrcodes, r.renders, r.animations, r.exports, r.purges, r.watermarks)
+	printHandler := newPrintHandler(r.prints)
+	userHandler := newUserHandler(r.user, r.userTokens)
+	paymentHandler := newPaymentHandler(r.payment, r.session)
+	voucherHandler := newVoucherHandler(r.voucher, r.campaigns, r.session)
+	referralHandler := newReferralHandler(r.referrals, r.session)
 	boothTokenHandler := newBoothTokenHandler(r.boothTokens)
 	boothAuth := newBoothAuthMiddleware(r.boothTokens)
+	staffAuth := newUserAuthMiddleware(r.userTokens, domainUser.RoleStaff, domainUser.RoleAdmin)
+	adminAuth := newUserAuthMiddleware(r.userTokens, domainUser.RoleAdmin)
+	boothOrAdminAuth := newBoothOrUserAuthMiddleware(r.boothTokens, r.userTokens, domainUser.RoleAdmin)
 
 	router.Post("/booth/register", boothTokenHandler.register)
 	router.Post("/booth/regenerate-token", boothAuth, boothTokenHandler.regenerate)
 	branchHandler.register(router.Group("/branches"))
 	boothHandler.register(router.Group("/booths"))
 	sessionHandler.register(router.Group("/sessions"), boothAuth)
-	mediaHandler.register(router.Group("/media"), boothAuth)
-	userHandler.register(router.Group("/users"))
-	paymentHandler.register(router.Group("/payments"))
+	mediaHandler.register(router.Group("/media"), boothAuth, adminAuth, boothOrAdminAuth)
+	printHandler.register(router.Group("/print-jobs"), boothAuth, staffAuth)
+	userHandler.register(router.Group("/users"), adminAuth)
+	paymentHandler.register(router.Group("/payments"), boothOrAdminAuth)
 	voucherHandler.register(router.Group("/vouchers"), boothAuth)
+	referralHandler.register(router.Group("/referrals"), boothAuth)
+}
+
+// RegisterShareRoutes mounts the public share pages QR codes open. They
+// live outside the API so SHARE_BASE_URL can stay short.
+func (r *Router) RegisterShareRoutes(router fiber.Router) {
+	newShareHandler(r.shares, r.qrcodes).register(router)
 }
@@ -71,10 +71,9 @@ func (h *sessionHandler) create(c *fiber.Ctx) error {
 	var body struct {
 		BoothID       string         `json:"booth_id"`
 		UserID        *string        `json:"user_id"`
-		VoucherID     *string        `json:"voucher_id"`
 		PaymentID     *string        `json:"payment_id"`
 		Status        *string        `json:"status"`
-		TotalPrice    *float64       `json:"total_price"`
+		BasePrice     *float64       `json:"base_price"`
 		BoothSnapshot map[string]any `json:"booth_snapshot"`
 		PhoneTemp     *string        `json:"phone_temp"`
 	}
@@ -91,10 +90,9 @@ func (h *sessionHandler) create(c *fiber.Ctx) error {
 	entity, err := h.sessionService.Create(context.Background(), appSession.CreateSessionInput{
 		BoothID:       token.BoothID,
 		UserID:        body.UserID,
-		VoucherID:     body.VoucherID,
 		PaymentID:     body.PaymentID,
 		Status:        status,
-		TotalPrice:    body.TotalPrice,
+		BasePrice:     body.BasePrice,
 		BoothSnapshot: body.BoothSnapshot,
 		PhoneTemp:     body.PhoneTemp,
 	})
@@ -128,10 +126,9 @@ func (h *sessionHandler) update(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var body struct {
 		UserID        *string        `json:"user_id"`
-		VoucherID     *string        `json:"voucher_id"`
 		PaymentID     *string        `json:"payment_id"`
 		Status        *string        `json:"status"`
-		TotalPrice    *float64       `json:"total_price"`
+		BasePrice     *float64       `json:"base_price"`
 		FinishedAt    *int64         `json:"finished_at"`
 		BoothSnapshot map[string]any `json:"booth_snapshot"`
 		PhoneTemp     *string        `json:"phone_temp"`
@@ -154,10 +151,9 @@ func (h *sessionHandler) update(c *fiber.Ctx) error {
 	entity, err := h.sessionService.Update(context.Background(), appSession.UpdateSessionInput{
 		ID:            id,
 		UserID:        body.UserID,
-		VoucherID:     body.VoucherID,
 		PaymentID:     body.PaymentID,
 		Status:        statusPtr,
-		TotalPrice:    body.TotalPrice,
+		BasePrice:     body.BasePrice,
 		FinishedAt:    finishedAtPtr,
 		BoothSnapshot: body.BoothSnapshot,
 		PhoneTemp:     body.PhoneTemp,
@@ -0,0 +1,264 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"path"
+	"strings"
+
+	appMedia "go-ddd-clean/internal/application/media"
+	domainMedia "go-ddd-clean/internal/domain/media"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// shareHandler serves the public pages QR codes link to. Customers are not
+// signed in, so the hash is the only credential.
+type shareHandler struct {
+	service *appMedia.ShareService
+	qrcodes *appMedia.QRCodeService
+}
+
+func newShareHandler(service *appMedia.ShareService, qrcodes *appMedia.QRCodeService) *shareHandler {
+	return &shareHandler{service: service, qrcodes: qrcodes}
+}
+
+// unlockCookie holds the token of a protected share page the browser has
+// entered the PIN for. It is scoped to that page's path.
+const unlockCookie = "share_unlock"
+
+func (h *shareHandler) register(router fiber.Router) {
+	router.Get("/:hash", h.page)
+	router.Post("/:hash/unlock", h.unlock)
+	router.Get("/:hash/download.zip", h.zip)
+	router.Get("/:hash/files/:index", h.file)
+}
+
+var sharePage = template.Must(template.New("share").Parse(`<!doctype html>
+<html lang="th">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>รูปของคุณ</title>
+<style>
+body{margin:0;font-family:system-ui,sans-serif;background:#111;color:#eee}
+header{padding:16px;text-align:center}
+h1{font-size:1.3rem;margin:0 0 8px}
+.all{display:inline-block;padding:12px 20px;border-radius:999px;background:#fff;color:#111;text-decoration:none;font-weight:600}
+main{display:grid;grid-template-columns:repeat(auto-fill,minmax(160px,1fr));gap:12px;padding:12px}
+figure{margin:0;background:#222;border-radius:8px;overflow:hidden}
+figure a{display:block}
+img{display:block;width:100%;height:auto}
+figcaption a{display:block;padding:10px;text-align:center;color:#eee;text-decoration:none}
+.note{padding:0 16px 24px;text-align:center;color:#999;font-size:.85rem}
+form input{font-size:1.5rem;width:8em;text-align:center;letter-spacing:.2em;padding:8px;border-radius:8px;border:0}
+form button{display:block;margin:12px auto 0;padding:12px 20px;border-radius:999px;border:0;font-weight:600}
+</style>
+</head>
+<body>
+<header>
+<h1>{{if .Message}}{{.Message}}{{else}}รูปของคุณ{{end}}</h1>
+{{if .Prompt}}<form method="post" action="{{.Base}}/unlock">
+<p>{{.Prompt}}</p>
+<input name="pin" inputmode="numeric" pattern="[0-9]*" maxlength="8" autocomplete="one-time-code" required autofocus>
+<button type="submit">เปิดดูรูป</button>
+</form>{{end}}
+{{if gt (len .Items) 1}}<a class="all" href="{{.Base}}/download.zip">ดาวน์โหลดทั้งหมด (ZIP)</a>{{end}}
+</header>
+{{if .Items}}<main>
+{{range $i, $item := .Items}}<figure>
+<a href="{{$item.ViewURL}}"><img src="{{$item.ThumbURL}}" alt="{{$item.Name}}" loading="lazy"></a>
+<figcaption><a href="{{$.Base}}/files/{{$i}}">ดาวน์โหลด</a></figcaption>
+</figure>
+{{end}}</main>{{end}}
+{{if .ExpireAt}}<p class="note">ลิงก์นี้ใช้ได้ถึง {{.ExpireAt}}</p>{{end}}
+</body>
+</html>
+`))
+
+type sharePageData struct {
+	Message  string
+	Prompt   string
+	Base     string
+	Items    []appMedia.SharedItem
+	ExpireAt string
+}
+
+func (h *shareHandler) page(c *fiber.Ctx) error {
+	share, err := h.resolve(c)
+	if err != nil {
+		return h.errorPage(c, err)
+	}
+	data := sharePageData{Base: shareBase(c), Items: share.Items}
+	if len(share.Items) == 0 {
+		data.Message = "ยังไม่มีรูปในลิงก์นี้"
+	}
+	if share.Code.ExpireAt != nil {
+		data.ExpireAt = share.Code.ExpireAt.Local().Format("02/01/2006 15:04")
+	}
+	return renderSharePage(c, fiber.StatusOK, data)
+}
+
+// unlock checks the PIN posted from the page's form and, when it is right,
+// remembers it in a cookie and sends the browser back to the page.
+func (h *shareHandler) unlock(c *fiber.Ctx) error {
+	hash := c.Params("hash")
+	token, err := h.qrcodes.Unlock(context.Background(), hash, strings.TrimSpace(c.FormValue("pin")))
+	if err != nil {
+		return h.errorPage(c, err)
+	}
+	code, err := h.qrcodes.GetByHash(context.Background(), hash)
+	if err != nil {
+		return h.errorPage(c, err)
+	}
+	base := shareBase(c)
+	cookie := &fiber.Cookie{
+		Name:     unlockCookie,
+		Value:    token,
+		Path:     base,
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+	if code.ExpireAt != nil {
+		cookie.Expires = *code.ExpireAt
+	}
+	c.Cookie(cookie)
+	return c.Redirect(base, fiber.StatusSeeOther)
+}
+
+// zip streams the whole share as one archive. The response has started by
+// the time a file fails to copy, so that is logged rather than returned.
+func (h *shareHandler) zip(c *fiber.Ctx) error {
+	share, err := h.resolve(c)
+	if err != nil {
+		return h.errorPage(c, err)
+	}
+	if len(share.Items) == 0 {
+		return h.errorPage(c, gorm.ErrRecordNotFound)
+	}
+	if err := h.qrcodes.CountDownload(context.Background(), share.Code); err != nil {
+		return respondError(c, err)
+	}
+	hash := share.Code.Hash
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="photos-%s.zip"`, hash[:8]))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.service.WriteZip(context.Background(), share, w); err != nil {
+			log.Printf("share %s: zip: %v", hash, err)
+		}
+	})
+	return nil
+}
+
+// file sends one item as an attachment, so phones save it instead of
+// opening it.
+func (h *shareHandler) file(c *fiber.Ctx) error {
+	share, err := h.resolve(c)
+	if err != nil {
+		return h.errorPage(c, err)
+	}
+	index, err := c.ParamsInt("index")
+	if err != nil || index < 0 || index >= len(share.Items) {
+		return h.errorPage(c, gorm.ErrRecordNotFound)
+	}
+	item := share.Items[index]
+	body, err := h.service.Open(context.Background(), item)
+	if err != nil {
+		return h.errorPage(c, err)
+	}
+	if err := h.qrcodes.CountDownload(context.Background(), share.Code); err != nil {
+		body.Close()
+		return respondError(c, err)
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, item.Name))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	c.Type(strings.TrimPrefix(path.Ext(item.Name), "."))
+	// fasthttp closes the body once it has been sent.
+	return c.Status(fiber.StatusOK).SendStream(body)
+}
+
+// errLocked marks a protected share the browser has not unlocked.
+type errLocked struct {
+	protection domainMedia.QRProtection
+}
+
+func (e errLocked) Error() string {
+	return "share is protected"
+}
+
+// resolve loads the share for the request and checks the unlock cookie of
+// protected ones.
+func (h *shareHandler) resolve(c *fiber.Ctx) (*appMedia.Share, error) {
+	share, err := h.service.Resolve(context.Background(), c.Params("hash"))
+	if err != nil {
+		return nil, err
+	}
+	if !h.qrcodes.Authorized(share.Code, c.Cookies(unlockCookie)) {
+		return nil, errLocked{protection: share.Code.Protection}
+	}
+	return share, nil
+}
+
+// shareBase is the path of the share page, which its links and form
+// build on, whichever of its routes is being served.
+func shareBase(c *fiber.Ctx) string {
+	path, hash := c.Path(), c.Params("hash")
+	if i := strings.Index(path, "/"+hash); i >= 0 {
+		return path[:i+1+len(hash)]
+	}
+	return path
+}
+
+// errorPage answers customers with a page rather than JSON.
+func (h *shareHandler) errorPage(c *fiber.Ctx, err error) error {
+	var locked errLocked
+	switch {
+	case errors.As(err, &locked):
+		return renderSharePage(c, fiber.StatusUnauthorized, sharePageData{
+			Message: "ลิงก์นี้มีรหัสป้องกัน",
+			Prompt:  pinPrompt(locked.protection),
+			Base:    shareBase(c),
+		})
+	case errors.Is(err, appMedia.ErrWrongPIN):
+		code, _ := h.qrcodes.GetByHash(context.Background(), c.Params("hash"))
+		data := sharePageData{Message: "รหัสไม่ถูกต้อง", Base: shareBase(c)}
+		if code != nil {
+			data.Prompt = pinPrompt(code.Protection)
+		}
+		return renderSharePage(c, fiber.StatusUnauthorized, data)
+	case errors.Is(err, appMedia.ErrQRCodeLocked):
+		return renderSharePage(c, fiber.StatusTooManyRequests, sharePageData{Message: "ใส่รหัสผิดหลายครั้ง กรุณาลองใหม่ภายหลัง"})
+	case errors.Is(err, domainMedia.ErrQRCodeExpired):
+		return renderSharePage(c, fiber.StatusGone, sharePageData{Message: "ลิงก์นี้หมดอายุแล้ว"})
+	case errors.Is(err, domainMedia.ErrMediaPurged):
+		return renderSharePage(c, fiber.StatusGone, sharePageData{Message: "รูปในลิงก์นี้ถูกลบตามระยะเวลาการเก็บรักษาแล้ว"})
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, domainMedia.ErrBlobNotFound):
+		return renderSharePage(c, fiber.StatusNotFound, sharePageData{Message: "ไม่พบรูปของลิงก์นี้"})
+	}
+	return respondError(c, err)
+}
+
+func pinPrompt(protection domainMedia.QRProtection) string {
+	if protection == domainMedia.QRProtectPhone {
+		return "กรอกเลข 4 ตัวท้ายของเบอร์โทรศัพท์"
+	}
+	return "กรอกรหัส PIN"
+}
+
+func renderSharePage(c *fiber.Ctx, status int, data sharePageData) error {
+	var page strings.Builder
+	if err := sharePage.Execute(&page, data); err != nil {
+		return respondError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Status(status).SendString(page.String())
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	appBooth "go-ddd-clean/internal/application/booth"
+	appUser "go-ddd-clean/internal/application/user"
+	domainUser "go-ddd-clean/internal/domain/user"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const userTokenContextKey = "user_token"
+
+// newUserAuthMiddleware lets through requests carrying a user token of one
+// of roles.
+func newUserAuthMiddleware(tokenService *appUser.TokenService, roles ...domainUser.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, err := parseBearerToken(c.Get("Authorization"))
+		if err != nil {
+			return fiber.ErrUnauthorized
+		}
+		validated, err := tokenService.Validate(context.Background(), token)
+		if err != nil {
+			if errors.Is(err, appUser.ErrInvalidUserToken) {
+				return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		if !slices.Contains(roles, validated.Role) {
+			return fiber.ErrForbidden
+		}
+		c.Locals(userTokenContextKey, validated)
+		return c.Next()
+	}
+}
+
+// newBoothOrUserAuthMiddleware lets through booths, and users of one of
+// roles. Handlers tell them apart with requireBoothToken.
+func newBoothOrUserAuthMiddleware(boothTokens *appBooth.TokenService, userTokens *appUser.TokenService, roles ...domainUser.Role) fiber.Handler {
+	users := newUserAuthMiddleware(userTokens, roles...)
+	return func(c *fiber.Ctx) error {
+		token, err := parseBearerToken(c.Get("Authorization"))
+		if err != nil {
+			return fiber.ErrUnauthorized
+		}
+		if booth, err := boothTokens.Validate(context.Background(), token); err == nil {
+			c.Locals(boothTokenContextKey, booth)
+			return c.Next()
+		}
+		return users(c)
+	}
+}
+
+func requireUserToken(c *fiber.Ctx) (*appUser.ValidatedToken, error) {
+	token, ok := c.Locals(userTokenContextKey).(*appUser.ValidatedToken)
+	if !ok || token == nil {
+		return nil, fiber.ErrUnauthorized
+	}
+	return token, nil
+}
@@ -2,6 +2,9 @@ package http
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"time"
 
 	appUser "go-ddd-clean/internal/application/user"
 	domainUser "go-ddd-clean/internal/domain/user"
@@ -10,20 +13,53 @@ import (
 )
 
 type userHandler struct {
-	service *appUser.Service
+	service      *appUser.Service
+	tokenService *appUser.TokenService
 }
 
-func newUserHandler(service *appUser.Service) *userHandler {
-	return &userHandler{service: service}
+func newUserHandler(service *appUser.Service, tokenService *appUser.TokenService) *userHandler {
+	return &userHandler{service: service, tokenService: tokenService}
 }
 
-func (h *userHandler) register(router fiber.Router) {
+// register mounts the user routes. Creating, changing and deleting users
+// takes an admin's token, since a user's role opens the staff and admin
+// routes, and so does anything that moves points.
+func (h *userHandler) register(router fiber.Router, adminAuth fiber.Handler) {
+	router.Post("/login", h.login)
 	router.Get("/", h.list)
-	router.Post("/", h.create)
+	router.Post("/", adminAuth, h.create)
 	router.Get("/:id", h.get)
-	router.Put("/:id", h.update)
-	router.Delete("/:id", h.delete)
-	router.Post("/:id/points", h.adjustPoints)
+	router.Put("/:id", adminAuth, h.update)
+	router.Delete("/:id", adminAuth, h.delete)
+	router.Post("/:id/points", adminAuth, h.adjustPoints)
+	router.Post("/:id/points/earn", adminAuth, h.earnPoints)
+	router.Get("/:id/points/history", h.pointsHistory)
+	router.Get("/points/expiring", h.expiringPoints)
+	router.Post("/points/expire", adminAuth, h.expirePoints)
+	router.Post("/tiers/recompute", adminAuth, h.recomputeTiers)
+}
+
+func (h *userHandler) login(c *fiber.Ctx) error {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.Email == "" || body.Password == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "email and password are required"))
+	}
+	token, err := h.tokenService.Login(context.Background(), body.Email, body.Password)
+	if err != nil {
+		if errors.Is(err, appUser.ErrInvalidCredentials) {
+			return respondError(c, fiber.NewError(fiber.StatusUnauthorized, err.Error()))
+		}
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, fiber.Map{
+		"token": token,
+	})
 }
 
 func (h *userHandler) list(c *fiber.Ctx) error {
@@ -76,7 +112,6 @@ func (h *userHandler) update(c *fiber.Ctx) error {
 		Email    *string `json:"email"`
 		Password *string `json:"password"`
 		Role     *string `json:"role"`
-		Points   *int    `json:"points"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -92,7 +127,6 @@ func (h *userHandler) update(c *fiber.Ctx) error {
 		Email:    body.Email,
 		Password: body.Password,
 		Role:     rolePtr,
-		Points:   body.Points,
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -122,3 +156,57 @@ func (h *userHandler) adjustPoints(c *fiber.Ctx) error {
 	}
 	return respondSuccess(c, fiber.StatusOK, entity)
 }
+
+func (h *userHandler) earnPoints(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var body struct {
+		Points int `json:"points"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	entity, err := h.service.EarnPoints(context.Background(), id, body.Points)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *userHandler) pointsHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+	result, err := h.service.PointsHistory(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *userHandler) expiringPoints(c *fiber.Ctx) error {
+	days := 30
+	if raw := c.Query("days", ""); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			days = parsed
+		}
+	}
+	result, err := h.service.UpcomingExpiry(context.Background(), time.Now(), time.Duration(days)*24*time.Hour)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *userHandler) expirePoints(c *fiber.Ctx) error {
+	result, err := h.service.ExpirePoints(context.Background(), time.Now())
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *userHandler) recomputeTiers(c *fiber.Ctx) error {
+	result, err := h.service.RecomputeTiers(context.Background(), time.Now())
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
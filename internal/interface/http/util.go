@@ -4,6 +4,8 @@ import (
 	"errors"
 	"net/http"
 
+	domainMedia "go-ddd-clean/internal/domain/media"
+
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
@@ -13,9 +15,14 @@ func respondError(c *fiber.Ctx, err error) error {
 		return nil
 	}
 	status := fiber.StatusBadRequest
+	var fiberErr *fiber.Error
 	switch {
-	case errors.Is(err, gorm.ErrRecordNotFound):
+	case errors.As(err, &fiberErr):
+		status = fiberErr.Code
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, domainMedia.ErrBlobNotFound):
 		status = fiber.StatusNotFound
+	case errors.Is(err, domainMedia.ErrQRCodeExpired), errors.Is(err, domainMedia.ErrMediaPurged):
+		status = fiber.StatusGone
 	case errors.Is(err, fiber.ErrUnauthorized):
 		status = fiber.StatusUnauthorized
 	case errors.Is(err, fiber.ErrForbidden):
@@ -2,6 +2,10 @@ package http
 
 import (
 	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	appSession "go-ddd-clean/internal/application/session"
@@ -12,25 +16,41 @@ import (
 )
 
 type voucherHandler struct {
-	service        *appVoucher.Service
-	sessionService *appSession.Service
+	service         *appVoucher.Service
+	campaignService *appVoucher.CampaignService
+	sessionService  *appSession.Service
 }
 
-func newVoucherHandler(service *appVoucher.Service, sessionService *appSession.Service) *voucherHandler {
+func newVoucherHandler(
+	service *appVoucher.Service,
+	campaignService *appVoucher.CampaignService,
+	sessionService *appSession.Service,
+) *voucherHandler {
 	return &voucherHandler{
-		service:        service,
-		sessionService: sessionService,
+		service:         service,
+		campaignService: campaignService,
+		sessionService:  sessionService,
 	}
 }
 
 func (h *voucherHandler) register(router fiber.Router, boothAuth fiber.Handler) {
+	campaigns := router.Group("/campaigns")
+	campaigns.Get("/", h.listCampaigns)
+	campaigns.Post("/", h.createCampaign)
+	campaigns.Get("/:id", h.getCampaign)
+	campaigns.Get("/:id/stats", h.campaignStats)
+	campaigns.Get("/:id/codes.csv", h.exportCampaignCodes)
+
 	router.Get("/", h.list)
 	router.Post("/", h.create)
 	router.Get("/:id", h.get)
 	router.Put("/:id", h.update)
 	router.Delete("/:id", h.delete)
+	router.Get("/:id/redemptions", h.listRedemptions)
+	router.Get("/:id/reversals", h.listReversals)
 	router.Get("/code/:code", h.getByCode)
 	router.Post("/redeem", boothAuth, h.redeem)
+	router.Post("/validate", boothAuth, h.validate)
 }
 
 func (h *voucherHandler) list(c *fiber.Ctx) error {
@@ -44,14 +64,23 @@ func (h *voucherHandler) list(c *fiber.Ctx) error {
 
 func (h *voucherHandler) create(c *fiber.Ctx) error {
 	var body struct {
-		Code      string  `json:"code"`
-		Type      string  `json:"type"`
-		Value     float64 `json:"value"`
-		Unit      string  `json:"unit"`
-		MaxUsage  int     `json:"max_usage"`
-		ValidFrom *int64  `json:"valid_from"`
-		ValidTo   *int64  `json:"valid_to"`
-		Active    *bool   `json:"active"`
+		Code           string   `json:"code"`
+		Type           string   `json:"type"`
+		Value          float64  `json:"value"`
+		Unit           string   `json:"unit"`
+		MaxUsage       int      `json:"max_usage"`
+		ValidFrom      *int64   `json:"valid_from"`
+		ValidTo        *int64   `json:"valid_to"`
+		Active         *bool    `json:"active"`
+		BranchIDs      []string `json:"branch_ids"`
+		BoothIDs       []string `json:"booth_ids"`
+		BoothType      *string  `json:"booth_type"`
+		MinSpend       *float64 `json:"min_spend"`
+		MaxPerCustomer int      `json:"max_per_customer"`
+		Weekdays       []int    `json:"weekdays"`
+		HourFrom       *int     `json:"hour_from"`
+		HourTo         *int     `json:"hour_to"`
+		Stackable      bool     `json:"stackable"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -84,6 +113,17 @@ func (h *voucherHandler) create(c *fiber.Ctx) error {
 		ValidFrom: validFrom,
 		ValidTo:   validTo,
 		Active:    active,
+		Restrictions: domainVoucher.Restrictions{
+			BranchIDs:      body.BranchIDs,
+			BoothIDs:       body.BoothIDs,
+			BoothType:      body.BoothType,
+			MinSpend:       body.MinSpend,
+			MaxPerCustomer: body.MaxPerCustomer,
+			Weekdays:       parseWeekdays(body.Weekdays),
+			HourFrom:       body.HourFrom,
+			HourTo:         body.HourTo,
+			Stackable:      body.Stackable,
+		},
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -103,12 +143,21 @@ func (h *voucherHandler) get(c *fiber.Ctx) error {
 func (h *voucherHandler) update(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var body struct {
-		Value     *float64 `json:"value"`
-		Unit      *string  `json:"unit"`
-		MaxUsage  *int     `json:"max_usage"`
-		ValidFrom *int64   `json:"valid_from"`
-		ValidTo   *int64   `json:"valid_to"`
-		Active    *bool    `json:"active"`
+		Value          *float64 `json:"value"`
+		Unit           *string  `json:"unit"`
+		MaxUsage       *int     `json:"max_usage"`
+		ValidFrom      *int64   `json:"valid_from"`
+		ValidTo        *int64   `json:"valid_to"`
+		Active         *bool    `json:"active"`
+		BranchIDs      []string `json:"branch_ids"`
+		BoothIDs       []string `json:"booth_ids"`
+		BoothType      *string  `json:"booth_type"`
+		MinSpend       *float64 `json:"min_spend"`
+		MaxPerCustomer *int     `json:"max_per_customer"`
+		Weekdays       []int    `json:"weekdays"`
+		HourFrom       *int     `json:"hour_from"`
+		HourTo         *int     `json:"hour_to"`
+		Stackable      *bool    `json:"stackable"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -138,6 +187,16 @@ func (h *voucherHandler) update(c *fiber.Ctx) error {
 		ValidFrom: validFrom,
 		ValidTo:   validTo,
 		Active:    body.Active,
+
+		BranchIDs:      body.BranchIDs,
+		BoothIDs:       body.BoothIDs,
+		BoothType:      body.BoothType,
+		MinSpend:       body.MinSpend,
+		MaxPerCustomer: body.MaxPerCustomer,
+		Weekdays:       parseWeekdays(body.Weekdays),
+		HourFrom:       body.HourFrom,
+		HourTo:         body.HourTo,
+		Stackable:      body.Stackable,
 	})
 	if err != nil {
 		return respondError(c, err)
@@ -153,6 +212,24 @@ func (h *voucherHandler) delete(c *fiber.Ctx) error {
 	return respondSuccess(c, fiber.StatusNoContent, nil)
 }
 
+func (h *voucherHandler) listRedemptions(c *fiber.Ctx) error {
+	id := c.Params("id")
+	result, err := h.service.ListRedemptions(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *voucherHandler) listReversals(c *fiber.Ctx) error {
+	id := c.Params("id")
+	result, err := h.service.ListReversals(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
 func (h *voucherHandler) getByCode(c *fiber.Ctx) error {
 	code := c.Params("code")
 	entity, err := h.service.GetByCode(context.Background(), code)
@@ -168,10 +245,9 @@ func (h *voucherHandler) redeem(c *fiber.Ctx) error {
 		return respondError(c, err)
 	}
 	var body struct {
-		Code      string   `json:"code"`
-		SessionID string   `json:"session_id"`
-		Tel       *string  `json:"tel"`
-		Discount  *float64 `json:"discount"`
+		Code      string  `json:"code"`
+		SessionID string  `json:"session_id"`
+		Tel       *string `json:"tel"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return respondError(c, err)
@@ -186,17 +262,235 @@ func (h *voucherHandler) redeem(c *fiber.Ctx) error {
 	if session.BoothID != token.BoothID {
 		return respondError(c, fiber.ErrForbidden)
 	}
-	redemption, voucher, err := h.service.Redeem(context.Background(), appVoucher.RedeemVoucherInput{
+	redemption, voucher, updated, err := h.service.Redeem(context.Background(), appVoucher.RedeemVoucherInput{
 		Code:      body.Code,
 		SessionID: body.SessionID,
 		Tel:       body.Tel,
-		Discount:  body.Discount,
 	})
+	var rejection *domainVoucher.RejectionError
+	if errors.As(err, &rejection) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":  rejection.Message,
+			"reason": rejection.Reason,
+		})
+	}
 	if err != nil {
 		return respondError(c, err)
 	}
 	return respondSuccess(c, fiber.StatusOK, fiber.Map{
 		"redemption": redemption,
 		"voucher":    voucher,
+		"session":    updated,
 	})
 }
+
+func (h *voucherHandler) validate(c *fiber.Ctx) error {
+	token, err := requireBoothToken(c)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var body struct {
+		Code      string   `json:"code"`
+		SessionID *string  `json:"session_id"`
+		Price     *float64 `json:"price"`
+		UserID    *string  `json:"user_id"`
+		Tel       *string  `json:"tel"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.Code == "" || (body.SessionID == nil && body.Price == nil) {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "code and either session_id or price required"))
+	}
+	if body.SessionID != nil {
+		session, err := h.sessionService.Get(context.Background(), *body.SessionID)
+		if err != nil {
+			return respondError(c, err)
+		}
+		if session.BoothID != token.BoothID {
+			return respondError(c, fiber.ErrForbidden)
+		}
+	}
+	result, err := h.service.Validate(context.Background(), appVoucher.ValidateVoucherInput{
+		Code:      body.Code,
+		SessionID: body.SessionID,
+		BoothID:   token.BoothID,
+		Price:     body.Price,
+		UserID:    body.UserID,
+		Tel:       body.Tel,
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+	if !result.Valid {
+		return respondSuccess(c, fiber.StatusOK, fiber.Map{
+			"valid":   false,
+			"reason":  result.Reason,
+			"message": result.Message,
+		})
+	}
+	return respondSuccess(c, fiber.StatusOK, fiber.Map{
+		"valid":     true,
+		"voucher":   result.Voucher,
+		"discount":  result.Discount,
+		"total":     result.Total,
+		"breakdown": result.Breakdown.Lines,
+	})
+}
+
+func (h *voucherHandler) listCampaigns(c *fiber.Ctx) error {
+	result, err := h.campaignService.List(context.Background())
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *voucherHandler) createCampaign(c *fiber.Ctx) error {
+	var body struct {
+		Name           string   `json:"name"`
+		CodePattern    string   `json:"code_pattern"`
+		Quantity       int      `json:"quantity"`
+		Type           string   `json:"type"`
+		Value          float64  `json:"value"`
+		Unit           string   `json:"unit"`
+		MaxUsage       int      `json:"max_usage"`
+		ValidFrom      *int64   `json:"valid_from"`
+		ValidTo        *int64   `json:"valid_to"`
+		Active         *bool    `json:"active"`
+		BranchIDs      []string `json:"branch_ids"`
+		BoothIDs       []string `json:"booth_ids"`
+		BoothType      *string  `json:"booth_type"`
+		MinSpend       *float64 `json:"min_spend"`
+		MaxPerCustomer int      `json:"max_per_customer"`
+		Weekdays       []int    `json:"weekdays"`
+		HourFrom       *int     `json:"hour_from"`
+		HourTo         *int     `json:"hour_to"`
+		Stackable      bool     `json:"stackable"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return respondError(c, err)
+	}
+	if body.Name == "" || body.CodePattern == "" || body.Type == "" || body.Unit == "" {
+		return respondError(c, fiber.NewError(fiber.StatusBadRequest, "name, code_pattern, type and unit required"))
+	}
+	var (
+		validFrom *time.Time
+		validTo   *time.Time
+	)
+	if body.ValidFrom != nil {
+		t := time.Unix(*body.ValidFrom, 0)
+		validFrom = &t
+	}
+	if body.ValidTo != nil {
+		t := time.Unix(*body.ValidTo, 0)
+		validTo = &t
+	}
+	active := true
+	if body.Active != nil {
+		active = *body.Active
+	}
+	entity, err := h.campaignService.Create(context.Background(), appVoucher.CreateCampaignInput{
+		Name:        body.Name,
+		CodePattern: body.CodePattern,
+		Quantity:    body.Quantity,
+		Type:        domainVoucher.Type(body.Type),
+		Value:       body.Value,
+		Unit:        domainVoucher.Unit(body.Unit),
+		MaxUsage:    body.MaxUsage,
+		ValidFrom:   validFrom,
+		ValidTo:     validTo,
+		Active:      active,
+		Restrictions: domainVoucher.Restrictions{
+			BranchIDs:      body.BranchIDs,
+			BoothIDs:       body.BoothIDs,
+			BoothType:      body.BoothType,
+			MinSpend:       body.MinSpend,
+			MaxPerCustomer: body.MaxPerCustomer,
+			Weekdays:       parseWeekdays(body.Weekdays),
+			HourFrom:       body.HourFrom,
+			HourTo:         body.HourTo,
+			Stackable:      body.Stackable,
+		},
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusCreated, entity)
+}
+
+func (h *voucherHandler) getCampaign(c *fiber.Ctx) error {
+	id := c.Params("id")
+	entity, err := h.campaignService.Get(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, entity)
+}
+
+func (h *voucherHandler) campaignStats(c *fiber.Ctx) error {
+	id := c.Params("id")
+	result, err := h.campaignService.Stats(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return respondSuccess(c, fiber.StatusOK, result)
+}
+
+func (h *voucherHandler) exportCampaignCodes(c *fiber.Ctx) error {
+	id := c.Params("id")
+	vouchers, err := h.campaignService.Vouchers(context.Background(), id)
+	if err != nil {
+		return respondError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="campaign-%s.csv"`, id))
+	now := time.Now()
+	w := csv.NewWriter(c)
+	if err := w.Write([]string{"code", "status", "used_count", "max_usage", "valid_from", "valid_to"}); err != nil {
+		return err
+	}
+	for _, v := range vouchers {
+		if err := w.Write([]string{
+			v.Code,
+			campaignCodeStatus(v, now),
+			strconv.Itoa(v.UsedCount),
+			strconv.Itoa(v.MaxUsage),
+			formatOptionalTime(v.ValidFrom),
+			formatOptionalTime(v.ValidTo),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func campaignCodeStatus(v domainVoucher.Voucher, now time.Time) string {
+	switch {
+	case v.UsedCount > 0:
+		return "redeemed"
+	case v.ValidTo != nil && v.ValidTo.Before(now):
+		return "expired"
+	default:
+		return "available"
+	}
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseWeekdays(days []int) []time.Weekday {
+	if days == nil {
+		return nil
+	}
+	result := make([]time.Weekday, 0, len(days))
+	for _, d := range days {
+		result = append(result, time.Weekday(d))
+	}
+	return result
+}